@@ -2,6 +2,7 @@ package api
 
 import (
 	"fmt"
+	"time"
 )
 
 type Location struct {
@@ -10,23 +11,152 @@ type Location struct {
 }
 
 type Place struct {
-	ID       string    `json:"id"`
-	Provider string    `json:"provider"`
-	Name     string    `json:"name"`
-	Location *Location `json:"location,omitempty"`
-	Address  string    `json:"address,omitempty"`
-	URI      string    `json:"uri"`
+	ID                string    `json:"id"`
+	Provider          string    `json:"provider"`
+	Name              string    `json:"name"`
+	Location          *Location `json:"location,omitempty"`
+	Address           string    `json:"address,omitempty"` // display line of the v1 API
+	URI               string    `json:"uri"`
+	Categories        []string  `json:"categories,omitempty"` // canonical categories, mapped from the provider ones
+	StructuredAddress *Address  `json:"-"`                    // exposed by the v2 API, see PlaceV2
 }
 
 type Places []Place
 
+// PlaceV2 is a place of the v2 API: its address is structured
+type PlaceV2 struct {
+	ID         string    `json:"id"`
+	Provider   string    `json:"provider"`
+	Name       string    `json:"name"`
+	Location   *Location `json:"location,omitempty"`
+	Address    *Address  `json:"address,omitempty"`
+	URI        string    `json:"uri"`
+	Categories []string  `json:"categories,omitempty"`
+}
+
+type PlacesV2 []PlaceV2
+
+// V2 returns the v2 representation of the place, a place without structured address keeps its display line.
+// A place without address at all has a null one
+func (p Place) V2() PlaceV2 {
+	address := p.StructuredAddress
+	if address != nil && *address == (Address{}) {
+		address = nil
+	}
+	if address == nil && p.Address != "" {
+		address = &Address{Formatted: p.Address}
+	}
+	return PlaceV2{
+		ID:         p.ID,
+		Provider:   p.Provider,
+		Name:       p.Name,
+		Location:   p.Location,
+		Address:    address,
+		URI:        p.URI,
+		Categories: p.Categories,
+	}
+}
+
+func (p Places) V2() PlacesV2 {
+	places := make(PlacesV2, 0, len(p))
+	for _, place := range p {
+		places = append(places, place.V2())
+	}
+	return places
+}
+
+// Address is a structured postal address
+type Address struct {
+	Street      string `json:"street,omitempty"`
+	HouseNumber string `json:"houseNumber,omitempty"`
+	PostalCode  string `json:"postalCode,omitempty"`
+	City        string `json:"city,omitempty"`
+	Region      string `json:"region,omitempty"`      // state, province...
+	CountryCode string `json:"countryCode,omitempty"` // ISO 3166-1 alpha-2, e.g. DE
+	Formatted   string `json:"formatted,omitempty"`   // display line, following the country conventions
+}
+
+// precision levels of the geocoding results, from the most precise
+const (
+	PrecisionRooftop      = "rooftop"      // the building
+	PrecisionInterpolated = "interpolated" // a house number interpolated along its street
+	PrecisionStreet       = "street"
+	PrecisionPostalCode   = "postal_code"
+	PrecisionCity         = "city"
+	PrecisionRegion       = "region"
+	PrecisionCountry      = "country"
+	PrecisionApproximate  = "approximate" // anything else, e.g. a natural feature
+)
+
+// GeocodingResult is a location matching a free-form address
+type GeocodingResult struct {
+	Address    Address  `json:"address"`
+	Location   Location `json:"location"`
+	Provider   string   `json:"provider"`
+	Precision  string   `json:"precision"`  // one of the Precision levels
+	Confidence float64  `json:"confidence"` // 0 to 1, from the precision and the provider match quality
+	Agreement  float64  `json:"agreement"`  // 0 to 1, share of the answering providers locating the address there
+}
+
+type GeocodingResults []GeocodingResult
+
+// ReverseGeocoding is the nearest address of a location and the establishments around it
+type ReverseGeocoding struct {
+	Address  *Address  `json:"address,omitempty"`  // nearest address, nil when none was found
+	Location *Location `json:"location,omitempty"` // of the nearest address
+	Provider string    `json:"provider,omitempty"` // of the nearest address
+	Places   Places    `json:"places"`             // establishments around the location
+}
+
+// ProviderPlaces is a streamed batch of places, sent as soon as its provider answers
+type ProviderPlaces struct {
+	Provider string `json:"provider"`
+	Places   Places `json:"places"`
+}
+
+// ProviderPlacesV2 is a streamed batch of places of the v2 API
+type ProviderPlacesV2 struct {
+	Provider string   `json:"provider"`
+	Places   PlacesV2 `json:"places"`
+}
+
+// StreamSummary ends a places stream
+type StreamSummary struct {
+	Complete  bool             `json:"complete"` // false when some providers failed
+	Providers []ProviderStatus `json:"providers"`
+}
+
+// AutocompleteQuery is a message of a websocket autocomplete session
+type AutocompleteQuery struct {
+	Text string   `json:"text"`
+	Lat  *float64 `json:"lat,omitempty"`
+	Lng  *float64 `json:"lng,omitempty"`
+}
+
+// AutocompleteResult answers the query with the same sequence number, superseded queries get no result
+type AutocompleteResult struct {
+	Seq        int    `json:"seq"`
+	Places     Places `json:"places"`
+	Complete   bool   `json:"complete"`
+	Error      *Error `json:"error,omitempty"`
+	RetryAfter int    `json:"retryAfter,omitempty"` // seconds, when the connection exceeded its rate limit
+}
+
+type ProviderStatus struct {
+	Provider string `json:"provider"`
+	State    string `json:"state"` // OK or FAILED
+	Count    int    `json:"count"` // places sent
+	Error    *Error `json:"error,omitempty"`
+}
+
 type Error struct {
-	StatusCode int    `json:"-"`                 // http status code. It will not be marshaled, instead used as a header
-	TraceId    string `json:"traceId,omitempty"` // can be a tracing id/correlation id
-	Type       string `json:"type,omitempty"`    // error type example "OAuthException" can be also an internal custom go Error type following the error interface
-	Code       int    `json:"code,omitempty"`    // internal application code.
-	Message    string `json:"message"`           // Human readable message
-	// we can also introduce other fields like "retryable (bool)" for a client back off logic
+	StatusCode int    `json:"-"`                   // http status code. It will not be marshaled, instead used as a header
+	TraceId    string `json:"traceId,omitempty"`   // can be a tracing id/correlation id
+	Type       string `json:"type,omitempty"`      // error type example "OAuthException" can be also an internal custom go Error type following the error interface
+	Code       int    `json:"code,omitempty"`      // internal application code.
+	Message    string `json:"message"`             // Human readable message
+	RetryAfter int    `json:"-"`                   // seconds, sent as a Retry-After header when set
+	Retryable  bool   `json:"retryable,omitempty"` // the same request can succeed later, for a client back off logic
 }
 
 // interface golang/error
@@ -37,12 +167,94 @@ func (e *Error) Error() string {
 const (
 	TextInputParamIsMissingErrorCode = 10001
 	LatLngParamMalformedErrorCode    = 10002
+	InvalidLogLevelErrorCode         = 10003
+	UnknownCacheErrorCode            = 10004
+	MissingAPIKeyErrorCode           = 10005
+	InvalidAPIKeyErrorCode           = 10006
+	OriginNotAllowedErrorCode        = 10007
+	ProviderNotAllowedErrorCode      = 10008
+	QuotaExceededErrorCode           = 10009
+	MissingBearerTokenErrorCode      = 10010
+	InvalidBearerTokenErrorCode      = 10011
+	InsufficientScopeErrorCode       = 10012
+	UnsupportedFormatErrorCode       = 10013
+	UnknownProviderErrorCode         = 10014
+	RadiusParamMalformedErrorCode    = 10015
+	LimitParamMalformedErrorCode     = 10016
+	QueryTooComplexErrorCode         = 10017
+	MalformedGraphQLRequestErrorCode = 10018
+	MalformedMessageErrorCode        = 10019
+	SessionParamMalformedErrorCode   = 10020
+	ModeParamMalformedErrorCode      = 10021
+	LocationRequiredErrorCode        = 10022
+	ModeNotSupportedErrorCode        = 10023
+	CursorParamMalformedErrorCode    = 10024
+	LanguageParamMalformedErrorCode  = 10025
+	CategoryParamMalformedErrorCode  = 10026
+	BBoxParamMalformedErrorCode      = 10027
+	MalformedPolygonErrorCode        = 10028
+	GeocodingNotSupportedErrorCode   = 10029
+	AddressParamIsMissingErrorCode   = 10030
+	ProviderTimeoutErrorCode         = 10031
+	ProviderAuthErrorCode            = 10032
+	ProviderQuotaExceededErrorCode   = 10033
+	ProviderUnavailableErrorCode     = 10034
+	ProviderBadRequestErrorCode      = 10035
+	ProviderNotFoundErrorCode        = 10036
 	//... can be extended in the future
 )
 
+// Errors types
+const (
+	AuthenticationErrorType = "AuthenticationException"
+	AuthorizationErrorType  = "AuthorizationException"
+	QuotaExceededErrorType  = "QuotaExceededException"
+	// failures of the upstream providers
+	ProviderTimeoutErrorType       = "ProviderTimeoutException"
+	ProviderAuthErrorType          = "ProviderAuthenticationException"
+	ProviderQuotaExceededErrorType = "ProviderQuotaExceededException"
+	ProviderUnavailableErrorType   = "ProviderUnavailableException"
+	ProviderBadRequestErrorType    = "ProviderBadRequestException"
+	ProviderNotFoundErrorType      = "ProviderNotFoundException"
+)
+
 var ErrorMessageText = map[int]string{
 	TextInputParamIsMissingErrorCode: "the 'text' query parameter is missing",
 	LatLngParamMalformedErrorCode:    "Malformed lat, lng parameters",
+	InvalidLogLevelErrorCode:         "Invalid log level, use one of: panic, fatal, error, warn, info, debug, trace",
+	UnknownCacheErrorCode:            "Unknown cache name",
+	MissingAPIKeyErrorCode:           "An API key is required, supply it with the X-API-Key header or the api_key query parameter",
+	InvalidAPIKeyErrorCode:           "Invalid API key",
+	OriginNotAllowedErrorCode:        "This origin is not allowed to use the API key",
+	ProviderNotAllowedErrorCode:      "The API key is not allowed to use any of the requested providers",
+	QuotaExceededErrorCode:           "Quota exceeded, retry later",
+	MissingBearerTokenErrorCode:      "A bearer token is required in the Authorization header",
+	InvalidBearerTokenErrorCode:      "Invalid, expired or not yet valid bearer token",
+	InsufficientScopeErrorCode:       "The token lacks the scope required by this endpoint",
+	UnsupportedFormatErrorCode:       "Unsupported 'format' query parameter",
+	UnknownProviderErrorCode:         "Unknown provider",
+	RadiusParamMalformedErrorCode:    "Malformed 'radius' parameter, it must be between 1 and 50 kilometers",
+	LimitParamMalformedErrorCode:     "Malformed 'limit' parameter, it must be between 1 and 50",
+	QueryTooComplexErrorCode:         "The query is too complex, request fewer places or details",
+	MalformedGraphQLRequestErrorCode: "Malformed GraphQL request, a 'query' is required",
+	MalformedMessageErrorCode:        "Malformed message, expected a json object: {\"text\": ..., \"lat\": ..., \"lng\": ...}",
+	SessionParamMalformedErrorCode:   "Malformed 'session' parameter, use up to 64 letters, digits, '-' or '_'",
+	ModeParamMalformedErrorCode:      "Unknown 'mode' parameter, use one of: autocomplete, text, nearby",
+	LocationRequiredErrorCode:        "The nearby mode requires the latitude and longitude parameters, or an area",
+	ModeNotSupportedErrorCode:        "None of the providers supports this search mode",
+	CursorParamMalformedErrorCode:    "Invalid or expired 'cursor' parameter, restart from the first page",
+	LanguageParamMalformedErrorCode:  "Unsupported 'language' parameter, use one of: de, en, es, fr, id, it, ja, ko, pt, ru, th, tr",
+	CategoryParamMalformedErrorCode:  "Unknown 'categories' parameter, use comma separated ids of the category tree, e.g. restaurant,vegan,hotel",
+	BBoxParamMalformedErrorCode:      "Malformed 'bbox' parameter, use minLng,minLat,maxLng,maxLat (not crossing the antimeridian), without polygon",
+	MalformedPolygonErrorCode:        "Malformed polygon, expected a GeoJSON Polygon with closed rings of at most 1000 positions",
+	GeocodingNotSupportedErrorCode:   "None of the providers supports geocoding",
+	AddressParamIsMissingErrorCode:   "The 'address' query parameter is missing or longer than 256 characters",
+	ProviderTimeoutErrorCode:         "The provider didn't answer in time, retry later",
+	ProviderAuthErrorCode:            "The provider denied the request, please refer to our support with your traceId",
+	ProviderQuotaExceededErrorCode:   "The provider quota is exceeded, retry later",
+	ProviderUnavailableErrorCode:     "The provider is unavailable, retry later",
+	ProviderBadRequestErrorCode:      "The provider rejected the request parameters",
+	ProviderNotFoundErrorCode:        "The provider doesn't know this place",
 	//... can be extended in the future
 }
 
@@ -60,3 +272,54 @@ type Status struct {
 	Message    string `json:"message"`
 	StateLabel string `json:"state"` //can be extended and mapped to application status
 }
+
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildTime string `json:"buildTime,omitempty"`
+}
+
+type ProviderHealth struct {
+	Provider     string     `json:"provider"`
+	StateLabel   string     `json:"state"`                  // UP, DOWN or UNKNOWN (when the provider has no health probe)
+	LastChecked  *time.Time `json:"lastChecked,omitempty"`  // last time a probe was run
+	LastSuccess  *time.Time `json:"lastSuccess,omitempty"`  // last time a probe succeeded
+	CircuitState string     `json:"circuitState,omitempty"` // only when the provider reports one
+	Error        string     `json:"error,omitempty"`        // last probe error
+}
+
+type Readiness struct {
+	Message    string           `json:"message"`
+	StateLabel string           `json:"state"`
+	Providers  []ProviderHealth `json:"providers"`
+	Build      BuildInfo        `json:"build"`
+}
+
+/*
+ * GeoJSON (RFC 7946) representation of the places
+ */
+type FeatureCollection struct {
+	Type     string    `json:"type"` // always FeatureCollection
+	Features []Feature `json:"features"`
+}
+
+type Feature struct {
+	Type       string            `json:"type"` // always Feature
+	ID         string            `json:"id,omitempty"`
+	Geometry   *Geometry         `json:"geometry"` // null for places without coordinates
+	Properties FeatureProperties `json:"properties"`
+}
+
+type Geometry struct {
+	Type        string    `json:"type"`        // Point
+	Coordinates []float64 `json:"coordinates"` // longitude first, then latitude
+}
+
+type FeatureProperties struct {
+	ID         string   `json:"id"`
+	Provider   string   `json:"provider"`
+	Name       string   `json:"name"`
+	Address    string   `json:"address,omitempty"`
+	URI        string   `json:"uri"`
+	Categories []string `json:"categories,omitempty"`
+}
@@ -0,0 +1,192 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/time/rate"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+ * Client API keys store. Keys are loaded from a json file and only their SHA-256 hashes are kept,
+ * so a leaked keys file doesn't leak the clients secrets. Example of a keys file:
+ *
+ * [
+ *   {
+ *     "id": "web-app",
+ *     "secretHash": "sha256:<hex encoded sha256 of the key>",
+ *     "allowedOrigins": ["https://app.example.com"],
+ *     "allowedProviders": ["GOOGLE_PLACES"],
+ *     "quotaPerMinute": 60,
+ *     "quotaPerDay": 10000
+ *   }
+ * ]
+ */
+
+const secretHashPrefix = "sha256:"
+
+type APIKey struct {
+	ID               string   `json:"id"`
+	SecretHash       string   `json:"secretHash"`
+	AllowedOrigins   []string `json:"allowedOrigins,omitempty"`   // empty: any origin
+	AllowedProviders []string `json:"allowedProviders,omitempty"` // empty: all the providers
+	QuotaPerMinute   int      `json:"quotaPerMinute,omitempty"`   // 0: unlimited
+	QuotaPerDay      int      `json:"quotaPerDay,omitempty"`      // 0: unlimited
+}
+
+// token buckets of a key
+type quota struct {
+	perMinute *rate.Limiter
+	perDay    *rate.Limiter
+}
+
+type APIKeyStore struct {
+	keysByHash map[string]*APIKey
+	mu         sync.Mutex // guards quotas
+	quotas     map[string]*quota
+	now        func() time.Time
+}
+
+// HashSecret returns the hash to be stored in the keys file for a given client key
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return secretHashPrefix + hex.EncodeToString(sum[:])
+}
+
+// LoadAPIKeyStore loads the keys from a json file
+func LoadAPIKeyStore(path string) (*APIKeyStore, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	keys := []APIKey{}
+	if err := json.Unmarshal(content, &keys); err != nil {
+		return nil, fmt.Errorf("malformed API keys file %s: %s", path, err.Error())
+	}
+	return NewAPIKeyStore(keys)
+}
+
+func NewAPIKeyStore(keys []APIKey) (*APIKeyStore, error) {
+	store := &APIKeyStore{
+		keysByHash: map[string]*APIKey{},
+		quotas:     map[string]*quota{},
+		now:        time.Now,
+	}
+	for i := range keys {
+		key := keys[i]
+		if key.ID == "" {
+			return nil, errors.New("API keys should have an id")
+		}
+		if !strings.HasPrefix(key.SecretHash, secretHashPrefix) {
+			return nil, fmt.Errorf("API key %s: the secret hash should be prefixed with %s", key.ID, secretHashPrefix)
+		}
+		if _, ok := store.quotas[key.ID]; ok {
+			return nil, fmt.Errorf("API key %s is defined twice", key.ID)
+		}
+		store.keysByHash[strings.ToLower(key.SecretHash)] = &key
+		store.quotas[key.ID] = newQuota(key)
+	}
+	return store, nil
+}
+
+func newQuota(key APIKey) *quota {
+	q := &quota{}
+	if key.QuotaPerMinute > 0 {
+		q.perMinute = rate.NewLimiter(rate.Limit(float64(key.QuotaPerMinute)/time.Minute.Seconds()), key.QuotaPerMinute)
+	}
+	if key.QuotaPerDay > 0 {
+		q.perDay = rate.NewLimiter(rate.Limit(float64(key.QuotaPerDay)/(24*time.Hour).Seconds()), key.QuotaPerDay)
+	}
+	return q
+}
+
+// Authenticate returns the key matching the supplied secret
+func (s *APIKeyStore) Authenticate(secret string) (*APIKey, bool) {
+	if secret == "" {
+		return nil, false
+	}
+	key, ok := s.keysByHash[HashSecret(secret)]
+	return key, ok
+}
+
+// Allow consumes a request from the quotas of a client (key id). When a quota is exhausted, it returns false
+// and the duration after which the client can retry. Clients without key have no quota
+func (s *APIKeyStore) Allow(clientID string) (bool, time.Duration) {
+	s.mu.Lock()
+	q, ok := s.quotas[clientID]
+	s.mu.Unlock()
+	if !ok {
+		return true, 0
+	}
+
+	now := s.now()
+	reservations := []*rate.Reservation{}
+	retryAfter := time.Duration(0)
+	for _, limiter := range []*rate.Limiter{q.perMinute, q.perDay} {
+		if limiter == nil {
+			continue
+		}
+		reservation := limiter.ReserveN(now, 1)
+		reservations = append(reservations, reservation)
+		if delay := reservation.DelayFrom(now); delay > retryAfter {
+			retryAfter = delay
+		}
+	}
+	if retryAfter > 0 {
+		// nothing is consumed when the request is refused
+		for _, reservation := range reservations {
+			reservation.CancelAt(now)
+		}
+		return false, retryAfter
+	}
+	return true, 0
+}
+
+// AllowedOrigins returns all the origins allowed by at least one key, e.g. to feed the CORS allowed origins
+func (s *APIKeyStore) AllowedOrigins() []string {
+	origins := []string{}
+	seen := map[string]bool{}
+	for _, key := range s.keysByHash {
+		for _, origin := range key.AllowedOrigins {
+			if !seen[origin] {
+				seen[origin] = true
+				origins = append(origins, origin)
+			}
+		}
+	}
+	sort.Strings(origins)
+	return origins
+}
+
+// IsOriginAllowed tells if a browser origin can use the key. Requests without origin (server to server) are allowed
+func (k *APIKey) IsOriginAllowed(origin string) bool {
+	if origin == "" || len(k.AllowedOrigins) == 0 {
+		return true
+	}
+	for _, allowed := range k.AllowedOrigins {
+		if MatchOrigin(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchOrigin matches an origin against "*", an exact origin or a pattern with a single wildcard, e.g. https://*.example.com
+func MatchOrigin(pattern string, origin string) bool {
+	pattern, origin = strings.ToLower(pattern), strings.ToLower(origin)
+	wildcard := strings.Index(pattern, "*")
+	if wildcard < 0 {
+		return pattern == origin
+	}
+	prefix, suffix := pattern[:wildcard], pattern[wildcard+1:]
+	return len(origin) > len(prefix)+len(suffix) &&
+		strings.HasPrefix(origin, prefix) &&
+		strings.HasSuffix(origin, suffix)
+}
@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestUnitHashSecret(t *testing.T) {
+	assert.Equal(t, "sha256:2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b", HashSecret("secret"))
+}
+
+func TestUnitLoadAPIKeyStore(t *testing.T) {
+	file, err := ioutil.TempFile("", "api-keys-*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString(`[{"id":"web-app","secretHash":"` + HashSecret("secret") + `","allowedProviders":["GOOGLE_PLACES"]}]`)
+	file.Close()
+
+	store, err := LoadAPIKeyStore(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, ok := store.Authenticate("secret")
+	assert.True(t, ok)
+	assert.Equal(t, "web-app", key.ID)
+	assert.Equal(t, []string{"GOOGLE_PLACES"}, key.AllowedProviders)
+
+	_, ok = store.Authenticate("wrong-secret")
+	assert.False(t, ok)
+	_, ok = store.Authenticate("")
+	assert.False(t, ok)
+}
+
+func TestUnitNewAPIKeyStoreValidation(t *testing.T) {
+	_, err := NewAPIKeyStore([]APIKey{{SecretHash: HashSecret("secret")}})
+	assert.Error(t, err)
+
+	// clear secrets are refused
+	_, err = NewAPIKeyStore([]APIKey{{ID: "web-app", SecretHash: "secret"}})
+	assert.Error(t, err)
+
+	_, err = NewAPIKeyStore([]APIKey{{ID: "web-app", SecretHash: HashSecret("a")}, {ID: "web-app", SecretHash: HashSecret("b")}})
+	assert.Error(t, err)
+}
+
+func TestUnitAPIKeyStoreQuotas(t *testing.T) {
+	store, err := NewAPIKeyStore([]APIKey{{ID: "web-app", SecretHash: HashSecret("secret"), QuotaPerMinute: 2, QuotaPerDay: 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2019, 7, 1, 10, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+	allowed, _ := store.Allow("web-app")
+	assert.True(t, allowed)
+	allowed, _ = store.Allow("web-app")
+	assert.True(t, allowed)
+
+	// per minute quota exhausted, one request is refilled every 30 seconds
+	allowed, retryAfter := store.Allow("web-app")
+	assert.False(t, allowed)
+	assert.Equal(t, 30*time.Second, retryAfter)
+
+	now = now.Add(30 * time.Second)
+	allowed, _ = store.Allow("web-app")
+	assert.True(t, allowed)
+
+	// per day quota exhausted, even with a refilled per minute bucket
+	now = now.Add(time.Minute)
+	allowed, retryAfter = store.Allow("web-app")
+	assert.False(t, allowed)
+	assert.True(t, retryAfter > time.Hour)
+}
+
+func TestUnitAPIKeyStoreUnlimited(t *testing.T) {
+	store, _ := NewAPIKeyStore([]APIKey{{ID: "internal", SecretHash: HashSecret("secret")}})
+	for i := 0; i < 100; i++ {
+		allowed, _ := store.Allow("internal")
+		assert.True(t, allowed)
+	}
+	// unknown clients (e.g. token authenticated) have no quota
+	allowed, _ := store.Allow("unknown-client")
+	assert.True(t, allowed)
+}
+
+func TestUnitIsOriginAllowed(t *testing.T) {
+	key := APIKey{AllowedOrigins: []string{"https://app.example.com"}}
+	assert.True(t, key.IsOriginAllowed(""))
+	assert.True(t, key.IsOriginAllowed("https://app.example.com"))
+	assert.False(t, key.IsOriginAllowed("https://evil.example.com"))
+
+	anyOrigin := APIKey{}
+	assert.True(t, anyOrigin.IsOriginAllowed("https://evil.example.com"))
+
+	wildcard := APIKey{AllowedOrigins: []string{"https://*.example.com"}}
+	assert.True(t, wildcard.IsOriginAllowed("https://app.example.com"))
+	assert.False(t, wildcard.IsOriginAllowed("https://example.com"))
+}
+
+func TestUnitMatchOrigin(t *testing.T) {
+	assert.True(t, MatchOrigin("*", "https://app.example.com"))
+	assert.True(t, MatchOrigin("https://app.example.com", "https://APP.example.com"))
+	assert.True(t, MatchOrigin("https://*.example.com", "https://app.example.com"))
+	assert.True(t, MatchOrigin("http://localhost:*", "http://localhost:3000"))
+	assert.False(t, MatchOrigin("https://*.example.com", "https://.example.com"))
+	assert.False(t, MatchOrigin("https://*.example.com", "https://example.com.evil.com"))
+	assert.False(t, MatchOrigin("https://*.example.com", "http://app.example.com"))
+}
+
+func TestUnitPrincipalIsProviderAllowed(t *testing.T) {
+	principal := Principal{ClientID: "web-app", AllowedProviders: []string{"GOOGLE_PLACES"}}
+	assert.True(t, principal.IsProviderAllowed("GOOGLE_PLACES"))
+	assert.False(t, principal.IsProviderAllowed("FOURSQUARE"))
+
+	unrestricted := Principal{ClientID: "internal"}
+	assert.True(t, unrestricted.IsProviderAllowed("FOURSQUARE"))
+}
+
+func TestUnitAPIKeyStoreAllowedOrigins(t *testing.T) {
+	store, _ := NewAPIKeyStore([]APIKey{
+		{ID: "web-app", SecretHash: HashSecret("a"), AllowedOrigins: []string{"https://app.example.com", "https://*.example.org"}},
+		{ID: "admin-app", SecretHash: HashSecret("b"), AllowedOrigins: []string{"https://app.example.com"}},
+		{ID: "internal", SecretHash: HashSecret("c")},
+	})
+	assert.Equal(t, []string{"https://*.example.org", "https://app.example.com"}, store.AllowedOrigins())
+}
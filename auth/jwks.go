@@ -0,0 +1,235 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/codeselim/go-webservice-places-provider/config"
+	"github.com/codeselim/go-webservice-places-provider/log"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+/**
+ * JSON Web Key Set (RFC 7517), loaded from a local file or a URL (e.g. the OIDC provider jwks_uri).
+ * The keys are cached and refreshed every refresh interval, or earlier when a token is signed with
+ * an unknown key id (keys rotation). Early refreshes are rate limited.
+ */
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// EC
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+type JWKS struct {
+	source             string // file path or URL
+	fetch              func(ctx context.Context) ([]byte, error)
+	refreshInterval    time.Duration
+	minRefreshInterval time.Duration
+
+	mu          sync.RWMutex
+	keys        map[string]crypto.PublicKey
+	fetchedAt   time.Time
+	attemptedAt time.Time
+}
+
+// NewJWKSFromFile loads the key set from a local file
+func NewJWKSFromFile(path string, refreshInterval time.Duration) (*JWKS, error) {
+	return newJWKS(path, refreshInterval, func(ctx context.Context) ([]byte, error) {
+		return ioutil.ReadFile(path)
+	})
+}
+
+// NewJWKSFromURL loads the key set from a URL, e.g. https://issuer.example.com/.well-known/jwks.json
+func NewJWKSFromURL(url string, refreshInterval time.Duration, httpClient *http.Client) (*JWKS, error) {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: config.DefaultProviderTimeout}
+	}
+	return newJWKS(url, refreshInterval, func(ctx context.Context) ([]byte, error) {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := httpClient.Do(req.WithContext(ctx))
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("unexpected status code %d fetching the JWKS", resp.StatusCode)
+		}
+		return ioutil.ReadAll(resp.Body)
+	})
+}
+
+func newJWKS(source string, refreshInterval time.Duration, fetch func(ctx context.Context) ([]byte, error)) (*JWKS, error) {
+	if refreshInterval <= 0 {
+		refreshInterval = config.DefaultJWKSRefreshInterval
+	}
+	jwks := &JWKS{
+		source:             source,
+		fetch:              fetch,
+		refreshInterval:    refreshInterval,
+		minRefreshInterval: config.DefaultJWKSMinRefreshInterval,
+		keys:               map[string]crypto.PublicKey{},
+	}
+	if err := jwks.refresh(context.Background()); err != nil {
+		return nil, err
+	}
+	return jwks, nil
+}
+
+// Key returns the public key for a key id, refreshing the set when it is stale or when the key id is unknown
+func (j *JWKS) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	j.mu.RLock()
+	key, ok := j.keys[kid]
+	stale := time.Since(j.fetchedAt) > j.refreshInterval
+	canRefresh := time.Since(j.attemptedAt) > j.minRefreshInterval
+	j.mu.RUnlock()
+
+	if (stale || !ok) && canRefresh {
+		if err := j.refresh(ctx); err != nil {
+			// keep serving the cached keys
+			log.GetLoggerWithContext(ctx).Error("Couldn't refresh the JWKS from " + j.source + ": " + err.Error())
+		} else {
+			j.mu.RLock()
+			key, ok = j.keys[kid]
+			j.mu.RUnlock()
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key id %q", kid)
+	}
+	return key, nil
+}
+
+// FlushCache marks the keys stale: the next verification refreshes them, the cached keys are kept if it fails
+func (j *JWKS) FlushCache() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.fetchedAt = time.Time{}
+	j.attemptedAt = time.Time{}
+}
+
+func (j *JWKS) refresh(ctx context.Context) error {
+	j.mu.Lock()
+	j.attemptedAt = time.Now()
+	j.mu.Unlock()
+
+	content, err := j.fetch(ctx)
+	if err != nil {
+		return err
+	}
+	keys, err := parseJWKS(content)
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.keys = keys
+	j.fetchedAt = time.Now()
+	return nil
+}
+
+// parseJWKS parses the signing keys of a set, unsupported keys are skipped
+func parseJWKS(content []byte) (map[string]crypto.PublicKey, error) {
+	set := jsonWebKeySet{}
+	if err := json.Unmarshal(content, &set); err != nil {
+		return nil, fmt.Errorf("malformed JWKS: %s", err.Error())
+	}
+	keys := map[string]crypto.PublicKey{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			log.GetLogger().Warn("Skipping JWK " + jwk.Kid + ": " + err.Error())
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("the JWKS holds no usable signing key")
+	}
+	return keys, nil
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		curve, ok := curves[k.Crv]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("EC point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+var curves = map[string]elliptic.Curve{
+	"P-256": elliptic.P256(),
+	"P-384": elliptic.P384(),
+	"P-521": elliptic.P521(),
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(decoded) == 0 {
+		return nil, errors.New("empty key parameter")
+	}
+	return new(big.Int).SetBytes(decoded), nil
+}
@@ -0,0 +1,213 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	_ "crypto/sha512" // registers SHA-384 and SHA-512
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+/**
+ * OAuth2/OIDC JWT access tokens verification (RFC 7519). Only asymmetric signatures are accepted
+ * (RS256/384/512, ES256/384/512), verified against the keys of a JWKS.
+ */
+
+type JWTConfig struct {
+	Issuer   string        // expected "iss"
+	Audience string        // expected in "aud"
+	Leeway   time.Duration // clock skew tolerance on "exp" and "nbf"
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Typ string `json:"typ,omitempty"`
+}
+
+// audience can be a single string or an array of strings
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+	*a = multiple
+	return nil
+}
+
+type Claims struct {
+	Issuer          string   `json:"iss"`
+	Subject         string   `json:"sub"`
+	Audience        audience `json:"aud"`
+	ExpiresAt       int64    `json:"exp"`
+	NotBefore       int64    `json:"nbf,omitempty"`
+	IssuedAt        int64    `json:"iat,omitempty"`
+	Scope           string   `json:"scope,omitempty"`     // space separated (RFC 8693)
+	Scp             []string `json:"scp,omitempty"`       // some providers use an array
+	ClientID        string   `json:"client_id,omitempty"` // RFC 9068
+	AuthorizedParty string   `json:"azp,omitempty"`       // OIDC
+}
+
+// Scopes returns the token scopes, whatever their encoding
+func (c *Claims) Scopes() []string {
+	if len(c.Scp) > 0 {
+		return c.Scp
+	}
+	return strings.Fields(c.Scope)
+}
+
+// Client returns the OAuth2 client the token was issued to
+func (c *Claims) Client() string {
+	if c.ClientID != "" {
+		return c.ClientID
+	}
+	return c.AuthorizedParty
+}
+
+type signingAlgorithm struct {
+	hash crypto.Hash
+	ec   bool
+}
+
+var signingAlgorithms = map[string]signingAlgorithm{
+	"RS256": {hash: crypto.SHA256},
+	"RS384": {hash: crypto.SHA384},
+	"RS512": {hash: crypto.SHA512},
+	"ES256": {hash: crypto.SHA256, ec: true},
+	"ES384": {hash: crypto.SHA384, ec: true},
+	"ES512": {hash: crypto.SHA512, ec: true},
+}
+
+type JWTVerifier struct {
+	config JWTConfig
+	keys   *JWKS
+	now    func() time.Time
+}
+
+func NewJWTVerifier(jwtConfig JWTConfig, keys *JWKS) (*JWTVerifier, error) {
+	if keys == nil {
+		return nil, errors.New("a JWKS should be provided")
+	}
+	if jwtConfig.Issuer == "" || jwtConfig.Audience == "" {
+		return nil, errors.New("both the expected issuer and audience should be provided")
+	}
+	return &JWTVerifier{config: jwtConfig, keys: keys, now: time.Now}, nil
+}
+
+// Verify checks the token signature and its iss, aud, exp and nbf claims
+func (v *JWTVerifier) Verify(ctx context.Context, token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	header := jwtHeader{}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed token header: %s", err.Error())
+	}
+	algorithm, ok := signingAlgorithms[header.Alg]
+	if !ok {
+		return nil, fmt.Errorf("unsupported signing algorithm %q", header.Alg)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed token signature")
+	}
+	key, err := v.keys.Key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(algorithm, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	claims := &Claims{}
+	if err := decodeSegment(parts[1], claims); err != nil {
+		return nil, fmt.Errorf("malformed token claims: %s", err.Error())
+	}
+	if err := v.validateClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (v *JWTVerifier) validateClaims(claims *Claims) error {
+	now := v.now()
+	if claims.Issuer != v.config.Issuer {
+		return fmt.Errorf("unexpected issuer %q", claims.Issuer)
+	}
+	audienceMatches := false
+	for _, aud := range claims.Audience {
+		if aud == v.config.Audience {
+			audienceMatches = true
+		}
+	}
+	if !audienceMatches {
+		return errors.New("the token is not issued for this audience")
+	}
+	if claims.ExpiresAt == 0 {
+		return errors.New("the token has no expiration")
+	}
+	if now.After(time.Unix(claims.ExpiresAt, 0).Add(v.config.Leeway)) {
+		return errors.New("the token is expired")
+	}
+	if claims.NotBefore != 0 && now.Before(time.Unix(claims.NotBefore, 0).Add(-v.config.Leeway)) {
+		return errors.New("the token is not valid yet")
+	}
+	return nil
+}
+
+func verifySignature(algorithm signingAlgorithm, key crypto.PublicKey, signingInput string, signature []byte) error {
+	hasher := algorithm.hash.New()
+	hasher.Write([]byte(signingInput))
+	digest := hasher.Sum(nil)
+
+	if algorithm.ec {
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return errors.New("the signing key doesn't match the token algorithm")
+		}
+		// JWS ECDSA signatures are the concatenation of r and s, each one of the curve size
+		size := (ecKey.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return errors.New("invalid token signature")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(ecKey, digest, r, s) {
+			return errors.New("invalid token signature")
+		}
+		return nil
+	}
+
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return errors.New("the signing key doesn't match the token algorithm")
+	}
+	if err := rsa.VerifyPKCS1v15(rsaKey, algorithm.hash, digest, signature); err != nil {
+		return errors.New("invalid token signature")
+	}
+	return nil
+}
+
+func decodeSegment(segment string, target interface{}) error {
+	decoded, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(decoded, target)
+}
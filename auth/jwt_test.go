@@ -0,0 +1,286 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const (
+	testIssuer   = "https://issuer.example.com"
+	testAudience = "places-api"
+)
+
+// keys generated at test time
+var (
+	testRSAKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+	testECKey, _  = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+)
+
+func encodeSegment(t *testing.T, value interface{}) string {
+	content, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(content)
+}
+
+func signToken(t *testing.T, alg string, kid string, key crypto.Signer, claims map[string]interface{}) string {
+	signingInput := encodeSegment(t, jwtHeader{Alg: alg, Kid: kid, Typ: "JWT"}) + "." + encodeSegment(t, claims)
+	hasher := signingAlgorithms[alg].hash.New()
+	hasher.Write([]byte(signingInput))
+	digest := hasher.Sum(nil)
+
+	var signature []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		var err error
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k, signingAlgorithms[alg].hash, digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		signature = make([]byte, 2*size)
+		r.FillBytes(signature[:size])
+		s.FillBytes(signature[size:])
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func rsaJWK(kid string, key *rsa.PublicKey) jsonWebKey {
+	return jsonWebKey{
+		Kty: "RSA", Kid: kid, Use: "sig",
+		N: base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E: base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func ecJWK(kid string, key *ecdsa.PublicKey) jsonWebKey {
+	return jsonWebKey{
+		Kty: "EC", Kid: kid, Crv: "P-256",
+		X: base64.RawURLEncoding.EncodeToString(key.X.Bytes()),
+		Y: base64.RawURLEncoding.EncodeToString(key.Y.Bytes()),
+	}
+}
+
+func writeJWKSFile(t *testing.T, keys ...jsonWebKey) string {
+	file, err := ioutil.TempFile("", "jwks-*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err := json.NewEncoder(file).Encode(jsonWebKeySet{Keys: keys}); err != nil {
+		t.Fatal(err)
+	}
+	return file.Name()
+}
+
+func validClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"iss":       testIssuer,
+		"sub":       "user-42",
+		"aud":       []string{"other-api", testAudience},
+		"exp":       time.Now().Add(time.Hour).Unix(),
+		"nbf":       time.Now().Add(-time.Minute).Unix(),
+		"scope":     "places:search openid",
+		"client_id": "mobile-app",
+	}
+}
+
+func newTestVerifier(t *testing.T) *JWTVerifier {
+	path := writeJWKSFile(t, rsaJWK("rsa-1", &testRSAKey.PublicKey), ecJWK("ec-1", &testECKey.PublicKey))
+	defer os.Remove(path)
+	jwks, err := NewJWKSFromFile(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := NewJWTVerifier(JWTConfig{Issuer: testIssuer, Audience: testAudience, Leeway: time.Second}, jwks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return verifier
+}
+
+func TestUnitJWTVerifierValidTokens(t *testing.T) {
+	verifier := newTestVerifier(t)
+
+	for _, token := range []string{
+		signToken(t, "RS256", "rsa-1", testRSAKey, validClaims()),
+		signToken(t, "RS512", "rsa-1", testRSAKey, validClaims()),
+		signToken(t, "ES256", "ec-1", testECKey, validClaims()),
+	} {
+		claims, err := verifier.Verify(context.Background(), token)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "user-42", claims.Subject)
+			assert.Equal(t, "mobile-app", claims.Client())
+			assert.Equal(t, []string{"places:search", "openid"}, claims.Scopes())
+		}
+	}
+}
+
+func TestUnitJWTVerifierRejectsInvalidTokens(t *testing.T) {
+	verifier := newTestVerifier(t)
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	withClaim := func(name string, value interface{}) map[string]interface{} {
+		claims := validClaims()
+		claims[name] = value
+		return claims
+	}
+	withoutClaim := func(name string) map[string]interface{} {
+		claims := validClaims()
+		delete(claims, name)
+		return claims
+	}
+
+	invalidTokens := map[string]string{
+		"malformed":           "not.a-token",
+		"unknown key":         signToken(t, "RS256", "rsa-2", testRSAKey, validClaims()),
+		"wrong signature":     signToken(t, "RS256", "rsa-1", otherKey, validClaims()),
+		"algorithm mismatch":  signToken(t, "ES256", "rsa-1", testECKey, validClaims()),
+		"expired":             signToken(t, "RS256", "rsa-1", testRSAKey, withClaim("exp", time.Now().Add(-time.Minute).Unix())),
+		"not yet valid":       signToken(t, "RS256", "rsa-1", testRSAKey, withClaim("nbf", time.Now().Add(time.Minute).Unix())),
+		"wrong issuer":        signToken(t, "RS256", "rsa-1", testRSAKey, withClaim("iss", "https://evil.example.com")),
+		"wrong audience":      signToken(t, "RS256", "rsa-1", testRSAKey, withClaim("aud", "other-api")),
+		"without expiration":  signToken(t, "RS256", "rsa-1", testRSAKey, withoutClaim("exp")),
+		"unsigned (alg none)": encodeSegment(t, jwtHeader{Alg: "none", Kid: "rsa-1"}) + "." + encodeSegment(t, validClaims()) + ".",
+	}
+
+	for name, token := range invalidTokens {
+		_, err := verifier.Verify(context.Background(), token)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestUnitJWKSFromURLRotation(t *testing.T) {
+	rotatedKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	var rotated int32
+	var fetches int32
+	jwksServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		keys := []jsonWebKey{ecJWK("ec-1", &testECKey.PublicKey)}
+		if atomic.LoadInt32(&rotated) == 1 {
+			keys = []jsonWebKey{ecJWK("ec-2", &rotatedKey.PublicKey)}
+		}
+		json.NewEncoder(w).Encode(jsonWebKeySet{Keys: keys})
+	}))
+	defer jwksServer.Close()
+
+	jwks, err := NewJWKSFromURL(jwksServer.URL, time.Hour, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks.minRefreshInterval = 0
+	verifier, _ := NewJWTVerifier(JWTConfig{Issuer: testIssuer, Audience: testAudience}, jwks)
+
+	_, err = verifier.Verify(context.Background(), signToken(t, "ES256", "ec-1", testECKey, validClaims()))
+	assert.NoError(t, err)
+	// the keys are cached
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fetches))
+
+	// the issuer rotates its keys: the unknown key id triggers a refresh
+	atomic.StoreInt32(&rotated, 1)
+	_, err = verifier.Verify(context.Background(), signToken(t, "ES256", "ec-2", rotatedKey, validClaims()))
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&fetches))
+
+	_, err = verifier.Verify(context.Background(), signToken(t, "ES256", "ec-1", testECKey, validClaims()))
+	assert.Error(t, err)
+}
+
+func TestUnitJWKSUnknownKeyRefreshIsRateLimited(t *testing.T) {
+	var fetches int32
+	jwksServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		json.NewEncoder(w).Encode(jsonWebKeySet{Keys: []jsonWebKey{ecJWK("ec-1", &testECKey.PublicKey)}})
+	}))
+	defer jwksServer.Close()
+
+	jwks, err := NewJWKSFromURL(jwksServer.URL, time.Hour, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		_, err := jwks.Key(context.Background(), "unknown")
+		assert.Error(t, err)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fetches))
+}
+
+func TestUnitJWKSFlushCache(t *testing.T) {
+	var fetches int32
+	jwksServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		json.NewEncoder(w).Encode(jsonWebKeySet{Keys: []jsonWebKey{ecJWK("ec-1", &testECKey.PublicKey)}})
+	}))
+	defer jwksServer.Close()
+
+	jwks, err := NewJWKSFromURL(jwksServer.URL, time.Hour, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = jwks.Key(context.Background(), "ec-1")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fetches))
+
+	// the flushed keys are refreshed on the next verification
+	jwks.FlushCache()
+	_, err = jwks.Key(context.Background(), "ec-1")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&fetches))
+
+	// and kept when the refresh fails
+	jwksServer.Close()
+	jwks.FlushCache()
+	_, err = jwks.Key(context.Background(), "ec-1")
+	assert.NoError(t, err)
+}
+
+func TestUnitParseJWKSSkipsUnusableKeys(t *testing.T) {
+	content, _ := json.Marshal(jsonWebKeySet{Keys: []jsonWebKey{
+		{Kty: "oct", Kid: "symmetric"},
+		{Kty: "RSA", Kid: "encryption", Use: "enc", N: "AQAB", E: "AQAB"},
+		ecJWK("ec-1", &testECKey.PublicKey),
+	}})
+	keys, err := parseJWKS(content)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(keys))
+
+	_, err = parseJWKS([]byte(`{"keys":[{"kty":"oct","kid":"symmetric"}]}`))
+	assert.Error(t, err)
+}
+
+func TestUnitNewJWTVerifierValidation(t *testing.T) {
+	_, err := NewJWTVerifier(JWTConfig{Issuer: testIssuer, Audience: testAudience}, nil)
+	assert.Error(t, err)
+	_, err = NewJWTVerifier(JWTConfig{Issuer: testIssuer}, &JWKS{})
+	assert.Error(t, err)
+}
+
+func TestUnitPrincipalHasScope(t *testing.T) {
+	apiKeyPrincipal := Principal{ClientID: "web-app"}
+	assert.True(t, apiKeyPrincipal.HasScope("places:search"))
+
+	tokenPrincipal := Principal{ClientID: "mobile-app", Scoped: true, Scopes: []string{"places:search"}}
+	assert.True(t, tokenPrincipal.HasScope("places:search"))
+	assert.False(t, tokenPrincipal.HasScope("places:details"))
+}
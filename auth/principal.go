@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"context"
+	"github.com/codeselim/go-webservice-places-provider/config"
+)
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	ClientID         string
+	Subject          string // the end user, only for token authenticated principals
+	Scoped           bool   // scopes are only enforced for token authenticated principals, API keys are not scoped
+	Scopes           []string
+	AllowedProviders []string // empty: all the providers
+}
+
+// HasScope tells if the principal was granted the given scope
+func (p *Principal) HasScope(scope string) bool {
+	if !p.Scoped {
+		return true
+	}
+	for _, granted := range p.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// IsProviderAllowed tells if the principal can fan out to the given provider
+func (p *Principal) IsProviderAllowed(providerLabel string) bool {
+	if len(p.AllowedProviders) == 0 {
+		return true
+	}
+	for _, allowed := range p.AllowedProviders {
+		if allowed == providerLabel {
+			return true
+		}
+	}
+	return false
+}
+
+// WithPrincipal attaches the principal to the context, its client id and subject are also attached
+// alongside the request id for logging purposes
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	ctx = context.WithValue(ctx, config.ContextKeyPrincipal, principal)
+	ctx = context.WithValue(ctx, config.ContextKeyClientID, principal.ClientID)
+	return context.WithValue(ctx, config.ContextKeySubject, principal.Subject)
+}
+
+// PrincipalFromContext returns the authenticated principal, if any
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(config.ContextKeyPrincipal).(*Principal)
+	return principal, ok
+}
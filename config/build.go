@@ -0,0 +1,9 @@
+package config
+
+// Build information, injected at build time via the linker flags, example:
+// go build -ldflags "-X github.com/codeselim/go-webservice-places-provider/config.Version=1.0.0"
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildTime = ""
+)
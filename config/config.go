@@ -12,18 +12,100 @@ import (
  */
 
 const (
-	DefaultSearchRadius         = 100 //km
+	DefaultSearchRadius         = 10 //km
 	DefaultGooglePlacesLanguage = "en"
+	SupportedLanguages          = "de,en,es,fr,id,it,ja,ko,pt,ru,th,tr" // languages of the results, localized by all the providers
 	DefaultHttpServerPort       = "8081"
 	DefaultProviderTimeout      = 10 * time.Second
-	MaxAllowedSearchRadius      = 50
+	DefaultProviderCacheTTL     = 5 * time.Minute // how long the providers results can be cached by the clients and CDNs
+	MaxAllowedSearchRadius      = 50              //km, the Google maximum
 	DefaultLoggingLevel         = "info"
+	DefaultHealthCheckTTL       = 30 * time.Second // provider health probes results are cached for this duration
+	DefaultHealthCheckTimeout   = 5 * time.Second
+
+	// http server hardening
+	DefaultReadHeaderTimeout   = 5 * time.Second
+	DefaultReadTimeout         = 10 * time.Second
+	DefaultWriteTimeout        = 30 * time.Second // must stay above the providers timeouts
+	DefaultIdleTimeout         = 120 * time.Second
+	DefaultMaxHeaderBytes      = 1 << 16
+	DefaultShutdownGracePeriod = 20 * time.Second // time given to in-flight requests to finish on shutdown
+	DefaultShutdownDelay       = 5 * time.Second  // time given to the load balancers to stop routing to a draining instance
+	DefaultTLSMinVersion       = "1.2"
+	DefaultTLSReloadInterval   = 30 * time.Second // how often the certificates files are checked for changes
+
+	// admin server
+	DefaultAdminServerPort   = "8082"
+	DefaultAdminBindAddress  = "127.0.0.1"     // localhost only by default
+	DefaultAdminWriteTimeout = 2 * time.Minute // long enough for cpu profiles and traces
+
+	// gRPC server
+	DefaultGrpcServerPort  = "9090"
+	DefaultGrpcBindAddress = "127.0.0.1" // localhost only by default, as the admin server
+
+	// JWT authentication
+	DefaultJWKSRefreshInterval    = 15 * time.Minute
+	DefaultJWKSMinRefreshInterval = 30 * time.Second // early refreshes on unknown key ids are rate limited
+	DefaultJWTLeeway              = 30 * time.Second // clock skew tolerance
+
+	// CORS
+	DefaultCORSAllowedOrigins = "*"
+	DefaultCORSAllowedMethods = "GET,HEAD,POST" // POST for the GraphQL queries
+	DefaultCORSAllowedHeaders = "Authorization,Content-Type,X-API-Key,X-Session-ID"
+	DefaultCORSExposedHeaders = "Retry-After,Link"
+	DefaultCORSMaxAge         = 10 * time.Minute
+
+	// compression
+	DefaultCompressionEncodings     = "br,zstd,gzip" // by order of preference
+	DefaultCompressionMinSize       = 1024           // bytes, smaller responses aren't worth it
+	DefaultCompressibleContentTypes = "application/json,application/x-ndjson,application/geo+json,application/xml,application/vnd.google-earth.kml+xml,application/gpx+xml,text/*"
+
+	// GraphQL
+	DefaultGraphQLMaxComplexity      = 200 // a query above it is rejected before hitting any provider
+	DefaultGraphQLPlacesLimit        = 10  // places returned when no limit is requested
+	MaxGraphQLPlacesLimit            = 50
+	GraphQLDetailsCost               = 10 // complexity of a place details fetch, a field costs 1
+	DefaultGraphQLDetailsConcurrency = 4  // parallel details calls per provider batch
+	MaxGraphQLRequestBytes           = 1 << 20
+
+	// pagination
+	DefaultPlacesPageSize = 20
+	MaxPlacesPageSize     = 50
+	PlacesCursorTTL       = 15 * time.Minute // the cursors expire, as the upstream page tokens do
+
+	// area searches
+	MaxAreaSearchRadius            = MaxAllowedSearchRadius * 1000 // meters, the Google maximum. The places of larger areas are the ones close to their center
+	MaxPolygonRequestBytes         = 64 << 10
+	MaxPolygonVertices             = 1000
+	PlaceLocationCacheTTL          = 24 * time.Hour // the autocomplete predictions locations, looked up to filter them
+	MaxCachedPlaceLocations        = 100000
+	PlaceLocationLookupConcurrency = 4
+
+	// geocoding
+	ReverseGeocodeRadius    = 50                              // meters around the location where the establishments are searched
+	NominatimUserAgent      = "go-webservice-places-provider" // identifies the application, required by the Nominatim usage policy
+	MaxGeocodeAddressLength = 256
+	MaxGeocodingResults     = 5 // per provider
+
+	// provider errors
+	ProviderQuotaRetryAfter = 60 // seconds, suggested to the clients when a provider quota is exceeded
+
+	// websocket autocomplete
+	DefaultAutocompleteDebounce    = 150 * time.Millisecond // a query is searched once the client stopped typing for this long
+	DefaultAutocompleteIdleTimeout = time.Minute            // connections without any query for this long are closed
+	DefaultAutocompleteRate        = 5                      // queries per second and connection
+	DefaultAutocompleteBurst       = 10
+	AutocompleteSessionTTL         = 3 * time.Minute // an autocomplete (billing) session expires after this long without keystrokes
+	MaxAutocompleteSessions        = 100000          // sessions in progress, the keystrokes of the sessions above are billed per request
+	AutocompleteWriteTimeout       = 10 * time.Second
+	MaxAutocompleteMessageBytes    = 4096
 )
 
 type configSchema struct {
 	GooglePlacesApiKey     string
 	FoursquareClientID     string
 	FoursquareClientSecret string
+	CursorSigningKey       string // signs the pagination cursors, shared by the instances of the service
 	DefaultHttpHeaders     map[string]string
 	//sync.RWMutex : Mutexes can be added if config would be extended to add write actions
 }
@@ -39,14 +121,34 @@ func Config() *configSchema {
 			GooglePlacesApiKey:     os.Getenv("GOOGLE_PLACES_API_KEY"),
 			FoursquareClientID:     os.Getenv("FOURSQUARE_CLIENT_ID"),
 			FoursquareClientSecret: os.Getenv("FOURSQUARE_CLIENT_SECRET"),
+			CursorSigningKey:       os.Getenv("CURSOR_SIGNING_KEY"),
 			DefaultHttpHeaders: map[string]string{
-				"Access-Control-Allow-Origin": "*",
+				"Content-Type": "application/json", // CORS headers are set by the CORS middleware
 			},
 		}
 	})
 	return c
 }
 
+const redactedValue = "<redacted>"
+
+// Redacted returns a copy of the configuration with its secrets masked, safe to be dumped
+func (c *configSchema) Redacted() configSchema {
+	redacted := *c
+	redacted.GooglePlacesApiKey = redact(c.GooglePlacesApiKey)
+	redacted.FoursquareClientSecret = redact(c.FoursquareClientSecret)
+	redacted.CursorSigningKey = redact(c.CursorSigningKey)
+	return redacted
+}
+
+// an empty value stays empty, it tells that the secret is missing
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return redactedValue
+}
+
 func init() {
 	log.Print("Configuration loaded...")
 }
@@ -7,3 +7,21 @@ type ContextKey string // can be unexported
 
 // ContextKeyRequestID is the ContextKey for RequestID
 const ContextKeyRequestID ContextKey = "requestID" // can be unexported
+
+// ContextKeyPrincipal is the ContextKey for the authenticated caller
+const ContextKeyPrincipal ContextKey = "principal"
+
+// ContextKeyClientID is the ContextKey for the authenticated client id
+const ContextKeyClientID ContextKey = "clientID"
+
+// ContextKeySubject is the ContextKey for the authenticated end user (token "sub" claim)
+const ContextKeySubject ContextKey = "subject"
+
+// ContextKeyDetailsLoader is the ContextKey for the place details loader of a GraphQL query
+const ContextKeyDetailsLoader ContextKey = "detailsLoader"
+
+// ContextKeySessionID is the ContextKey for the client autocomplete session id
+const ContextKeySessionID ContextKey = "sessionID"
+
+// ContextKeyAPIVersion is the ContextKey for the API version of a request, when not the first one
+const ContextKeyAPIVersion ContextKey = "apiVersion"
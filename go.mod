@@ -1,30 +1,33 @@
 module github.com/codeselim/go-webservice-places-provider
 
-go 1.12
+go 1.25.0
 
 require (
-	github.com/Masterminds/semver v1.4.2 // indirect
-	github.com/Masterminds/vcs v1.13.1 // indirect
-	github.com/armon/go-radix v1.0.0 // indirect
-	github.com/boltdb/bolt v1.3.1 // indirect
-	github.com/davecgh/go-spew v1.1.1
-	github.com/dghubble/sling v1.3.0
-	github.com/golang/dep v0.5.4 // indirect
-	github.com/golang/protobuf v1.3.2 // indirect
-	github.com/google/go-querystring v1.0.0
-	github.com/google/uuid v1.1.1
+	github.com/andybalholm/brotli v1.2.0
+	github.com/google/uuid v1.6.0
 	github.com/gorilla/handlers v1.4.1
 	github.com/gorilla/mux v1.7.3
-	github.com/jmank88/nuts v0.3.0 // indirect
-	github.com/nightlyone/lockfile v0.0.0-20180618180623-0ad87eef1443 // indirect
-	github.com/pelletier/go-toml v1.4.0 // indirect
+	github.com/gorilla/websocket v1.5.3
+	github.com/graphql-go/graphql v0.8.1
+	github.com/klauspost/compress v1.18.0
 	github.com/peppage/foursquarego v4.0.0+incompatible
-	github.com/pkg/errors v0.8.1 // indirect
-	github.com/sdboyer/constext v0.0.0-20170321163424-836a14457353 // indirect
 	github.com/sirupsen/logrus v1.4.2
-	github.com/stretchr/objx v0.2.0 // indirect
 	github.com/stretchr/testify v1.3.0
-	golang.org/x/sync v0.0.0-20190423024810-112230192c58
 	golang.org/x/time v0.0.0-20190308202827-9d24e82272b4
+	google.golang.org/grpc v1.82.1
+	google.golang.org/protobuf v1.36.11
 	googlemaps.github.io/maps v0.0.0-20190709232500-0dbd631282e2
 )
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/dghubble/sling v1.3.0 // indirect
+	github.com/google/go-querystring v1.0.0 // indirect
+	github.com/konsorten/go-windows-terminal-sequences v1.0.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/stretchr/objx v0.2.0 // indirect
+	golang.org/x/net v0.53.0 // indirect
+	golang.org/x/sys v0.43.0 // indirect
+	golang.org/x/text v0.36.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20260414002931-afd174a4e478 // indirect
+)
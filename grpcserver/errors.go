@@ -0,0 +1,60 @@
+package grpcserver
+
+import (
+	"context"
+	"github.com/codeselim/go-webservice-places-provider/api"
+	"github.com/codeselim/go-webservice-places-provider/handlers"
+	"github.com/codeselim/go-webservice-places-provider/log"
+	"github.com/codeselim/go-webservice-places-provider/placespb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/http"
+)
+
+// http statuses of the api errors and their gRPC equivalents
+var statusCodes = map[int]codes.Code{
+	http.StatusBadRequest:          codes.InvalidArgument,
+	http.StatusUnauthorized:        codes.Unauthenticated,
+	http.StatusForbidden:           codes.PermissionDenied,
+	http.StatusNotFound:            codes.NotFound,
+	http.StatusTooManyRequests:     codes.ResourceExhausted,
+	http.StatusBadGateway:          codes.Unavailable,
+	http.StatusServiceUnavailable:  codes.Unavailable,
+	http.StatusGatewayTimeout:      codes.DeadlineExceeded,
+	http.StatusInternalServerError: codes.Internal,
+}
+
+// toAPIError logs an error and turns it into an api.Error, as the http errors handler does
+func toAPIError(ctx context.Context, err error) *api.Error {
+	if _, ok := err.(*api.Error); !ok {
+		log.GetLoggerWithContext(ctx).Error(err.Error())
+	}
+	return handlers.ToAPIError(ctx, err)
+}
+
+func toProtoError(apiError *api.Error) *placespb.Error {
+	return &placespb.Error{
+		TraceId:           apiError.TraceId,
+		Type:              apiError.Type,
+		Code:              int32(apiError.Code),
+		Message:           apiError.Message,
+		RetryAfterSeconds: int32(apiError.RetryAfter),
+	}
+}
+
+// toStatusError returns the gRPC status of an error, the api.Error is attached to the status details
+func toStatusError(err error) error {
+	apiError, ok := err.(*api.Error)
+	if !ok {
+		return status.Error(codes.Internal, err.Error())
+	}
+	code, ok := statusCodes[apiError.StatusCode]
+	if !ok {
+		code = codes.Unknown
+	}
+	st, detailsErr := status.New(code, apiError.Message).WithDetails(toProtoError(apiError))
+	if detailsErr != nil {
+		return status.Error(code, apiError.Message)
+	}
+	return st.Err()
+}
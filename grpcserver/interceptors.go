@@ -0,0 +1,119 @@
+package grpcserver
+
+import (
+	"context"
+	"github.com/codeselim/go-webservice-places-provider/auth"
+	"github.com/codeselim/go-webservice-places-provider/handlers"
+	"github.com/codeselim/go-webservice-places-provider/log"
+	"github.com/codeselim/go-webservice-places-provider/placespb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"strings"
+)
+
+// the request id is read from (or assigned and sent back in) this metadata key, so calls can be traced across services
+const requestIDMetadataKey = "x-request-id"
+
+func withRequestID(ctx context.Context) context.Context {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(requestIDMetadataKey); len(ids) > 0 && ids[0] != "" {
+			return handlers.WithRequestID(ctx, ids[0])
+		}
+	}
+	return handlers.AssignRequestID(ctx)
+}
+
+func unaryRequestIDInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx = withRequestID(ctx)
+	grpc.SetHeader(ctx, metadata.Pairs(requestIDMetadataKey, handlers.GetRequestID(ctx)))
+
+	logger := log.GetLoggerWithContext(ctx)
+	logger.Info("Incomming gRPC call ", info.FullMethod)
+	resp, err := handler(ctx, req)
+	logger.Info("Finished handling gRPC call")
+	return resp, err
+}
+
+// requestIDStream overrides the context of a server stream: its request id, then its principal
+type requestIDStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *requestIDStream) Context() context.Context {
+	return s.ctx
+}
+
+func streamRequestIDInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx := withRequestID(stream.Context())
+	stream.SetHeader(metadata.Pairs(requestIDMetadataKey, handlers.GetRequestID(ctx)))
+
+	logger := log.GetLoggerWithContext(ctx)
+	logger.Info("Incomming gRPC stream ", info.FullMethod)
+	err := handler(srv, &requestIDStream{ServerStream: stream, ctx: ctx})
+	logger.Info("Finished handling gRPC stream")
+	return err
+}
+
+// metadata keys of the credentials, as the http headers
+const (
+	authorizationMetadataKey = "authorization"
+	apiKeyMetadataKey        = "x-api-key"
+	bearerPrefix             = "Bearer "
+)
+
+// scopes gating the PlacesService methods, as the http endpoints
+var methodScopes = map[string]string{
+	placespb.PlacesService_SearchPlaces_FullMethodName:       handlers.ScopePlacesSearch,
+	placespb.PlacesService_StreamSearchPlaces_FullMethodName: handlers.ScopePlacesSearch,
+	placespb.PlacesService_GetPlaceDetails_FullMethodName:    handlers.ScopePlacesDetails,
+}
+
+// authenticate authenticates the caller from its metadata, consumes its quotas and checks the method scope.
+// The principal is attached to the returned context
+func authenticate(ctx context.Context, authConfig handlers.AuthConfig, fullMethod string) (context.Context, error) {
+	credentials := handlers.Credentials{}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(authorizationMetadataKey); len(values) > 0 && strings.HasPrefix(values[0], bearerPrefix) {
+			credentials.BearerToken = strings.TrimPrefix(values[0], bearerPrefix)
+		}
+		if values := md.Get(apiKeyMetadataKey); len(values) > 0 {
+			credentials.APIKey = values[0]
+		}
+	}
+	principal, apiError := handlers.Authenticate(ctx, authConfig, credentials)
+	if apiError != nil {
+		return ctx, toStatusError(apiError)
+	}
+	ctx = auth.WithPrincipal(ctx, principal)
+	scope, ok := methodScopes[fullMethod]
+	if !ok {
+		scope = handlers.ScopePlacesSearch
+	}
+	if apiError := handlers.CheckScope(ctx, scope); apiError != nil {
+		return ctx, toStatusError(apiError)
+	}
+	return ctx, nil
+}
+
+func unaryAuthInterceptor(authConfig handlers.AuthConfig) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := authenticate(ctx, authConfig, info.FullMethod)
+		if err != nil {
+			log.GetLoggerWithContext(ctx).Warn("gRPC call rejected: " + err.Error())
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func streamAuthInterceptor(authConfig handlers.AuthConfig) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(stream.Context(), authConfig, info.FullMethod)
+		if err != nil {
+			log.GetLoggerWithContext(ctx).Warn("gRPC stream rejected: " + err.Error())
+			return err
+		}
+		return handler(srv, &requestIDStream{ServerStream: stream, ctx: ctx})
+	}
+}
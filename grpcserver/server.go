@@ -0,0 +1,172 @@
+package grpcserver
+
+import (
+	"context"
+	"crypto/tls"
+	"github.com/codeselim/go-webservice-places-provider/api"
+	"github.com/codeselim/go-webservice-places-provider/handlers"
+	"github.com/codeselim/go-webservice-places-provider/log"
+	"github.com/codeselim/go-webservice-places-provider/placespb"
+	"github.com/codeselim/go-webservice-places-provider/providers"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"net"
+	"net/http"
+	"time"
+)
+
+/**
+ * gRPC API of the places aggregation (proto/places.proto), for internal services.
+ * It shares the aggregation core of the http API (handlers.PlacesHandler): same providers, same errors codes.
+ */
+
+type placesService struct {
+	placespb.UnimplementedPlacesServiceServer
+	placesHandler *handlers.PlacesHandler
+}
+
+// Config of the gRPC server, its zero value serves plaintext and unauthenticated calls
+type Config struct {
+	Auth *handlers.AuthConfig // the same API keys, tokens and quotas as the http API. Nil: unauthenticated
+	TLS  *tls.Config          // nil: plaintext
+}
+
+// NewServer returns a gRPC server exposing the PlacesService
+func NewServer(placesHandler *handlers.PlacesHandler, serverConfig Config) *grpc.Server {
+	if placesHandler == nil {
+		log.GetLogger().Panic("places handler should be provided")
+	}
+	unaryInterceptors := []grpc.UnaryServerInterceptor{unaryRequestIDInterceptor}
+	streamInterceptors := []grpc.StreamServerInterceptor{streamRequestIDInterceptor}
+	if serverConfig.Auth != nil {
+		unaryInterceptors = append(unaryInterceptors, unaryAuthInterceptor(*serverConfig.Auth))
+		streamInterceptors = append(streamInterceptors, streamAuthInterceptor(*serverConfig.Auth))
+	}
+	options := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unaryInterceptors...),
+		grpc.ChainStreamInterceptor(streamInterceptors...),
+	}
+	if serverConfig.TLS != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(serverConfig.TLS)))
+	}
+	server := grpc.NewServer(options...)
+	placespb.RegisterPlacesServiceServer(server, &placesService{placesHandler: placesHandler})
+	return server
+}
+
+// Serve serves on the listener until ctx is done, then stops gracefully: in-flight calls are given gracePeriod to finish
+func Serve(ctx context.Context, server *grpc.Server, listener net.Listener, gracePeriod time.Duration) error {
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		done := make(chan struct{})
+		go func() {
+			server.GracefulStop()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(gracePeriod):
+			log.GetLogger().Warn("gRPC calls still running after the grace period, stopping them")
+			server.Stop()
+		}
+	}()
+
+	err := server.Serve(listener)
+	if err == grpc.ErrServerStopped {
+		err = nil
+	}
+	if ctx.Err() != nil {
+		<-stopped
+	}
+	return err
+}
+
+func (s *placesService) SearchPlaces(ctx context.Context, request *placespb.SearchPlacesRequest) (*placespb.SearchPlacesResponse, error) {
+	searchRequest, err := toSearchRequest(ctx, request)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	placesProviders, err := s.placesHandler.AllowedProviders(ctx)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	places, complete, err := s.placesHandler.SearchPlaces(ctx, placesProviders, searchRequest)
+	if err != nil {
+		// every provider failed: the dominant provider error
+		return nil, toStatusError(toAPIError(ctx, err))
+	}
+	return &placespb.SearchPlacesResponse{Places: toProtoPlaces(places), Complete: complete}, nil
+}
+
+func (s *placesService) StreamSearchPlaces(request *placespb.SearchPlacesRequest, stream placespb.PlacesService_StreamSearchPlacesServer) error {
+	ctx := stream.Context()
+	searchRequest, err := toSearchRequest(ctx, request)
+	if err != nil {
+		return toStatusError(err)
+	}
+	placesProviders, err := s.placesHandler.AllowedProviders(ctx)
+	if err != nil {
+		return toStatusError(err)
+	}
+
+	var sendErr error
+	s.placesHandler.StreamPlaces(ctx, placesProviders, searchRequest, func(label providers.ProviderLabel, places api.Places, err error) {
+		if sendErr != nil {
+			return // the client is gone
+		}
+		results := &placespb.ProviderPlaces{Provider: string(label), Places: toProtoPlaces(places)}
+		if err != nil {
+			results.Error = toProtoError(toAPIError(ctx, err))
+		}
+		sendErr = stream.Send(results)
+	})
+	return sendErr
+}
+
+func (s *placesService) GetPlaceDetails(ctx context.Context, request *placespb.GetPlaceDetailsRequest) (*placespb.PlaceDetails, error) {
+	placesProviders, err := s.placesHandler.AllowedProviders(ctx)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	details, err := s.placesHandler.GetPlaceDetails(ctx, placesProviders, request.GetProvider(), request.GetId())
+	if err != nil {
+		return nil, toStatusError(toAPIError(ctx, err))
+	}
+	return &placespb.PlaceDetails{Id: details.ID, Name: details.Name, SomeText: details.SomeText}, nil
+}
+
+func toSearchRequest(ctx context.Context, request *placespb.SearchPlacesRequest) (providers.PlaceSearchRequest, error) {
+	if request.GetText() == "" {
+		return providers.PlaceSearchRequest{}, &api.Error{
+			Code:       api.TextInputParamIsMissingErrorCode,
+			Message:    api.ErrorMessageText[api.TextInputParamIsMissingErrorCode],
+			StatusCode: http.StatusBadRequest,
+			TraceId:    handlers.GetRequestID(ctx),
+		}
+	}
+	searchRequest := providers.PlaceSearchRequest{InputString: request.GetText()}
+	if location := request.GetLocation(); location != nil {
+		searchRequest.Location = &providers.Location{Lat: location.GetLat(), Lng: location.GetLng()}
+	}
+	return searchRequest, nil
+}
+
+func toProtoPlaces(places api.Places) []*placespb.Place {
+	protoPlaces := make([]*placespb.Place, 0, len(places))
+	for _, place := range places {
+		protoPlace := &placespb.Place{
+			Id:       place.ID,
+			Provider: place.Provider,
+			Name:     place.Name,
+			Address:  place.Address,
+			Uri:      place.URI,
+		}
+		if place.Location != nil {
+			protoPlace.Location = &placespb.Location{Lat: place.Location.Lat, Lng: place.Location.Lng}
+		}
+		protoPlaces = append(protoPlaces, protoPlace)
+	}
+	return protoPlaces
+}
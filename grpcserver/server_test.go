@@ -0,0 +1,283 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"github.com/codeselim/go-webservice-places-provider/api"
+	"github.com/codeselim/go-webservice-places-provider/auth"
+	"github.com/codeselim/go-webservice-places-provider/handlers"
+	"github.com/codeselim/go-webservice-places-provider/placespb"
+	"github.com/codeselim/go-webservice-places-provider/providers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"testing"
+	"time"
+)
+
+type mockPlacesProvider struct {
+	mock.Mock
+	label providers.ProviderLabel
+}
+
+func (m *mockPlacesProvider) GetPlacesByQuery(ctx context.Context, request providers.PlaceSearchRequest) (api.Places, error) {
+	args := m.Called(ctx, request)
+	return args.Get(0).(api.Places), args.Error(1)
+}
+func (m *mockPlacesProvider) GetPlaceDetails(ctx context.Context, placeId string) (api.PlaceDetails, error) {
+	args := m.Called(ctx, placeId)
+	return args.Get(0).(api.PlaceDetails), args.Error(1)
+}
+func (m *mockPlacesProvider) GetProviderLabel() providers.ProviderLabel {
+	return m.label
+}
+func (m *mockPlacesProvider) GetSearchModes() []providers.SearchMode {
+	return []providers.SearchMode{providers.AutocompleteMode}
+}
+
+// starts the PlacesService on an in-memory listener and returns a client connected to it
+func newTestClient(t *testing.T, placesProviders ...providers.Provider) placespb.PlacesServiceClient {
+	return newTestClientWithConfig(t, Config{}, placesProviders...)
+}
+
+func newTestClientWithConfig(t *testing.T, serverConfig Config, placesProviders ...providers.Provider) placespb.PlacesServiceClient {
+	placesHandler := handlers.NewPlacesHandler(placesProviders...)
+	listener := bufconn.Listen(1 << 20)
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		Serve(ctx, NewServer(&placesHandler, serverConfig), listener, time.Second)
+	}()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		conn.Close()
+		cancel()
+		<-served
+	})
+	return placespb.NewPlacesServiceClient(conn)
+}
+
+func TestSearchPlaces(t *testing.T) {
+	google := &mockPlacesProvider{label: "google"}
+	google.On("GetPlacesByQuery", mock.Anything, providers.PlaceSearchRequest{
+		InputString: "coffee",
+		Location:    &providers.Location{Lat: 48.85, Lng: 2.35},
+	}).Return(api.Places{{ID: "1", Provider: "google", Name: "Cafe", Location: &api.Location{Lat: 48.85, Lng: 2.35}, URI: "https://g/1"}}, nil)
+	client := newTestClient(t, google)
+
+	response, err := client.SearchPlaces(context.Background(), &placespb.SearchPlacesRequest{
+		Text:     "coffee",
+		Location: &placespb.Location{Lat: 48.85, Lng: 2.35},
+	})
+
+	require.NoError(t, err)
+	assert.True(t, response.GetComplete())
+	require.Len(t, response.GetPlaces(), 1)
+	place := response.GetPlaces()[0]
+	assert.Equal(t, "1", place.GetId())
+	assert.Equal(t, "google", place.GetProvider())
+	assert.Equal(t, "Cafe", place.GetName())
+	assert.Equal(t, "https://g/1", place.GetUri())
+	assert.Equal(t, 48.85, place.GetLocation().GetLat())
+	assert.Equal(t, 2.35, place.GetLocation().GetLng())
+}
+
+func TestSearchPlacesMissingText(t *testing.T) {
+	client := newTestClient(t, &mockPlacesProvider{label: "google"})
+
+	_, err := client.SearchPlaces(context.Background(), &placespb.SearchPlacesRequest{})
+
+	st := status.Convert(err)
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+	require.Len(t, st.Details(), 1)
+	details := st.Details()[0].(*placespb.Error)
+	assert.Equal(t, int32(api.TextInputParamIsMissingErrorCode), details.GetCode())
+	assert.NotEmpty(t, details.GetTraceId())
+}
+
+func TestSearchPlacesAllProvidersFailed(t *testing.T) {
+	google := &mockPlacesProvider{label: "google"}
+	google.On("GetPlacesByQuery", mock.Anything, mock.Anything).Return(api.Places{},
+		&providers.ProviderError{Provider: "google", Kind: providers.UpstreamErrorKind, Err: errors.New("google is down")})
+	foursquare := &mockPlacesProvider{label: "foursquare"}
+	foursquare.On("GetPlacesByQuery", mock.Anything, mock.Anything).Return(api.Places{},
+		&providers.ProviderError{Provider: "foursquare", Kind: providers.UpstreamErrorKind, Err: errors.New("foursquare is down")})
+	client := newTestClient(t, google, foursquare)
+
+	_, err := client.SearchPlaces(context.Background(), &placespb.SearchPlacesRequest{Text: "coffee"})
+
+	st := status.Convert(err)
+	assert.Equal(t, codes.Unavailable, st.Code())
+	assert.NotContains(t, st.Message(), "is down", "the upstream message isn't leaked")
+	require.Len(t, st.Details(), 1)
+	assert.Equal(t, int32(api.ProviderUnavailableErrorCode), st.Details()[0].(*placespb.Error).GetCode())
+}
+
+func TestStreamSearchPlaces(t *testing.T) {
+	google := &mockPlacesProvider{label: "google"}
+	google.On("GetPlacesByQuery", mock.Anything, mock.Anything).Return(api.Places{{ID: "1", Provider: "google"}}, nil)
+	foursquare := &mockPlacesProvider{label: "foursquare"}
+	foursquare.On("GetPlacesByQuery", mock.Anything, mock.Anything).Return(api.Places{}, errors.New("boom"))
+	client := newTestClient(t, google, foursquare)
+
+	stream, err := client.StreamSearchPlaces(context.Background(), &placespb.SearchPlacesRequest{Text: "coffee"})
+	require.NoError(t, err)
+
+	results := []*placespb.ProviderPlaces{}
+	for {
+		providerPlaces, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		results = append(results, providerPlaces)
+	}
+
+	require.Len(t, results, 2)
+	sort.Slice(results, func(i, j int) bool { return results[i].GetProvider() < results[j].GetProvider() })
+	assert.Equal(t, "foursquare", results[0].GetProvider())
+	assert.Empty(t, results[0].GetPlaces())
+	assert.Equal(t, int32(0), results[0].GetError().GetCode())
+	assert.NotEmpty(t, results[0].GetError().GetMessage())
+	assert.Equal(t, "google", results[1].GetProvider())
+	assert.Len(t, results[1].GetPlaces(), 1)
+	assert.Nil(t, results[1].GetError())
+}
+
+func TestGetPlaceDetails(t *testing.T) {
+	google := &mockPlacesProvider{label: "google"}
+	google.On("GetPlaceDetails", mock.Anything, "42").Return(api.PlaceDetails{ID: "42", Name: "Cafe", SomeText: "text"}, nil)
+	client := newTestClient(t, google)
+
+	details, err := client.GetPlaceDetails(context.Background(), &placespb.GetPlaceDetailsRequest{Provider: "google", Id: "42"})
+
+	require.NoError(t, err)
+	assert.Equal(t, "42", details.GetId())
+	assert.Equal(t, "Cafe", details.GetName())
+	assert.Equal(t, "text", details.GetSomeText())
+}
+
+func TestGetPlaceDetailsUnknownProvider(t *testing.T) {
+	client := newTestClient(t, &mockPlacesProvider{label: "google"})
+
+	_, err := client.GetPlaceDetails(context.Background(), &placespb.GetPlaceDetailsRequest{Provider: "yelp", Id: "42"})
+
+	st := status.Convert(err)
+	assert.Equal(t, codes.NotFound, st.Code())
+	require.Len(t, st.Details(), 1)
+	assert.Equal(t, int32(api.UnknownProviderErrorCode), st.Details()[0].(*placespb.Error).GetCode())
+}
+
+func TestRequestIDPropagation(t *testing.T) {
+	google := &mockPlacesProvider{label: "google"}
+	google.On("GetPlacesByQuery", mock.Anything, mock.Anything).Return(api.Places{}, nil)
+	client := newTestClient(t, google)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), requestIDMetadataKey, "my-request-id")
+	var header metadata.MD
+	_, err := client.SearchPlaces(ctx, &placespb.SearchPlacesRequest{Text: "coffee"}, grpc.Header(&header))
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"my-request-id"}, header.Get(requestIDMetadataKey))
+	// the providers are called with the caller request id
+	assert.Equal(t, "my-request-id", handlers.GetRequestID(google.Calls[0].Arguments.Get(0).(context.Context)))
+}
+
+func TestRequestIDAssigned(t *testing.T) {
+	client := newTestClient(t, &mockPlacesProvider{label: "google"})
+
+	var header metadata.MD
+	_, err := client.SearchPlaces(context.Background(), &placespb.SearchPlacesRequest{}, grpc.Header(&header))
+
+	require.Error(t, err)
+	require.Len(t, header.Get(requestIDMetadataKey), 1)
+	assert.Equal(t, header.Get(requestIDMetadataKey)[0], status.Convert(err).Details()[0].(*placespb.Error).GetTraceId())
+}
+
+func TestToStatusError(t *testing.T) {
+	tests := []struct {
+		statusCode int
+		code       codes.Code
+	}{
+		{http.StatusBadRequest, codes.InvalidArgument},
+		{http.StatusUnauthorized, codes.Unauthenticated},
+		{http.StatusForbidden, codes.PermissionDenied},
+		{http.StatusNotFound, codes.NotFound},
+		{http.StatusTooManyRequests, codes.ResourceExhausted},
+		{http.StatusBadGateway, codes.Unavailable},
+		{http.StatusServiceUnavailable, codes.Unavailable},
+		{http.StatusGatewayTimeout, codes.DeadlineExceeded},
+		{http.StatusInternalServerError, codes.Internal},
+		{http.StatusTeapot, codes.Unknown},
+	}
+	for _, test := range tests {
+		err := toStatusError(&api.Error{StatusCode: test.statusCode, Message: "message", RetryAfter: 3})
+		st := status.Convert(err)
+		assert.Equal(t, test.code, st.Code(), test.statusCode)
+		assert.Equal(t, "message", st.Message())
+		assert.Equal(t, int32(3), st.Details()[0].(*placespb.Error).GetRetryAfterSeconds())
+	}
+	assert.Equal(t, codes.Internal, status.Code(toStatusError(errors.New("boom"))))
+}
+
+func TestAuthenticatedCalls(t *testing.T) {
+	store, err := auth.NewAPIKeyStore([]auth.APIKey{
+		{ID: "backend", SecretHash: auth.HashSecret("secret"), AllowedProviders: []string{"google"}, QuotaPerMinute: 2},
+	})
+	require.NoError(t, err)
+	google := &mockPlacesProvider{label: "google"}
+	google.On("GetPlacesByQuery", mock.Anything, mock.Anything).Return(api.Places{{ID: "1", Provider: "google"}}, nil)
+	foursquare := &mockPlacesProvider{label: "foursquare"}
+	client := newTestClientWithConfig(t, Config{Auth: &handlers.AuthConfig{APIKeys: store}}, google, foursquare)
+	request := &placespb.SearchPlacesRequest{Text: "coffee"}
+
+	// missing and invalid keys
+	_, err = client.SearchPlaces(context.Background(), request)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	ctx := metadata.AppendToOutgoingContext(context.Background(), apiKeyMetadataKey, "wrong")
+	stream, err := client.StreamSearchPlaces(ctx, request)
+	require.NoError(t, err) // the stream errors come with its first message
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// the key allowed providers apply
+	ctx = metadata.AppendToOutgoingContext(context.Background(), apiKeyMetadataKey, "secret")
+	response, err := client.SearchPlaces(ctx, request)
+	require.NoError(t, err)
+	require.Len(t, response.GetPlaces(), 1)
+	assert.Equal(t, "google", response.GetPlaces()[0].GetProvider())
+	foursquare.AssertNotCalled(t, "GetPlacesByQuery", mock.Anything, mock.Anything)
+
+	// and its quotas
+	_, err = client.SearchPlaces(ctx, request)
+	require.NoError(t, err)
+	_, err = client.SearchPlaces(ctx, request)
+	st := status.Convert(err)
+	assert.Equal(t, codes.ResourceExhausted, st.Code())
+	assert.True(t, st.Details()[0].(*placespb.Error).GetRetryAfterSeconds() > 0)
+}
+
+func TestMethodScopes(t *testing.T) {
+	// the same scopes as the http endpoints
+	assert.Equal(t, handlers.ScopePlacesSearch, methodScopes[placespb.PlacesService_SearchPlaces_FullMethodName])
+	assert.Equal(t, handlers.ScopePlacesSearch, methodScopes[placespb.PlacesService_StreamSearchPlaces_FullMethodName])
+	assert.Equal(t, handlers.ScopePlacesDetails, methodScopes[placespb.PlacesService_GetPlaceDetails_FullMethodName])
+}
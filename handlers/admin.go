@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"flag"
+	"github.com/codeselim/go-webservice-places-provider/api"
+	"github.com/codeselim/go-webservice-places-provider/config"
+	"github.com/codeselim/go-webservice-places-provider/log"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/pprof"
+	"sort"
+	"strings"
+	"sync"
+)
+
+/**
+ * Admin endpoints: profiling, metrics, configuration dump and runtime controls.
+ * They are served on a separate listener (bound to localhost by default) and must never be
+ * registered on the public API router.
+ */
+
+// CacheFlusher is implemented by any cache which can be flushed from the admin server
+type CacheFlusher interface {
+	FlushCache()
+}
+
+// flags whose name contains one of these are redacted in the configuration dump
+var secretFlagsHints = []string{"secret", "password", "token", "apikey"}
+
+type AdminHandler struct {
+	healthHandler *HealthHandler
+	flagSet       *flag.FlagSet
+
+	mu     sync.RWMutex // guards caches
+	caches map[string]CacheFlusher
+}
+
+type effectiveConfig struct {
+	Config interface{}       `json:"config"`
+	Flags  map[string]string `json:"flags"`
+	Build  api.BuildInfo     `json:"build"`
+}
+
+type logLevel struct {
+	Level string `json:"level"`
+}
+
+type flushedCaches struct {
+	Flushed []string `json:"flushed"`
+}
+
+// Constructor, flagSet is the application flags set dumped with the effective configuration
+func NewAdminHandler(healthHandler *HealthHandler, flagSet *flag.FlagSet) *AdminHandler {
+	if healthHandler == nil || flagSet == nil {
+		log.GetLogger().Panic("health handler and flag set should be provided")
+	}
+	adminHandler := &AdminHandler{
+		healthHandler: healthHandler,
+		flagSet:       flagSet,
+		caches:        map[string]CacheFlusher{},
+	}
+	adminHandler.RegisterCache("health", healthHandler)
+	return adminHandler
+}
+
+// RegisterCache makes a cache flushable via the admin cache-flush endpoint
+func (a *AdminHandler) RegisterCache(name string, cache CacheFlusher) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.caches[name] = cache
+}
+
+// Router returns the admin router. Keep it off the public API router!
+func (a *AdminHandler) Router() *mux.Router {
+	r := mux.NewRouter()
+	r.Use(RequestIdMiddleware, LoggingMiddleware)
+
+	// profiling
+	r.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	r.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	r.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	r.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	r.PathPrefix("/debug/pprof/").HandlerFunc(pprof.Index) // named profiles (heap, goroutine...) are served by the index handler
+	// metrics
+	r.Handle("/debug/vars", expvar.Handler()).Methods("GET")
+
+	r.HandleFunc("/admin/config", a.GetConfig).Methods("GET")
+	r.HandleFunc("/admin/providers", a.GetProviders).Methods("GET")
+	r.HandleFunc("/admin/loglevel", a.GetLogLevel).Methods("GET")
+	r.HandleFunc("/admin/loglevel", a.SetLogLevel).Methods("PUT")
+	r.HandleFunc("/admin/cache/flush", a.FlushCaches).Methods("POST")
+	return r
+}
+
+// GetConfig dumps the effective configuration, secrets are redacted
+func (a *AdminHandler) GetConfig(w http.ResponseWriter, r *http.Request) {
+	flags := map[string]string{}
+	a.flagSet.VisitAll(func(f *flag.Flag) {
+		flags[f.Name] = f.Value.String()
+		if isSecretFlag(f.Name) && f.Value.String() != "" {
+			flags[f.Name] = "<redacted>"
+		}
+	})
+
+	writeJSON(w, http.StatusOK, effectiveConfig{
+		Config: config.Config().Redacted(),
+		Flags:  flags,
+		Build: api.BuildInfo{
+			Version:   config.Version,
+			Commit:    config.Commit,
+			BuildTime: config.BuildTime,
+		},
+	})
+}
+
+// GetProviders lists the registered providers with their last known state
+func (a *AdminHandler) GetProviders(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.healthHandler.ProvidersHealth())
+}
+
+func (a *AdminHandler) GetLogLevel(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, logLevel{Level: log.GetLevel()})
+}
+
+// SetLogLevel switches the log level at runtime. The level is read from the "level" query param or a json body
+func (a *AdminHandler) SetLogLevel(w http.ResponseWriter, r *http.Request) {
+	requested := logLevel{Level: r.URL.Query().Get("level")}
+	if requested.Level == "" {
+		json.NewDecoder(r.Body).Decode(&requested)
+	}
+
+	if err := log.SetLevel(requested.Level); err != nil {
+		HandleError(newBadRequestError(r, api.InvalidLogLevelErrorCode), w, r)
+		return
+	}
+	log.GetLoggerWithContext(r.Context()).Warn("Log level switched to " + log.GetLevel())
+	writeJSON(w, http.StatusOK, logLevel{Level: log.GetLevel()})
+}
+
+// FlushCaches flushes the cache given by the "name" query param, or all the registered caches
+func (a *AdminHandler) FlushCaches(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	flushed := []string{}
+	if name != "" {
+		cache, ok := a.caches[name]
+		if !ok {
+			HandleError(newBadRequestError(r, api.UnknownCacheErrorCode), w, r)
+			return
+		}
+		cache.FlushCache()
+		flushed = append(flushed, name)
+	} else {
+		for cacheName, cache := range a.caches {
+			cache.FlushCache()
+			flushed = append(flushed, cacheName)
+		}
+		sort.Strings(flushed)
+	}
+	log.GetLoggerWithContext(r.Context()).Warn("Caches flushed: " + strings.Join(flushed, ", "))
+	writeJSON(w, http.StatusOK, flushedCaches{Flushed: flushed})
+}
+
+func isSecretFlag(name string) bool {
+	lowerName := strings.ToLower(name)
+	for _, hint := range secretFlagsHints {
+		if strings.Contains(lowerName, hint) {
+			return true
+		}
+	}
+	return false
+}
+
+func newBadRequestError(r *http.Request, code int) *api.Error {
+	return newBadRequestErrorWithContext(r.Context(), code)
+}
+
+// for the callers without the http request, e.g. the GraphQL resolvers
+func newBadRequestErrorWithContext(ctx context.Context, code int) *api.Error {
+	return &api.Error{
+		Code:       code,
+		Message:    api.ErrorMessageText[code],
+		StatusCode: http.StatusBadRequest,
+		TraceId:    GetRequestID(ctx),
+	}
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, body interface{}) {
+	setDefaultHeaders(w)
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(body)
+}
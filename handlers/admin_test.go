@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"encoding/json"
+	"flag"
+	"github.com/codeselim/go-webservice-places-provider/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type mockCache struct {
+	flushed int
+}
+
+func (m *mockCache) FlushCache() {
+	m.flushed++
+}
+
+func newTestAdminHandler() *AdminHandler {
+	flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+	flagSet.String("httpServerPort", "8081", "")
+	flagSet.String("foursquareClientSecret", "very-secret", "")
+	return NewAdminHandler(NewHealthHandler(new(mockGooglePlacesProvider)), flagSet)
+}
+
+func serveAdmin(adminHandler *AdminHandler, method string, url string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	adminHandler.Router().ServeHTTP(rr, req)
+	return rr
+}
+
+func TestUnitAdminGetConfigIsRedacted(t *testing.T) {
+	rr := serveAdmin(newTestAdminHandler(), "GET", "/admin/config", "")
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	dump := effectiveConfig{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &dump); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "8081", dump.Flags["httpServerPort"])
+	assert.Equal(t, "<redacted>", dump.Flags["foursquareClientSecret"])
+	assert.NotContains(t, rr.Body.String(), "very-secret")
+}
+
+func TestUnitAdminGetProviders(t *testing.T) {
+	rr := serveAdmin(newTestAdminHandler(), "GET", "/admin/providers", "")
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `[{"provider":"google-provider-label","state":"UNKNOWN"}]`, rr.Body.String())
+}
+
+func TestUnitAdminSetLogLevel(t *testing.T) {
+	defer log.SetLevel("info")
+	adminHandler := newTestAdminHandler()
+
+	rr := serveAdmin(adminHandler, "PUT", "/admin/loglevel?level=debug", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "debug", log.GetLevel())
+
+	rr = serveAdmin(adminHandler, "PUT", "/admin/loglevel", `{"level":"warning"}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "warning", log.GetLevel())
+
+	rr = serveAdmin(adminHandler, "GET", "/admin/loglevel", "")
+	assert.JSONEq(t, `{"level":"warning"}`, rr.Body.String())
+
+	rr = serveAdmin(adminHandler, "PUT", "/admin/loglevel?level=verbose", "")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Equal(t, "warning", log.GetLevel())
+}
+
+func TestUnitAdminFlushCaches(t *testing.T) {
+	adminHandler := newTestAdminHandler()
+	cache := &mockCache{}
+	adminHandler.RegisterCache("places", cache)
+
+	rr := serveAdmin(adminHandler, "POST", "/admin/cache/flush?name=places", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"flushed":["places"]}`, rr.Body.String())
+	assert.Equal(t, 1, cache.flushed)
+
+	rr = serveAdmin(adminHandler, "POST", "/admin/cache/flush", "")
+	assert.JSONEq(t, `{"flushed":["health","places"]}`, rr.Body.String())
+	assert.Equal(t, 2, cache.flushed)
+
+	rr = serveAdmin(adminHandler, "POST", "/admin/cache/flush?name=unknown", "")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestUnitAdminFlushHealthCache(t *testing.T) {
+	googlePlacesProvider := new(mockCheckableGooglePlacesProvider)
+	googlePlacesProvider.On("CheckHealth", mock.Anything).Return(nil)
+	healthHandler := NewHealthHandler(googlePlacesProvider)
+	adminHandler := NewAdminHandler(healthHandler, flag.NewFlagSet("test", flag.ContinueOnError))
+
+	serveReadiness(t, healthHandler)
+	serveAdmin(adminHandler, "POST", "/admin/cache/flush?name=health", "")
+	serveReadiness(t, healthHandler)
+
+	googlePlacesProvider.AssertNumberOfCalls(t, "CheckHealth", 2)
+}
+
+func TestUnitAdminServesProfilingAndMetrics(t *testing.T) {
+	adminHandler := newTestAdminHandler()
+
+	rr := serveAdmin(adminHandler, "GET", "/debug/pprof/", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = serveAdmin(adminHandler, "GET", "/debug/pprof/goroutine?debug=1", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = serveAdmin(adminHandler, "GET", "/debug/vars", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "provider_calls")
+}
+
+func TestUnitMetricsMiddleware(t *testing.T) {
+	before := httpRequests.Get("418")
+	handler := MetricsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	assert.Nil(t, before)
+	assert.Equal(t, "1", httpRequests.Get("418").String())
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/codeselim/go-webservice-places-provider/api"
+	"github.com/codeselim/go-webservice-places-provider/config"
+	"github.com/codeselim/go-webservice-places-provider/providers"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+/**
+ * Area searches: the places are searched in a bounding box (bbox query parameter, e.g. a map viewport) or in a
+ * GeoJSON Polygon POSTed as the request body, the other search parameters staying in the query string.
+ */
+
+const bboxQueryParam = "bbox"
+
+// geoJSONPolygon is a GeoJSON (RFC 7946) Polygon geometry: rings of [lng, lat] positions
+type geoJSONPolygon struct {
+	Type        string        `json:"type"`
+	Coordinates [][][]float64 `json:"coordinates"`
+}
+
+// getArea returns the area of the request: the polygon of a POST, else the bounding box. Nil without area
+func getArea(r *http.Request) (*providers.Area, error) {
+	bbox := r.URL.Query().Get(bboxQueryParam)
+	if r.Method == http.MethodPost {
+		if bbox != "" {
+			return nil, newBadRequestError(r, api.BBoxParamMalformedErrorCode)
+		}
+		return parsePolygon(r)
+	}
+	if bbox == "" {
+		return nil, nil
+	}
+	return parseBBox(r, bbox)
+}
+
+// parseBBox reads a minLng,minLat,maxLng,maxLat bounding box
+func parseBBox(r *http.Request, bbox string) (*providers.Area, error) {
+	fields := strings.Split(bbox, ",")
+	if len(fields) != 4 {
+		return nil, newBadRequestError(r, api.BBoxParamMalformedErrorCode)
+	}
+	bounds := make([]float64, 0, 4)
+	for _, field := range fields {
+		bound, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return nil, newBadRequestError(r, api.BBoxParamMalformedErrorCode)
+		}
+		bounds = append(bounds, bound)
+	}
+	minLng, minLat, maxLng, maxLat := bounds[0], bounds[1], bounds[2], bounds[3]
+	if !validPosition(minLng, minLat) || !validPosition(maxLng, maxLat) || minLng >= maxLng || minLat >= maxLat {
+		return nil, newBadRequestError(r, api.BBoxParamMalformedErrorCode)
+	}
+	return providers.NewBoundingBox(minLng, minLat, maxLng, maxLat), nil
+}
+
+// parsePolygon reads the GeoJSON Polygon of the request body, its rings have to be closed
+func parsePolygon(r *http.Request) (*providers.Area, error) {
+	polygon := geoJSONPolygon{}
+	body := http.MaxBytesReader(nil, r.Body, config.MaxPolygonRequestBytes)
+	if err := json.NewDecoder(body).Decode(&polygon); err != nil || polygon.Type != "Polygon" || len(polygon.Coordinates) == 0 {
+		return nil, newBadRequestError(r, api.MalformedPolygonErrorCode)
+	}
+	area := &providers.Area{}
+	vertices := 0
+	for _, ring := range polygon.Coordinates {
+		vertices += len(ring)
+		if len(ring) < 4 || vertices > config.MaxPolygonVertices {
+			return nil, newBadRequestError(r, api.MalformedPolygonErrorCode)
+		}
+		locations := make([]providers.Location, 0, len(ring))
+		for _, position := range ring {
+			if len(position) < 2 || !validPosition(position[0], position[1]) {
+				return nil, newBadRequestError(r, api.MalformedPolygonErrorCode)
+			}
+			locations = append(locations, providers.Location{Lat: position[1], Lng: position[0]})
+		}
+		if locations[0] != locations[len(locations)-1] {
+			return nil, newBadRequestError(r, api.MalformedPolygonErrorCode)
+		}
+		area.Rings = append(area.Rings, locations)
+	}
+	return area, nil
+}
+
+func validPosition(lng float64, lat float64) bool {
+	return lng >= -180 && lng <= 180 && lat >= -90 && lat <= 90
+}
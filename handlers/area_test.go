@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/codeselim/go-webservice-places-provider/api"
+	"github.com/codeselim/go-webservice-places-provider/providers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var areaPlaces = api.Places{
+	{ID: "in", Provider: "foursquare-provider-label", Location: &api.Location{Lat: 53.55, Lng: 10}},
+	{ID: "out", Provider: "foursquare-provider-label", Location: &api.Location{Lat: 52.5, Lng: 13.4}},
+	{ID: "unlocated", Provider: "foursquare-provider-label"},
+}
+
+func getPlaceIDs(t *testing.T, rr *httptest.ResponseRecorder) []string {
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	places := api.Places{}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &places))
+	ids := []string{}
+	for _, place := range places {
+		ids = append(ids, place.ID)
+	}
+	return ids
+}
+
+func TestPlacesHandlerGetPlacesBBox(t *testing.T) {
+	foursquareProvider := new(mockFourSquarePlacesProvider)
+	foursquareProvider.On("GetPlacesByQuery", mock.Anything, mock.Anything).Return(areaPlaces, nil)
+	placesHandler := NewPlacesHandler(foursquareProvider)
+
+	rr := httptest.NewRecorder()
+	placesHandler.GetPlaces(rr, httptest.NewRequest("GET", "/api/v1/places?text=pizza&bbox=9.9,53.5,10.1,53.6", nil))
+	assert.Equal(t, []string{"in"}, getPlaceIDs(t, rr))
+
+	// the providers searching around a location get the center of the area
+	request := foursquareProvider.Calls[0].Arguments.Get(1).(providers.PlaceSearchRequest)
+	require.NotNil(t, request.Area)
+	require.NotNil(t, request.Location)
+	assert.InDelta(t, 53.55, request.Location.Lat, 1e-9)
+	assert.InDelta(t, 10.0, request.Location.Lng, 1e-9)
+
+	// the area satisfies the nearby location
+	rr = httptest.NewRecorder()
+	placesHandler.GetPlaces(rr, httptest.NewRequest("GET", "/api/v1/places?mode=nearby&bbox=9.9,53.5,10.1,53.6", nil))
+	assert.Equal(t, []string{"in"}, getPlaceIDs(t, rr))
+
+	for _, bbox := range []string{"9.9,53.5,10.1", "9.9,53.5,10.1,north", "10.1,53.5,9.9,53.6", "9.9,53.6,10.1,53.5", "9.9,53.5,190,53.6"} {
+		rr = httptest.NewRecorder()
+		placesHandler.GetPlaces(rr, httptest.NewRequest("GET", "/api/v1/places?text=pizza&bbox="+bbox, nil))
+		assert.Equal(t, http.StatusBadRequest, rr.Code, bbox)
+		assert.Contains(t, rr.Body.String(), `"code":`+strconv.Itoa(api.BBoxParamMalformedErrorCode), bbox)
+	}
+}
+
+func TestPlacesHandlerPostPlacesPolygon(t *testing.T) {
+	foursquareProvider := new(mockFourSquarePlacesProvider)
+	foursquareProvider.On("GetPlacesByQuery", mock.Anything, mock.Anything).Return(areaPlaces, nil)
+	placesHandler := NewPlacesHandler(foursquareProvider)
+
+	polygon := `{"type": "Polygon", "coordinates": [[[9.9, 53.5], [10.1, 53.5], [10.1, 53.58], [9.9, 53.5]]]}`
+	rr := httptest.NewRecorder()
+	placesHandler.GetPlaces(rr, httptest.NewRequest("POST", "/api/v1/places?text=pizza", strings.NewReader(polygon)))
+	assert.Empty(t, getPlaceIDs(t, rr), "in the bounds, out of the triangle")
+
+	polygon = `{"type": "Polygon", "coordinates": [[[9.9, 53.5], [10.1, 53.5], [10.1, 53.6], [9.9, 53.6], [9.9, 53.5]]]}`
+	rr = httptest.NewRecorder()
+	placesHandler.GetPlaces(rr, httptest.NewRequest("POST", "/api/v1/places?text=pizza", strings.NewReader(polygon)))
+	assert.Equal(t, []string{"in"}, getPlaceIDs(t, rr))
+
+	tests := []struct {
+		query string
+		body  string
+		code  int
+	}{
+		{"text=pizza", `{"type": "Point", "coordinates": [9.9, 53.5]}`, api.MalformedPolygonErrorCode},
+		{"text=pizza", `{"type": "Polygon", "coordinates": []}`, api.MalformedPolygonErrorCode},
+		{"text=pizza", `{"type": "Polygon", "coordinates": [[[9.9, 53.5], [10.1, 53.5], [9.9, 53.5]]]}`, api.MalformedPolygonErrorCode},
+		{"text=pizza", `{"type": "Polygon", "coordinates": [[[9.9, 53.5], [10.1, 53.5], [10.1, 53.6], [9.9, 53.6]]]}`, api.MalformedPolygonErrorCode},
+		{"text=pizza", `{"type": "Polygon", "coordinates": [[[9.9, 53.5], [10.1, 95], [10.1, 53.6], [9.9, 53.5]]]}`, api.MalformedPolygonErrorCode},
+		{"text=pizza", `not json`, api.MalformedPolygonErrorCode},
+		{"text=pizza&bbox=9.9,53.5,10.1,53.6", polygon, api.BBoxParamMalformedErrorCode},
+	}
+	for _, test := range tests {
+		rr = httptest.NewRecorder()
+		placesHandler.GetPlaces(rr, httptest.NewRequest("POST", "/api/v1/places?"+test.query, strings.NewReader(test.body)))
+		assert.Equal(t, http.StatusBadRequest, rr.Code, test.body)
+		assert.Contains(t, rr.Body.String(), `"code":`+strconv.Itoa(test.code), test.body)
+	}
+}
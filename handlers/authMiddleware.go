@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"github.com/codeselim/go-webservice-places-provider/api"
+	"github.com/codeselim/go-webservice-places-provider/auth"
+	"github.com/codeselim/go-webservice-places-provider/log"
+	"math"
+	"net/http"
+	"strings"
+)
+
+const (
+	apiKeyHeader       = "X-API-Key"
+	apiKeyQueryParam   = "api_key"
+	bearerPrefix       = "Bearer "
+	authenticateHeader = "WWW-Authenticate"
+
+	// OAuth2 scopes gating the endpoints
+	ScopePlacesSearch  = "places:search"
+	ScopePlacesDetails = "places:details" // the details of a place, a billed call for most of the providers
+)
+
+// AuthConfig holds the accepted credentials. At least one of them should be configured
+type AuthConfig struct {
+	APIKeys *auth.APIKeyStore // API keys, their quotas also apply to token clients with the same id
+	JWT     *auth.JWTVerifier // OAuth2/OIDC JWT bearer tokens
+}
+
+// Credentials are the credentials presented by a caller, whatever its transport (http headers, gRPC metadata)
+type Credentials struct {
+	BearerToken string
+	APIKey      string
+	Origin      string // browser origin, checked against the API key allowed origins
+}
+
+// AuthMiddleware authenticates the clients with a JWT bearer token (Authorization header)
+// or an API key (header or query param), checks the key allowed origins and consumes the client quotas.
+// The authenticated principal is attached to the request context.
+func AuthMiddleware(authConfig AuthConfig) func(http.Handler) http.Handler {
+	if authConfig.APIKeys == nil && authConfig.JWT == nil {
+		log.GetLogger().Panic("API keys store or JWT verifier should be provided")
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			credentials := Credentials{Origin: r.Header.Get("Origin")}
+			if authorization := r.Header.Get("Authorization"); strings.HasPrefix(authorization, bearerPrefix) {
+				credentials.BearerToken = strings.TrimPrefix(authorization, bearerPrefix)
+			}
+			if credentials.APIKey = r.Header.Get(apiKeyHeader); credentials.APIKey == "" {
+				credentials.APIKey = r.URL.Query().Get(apiKeyQueryParam)
+			}
+
+			principal, apiError := Authenticate(r.Context(), authConfig, credentials)
+			if apiError != nil {
+				switch apiError.Code {
+				case api.MissingBearerTokenErrorCode:
+					w.Header().Set(authenticateHeader, "Bearer")
+				case api.InvalidBearerTokenErrorCode:
+					w.Header().Set(authenticateHeader, `Bearer error="invalid_token"`)
+				}
+				HandleError(apiError, w, r)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+		})
+	}
+}
+
+// Authenticate authenticates a caller and consumes its quotas: a bearer token wins over an API key
+func Authenticate(ctx context.Context, authConfig AuthConfig, credentials Credentials) (*auth.Principal, *api.Error) {
+	var principal *auth.Principal
+	var apiError *api.Error
+	if authConfig.JWT != nil && credentials.BearerToken != "" {
+		principal, apiError = authenticateBearerToken(ctx, authConfig.JWT, credentials.BearerToken)
+	} else if authConfig.APIKeys != nil {
+		principal, apiError = authenticateAPIKey(ctx, authConfig.APIKeys, credentials)
+	} else {
+		apiError = newAuthError(ctx, http.StatusUnauthorized, api.AuthenticationErrorType, api.MissingBearerTokenErrorCode)
+	}
+	if apiError != nil {
+		return nil, apiError
+	}
+
+	if authConfig.APIKeys != nil {
+		if allowed, retryAfter := authConfig.APIKeys.Allow(principal.ClientID); !allowed {
+			apiError := newAuthError(ctx, http.StatusTooManyRequests, api.QuotaExceededErrorType, api.QuotaExceededErrorCode)
+			apiError.RetryAfter = int(math.Ceil(retryAfter.Seconds()))
+			return nil, apiError
+		}
+	}
+	return principal, nil
+}
+
+func authenticateAPIKey(ctx context.Context, store *auth.APIKeyStore, credentials Credentials) (*auth.Principal, *api.Error) {
+	if credentials.APIKey == "" {
+		return nil, newAuthError(ctx, http.StatusUnauthorized, api.AuthenticationErrorType, api.MissingAPIKeyErrorCode)
+	}
+
+	key, ok := store.Authenticate(credentials.APIKey)
+	if !ok {
+		return nil, newAuthError(ctx, http.StatusUnauthorized, api.AuthenticationErrorType, api.InvalidAPIKeyErrorCode)
+	}
+	if !key.IsOriginAllowed(credentials.Origin) {
+		return nil, newAuthError(ctx, http.StatusForbidden, api.AuthorizationErrorType, api.OriginNotAllowedErrorCode)
+	}
+	return &auth.Principal{
+		ClientID:         key.ID,
+		AllowedProviders: key.AllowedProviders,
+	}, nil
+}
+
+func authenticateBearerToken(ctx context.Context, verifier *auth.JWTVerifier, token string) (*auth.Principal, *api.Error) {
+	claims, err := verifier.Verify(ctx, token)
+	if err != nil {
+		log.GetLoggerWithContext(ctx).Warn("Bearer token rejected: " + err.Error())
+		return nil, newAuthError(ctx, http.StatusUnauthorized, api.AuthenticationErrorType, api.InvalidBearerTokenErrorCode)
+	}
+	return &auth.Principal{
+		ClientID: claims.Client(),
+		Subject:  claims.Subject,
+		Scoped:   true,
+		Scopes:   claims.Scopes(),
+	}, nil
+}
+
+// RequireScope gates an endpoint behind an OAuth2 scope. Only token authenticated principals are scoped
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if apiError := CheckScope(r.Context(), scope); apiError != nil {
+				w.Header().Set(authenticateHeader, fmt.Sprintf(`Bearer error="insufficient_scope", scope="%s"`, scope))
+				HandleError(apiError, w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// CheckScope rejects the scoped principals lacking the scope, the callers without principal are not gated
+func CheckScope(ctx context.Context, scope string) *api.Error {
+	if principal, ok := auth.PrincipalFromContext(ctx); ok && !principal.HasScope(scope) {
+		return newAuthError(ctx, http.StatusForbidden, api.AuthorizationErrorType, api.InsufficientScopeErrorCode)
+	}
+	return nil
+}
+
+func newAuthError(ctx context.Context, statusCode int, errorType string, code int) *api.Error {
+	return &api.Error{
+		StatusCode: statusCode,
+		Type:       errorType,
+		Code:       code,
+		Message:    api.ErrorMessageText[code],
+		TraceId:    GetRequestID(ctx),
+	}
+}
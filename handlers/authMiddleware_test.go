@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/codeselim/go-webservice-places-provider/api"
+	"github.com/codeselim/go-webservice-places-provider/auth"
+	"github.com/codeselim/go-webservice-places-provider/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func newTestAPIKeyStore(t *testing.T) *auth.APIKeyStore {
+	store, err := auth.NewAPIKeyStore([]auth.APIKey{
+		{ID: "web-app", SecretHash: auth.HashSecret("web-secret"), AllowedOrigins: []string{"https://app.example.com"}, QuotaPerMinute: 1},
+		{ID: "google-only", SecretHash: auth.HashSecret("google-secret"), AllowedProviders: []string{"google-provider-label"}},
+		{ID: "nothing-allowed", SecretHash: auth.HashSecret("other-secret"), AllowedProviders: []string{"OTHER"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func assertAPIError(t *testing.T, rr *httptest.ResponseRecorder, statusCode int, code int) {
+	assert.Equal(t, statusCode, rr.Code)
+	apiError := api.Error{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &apiError); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, code, apiError.Code)
+}
+
+func TestUnitAPIKeyAuthMiddleware(t *testing.T) {
+	store := newTestAPIKeyStore(t)
+	var principal *auth.Principal
+	handler := AuthMiddleware(AuthConfig{APIKeys: store})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ = auth.PrincipalFromContext(r.Context())
+	}))
+
+	// missing key
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/places?text=vegan", nil))
+	assertAPIError(t, rr, http.StatusUnauthorized, api.MissingAPIKeyErrorCode)
+
+	// unknown key
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/places?text=vegan&api_key=guess", nil))
+	assertAPIError(t, rr, http.StatusUnauthorized, api.InvalidAPIKeyErrorCode)
+
+	// origin not allowed
+	req := httptest.NewRequest("GET", "/api/v1/places?text=vegan", nil)
+	req.Header.Set("X-API-Key", "web-secret")
+	req.Header.Set("Origin", "https://evil.example.com")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assertAPIError(t, rr, http.StatusForbidden, api.OriginNotAllowedErrorCode)
+
+	// authenticated with the header
+	req = httptest.NewRequest("GET", "/api/v1/places?text=vegan", nil)
+	req.Header.Set("X-API-Key", "web-secret")
+	req.Header.Set("Origin", "https://app.example.com")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "web-app", principal.ClientID)
+
+	// quota of 1 per minute exhausted
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/places?text=vegan&api_key=web-secret", nil))
+	assertAPIError(t, rr, http.StatusTooManyRequests, api.QuotaExceededErrorCode)
+	assert.Equal(t, "60", rr.Header().Get("Retry-After"))
+}
+
+func TestUnitPlacesHandlerFiltersProvidersOfTheClient(t *testing.T) {
+	store := newTestAPIKeyStore(t)
+	googlePlacesProvider := new(mockGooglePlacesProvider)
+	foursquarePlacesProvider := new(mockFourSquarePlacesProvider)
+	googlePlacesProvider.On("GetPlacesByQuery", mock.Anything, mock.Anything).Return(api.Places{apiPlaceFromGoogle}, nil)
+	foursquarePlacesProvider.On("GetPlacesByQuery", mock.Anything, mock.Anything).Return(api.Places{apiPlaceFromFoursquare}, nil)
+	placesHandler := NewPlacesHandler(googlePlacesProvider, foursquarePlacesProvider)
+	handler := AuthMiddleware(AuthConfig{APIKeys: store})(http.HandlerFunc(placesHandler.GetPlaces))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/places?text=vegan&api_key=google-secret", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	actualPlaces := api.Places{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &actualPlaces); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, api.Places{apiPlaceFromGoogle}, actualPlaces)
+	foursquarePlacesProvider.AssertNotCalled(t, "GetPlacesByQuery", mock.Anything, mock.Anything)
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/places?text=vegan&api_key=other-secret", nil))
+	assertAPIError(t, rr, http.StatusForbidden, api.ProviderNotAllowedErrorCode)
+}
+
+func TestUnitRedactedRequestURI(t *testing.T) {
+	assert.Equal(t, "/api/v1/places?text=vegan", redactedRequestURI(httptest.NewRequest("GET", "/api/v1/places?text=vegan", nil)))
+	assert.Equal(t, "/api/v1/places?api_key=%3Credacted%3E&text=vegan", redactedRequestURI(httptest.NewRequest("GET", "/api/v1/places?text=vegan&api_key=web-secret", nil)))
+}
+
+// ES256 key generated at test time, published in a local JWKS file
+func newTestJWTVerifier(t *testing.T) (*auth.JWTVerifier, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := ioutil.TempFile("", "jwks-*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString(`{"keys":[{"kty":"EC","kid":"test-key","crv":"P-256","x":"` +
+		base64.RawURLEncoding.EncodeToString(key.X.Bytes()) + `","y":"` +
+		base64.RawURLEncoding.EncodeToString(key.Y.Bytes()) + `"}]}`)
+	file.Close()
+
+	jwks, err := auth.NewJWKSFromFile(file.Name(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := auth.NewJWTVerifier(auth.JWTConfig{Issuer: "https://issuer.example.com", Audience: "places-api"}, jwks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return verifier, key
+}
+
+func signTestToken(t *testing.T, key *ecdsa.PrivateKey, scope string) string {
+	header, _ := json.Marshal(map[string]string{"alg": "ES256", "kid": "test-key"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":       "https://issuer.example.com",
+		"aud":       "places-api",
+		"sub":       "user-42",
+		"client_id": "mobile-app",
+		"scope":     scope,
+		"exp":       time.Now().Add(time.Hour).Unix(),
+	})
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestUnitAuthMiddlewareBearerToken(t *testing.T) {
+	verifier, key := newTestJWTVerifier(t)
+	var principal *auth.Principal
+	var requestCtx context.Context
+	handler := AuthMiddleware(AuthConfig{JWT: verifier})(RequireScope(ScopePlacesSearch)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ = auth.PrincipalFromContext(r.Context())
+		requestCtx = r.Context()
+	})))
+
+	serve := func(authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/v1/places?text=vegan", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := serve("")
+	assertAPIError(t, rr, http.StatusUnauthorized, api.MissingBearerTokenErrorCode)
+	assert.Equal(t, "Bearer", rr.Header().Get("WWW-Authenticate"))
+
+	rr = serve("Bearer " + signTestToken(t, key, "places:search")[1:])
+	assertAPIError(t, rr, http.StatusUnauthorized, api.InvalidBearerTokenErrorCode)
+	assert.Equal(t, `Bearer error="invalid_token"`, rr.Header().Get("WWW-Authenticate"))
+
+	rr = serve("Bearer " + signTestToken(t, key, "openid"))
+	assertAPIError(t, rr, http.StatusForbidden, api.InsufficientScopeErrorCode)
+	assert.Equal(t, `Bearer error="insufficient_scope", scope="places:search"`, rr.Header().Get("WWW-Authenticate"))
+
+	rr = serve("Bearer " + signTestToken(t, key, "openid places:search"))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "user-42", principal.Subject)
+	assert.Equal(t, "mobile-app", principal.ClientID)
+	// subject and client id travel alongside the request id
+	assert.Equal(t, "user-42", requestCtx.Value(config.ContextKeySubject))
+	assert.Equal(t, "mobile-app", requestCtx.Value(config.ContextKeyClientID))
+}
+
+func TestUnitAuthMiddlewareBearerTokenQuota(t *testing.T) {
+	verifier, key := newTestJWTVerifier(t)
+	// the token client quota is configured with the API keys
+	store, _ := auth.NewAPIKeyStore([]auth.APIKey{{ID: "mobile-app", SecretHash: auth.HashSecret("mobile-secret"), QuotaPerMinute: 1}})
+	handler := AuthMiddleware(AuthConfig{APIKeys: store, JWT: verifier})(http.HandlerFunc(dummyHandler))
+	token := signTestToken(t, key, "places:search")
+
+	for _, expectedStatus := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		req := httptest.NewRequest("GET", "/api/v1/places?text=vegan", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, expectedStatus, rr.Code)
+	}
+}
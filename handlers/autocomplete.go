@@ -0,0 +1,347 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/codeselim/go-webservice-places-provider/api"
+	"github.com/codeselim/go-webservice-places-provider/auth"
+	"github.com/codeselim/go-webservice-places-provider/config"
+	"github.com/codeselim/go-webservice-places-provider/log"
+	"github.com/codeselim/go-webservice-places-provider/providers"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"golang.org/x/time/rate"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+/**
+ * Websocket autocomplete sessions, for the typing-driven clients: the client sends its successive queries
+ * ({"text", "lat", "lng"}) on a single connection instead of a request per keystroke.
+ * A query is searched once the client stopped typing for the debounce duration, a new query cancels the provider
+ * calls of the previous one, and the results are tagged with the sequence number of their query.
+ * The queries of a connection share an autocomplete session (the session param or header of the upgrade request,
+ * else a generated one), so the providers bill them as a single session.
+ * Each search charges the API key quotas of the client, as a request would. On shutdown, the sessions are closed
+ * with a 1001 (going away): the http server doesn't drain the hijacked connections.
+ */
+
+type AutocompleteConfig struct {
+	AllowedOrigins []string          // browser origins allowed to connect, "*" for any. Clients without Origin are always allowed
+	Debounce       time.Duration     // defaults to config.DefaultAutocompleteDebounce
+	IdleTimeout    time.Duration     // defaults to config.DefaultAutocompleteIdleTimeout
+	Rate           float64           // queries per second and connection, defaults to config.DefaultAutocompleteRate
+	Burst          int               // defaults to config.DefaultAutocompleteBurst
+	APIKeys        *auth.APIKeyStore // the quotas charged by the searches, nil: none
+}
+
+type AutocompleteHandler struct {
+	placesHandler *PlacesHandler
+	config        AutocompleteConfig
+	upgrader      websocket.Upgrader
+
+	shuttingDown chan struct{} // closed on shutdown, the sessions then close their connections
+	shutdownOnce sync.Once
+	sessionsMu   sync.Mutex // guards sessions
+	sessions     map[*autocompleteSession]struct{}
+}
+
+func NewAutocompleteHandler(placesHandler *PlacesHandler, autocompleteConfig AutocompleteConfig) *AutocompleteHandler {
+	if placesHandler == nil {
+		log.GetLogger().Panic("places handler should be provided")
+	}
+	if autocompleteConfig.Debounce <= 0 {
+		autocompleteConfig.Debounce = config.DefaultAutocompleteDebounce
+	}
+	if autocompleteConfig.IdleTimeout <= 0 {
+		autocompleteConfig.IdleTimeout = config.DefaultAutocompleteIdleTimeout
+	}
+	if autocompleteConfig.Rate <= 0 {
+		autocompleteConfig.Rate = config.DefaultAutocompleteRate
+	}
+	if autocompleteConfig.Burst <= 0 {
+		autocompleteConfig.Burst = config.DefaultAutocompleteBurst
+	}
+	a := &AutocompleteHandler{
+		placesHandler: placesHandler,
+		config:        autocompleteConfig,
+		shuttingDown:  make(chan struct{}),
+		sessions:      map[*autocompleteSession]struct{}{},
+	}
+	a.upgrader = websocket.Upgrader{CheckOrigin: a.checkOrigin}
+	return a
+}
+
+// ServeHTTP upgrades the connection and runs the session until the client leaves or stays idle
+func (a *AutocompleteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	placesProviders, err := a.placesHandler.AllowedProviders(r.Context())
+	if err != nil {
+		HandleError(err, w, r)
+		return
+	}
+	sessionID, err := getSessionID(r)
+	if err != nil {
+		HandleError(err, w, r)
+		return
+	}
+	if sessionID == "" {
+		sessionID = uuid.New().String()
+	}
+	conn, err := a.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return // the upgrader answered with the http error
+	}
+
+	session := &autocompleteSession{
+		handler:         a,
+		conn:            conn,
+		placesProviders: placesProviders,
+		sessionID:       sessionID,
+		limiter:         rate.NewLimiter(rate.Limit(a.config.Rate), a.config.Burst),
+		ended:           make(chan struct{}),
+	}
+	a.sessionsMu.Lock()
+	a.sessions[session] = struct{}{}
+	a.sessionsMu.Unlock()
+	defer func() {
+		a.sessionsMu.Lock()
+		delete(a.sessions, session)
+		a.sessionsMu.Unlock()
+		close(session.ended)
+	}()
+
+	logger := log.GetLoggerWithContext(r.Context())
+	logger.Info("Autocomplete session started")
+	session.run(r.Context())
+	logger.Info("Autocomplete session ended")
+}
+
+// Shutdown closes the sessions with a 1001 (going away) and waits for them to end, at most until ctx is done.
+// The sessions opened afterwards are closed right away
+func (a *AutocompleteHandler) Shutdown(ctx context.Context) {
+	a.shutdownOnce.Do(func() { close(a.shuttingDown) })
+	a.sessionsMu.Lock()
+	sessions := make([]*autocompleteSession, 0, len(a.sessions))
+	for session := range a.sessions {
+		sessions = append(sessions, session)
+	}
+	a.sessionsMu.Unlock()
+
+	for _, session := range sessions {
+		select {
+		case <-session.ended:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// browsers send their Origin with the upgrade request, the CORS headers don't apply to websockets
+func (a *AutocompleteHandler) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, pattern := range a.config.AllowedOrigins {
+		if auth.MatchOrigin(pattern, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+type autocompleteSession struct {
+	handler         *AutocompleteHandler
+	conn            *websocket.Conn
+	placesProviders []providers.Provider
+	sessionID       string
+	limiter         *rate.Limiter
+	ended           chan struct{} // closed once the connection is closed
+
+	writeMu sync.Mutex // a websocket supports a single writer
+
+	seq int
+}
+
+// a query read from the connection, or the error to answer it with
+type autocompleteMessage struct {
+	request providers.PlaceSearchRequest
+	err     *api.Error
+}
+
+type pendingSearch struct {
+	seq     int
+	request providers.PlaceSearchRequest
+}
+
+func (s *autocompleteSession) run(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	var searches sync.WaitGroup
+	cancelSearch := func() {}
+	defer func() {
+		cancel()
+		searches.Wait()
+		s.conn.Close()
+	}()
+
+	messages := make(chan autocompleteMessage)
+	go s.readMessages(ctx, messages)
+
+	idle := time.NewTimer(s.handler.config.IdleTimeout)
+	defer idle.Stop()
+	debounce := time.NewTimer(time.Hour)
+	debounce.Stop()
+	defer debounce.Stop()
+	var pending *pendingSearch
+
+	for {
+		select {
+		case message, ok := <-messages:
+			if !ok {
+				return // the client is gone
+			}
+			resetTimer(idle, s.handler.config.IdleTimeout)
+			s.seq++
+			if message.err != nil {
+				s.send(api.AutocompleteResult{Seq: s.seq, Error: message.err})
+				continue
+			}
+			if reservation := s.limiter.Reserve(); reservation.Delay() > 0 {
+				reservation.Cancel()
+				s.sendQuotaError(ctx, s.seq, time.Duration(float64(time.Second)/s.handler.config.Rate))
+				continue
+			}
+			// the previous query is superseded, its results are never sent
+			cancelSearch()
+			pending = &pendingSearch{seq: s.seq, request: message.request}
+			resetTimer(debounce, s.handler.config.Debounce)
+
+		case <-debounce.C:
+			if pending == nil {
+				continue
+			}
+			// a search costs provider calls: it is charged to the client quotas
+			if allowed, retryAfter := s.allow(ctx); !allowed {
+				s.sendQuotaError(ctx, pending.seq, retryAfter)
+				pending = nil
+				continue
+			}
+			searchCtx, cancelSearchCtx := context.WithCancel(ctx)
+			cancelSearch = cancelSearchCtx
+			searches.Add(1)
+			go func(search *pendingSearch) {
+				defer searches.Done()
+				s.search(searchCtx, search)
+			}(pending)
+			pending = nil
+
+		case <-idle.C:
+			s.close(websocket.CloseNormalClosure, "idle timeout")
+			return
+
+		case <-s.handler.shuttingDown:
+			s.close(websocket.CloseGoingAway, "server shutting down")
+			return
+
+		case <-ctx.Done():
+			// the server cancelled the requests, its grace period is over
+			s.close(websocket.CloseGoingAway, "server shutting down")
+			return
+		}
+	}
+}
+
+func (s *autocompleteSession) readMessages(ctx context.Context, messages chan<- autocompleteMessage) {
+	defer close(messages)
+	s.conn.SetReadLimit(config.MaxAutocompleteMessageBytes)
+	for {
+		_, data, err := s.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		select {
+		case messages <- s.parseMessage(ctx, data):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *autocompleteSession) parseMessage(ctx context.Context, data []byte) autocompleteMessage {
+	query := api.AutocompleteQuery{}
+	if err := json.Unmarshal(data, &query); err != nil {
+		return autocompleteMessage{err: newBadRequestErrorWithContext(ctx, api.MalformedMessageErrorCode)}
+	}
+	if query.Text == "" {
+		return autocompleteMessage{err: newBadRequestErrorWithContext(ctx, api.TextInputParamIsMissingErrorCode)}
+	}
+	request := providers.PlaceSearchRequest{InputString: query.Text, SessionID: s.sessionID}
+	if (query.Lat == nil) != (query.Lng == nil) {
+		return autocompleteMessage{err: newBadRequestErrorWithContext(ctx, api.LatLngParamMalformedErrorCode)}
+	}
+	if query.Lat != nil {
+		request.Location = &providers.Location{Lat: *query.Lat, Lng: *query.Lng}
+	}
+	return autocompleteMessage{request: request}
+}
+
+func (s *autocompleteSession) search(ctx context.Context, search *pendingSearch) {
+	places, complete, err := s.handler.placesHandler.SearchPlaces(ctx, s.placesProviders, search.request)
+	if ctx.Err() != nil {
+		return // superseded or the client is gone
+	}
+	result := api.AutocompleteResult{Seq: search.seq, Places: places, Complete: complete}
+	if err != nil {
+		result = api.AutocompleteResult{Seq: search.seq, Error: ToAPIError(ctx, err)}
+	}
+	s.send(result)
+}
+
+// allow consumes a search from the API key quotas of the client, clients without key have none
+func (s *autocompleteSession) allow(ctx context.Context) (bool, time.Duration) {
+	principal, ok := auth.PrincipalFromContext(ctx)
+	if s.handler.config.APIKeys == nil || !ok {
+		return true, 0
+	}
+	return s.handler.config.APIKeys.Allow(principal.ClientID)
+}
+
+func (s *autocompleteSession) sendQuotaError(ctx context.Context, seq int, retryAfter time.Duration) {
+	quotaError := &api.Error{
+		StatusCode: http.StatusTooManyRequests,
+		TraceId:    GetRequestID(ctx),
+		Type:       api.QuotaExceededErrorType,
+		Code:       api.QuotaExceededErrorCode,
+		Message:    api.ErrorMessageText[api.QuotaExceededErrorCode],
+		RetryAfter: int(math.Ceil(retryAfter.Seconds())),
+	}
+	s.send(api.AutocompleteResult{Seq: seq, Error: quotaError, RetryAfter: quotaError.RetryAfter})
+}
+
+func (s *autocompleteSession) send(result api.AutocompleteResult) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.conn.SetWriteDeadline(time.Now().Add(config.AutocompleteWriteTimeout))
+	if err := s.conn.WriteJSON(result); err != nil {
+		log.GetLogger().Debug("Couldn't send the autocomplete result: " + err.Error())
+	}
+}
+
+func (s *autocompleteSession) close(code int, reason string) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(config.AutocompleteWriteTimeout))
+}
+
+// resetTimer restarts a timer, whether it fired or not
+func resetTimer(timer *time.Timer, duration time.Duration) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+	timer.Reset(duration)
+}
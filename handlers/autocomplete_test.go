@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"context"
+	"github.com/codeselim/go-webservice-places-provider/api"
+	"github.com/codeselim/go-webservice-places-provider/auth"
+	"github.com/codeselim/go-webservice-places-provider/providers"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// a google provider recording its requests, answering once released (or right away when release is nil)
+func newAutocompleteTestServer(t *testing.T, autocompleteConfig AutocompleteConfig, release chan struct{}) (*httptest.Server, chan providers.PlaceSearchRequest, chan error) {
+	requests := make(chan providers.PlaceSearchRequest, 10)
+	done := make(chan error, 10)
+	googleProvider := new(mockGooglePlacesProvider)
+	googleProvider.On("GetPlacesByQuery", mock.Anything, mock.Anything).Return(api.Places{apiPlaceFromGoogle}, nil).Run(func(args mock.Arguments) {
+		ctx := args.Get(0).(context.Context)
+		requests <- args.Get(1).(providers.PlaceSearchRequest)
+		if release == nil {
+			done <- nil
+			return
+		}
+		select {
+		case <-release:
+			done <- nil
+		case <-ctx.Done():
+			done <- ctx.Err()
+		}
+	})
+	placesHandler := NewPlacesHandler(googleProvider)
+
+	server := httptest.NewServer(NewAutocompleteHandler(&placesHandler, autocompleteConfig))
+	t.Cleanup(server.Close)
+	return server, requests, done
+}
+
+func dialAutocomplete(t *testing.T, server *httptest.Server, header http.Header) *websocket.Conn {
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), header)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func readAutocompleteResult(t *testing.T, conn *websocket.Conn) api.AutocompleteResult {
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	result := api.AutocompleteResult{}
+	require.NoError(t, conn.ReadJSON(&result))
+	return result
+}
+
+func TestAutocompleteResultsAndSessionToken(t *testing.T) {
+	server, requests, _ := newAutocompleteTestServer(t, AutocompleteConfig{Debounce: time.Millisecond}, nil)
+	conn := dialAutocomplete(t, server, nil)
+
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(`{"text": "cof", "lat": 48.85, "lng": 2.35}`)))
+	result := readAutocompleteResult(t, conn)
+	assert.Equal(t, 1, result.Seq)
+	assert.True(t, result.Complete)
+	assert.Nil(t, result.Error)
+	assert.Equal(t, api.Places{apiPlaceFromGoogle}, result.Places)
+	first := <-requests
+	assert.Equal(t, "cof", first.InputString)
+	assert.Equal(t, &providers.Location{Lat: 48.85, Lng: 2.35}, first.Location)
+	assert.NotEmpty(t, first.SessionID)
+
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(`{"text": "coffee"}`)))
+	result = readAutocompleteResult(t, conn)
+	assert.Equal(t, 2, result.Seq)
+	// the keystrokes of a connection are billed as a single session
+	second := <-requests
+	assert.Equal(t, first.SessionID, second.SessionID)
+}
+
+func TestAutocompleteDebounce(t *testing.T) {
+	server, requests, _ := newAutocompleteTestServer(t, AutocompleteConfig{Debounce: 200 * time.Millisecond}, nil)
+	conn := dialAutocomplete(t, server, nil)
+
+	for _, text := range []string{"c", "co", "cof"} {
+		require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(`{"text": "`+text+`"}`)))
+	}
+	result := readAutocompleteResult(t, conn)
+	assert.Equal(t, 3, result.Seq)
+	assert.Equal(t, "cof", (<-requests).InputString)
+	assert.Len(t, requests, 0)
+}
+
+func TestAutocompleteCancelsSupersededQuery(t *testing.T) {
+	release := make(chan struct{})
+	server, requests, done := newAutocompleteTestServer(t, AutocompleteConfig{Debounce: time.Millisecond}, release)
+	conn := dialAutocomplete(t, server, nil)
+
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(`{"text": "cof"}`)))
+	<-requests // the first search is in flight
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(`{"text": "coffee"}`)))
+	select {
+	case err := <-done:
+		assert.Equal(t, context.Canceled, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the superseded provider call wasn't cancelled")
+	}
+
+	<-requests
+	close(release)
+	// only the results of the last query are sent
+	result := readAutocompleteResult(t, conn)
+	assert.Equal(t, 2, result.Seq)
+	assert.Nil(t, result.Error)
+}
+
+func TestAutocompleteRateLimit(t *testing.T) {
+	server, _, _ := newAutocompleteTestServer(t, AutocompleteConfig{Debounce: time.Hour, Rate: 0.5, Burst: 1}, nil)
+	conn := dialAutocomplete(t, server, nil)
+
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(`{"text": "c"}`)))
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(`{"text": "co"}`)))
+	result := readAutocompleteResult(t, conn)
+	assert.Equal(t, 2, result.Seq)
+	require.NotNil(t, result.Error)
+	assert.Equal(t, api.QuotaExceededErrorCode, result.Error.Code)
+	assert.Equal(t, api.QuotaExceededErrorType, result.Error.Type)
+	assert.Equal(t, 2, result.RetryAfter)
+}
+
+func TestAutocompleteChargesAPIKeyQuota(t *testing.T) {
+	store, err := auth.NewAPIKeyStore([]auth.APIKey{{ID: "mobile-app", SecretHash: auth.HashSecret("mobile-secret"), QuotaPerMinute: 2}})
+	require.NoError(t, err)
+	googleProvider := new(mockGooglePlacesProvider)
+	googleProvider.On("GetPlacesByQuery", mock.Anything, mock.Anything).Return(api.Places{apiPlaceFromGoogle}, nil)
+	placesHandler := NewPlacesHandler(googleProvider)
+	server := httptest.NewServer(AuthMiddleware(AuthConfig{APIKeys: store})(NewAutocompleteHandler(&placesHandler, AutocompleteConfig{
+		Debounce: time.Millisecond,
+		APIKeys:  store,
+	})))
+	t.Cleanup(server.Close)
+	// the upgrade request consumes a first unit of the quota
+	conn := dialAutocomplete(t, server, http.Header{apiKeyHeader: {"mobile-secret"}})
+
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(`{"text": "cof"}`)))
+	result := readAutocompleteResult(t, conn)
+	assert.Equal(t, 1, result.Seq)
+	assert.Nil(t, result.Error)
+
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(`{"text": "coffee"}`)))
+	result = readAutocompleteResult(t, conn)
+	assert.Equal(t, 2, result.Seq)
+	require.NotNil(t, result.Error)
+	assert.Equal(t, api.QuotaExceededErrorCode, result.Error.Code)
+	assert.Equal(t, 30, result.RetryAfter)
+	googleProvider.AssertNumberOfCalls(t, "GetPlacesByQuery", 1)
+}
+
+func TestAutocompleteMalformedMessages(t *testing.T) {
+	server, _, _ := newAutocompleteTestServer(t, AutocompleteConfig{Debounce: time.Millisecond}, nil)
+	conn := dialAutocomplete(t, server, nil)
+
+	tests := []struct {
+		message string
+		code    int
+	}{
+		{`{"text": `, api.MalformedMessageErrorCode},
+		{`{"lat": 48.85, "lng": 2.35}`, api.TextInputParamIsMissingErrorCode},
+		{`{"text": "coffee", "lat": 48.85}`, api.LatLngParamMalformedErrorCode},
+	}
+	for i, test := range tests {
+		require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(test.message)))
+		result := readAutocompleteResult(t, conn)
+		assert.Equal(t, i+1, result.Seq)
+		require.NotNil(t, result.Error, test.message)
+		assert.Equal(t, test.code, result.Error.Code)
+	}
+}
+
+func TestAutocompleteIdleTimeout(t *testing.T) {
+	server, _, _ := newAutocompleteTestServer(t, AutocompleteConfig{IdleTimeout: 50 * time.Millisecond}, nil)
+	conn := dialAutocomplete(t, server, nil)
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, _, err := conn.ReadMessage()
+	closeErr, ok := err.(*websocket.CloseError)
+	require.True(t, ok, err)
+	assert.Equal(t, websocket.CloseNormalClosure, closeErr.Code)
+	assert.Equal(t, "idle timeout", closeErr.Text)
+}
+
+func TestAutocompleteShutdown(t *testing.T) {
+	googleProvider := new(mockGooglePlacesProvider)
+	placesHandler := NewPlacesHandler(googleProvider)
+	autocompleteHandler := NewAutocompleteHandler(&placesHandler, AutocompleteConfig{})
+	server := httptest.NewServer(autocompleteHandler)
+	t.Cleanup(server.Close)
+	conn := dialAutocomplete(t, server, nil)
+
+	// the session is registered once the upgrade is answered
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		autocompleteHandler.sessionsMu.Lock()
+		count := len(autocompleteHandler.sessions)
+		autocompleteHandler.sessionsMu.Unlock()
+		if count > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	autocompleteHandler.Shutdown(ctx)
+	assert.NoError(t, ctx.Err(), "the sessions ended")
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, _, err := conn.ReadMessage()
+	closeErr, ok := err.(*websocket.CloseError)
+	require.True(t, ok, err)
+	assert.Equal(t, websocket.CloseGoingAway, closeErr.Code)
+
+	// the sessions opened afterwards are closed right away
+	conn = dialAutocomplete(t, server, nil)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, _, err = conn.ReadMessage()
+	closeErr, ok = err.(*websocket.CloseError)
+	require.True(t, ok, err)
+	assert.Equal(t, websocket.CloseGoingAway, closeErr.Code)
+}
+
+func TestAutocompleteOrigins(t *testing.T) {
+	server, _, _ := newAutocompleteTestServer(t, AutocompleteConfig{AllowedOrigins: []string{"https://*.example.com"}}, nil)
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	_, resp, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {"https://evil.com"}})
+	require.Error(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {"https://app.example.com"}})
+	require.NoError(t, err)
+	conn.Close()
+}
@@ -0,0 +1,350 @@
+package handlers
+
+import (
+	"bufio"
+	"compress/gzip"
+	"github.com/andybalholm/brotli"
+	"github.com/codeselim/go-webservice-places-provider/log"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/**
+ * Accept-Encoding negotiated response compression (gzip, brotli and zstd).
+ * Responses are buffered until MinSize bytes are written: smaller responses are sent as is. A flush
+ * (streaming responses) starts the compression right away, whatever the size.
+ * The ETag of a compressed response gets the encoding as suffix ("<etag>-gzip"), a representation
+ * is then never confused with another one, and the suffix is removed from the If-None-Match of the
+ * requests so the handlers keep comparing their own ETags. A 304 gets the Vary and the ETag suffix
+ * of the 200 it validates.
+ */
+
+const (
+	encodingBrotli = "br"
+	encodingZstd   = "zstd"
+	encodingGzip   = "gzip"
+
+	brotliLevel = 4 // higher levels are too slow for dynamic responses
+)
+
+type CompressionConfig struct {
+	Encodings    []string // supported encodings by order of preference: br, zstd, gzip
+	MinSize      int      // responses smaller than this aren't compressed
+	ContentTypes []string // compressible media types, e.g. application/json or text/*
+}
+
+// common interface of the gzip, brotli and zstd writers
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+type compressionPolicy struct {
+	config CompressionConfig
+	pools  map[string]*sync.Pool // encoders are expensive to allocate, they are reused
+}
+
+// CompressMiddleware compresses the responses with the best encoding accepted by the client
+func CompressMiddleware(compressionConfig CompressionConfig) func(http.Handler) http.Handler {
+	policy := &compressionPolicy{
+		config: CompressionConfig{MinSize: compressionConfig.MinSize},
+		pools:  map[string]*sync.Pool{},
+	}
+	for _, encoding := range compressionConfig.Encodings {
+		encoding = strings.ToLower(strings.TrimSpace(encoding))
+		pool, ok := newEncoderPool(encoding)
+		if !ok {
+			log.GetLogger().Panic("unsupported compression encoding: " + encoding)
+		}
+		policy.config.Encodings = append(policy.config.Encodings, encoding)
+		policy.pools[encoding] = pool
+	}
+	for _, contentType := range compressionConfig.ContentTypes {
+		policy.config.ContentTypes = append(policy.config.ContentTypes, strings.ToLower(strings.TrimSpace(contentType)))
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// protocol upgrades (websockets) hijack the connection
+			if r.Header.Get("Upgrade") != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			cw := &compressResponseWriter{
+				ResponseWriter: w,
+				policy:         policy,
+				encoding:       policy.negotiate(r.Header.Get("Accept-Encoding")),
+				head:           r.Method == http.MethodHead,
+			}
+			if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+				cw.encodedIfNoneMatch = cw.encoding != "" && strings.Contains(ifNoneMatch, "-"+cw.encoding+`"`)
+				r.Header.Set("If-None-Match", policy.stripETagsSuffixes(ifNoneMatch))
+			}
+			next.ServeHTTP(cw, r)
+			// not deferred: on panic, nothing should be written before the recovery handler's 500
+			cw.close()
+		})
+	}
+}
+
+func newEncoderPool(encoding string) (*sync.Pool, bool) {
+	switch encoding {
+	case encodingGzip:
+		return &sync.Pool{New: func() interface{} {
+			gz, _ := gzip.NewWriterLevel(ioutil.Discard, gzip.DefaultCompression)
+			return gz
+		}}, true
+	case encodingBrotli:
+		return &sync.Pool{New: func() interface{} {
+			return brotli.NewWriterLevel(ioutil.Discard, brotliLevel)
+		}}, true
+	case encodingZstd:
+		return &sync.Pool{New: func() interface{} {
+			// valid options, no error can be returned
+			zw, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault), zstd.WithEncoderConcurrency(1))
+			return zw
+		}}, true
+	}
+	return nil, false
+}
+
+// negotiate returns the supported encoding with the highest quality in the Accept-Encoding header,
+// the server preference breaks the ties. Empty when the client accepts none of them
+func (c *compressionPolicy) negotiate(acceptEncoding string) string {
+	if acceptEncoding == "" {
+		return ""
+	}
+	qualities := map[string]float64{}
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		fields := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(fields[0]))
+		if coding == "x-gzip" {
+			coding = encodingGzip
+		}
+		quality := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				parsed, err := strconv.ParseFloat(param[2:], 64)
+				if err != nil {
+					parsed = 0
+				}
+				quality = parsed
+			}
+		}
+		qualities[coding] = quality
+	}
+
+	best, bestQuality := "", 0.0
+	for _, encoding := range c.config.Encodings {
+		quality, ok := qualities[encoding]
+		if !ok {
+			quality, ok = qualities["*"]
+		}
+		if ok && quality > bestQuality {
+			best, bestQuality = encoding, quality
+		}
+	}
+	return best
+}
+
+func (c *compressionPolicy) isCompressible(contentType string) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	if mediaType == "" {
+		return false
+	}
+	for _, allowed := range c.config.ContentTypes {
+		if allowed == mediaType || strings.HasSuffix(allowed, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(allowed, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// "abc-gzip", W/"abc-br" => "abc", W/"abc"
+func (c *compressionPolicy) stripETagsSuffixes(ifNoneMatch string) string {
+	for encoding := range c.pools {
+		ifNoneMatch = strings.Replace(ifNoneMatch, "-"+encoding+`"`, `"`, -1)
+	}
+	return ifNoneMatch
+}
+
+type compressResponseWriter struct {
+	http.ResponseWriter
+	policy   *compressionPolicy
+	encoding string // negotiated encoding, empty when the client accepts none
+	head     bool   // HEAD requests get the headers of a GET, without body
+	// the If-None-Match has ETags of the negotiated encoding: the client validates a compressed response
+	encodedIfNoneMatch bool
+
+	status  int
+	buffer  []byte
+	decided bool // the response headers are sent
+	encoder encoder
+}
+
+func (c *compressResponseWriter) WriteHeader(status int) {
+	if status < http.StatusOK {
+		// informational responses (e.g. 103 Early Hints) are sent as they are
+		c.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if c.status == 0 {
+		c.status = status
+	}
+}
+
+func (c *compressResponseWriter) Write(b []byte) (int, error) {
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	if !c.decided {
+		c.buffer = append(c.buffer, b...)
+		if len(c.buffer) < c.policy.config.MinSize {
+			return len(b), nil
+		}
+		if err := c.decide(true); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	return c.write(b)
+}
+
+// Flush sends what is buffered, a streaming response is compressed whatever its size
+func (c *compressResponseWriter) Flush() {
+	if !c.decided {
+		if c.status == 0 {
+			c.status = http.StatusOK
+		}
+		c.decide(true)
+	}
+	if c.encoder != nil {
+		c.encoder.Flush()
+	}
+	if flusher, ok := c.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack keeps the connection takeover capability of the wrapped writer
+func (c *compressResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := c.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	return hijacker.Hijack()
+}
+
+// decide chooses between compressing or not, sends the headers and the buffered content
+func (c *compressResponseWriter) decide(sizeReached bool) error {
+	c.decided = true
+	headers := c.Header()
+	if headers.Get("Content-Type") == "" && len(c.buffer) > 0 {
+		headers.Set("Content-Type", http.DetectContentType(c.buffer))
+	}
+
+	if c.isCompressible() {
+		// the representation depends on the Accept-Encoding, even when not compressed
+		addVary(headers, "Accept-Encoding")
+		switch {
+		case c.status == http.StatusNotModified:
+			// no body, the ETag is the one of the validated response
+			if c.encodedIfNoneMatch {
+				c.suffixETag()
+			}
+		case c.encoding != "" && sizeReached:
+			c.startEncoder()
+		}
+	}
+	c.ResponseWriter.WriteHeader(c.status)
+
+	buffered := c.buffer
+	c.buffer = nil
+	if len(buffered) == 0 {
+		return nil
+	}
+	_, err := c.write(buffered)
+	return err
+}
+
+func (c *compressResponseWriter) isCompressible() bool {
+	headers := c.Header()
+	switch {
+	case c.status == http.StatusNoContent || c.status == http.StatusPartialContent:
+		return false
+	case headers.Get("Content-Encoding") != "" || headers.Get("Content-Range") != "":
+		return false
+	case strings.Contains(headers.Get("Cache-Control"), "no-transform"):
+		return false
+	}
+	return c.policy.isCompressible(headers.Get("Content-Type"))
+}
+
+func (c *compressResponseWriter) startEncoder() {
+	headers := c.Header()
+	headers.Set("Content-Encoding", c.encoding)
+	headers.Del("Content-Length")
+	c.suffixETag()
+
+	c.encoder = c.policy.pools[c.encoding].Get().(encoder)
+	if c.head {
+		// no body is sent, only the headers have to match the ones of a GET
+		c.encoder.Reset(ioutil.Discard)
+	} else {
+		c.encoder.Reset(c.ResponseWriter)
+	}
+}
+
+// suffixETag appends the encoding to the ETag, a compressed representation has its own
+func (c *compressResponseWriter) suffixETag() {
+	headers := c.Header()
+	if etag := headers.Get("ETag"); strings.HasSuffix(etag, `"`) {
+		headers.Set("ETag", strings.TrimSuffix(etag, `"`)+"-"+c.encoding+`"`)
+	}
+}
+
+func (c *compressResponseWriter) write(b []byte) (int, error) {
+	if c.encoder != nil {
+		return c.encoder.Write(b)
+	}
+	return c.ResponseWriter.Write(b)
+}
+
+// close sends a response smaller than the minimum size, or terminates the compressed stream
+func (c *compressResponseWriter) close() {
+	if !c.decided {
+		if c.status == 0 {
+			// nothing was written, the server answers with an empty 200
+			return
+		}
+		c.decide(false)
+	}
+	if c.encoder != nil {
+		if err := c.encoder.Close(); err != nil {
+			log.GetLogger().Warn("Couldn't terminate the compressed response: " + err.Error())
+		}
+		c.encoder.Reset(ioutil.Discard) // doesn't retain the response writer
+		c.policy.pools[c.encoding].Put(c.encoder)
+		c.encoder = nil
+	}
+}
+
+// addVary adds a value to the Vary header if not already present
+func addVary(headers http.Header, value string) {
+	for _, vary := range headers["Vary"] {
+		for _, existing := range strings.Split(vary, ",") {
+			if strings.EqualFold(strings.TrimSpace(existing), value) {
+				return
+			}
+		}
+	}
+	headers.Add("Vary", value)
+}
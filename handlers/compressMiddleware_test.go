@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var largeJSONBody = `{"places":[` + strings.Repeat(`{"name":"Vegan Burger","address":"Main street 1, Berlin"},`, 50) + `{}]}`
+
+func newTestCompressionConfig() CompressionConfig {
+	return CompressionConfig{
+		Encodings:    []string{"br", "zstd", "gzip"},
+		MinSize:      1024,
+		ContentTypes: []string{"application/json", "text/*"},
+	}
+}
+
+func serveCompressed(handler http.HandlerFunc, req *http.Request) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	CompressMiddleware(newTestCompressionConfig())(handler).ServeHTTP(rr, req)
+	return rr
+}
+
+func jsonHandler(body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", `"abc"`)
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, body)
+	}
+}
+
+func decompress(t *testing.T, encoding string, body []byte) string {
+	var reader io.Reader
+	switch encoding {
+	case "gzip":
+		gz, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = gz
+	case "br":
+		reader = brotli.NewReader(bytes.NewReader(body))
+	case "zstd":
+		zr, err := zstd.NewReader(bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer zr.Close()
+		reader = zr
+	default:
+		return string(body)
+	}
+	content, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestUnitCompressionNegotiation(t *testing.T) {
+	policy := &compressionPolicy{config: newTestCompressionConfig()}
+	negotiations := map[string]string{
+		"":                        "",
+		"identity":                "",
+		"gzip":                    "gzip",
+		"x-gzip":                  "gzip",
+		"gzip, deflate, br":       "br",
+		"gzip, br;q=0.5":          "gzip",
+		"br;q=0, gzip":            "gzip",
+		"zstd, gzip":              "zstd",
+		"*":                       "br",
+		"*;q=0.1, gzip;q=0.5":     "gzip",
+		"deflate, gzip;q=invalid": "",
+	}
+	for acceptEncoding, expected := range negotiations {
+		assert.Equal(t, expected, policy.negotiate(acceptEncoding), acceptEncoding)
+	}
+}
+
+func TestUnitCompressMiddlewareEncodings(t *testing.T) {
+	for _, encoding := range []string{"gzip", "br", "zstd"} {
+		req := httptest.NewRequest("GET", "/api/v1/places", nil)
+		req.Header.Set("Accept-Encoding", encoding)
+		rr := serveCompressed(jsonHandler(largeJSONBody), req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, encoding, rr.Header().Get("Content-Encoding"))
+		assert.Equal(t, "Accept-Encoding", rr.Header().Get("Vary"))
+		assert.Equal(t, `"abc-`+encoding+`"`, rr.Header().Get("ETag"))
+		assert.True(t, rr.Body.Len() < len(largeJSONBody))
+		assert.Equal(t, largeJSONBody, decompress(t, encoding, rr.Body.Bytes()))
+	}
+}
+
+func TestUnitCompressMiddlewareSkipped(t *testing.T) {
+	// smaller than the minimum size
+	req := httptest.NewRequest("GET", "/api/v1/places", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr := serveCompressed(jsonHandler(`{"places":[]}`), req)
+	assert.Equal(t, "", rr.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", rr.Header().Get("Vary"))
+	assert.Equal(t, `"abc"`, rr.Header().Get("ETag"))
+	assert.Equal(t, `{"places":[]}`, rr.Body.String())
+
+	// the client doesn't accept any encoding
+	rr = serveCompressed(jsonHandler(largeJSONBody), httptest.NewRequest("GET", "/api/v1/places", nil))
+	assert.Equal(t, "", rr.Header().Get("Content-Encoding"))
+	assert.Equal(t, largeJSONBody, rr.Body.String())
+
+	// content type not allowed
+	rr = serveCompressed(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		io.WriteString(w, largeJSONBody)
+	}, req)
+	assert.Equal(t, "", rr.Header().Get("Content-Encoding"))
+	assert.Equal(t, "", rr.Header().Get("Vary"))
+	assert.Equal(t, largeJSONBody, rr.Body.String())
+
+	// not modified
+	rr = serveCompressed(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotModified)
+	}, req)
+	assert.Equal(t, http.StatusNotModified, rr.Code)
+	assert.Equal(t, "", rr.Header().Get("Content-Encoding"))
+	assert.Equal(t, 0, rr.Body.Len())
+}
+
+func TestUnitCompressMiddlewareIfNoneMatch(t *testing.T) {
+	var ifNoneMatch string
+	req := httptest.NewRequest("GET", "/api/v1/places", nil)
+	req.Header.Set("If-None-Match", `"abc-gzip", W/"def-br"`)
+	serveCompressed(func(w http.ResponseWriter, r *http.Request) {
+		ifNoneMatch = r.Header.Get("If-None-Match")
+	}, req)
+	assert.Equal(t, `"abc", W/"def"`, ifNoneMatch)
+}
+
+func TestUnitCompressMiddlewareNotModified(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		writeCacheable(w, r, []byte(largeJSONBody), "application/json", cachePolicy{maxAge: time.Minute})
+	}
+	get := httptest.NewRequest("GET", "/api/v1/places", nil)
+	get.Header.Set("Accept-Encoding", "gzip")
+	ok := serveCompressed(handler, get)
+	assert.Equal(t, http.StatusOK, ok.Code)
+	assert.Equal(t, "gzip", ok.Header().Get("Content-Encoding"))
+
+	conditional := httptest.NewRequest("GET", "/api/v1/places", nil)
+	conditional.Header.Set("Accept-Encoding", "gzip")
+	conditional.Header.Set("If-None-Match", ok.Header().Get("ETag"))
+	notModified := serveCompressed(handler, conditional)
+	assert.Equal(t, http.StatusNotModified, notModified.Code)
+	assert.Equal(t, ok.Header().Get("ETag"), notModified.Header().Get("ETag"))
+	assert.Equal(t, ok.Header()["Vary"], notModified.Header()["Vary"])
+	assert.Equal(t, 0, notModified.Body.Len())
+
+	// a response too small to be compressed keeps its ETag
+	smallHandler := func(w http.ResponseWriter, r *http.Request) {
+		writeCacheable(w, r, []byte(`{"places":[]}`), "application/json", cachePolicy{maxAge: time.Minute})
+	}
+	ok = serveCompressed(smallHandler, get)
+	assert.Equal(t, "", ok.Header().Get("Content-Encoding"))
+	conditional.Header.Set("If-None-Match", ok.Header().Get("ETag"))
+	notModified = serveCompressed(smallHandler, conditional)
+	assert.Equal(t, http.StatusNotModified, notModified.Code)
+	assert.Equal(t, ok.Header().Get("ETag"), notModified.Header().Get("ETag"))
+	assert.Equal(t, []string{"Accept-Encoding"}, notModified.Header()["Vary"])
+}
+
+func TestUnitCompressMiddlewareHead(t *testing.T) {
+	get := httptest.NewRequest("GET", "/api/v1/places", nil)
+	get.Header.Set("Accept-Encoding", "gzip")
+	head := httptest.NewRequest("HEAD", "/api/v1/places", nil)
+	head.Header.Set("Accept-Encoding", "gzip")
+
+	getResponse := serveCompressed(jsonHandler(largeJSONBody), get)
+	headResponse := serveCompressed(jsonHandler(largeJSONBody), head)
+	assert.Equal(t, getResponse.Header(), headResponse.Header())
+	assert.Equal(t, 0, headResponse.Body.Len())
+}
+
+func TestUnitCompressMiddlewareStreaming(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/v1/places", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	var flushedBody []byte
+	rr := httptest.NewRecorder()
+	CompressMiddleware(newTestCompressionConfig())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: first\n\n")
+		w.(http.Flusher).Flush()
+		flushedBody = append(flushedBody, rr.Body.Bytes()...)
+		io.WriteString(w, "data: second\n\n")
+	})).ServeHTTP(rr, req)
+
+	assert.True(t, rr.Flushed)
+	assert.Equal(t, "gzip", rr.Header().Get("Content-Encoding"))
+	// the first event can be decoded before the end of the stream
+	gz, err := gzip.NewReader(bytes.NewReader(flushedBody))
+	if assert.NoError(t, err) {
+		first := make([]byte, len("data: first\n\n"))
+		_, err = io.ReadFull(gz, first)
+		assert.NoError(t, err)
+		assert.Equal(t, "data: first\n\n", string(first))
+	}
+	assert.Equal(t, "data: first\n\ndata: second\n\n", decompress(t, "gzip", rr.Body.Bytes()))
+}
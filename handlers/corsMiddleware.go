@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"github.com/codeselim/go-webservice-places-provider/auth"
+	"github.com/codeselim/go-webservice-places-provider/log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+ * CORS (https://fetch.spec.whatwg.org/#http-cors-protocol).
+ * The middleware has to wrap the router, not be registered with router.Use(): preflight OPTIONS requests
+ * don't match the GET routes and would be answered with a 405 before reaching a router middleware.
+ */
+
+type CORSConfig struct {
+	AllowedOrigins   []string      // exact origins ("https://app.example.com"), wildcard patterns ("https://*.example.com") or "*"
+	AllowedMethods   []string      // e.g. GET, HEAD
+	AllowedHeaders   []string      // request headers the clients can send, e.g. Authorization, X-API-Key
+	ExposedHeaders   []string      // response headers readable by the clients, e.g. Retry-After
+	AllowCredentials bool          // cookies/authorization headers, the origin is then always echoed instead of "*"
+	MaxAge           time.Duration // how long the preflight response can be cached
+}
+
+type corsPolicy struct {
+	config         CORSConfig
+	anyOrigin      bool
+	varyOrigin     bool // the responses depend on the request origin, unless all the origins get "*"
+	allowedMethods map[string]bool
+	allowedHeaders map[string]bool
+}
+
+// CORSMiddleware handles the preflight requests and sets the CORS headers of the allowed origins
+func CORSMiddleware(corsConfig CORSConfig) func(http.Handler) http.Handler {
+	policy := &corsPolicy{
+		config:         corsConfig,
+		allowedMethods: map[string]bool{},
+		allowedHeaders: map[string]bool{},
+	}
+	for _, origin := range corsConfig.AllowedOrigins {
+		if origin == "*" {
+			policy.anyOrigin = true
+		}
+	}
+	policy.varyOrigin = !policy.anyOrigin || corsConfig.AllowCredentials
+	for _, method := range corsConfig.AllowedMethods {
+		policy.allowedMethods[strings.ToUpper(method)] = true
+	}
+	for _, header := range corsConfig.AllowedHeaders {
+		policy.allowedHeaders[http.CanonicalHeaderKey(header)] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				policy.handlePreflight(w, r, origin)
+				return
+			}
+			// even without Origin: a cached response without CORS headers must not be served to the browsers
+			if policy.varyOrigin {
+				w.Header().Add("Vary", "Origin")
+			}
+			if policy.isOriginAllowed(origin) || !policy.varyOrigin {
+				policy.setOriginHeaders(w, origin)
+				if len(corsConfig.ExposedHeaders) > 0 {
+					w.Header().Set("Access-Control-Expose-Headers", strings.Join(corsConfig.ExposedHeaders, ", "))
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// a refused preflight gets no CORS headers, the browser then blocks the actual request
+func (c *corsPolicy) handlePreflight(w http.ResponseWriter, r *http.Request, origin string) {
+	headers := w.Header()
+	headers.Add("Vary", "Origin")
+	headers.Add("Vary", "Access-Control-Request-Method")
+	headers.Add("Vary", "Access-Control-Request-Headers")
+
+	requestedMethod := strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))
+	requestedHeaders := parseHeadersList(r.Header.Get("Access-Control-Request-Headers"))
+	logger := log.GetLoggerWithContext(r.Context())
+
+	switch {
+	case !c.isOriginAllowed(origin):
+		logger.Info("CORS preflight refused, origin not allowed: " + origin)
+	case !c.allowedMethods[requestedMethod]:
+		logger.Info("CORS preflight refused, method not allowed: " + requestedMethod)
+	case !c.areHeadersAllowed(requestedHeaders):
+		logger.Info("CORS preflight refused, headers not allowed: " + strings.Join(requestedHeaders, ", "))
+	default:
+		c.setOriginHeaders(w, origin)
+		headers.Set("Access-Control-Allow-Methods", strings.Join(c.config.AllowedMethods, ", "))
+		if len(requestedHeaders) > 0 {
+			headers.Set("Access-Control-Allow-Headers", strings.Join(requestedHeaders, ", "))
+		}
+		if c.config.MaxAge > 0 {
+			headers.Set("Access-Control-Max-Age", strconv.Itoa(int(c.config.MaxAge.Seconds())))
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *corsPolicy) setOriginHeaders(w http.ResponseWriter, origin string) {
+	if c.anyOrigin && !c.config.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	} else {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+	}
+	if c.config.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func (c *corsPolicy) isOriginAllowed(origin string) bool {
+	if origin == "" {
+		return false
+	}
+	if c.anyOrigin {
+		return true
+	}
+	for _, allowed := range c.config.AllowedOrigins {
+		if auth.MatchOrigin(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *corsPolicy) areHeadersAllowed(requestedHeaders []string) bool {
+	for _, header := range requestedHeaders {
+		if !c.allowedHeaders[http.CanonicalHeaderKey(header)] {
+			return false
+		}
+	}
+	return true
+}
+
+func parseHeadersList(value string) []string {
+	headers := []string{}
+	for _, header := range strings.Split(value, ",") {
+		if header = strings.TrimSpace(header); header != "" {
+			headers = append(headers, header)
+		}
+	}
+	return headers
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newCORSTestRouter(corsConfig CORSConfig) http.Handler {
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v1/places", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}).Methods("GET")
+	return CORSMiddleware(corsConfig)(r)
+}
+
+func newPreflightRequest(origin string, method string, headers string) *http.Request {
+	req := httptest.NewRequest("OPTIONS", "/api/v1/places", nil)
+	req.Header.Set("Origin", origin)
+	req.Header.Set("Access-Control-Request-Method", method)
+	if headers != "" {
+		req.Header.Set("Access-Control-Request-Headers", headers)
+	}
+	return req
+}
+
+func TestUnitCORSPreflight(t *testing.T) {
+	handler := newCORSTestRouter(CORSConfig{
+		AllowedOrigins: []string{"https://app.example.com", "https://*.partner.com"},
+		AllowedMethods: []string{"GET", "HEAD"},
+		AllowedHeaders: []string{"Authorization", "X-API-Key"},
+		MaxAge:         10 * time.Minute,
+	})
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, newPreflightRequest("https://app.example.com", "GET", "x-api-key, authorization"))
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Equal(t, "https://app.example.com", rr.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "GET, HEAD", rr.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "x-api-key, authorization", rr.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "600", rr.Header().Get("Access-Control-Max-Age"))
+	assert.Equal(t, "", rr.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Contains(t, rr.Header()["Vary"], "Origin")
+
+	// wildcard pattern
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, newPreflightRequest("https://maps.partner.com", "GET", ""))
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Equal(t, "https://maps.partner.com", rr.Header().Get("Access-Control-Allow-Origin"))
+
+	refused := map[string]*http.Request{
+		"origin":  newPreflightRequest("https://evil.example.com", "GET", ""),
+		"method":  newPreflightRequest("https://app.example.com", "DELETE", ""),
+		"headers": newPreflightRequest("https://app.example.com", "GET", "X-Custom"),
+	}
+	for name, req := range refused {
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusNoContent, rr.Code, name)
+		assert.Equal(t, "", rr.Header().Get("Access-Control-Allow-Origin"), name)
+		assert.Equal(t, "", rr.Header().Get("Access-Control-Allow-Methods"), name)
+	}
+}
+
+func TestUnitCORSActualRequest(t *testing.T) {
+	handler := newCORSTestRouter(CORSConfig{
+		AllowedOrigins: []string{"https://app.example.com"},
+		AllowedMethods: []string{"GET"},
+		ExposedHeaders: []string{"Retry-After", "X-Request-Id"},
+	})
+
+	req := httptest.NewRequest("GET", "/api/v1/places", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "https://app.example.com", rr.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "Retry-After, X-Request-Id", rr.Header().Get("Access-Control-Expose-Headers"))
+	assert.Equal(t, "Origin", rr.Header().Get("Vary"))
+
+	// a refused origin still gets the response, the browser hides it
+	req = httptest.NewRequest("GET", "/api/v1/places", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "", rr.Header().Get("Access-Control-Allow-Origin"))
+
+	// server to server requests have no CORS headers, their response still varies by origin for the caches
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/places", nil))
+	assert.Equal(t, "", rr.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "Origin", rr.Header().Get("Vary"))
+}
+
+func TestUnitCORSAnyOrigin(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/v1/places", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+
+	rr := httptest.NewRecorder()
+	newCORSTestRouter(CORSConfig{AllowedOrigins: []string{"*"}}).ServeHTTP(rr, req)
+	assert.Equal(t, "*", rr.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "", rr.Header().Get("Vary"))
+
+	// the same response with or without origin, it doesn't vary
+	rr = httptest.NewRecorder()
+	newCORSTestRouter(CORSConfig{AllowedOrigins: []string{"*"}}).ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/places", nil))
+	assert.Equal(t, "*", rr.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "", rr.Header().Get("Vary"))
+
+	// "*" is not allowed by the browsers with credentials: the origin is echoed
+	rr = httptest.NewRecorder()
+	newCORSTestRouter(CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true}).ServeHTTP(rr, req)
+	assert.Equal(t, "https://app.example.com", rr.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", rr.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "Origin", rr.Header().Get("Vary"))
+}
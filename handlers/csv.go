@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"github.com/codeselim/go-webservice-places-provider/api"
+	"io"
+	"strconv"
+	"strings"
+)
+
+/**
+ * CSV encoder (RFC 4180), one row per place, for spreadsheets imports.
+ * Places without coordinates have empty latitude and longitude cells.
+ */
+
+var csvHeader = []string{"id", "provider", "name", "address", "latitude", "longitude", "uri"}
+
+type csvEncoder struct{}
+
+func (csvEncoder) ContentType() string {
+	return "text/csv"
+}
+
+func (csvEncoder) FileExtension() string {
+	return "csv"
+}
+
+func (csvEncoder) EncodePlaces(w io.Writer, places api.Places) error {
+	writer := csv.NewWriter(w) // buffered, flushed every 4KB
+	if err := writer.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, place := range places {
+		lat, lng := "", ""
+		if place.Location != nil {
+			lat = strconv.FormatFloat(place.Location.Lat, 'f', -1, 64)
+			lng = strconv.FormatFloat(place.Location.Lng, 'f', -1, 64)
+		}
+		row := []string{
+			escapeFormula(place.ID),
+			escapeFormula(place.Provider),
+			escapeFormula(place.Name),
+			escapeFormula(place.Address),
+			lat,
+			lng,
+			escapeFormula(place.URI),
+		}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// the places texts come from the providers (user generated content): a name starting with "=" would be
+// evaluated as a formula by the spreadsheets. They are prefixed with a quote, as recommended by OWASP
+func escapeFormula(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
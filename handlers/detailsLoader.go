@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"context"
+	"github.com/codeselim/go-webservice-places-provider/api"
+	"github.com/codeselim/go-webservice-places-provider/config"
+	"github.com/codeselim/go-webservice-places-provider/providers"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"sync"
+)
+
+/**
+ * Dataloader of the GraphQL place details. The resolvers register the places they need and return a thunk,
+ * the executor calls the thunks once the whole level of the query is resolved: the first call fetches all the
+ * registered places, batched per provider. A place asked several times in a query is fetched once.
+ */
+
+type detailsKey struct {
+	provider string
+	id       string
+}
+
+type detailsResult struct {
+	done    chan struct{}
+	details api.PlaceDetails
+	err     error
+}
+
+type detailsLoader struct {
+	ctx           context.Context
+	placesHandler *PlacesHandler
+
+	mu      sync.Mutex
+	pending map[string][]string // provider label -> ids not fetched yet
+	results map[detailsKey]*detailsResult
+	errors  []gqlerrors.FormattedError // of the failed fetches, see GraphQLHandler.loadDetails
+}
+
+// a loader lives for a single query
+func newDetailsLoader(ctx context.Context, placesHandler *PlacesHandler) *detailsLoader {
+	return &detailsLoader{
+		ctx:           ctx,
+		placesHandler: placesHandler,
+		pending:       map[string][]string{},
+		results:       map[detailsKey]*detailsResult{},
+	}
+}
+
+// load registers a place and returns the thunk resolving its details
+func (l *detailsLoader) load(provider string, id string) func() (interface{}, error) {
+	key := detailsKey{provider: provider, id: id}
+	l.mu.Lock()
+	result, ok := l.results[key]
+	if !ok {
+		result = &detailsResult{done: make(chan struct{})}
+		l.results[key] = result
+		l.pending[provider] = append(l.pending[provider], id)
+	}
+	l.mu.Unlock()
+
+	return func() (interface{}, error) {
+		l.dispatch()
+		<-result.done
+		return result.details, result.err
+	}
+}
+
+func (l *detailsLoader) addError(err gqlerrors.FormattedError) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.errors = append(l.errors, err)
+}
+
+// dispatch fetches the pending places, the providers batches run in parallel
+func (l *detailsLoader) dispatch() {
+	l.mu.Lock()
+	pending := l.pending
+	l.pending = map[string][]string{}
+	l.mu.Unlock()
+	if len(pending) == 0 {
+		return
+	}
+
+	placesProviders, err := l.placesHandler.AllowedProviders(l.ctx)
+	var wg sync.WaitGroup
+	for provider, ids := range pending {
+		wg.Add(1)
+		go func(provider string, ids []string) {
+			defer wg.Done()
+			l.fetchBatch(placesProviders, err, provider, ids)
+		}(provider, ids)
+	}
+	wg.Wait()
+}
+
+// the providers have no batch endpoint: a batch is a bounded set of concurrent calls
+func (l *detailsLoader) fetchBatch(placesProviders []providers.Provider, providersErr error, provider string, ids []string) {
+	semaphore := make(chan struct{}, config.DefaultGraphQLDetailsConcurrency)
+	var wg sync.WaitGroup
+	for _, id := range ids {
+		l.mu.Lock()
+		result := l.results[detailsKey{provider: provider, id: id}]
+		l.mu.Unlock()
+		if providersErr != nil {
+			result.err = providersErr
+			close(result.done)
+			continue
+		}
+
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(id string, result *detailsResult) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			result.details, result.err = l.placesHandler.GetPlaceDetails(l.ctx, placesProviders, provider, id)
+			close(result.done)
+		}(id, result)
+	}
+	wg.Wait()
+}
+
+func withDetailsLoader(ctx context.Context, loader *detailsLoader) context.Context {
+	return context.WithValue(ctx, config.ContextKeyDetailsLoader, loader)
+}
+
+func detailsLoaderFromContext(ctx context.Context) *detailsLoader {
+	loader, _ := ctx.Value(config.ContextKeyDetailsLoader).(*detailsLoader)
+	return loader
+}
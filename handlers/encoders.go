@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/codeselim/go-webservice-places-provider/api"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/**
+ * Response encoders registry. The places responses format is chosen with the "format" query parameter
+ * (e.g. format=geojson) or negotiated with the Accept header (e.g. Accept: application/geo+json).
+ * JSON is the default format. New formats are added with RegisterResponseEncoder.
+ * The "filename" query parameter turns the response into a download (Content-Disposition: attachment).
+ */
+
+const (
+	formatQueryParam   = "format"
+	filenameQueryParam = "filename" // downloads the response as <filename>.<format extension>
+	defaultFormat      = "json"
+	maxFilenameLength  = 100
+)
+
+// ResponseEncoder writes places in a given format. Encoders should write the places one by one instead of
+// building the whole document in memory, results can be large
+type ResponseEncoder interface {
+	ContentType() string
+	FileExtension() string // used in the Content-Disposition filename, e.g. csv
+	EncodePlaces(w io.Writer, places api.Places) error
+}
+
+var (
+	encodersMu sync.RWMutex // guards encoders
+	encoders   = map[string]ResponseEncoder{
+		defaultFormat: jsonEncoder{},
+		"geojson":     geoJSONEncoder{},
+		"csv":         csvEncoder{},
+		"kml":         kmlEncoder{},
+		"gpx":         gpxEncoder{},
+	}
+)
+
+// RegisterResponseEncoder makes a format available to the clients, by name (format query parameter) and media type (Accept header)
+func RegisterResponseEncoder(format string, encoder ResponseEncoder) {
+	encodersMu.Lock()
+	defer encodersMu.Unlock()
+	encoders[format] = encoder
+}
+
+// SupportedFormats returns the names of the registered formats
+func SupportedFormats() []string {
+	encodersMu.RLock()
+	defer encodersMu.RUnlock()
+	formats := []string{}
+	for format := range encoders {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// negotiateEncoder returns the encoder requested with the format query parameter, else the best match of the Accept header.
+// Accept headers without any registered media type get the default format. The json of the v2 API has its own encoder
+func negotiateEncoder(r *http.Request) (ResponseEncoder, error) {
+	encoder, err := negotiateFormat(r)
+	if _, ok := encoder.(jsonEncoder); ok && isAPIVersion2(r.Context()) {
+		return jsonV2Encoder{}, nil
+	}
+	return encoder, err
+}
+
+func negotiateFormat(r *http.Request) (ResponseEncoder, error) {
+	encodersMu.RLock()
+	defer encodersMu.RUnlock()
+
+	if format := strings.ToLower(r.URL.Query().Get(formatQueryParam)); format != "" {
+		encoder, ok := encoders[format]
+		if !ok {
+			return nil, newBadRequestError(r, api.UnsupportedFormatErrorCode)
+		}
+		return encoder, nil
+	}
+
+	best, bestQuality := encoders[defaultFormat], 0.0
+	for _, mediaRange := range parseAccept(r.Header.Get("Accept")) {
+		// wildcards (*/*, application/*) are served with the default format
+		if strings.HasSuffix(mediaRange.mediaType, "*") || mediaRange.quality <= bestQuality {
+			continue
+		}
+		for _, encoder := range encoders {
+			if encoder.ContentType() == mediaRange.mediaType {
+				best, bestQuality = encoder, mediaRange.quality
+			}
+		}
+	}
+	return best, nil
+}
+
+type acceptedMediaRange struct {
+	mediaType string
+	quality   float64
+}
+
+// parseAccept returns the media ranges of an Accept header, lower cased, with their quality (1 by default)
+func parseAccept(accept string) []acceptedMediaRange {
+	mediaRanges := []acceptedMediaRange{}
+	for _, mediaRange := range strings.Split(accept, ",") {
+		fields := strings.Split(mediaRange, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(fields[0]))
+		if mediaType == "" {
+			continue
+		}
+		quality := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if parsed, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					quality = parsed
+				}
+			}
+		}
+		mediaRanges = append(mediaRanges, acceptedMediaRange{mediaType: mediaType, quality: quality})
+	}
+	return mediaRanges
+}
+
+// contentDisposition returns the attachment header value of a filename supplied by a client. The filename
+// is restricted to letters, digits, dots, dashes and underscores, so it can't break out of the header
+func contentDisposition(filename string, extension string) string {
+	filename = strings.TrimSuffix(filename, "."+extension)
+	sanitized := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, filename)
+	if len(sanitized) > maxFilenameLength {
+		sanitized = sanitized[:maxFilenameLength]
+	}
+	return `attachment; filename="` + sanitized + "." + extension + `"`
+}
+
+type jsonEncoder struct{}
+
+func (jsonEncoder) ContentType() string {
+	return "application/json"
+}
+
+func (jsonEncoder) FileExtension() string {
+	return "json"
+}
+
+func (jsonEncoder) EncodePlaces(w io.Writer, places api.Places) error {
+	return json.NewEncoder(w).Encode(places)
+}
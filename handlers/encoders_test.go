@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"github.com/codeselim/go-webservice-places-provider/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUnitNegotiateEncoder(t *testing.T) {
+	negotiations := map[string]string{
+		"":                                      "application/json",
+		"*/*":                                   "application/json",
+		"application/json":                      "application/json",
+		"application/geo+json":                  "application/geo+json",
+		"application/geo+json;q=0.9, */*;q=0.1": "application/geo+json",
+		"application/json;q=0.5, application/geo+json": "application/geo+json",
+		"application/geo+json;q=0.5, application/json": "application/json",
+		"application/xml": "application/json",
+	}
+	for accept, expected := range negotiations {
+		req := httptest.NewRequest("GET", "/api/v1/places?text=vegan", nil)
+		req.Header.Set("Accept", accept)
+		encoder, err := negotiateEncoder(req)
+		if assert.NoError(t, err, accept) {
+			assert.Equal(t, expected, encoder.ContentType(), accept)
+		}
+	}
+
+	// the format query parameter wins
+	req := httptest.NewRequest("GET", "/api/v1/places?text=vegan&format=geojson", nil)
+	req.Header.Set("Accept", "application/json")
+	encoder, err := negotiateEncoder(req)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "application/geo+json", encoder.ContentType())
+	}
+
+	_, err = negotiateEncoder(httptest.NewRequest("GET", "/api/v1/places?text=vegan&format=shapefile", nil))
+	if assert.Error(t, err) {
+		assert.Equal(t, api.UnsupportedFormatErrorCode, err.(*api.Error).Code)
+	}
+}
+
+type plainTextEncoder struct{}
+
+func (plainTextEncoder) ContentType() string {
+	return "text/plain"
+}
+
+func (plainTextEncoder) FileExtension() string {
+	return "txt"
+}
+
+func (plainTextEncoder) EncodePlaces(w io.Writer, places api.Places) error {
+	for _, place := range places {
+		io.WriteString(w, place.Name+"\n")
+	}
+	return nil
+}
+
+func TestPlacesHandlerGetPlacesRegisteredFormat(t *testing.T) {
+	RegisterResponseEncoder("text", plainTextEncoder{})
+	defer func() {
+		encodersMu.Lock()
+		delete(encoders, "text")
+		encodersMu.Unlock()
+	}()
+	assert.Contains(t, SupportedFormats(), "text")
+
+	googlePlacesProvider := new(mockGooglePlacesProvider)
+	googlePlacesProvider.On("GetPlacesByQuery", mock.Anything, mock.Anything).Return(api.Places{apiPlaceFromGoogle}, nil)
+	placesHandler := NewPlacesHandler(googlePlacesProvider)
+
+	rr := httptest.NewRecorder()
+	placesHandler.GetPlaces(rr, httptest.NewRequest("GET", "/api/v1/places?text=vegan&format=text", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "text/plain", rr.Header().Get("Content-Type"))
+	assert.Equal(t, "Accept", rr.Header().Get("Vary"))
+	assert.Equal(t, "place1\n", rr.Body.String())
+}
@@ -1,11 +1,16 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"github.com/codeselim/go-webservice-places-provider/api"
+	"github.com/codeselim/go-webservice-places-provider/config"
 	"github.com/codeselim/go-webservice-places-provider/log"
+	"github.com/codeselim/go-webservice-places-provider/providers"
 
 	"net/http"
+	"strconv"
 )
 
 // Customized error handler, checks types of returned error,
@@ -16,24 +21,93 @@ func HandleError(err error, w http.ResponseWriter, r *http.Request) {
 
 	switch e := err.(type) {
 	case *api.Error:
-		setDefaultHeaders(w)
-		w.WriteHeader(e.StatusCode)
-		json.NewEncoder(w).Encode(e)
+		writeAPIError(w, e)
 		loggerWithContext.Error(e.Error())
 
 		//... extend here other cases and Errors types
 
 	default:
 		// Any error types we don't specifically look out for, defaults
-		// to serving a HTTP 500 - Internal Server Error - writes a JSON response
-		resp := api.Error{
-			StatusCode: http.StatusInternalServerError,
-			TraceId:    GetRequestID(r.Context()),
-			Message:    "Oops! something went wrong! Please refer to our support with your traceId",
-		}
+		// to serving a HTTP 500 - Internal Server Error - writes a JSON response.
+		// The classified provider failures get their own status
+		resp := ToAPIError(r.Context(), e)
 		loggerWithContext.Error(e.Error())
-		setDefaultHeaders(w)
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(resp)
+		writeAPIError(w, resp)
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, e *api.Error) {
+	setDefaultHeaders(w)
+	if e.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(e.RetryAfter))
+	}
+	w.WriteHeader(e.StatusCode)
+	json.NewEncoder(w).Encode(e)
+}
+
+// api errors of the classified provider failures
+var providerAPIErrors = map[providers.ErrorKind]struct {
+	statusCode int
+	errorType  string
+	code       int
+}{
+	providers.TimeoutErrorKind:    {http.StatusGatewayTimeout, api.ProviderTimeoutErrorType, api.ProviderTimeoutErrorCode},
+	providers.AuthErrorKind:       {http.StatusInternalServerError, api.ProviderAuthErrorType, api.ProviderAuthErrorCode}, // our credentials, not the client ones
+	providers.QuotaErrorKind:      {http.StatusServiceUnavailable, api.ProviderQuotaExceededErrorType, api.ProviderQuotaExceededErrorCode},
+	providers.UpstreamErrorKind:   {http.StatusBadGateway, api.ProviderUnavailableErrorType, api.ProviderUnavailableErrorCode},
+	providers.BadRequestErrorKind: {http.StatusBadRequest, api.ProviderBadRequestErrorType, api.ProviderBadRequestErrorCode},
+	providers.NotFoundErrorKind:   {http.StatusNotFound, api.ProviderNotFoundErrorType, api.ProviderNotFoundErrorCode},
+}
+
+// dominantError returns the error of the most frequent class among the failed providers, the first one in the
+// providers order on a tie. The unclassified errors only dominate when none of the failures is classified
+func dominantError(placesProviders []providers.Provider, providersErrors map[providers.ProviderLabel]error) error {
+	kindCounts := map[providers.ErrorKind]int{}
+	for _, err := range providersErrors {
+		if kind := providers.KindOf(err); kind != providers.UnknownErrorKind {
+			kindCounts[kind]++
+		}
+	}
+	var dominant error
+	dominantCount := 0
+	for _, provider := range placesProviders {
+		err, failed := providersErrors[provider.GetProviderLabel()]
+		if !failed {
+			continue
+		}
+		if count := kindCounts[providers.KindOf(err)]; dominant == nil || count > dominantCount {
+			dominant, dominantCount = err, count
+		}
+	}
+	return dominant
+}
+
+// ToAPIError returns the api.Error sent to the clients for an error: the provider failures are mapped by class,
+// unexpected errors are hidden behind an internal error. The details of both stay in the logs
+func ToAPIError(ctx context.Context, err error) *api.Error {
+	if apiError, ok := err.(*api.Error); ok {
+		return apiError
+	}
+	var providerError *providers.ProviderError
+	if errors.As(err, &providerError) {
+		if providerAPIError, ok := providerAPIErrors[providerError.Kind]; ok {
+			apiError := &api.Error{
+				StatusCode: providerAPIError.statusCode,
+				TraceId:    GetRequestID(ctx),
+				Type:       providerAPIError.errorType,
+				Code:       providerAPIError.code,
+				Message:    api.ErrorMessageText[providerAPIError.code],
+				Retryable:  providerError.Retryable(),
+			}
+			if providerError.Kind == providers.QuotaErrorKind {
+				apiError.RetryAfter = config.ProviderQuotaRetryAfter
+			}
+			return apiError
+		}
+	}
+	return &api.Error{
+		StatusCode: http.StatusInternalServerError,
+		TraceId:    GetRequestID(ctx),
+		Message:    "Oops! something went wrong! Please refer to our support with your traceId",
 	}
 }
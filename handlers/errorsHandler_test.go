@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/codeselim/go-webservice-places-provider/api"
+	"github.com/codeselim/go-webservice-places-provider/config"
+	"github.com/codeselim/go-webservice-places-provider/providers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestToAPIErrorProviderErrors(t *testing.T) {
+	tests := []struct {
+		kind       providers.ErrorKind
+		statusCode int
+		errorType  string
+		code       int
+		retryable  bool
+	}{
+		{providers.TimeoutErrorKind, http.StatusGatewayTimeout, api.ProviderTimeoutErrorType, api.ProviderTimeoutErrorCode, true},
+		{providers.AuthErrorKind, http.StatusInternalServerError, api.ProviderAuthErrorType, api.ProviderAuthErrorCode, false},
+		{providers.QuotaErrorKind, http.StatusServiceUnavailable, api.ProviderQuotaExceededErrorType, api.ProviderQuotaExceededErrorCode, true},
+		{providers.UpstreamErrorKind, http.StatusBadGateway, api.ProviderUnavailableErrorType, api.ProviderUnavailableErrorCode, true},
+		{providers.BadRequestErrorKind, http.StatusBadRequest, api.ProviderBadRequestErrorType, api.ProviderBadRequestErrorCode, false},
+		{providers.NotFoundErrorKind, http.StatusNotFound, api.ProviderNotFoundErrorType, api.ProviderNotFoundErrorCode, false},
+	}
+	for _, test := range tests {
+		err := fmt.Errorf("details: %w", &providers.ProviderError{Provider: providers.GooglePlacesProviderLabel, Kind: test.kind,
+			Err: errors.New("maps: REQUEST_DENIED - The provided API key is invalid.")})
+		apiError := ToAPIError(WithRequestID(context.Background(), "trace-id"), err)
+		assert.Equal(t, test.statusCode, apiError.StatusCode, test.kind)
+		assert.Equal(t, test.errorType, apiError.Type, test.kind)
+		assert.Equal(t, test.code, apiError.Code, test.kind)
+		assert.Equal(t, test.retryable, apiError.Retryable, test.kind)
+		assert.Equal(t, "trace-id", apiError.TraceId)
+		assert.NotContains(t, apiError.Message, "API key", "the upstream details stay in the logs")
+	}
+
+	// unclassified errors are still hidden behind an internal error
+	apiError := ToAPIError(WithRequestID(context.Background(), "trace-id"), errors.New("boom"))
+	assert.Equal(t, http.StatusInternalServerError, apiError.StatusCode)
+	assert.Empty(t, apiError.Type)
+	assert.False(t, apiError.Retryable)
+}
+
+func TestHandleErrorProviderQuota(t *testing.T) {
+	rr := httptest.NewRecorder()
+	err := &providers.ProviderError{Provider: providers.FoursquareLabel, Kind: providers.QuotaErrorKind, Err: errors.New("foursquare: 429 Quota exceeded")}
+	HandleError(err, rr, httptest.NewRequest("GET", "/api/v1/places", nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Equal(t, strconv.Itoa(config.ProviderQuotaRetryAfter), rr.Header().Get("Retry-After"))
+	apiError := api.Error{}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &apiError))
+	assert.Equal(t, api.ProviderQuotaExceededErrorCode, apiError.Code)
+	assert.True(t, apiError.Retryable)
+}
+
+func TestDominantError(t *testing.T) {
+	placesProviders := []providers.Provider{new(mockGooglePlacesProvider), new(mockFourSquarePlacesProvider), new(mockGeocoderProvider)}
+	timeout := &providers.ProviderError{Kind: providers.TimeoutErrorKind, Err: errors.New("timeout")}
+	quota := &providers.ProviderError{Kind: providers.QuotaErrorKind, Err: errors.New("quota")}
+	unclassified := errors.New("boom")
+
+	assert.Equal(t, quota, dominantError(placesProviders, map[providers.ProviderLabel]error{
+		"google-provider-label": timeout, "foursquare-provider-label": quota, "geocoder-provider-label": quota,
+	}), "the most frequent class")
+	assert.Equal(t, timeout, dominantError(placesProviders, map[providers.ProviderLabel]error{
+		"google-provider-label": timeout, "foursquare-provider-label": quota,
+	}), "the providers order on a tie")
+	assert.Equal(t, quota, dominantError(placesProviders, map[providers.ProviderLabel]error{
+		"google-provider-label": unclassified, "foursquare-provider-label": quota,
+	}), "the classified errors first")
+	assert.Equal(t, unclassified, dominantError(placesProviders, map[providers.ProviderLabel]error{"google-provider-label": unclassified}))
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"bytes"
+	"flag"
+	"github.com/codeselim/go-webservice-places-provider/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// go test ./handlers -run Golden -update rewrites the golden files
+var updateGoldenFiles = flag.Bool("update", false, "update the golden files")
+
+var goldenPlaces = api.Places{
+	apiPlaceFromGoogle,
+	apiPlaceFromFoursquare,
+	{
+		ID:       "id3",
+		Provider: "foursquare-provider-label",
+		Name:     `=HYPERLINK("https://evil.example.com")`,
+		Address:  `Café "Le Petit" & Bar <Sydney>`,
+		URI:      "https://foursquare.com/v/id3",
+		Location: &api.Location{Lat: -33.8688, Lng: 151.2093},
+	},
+}
+
+func TestUnitEncodersGoldenFiles(t *testing.T) {
+	for format, encoder := range map[string]ResponseEncoder{"csv": csvEncoder{}, "kml": kmlEncoder{}, "gpx": gpxEncoder{}} {
+		content := &bytes.Buffer{}
+		if err := encoder.EncodePlaces(content, goldenPlaces); err != nil {
+			t.Fatal(err)
+		}
+
+		goldenFile := filepath.Join("testdata", "places."+format+".golden")
+		if *updateGoldenFiles {
+			if err := ioutil.WriteFile(goldenFile, content.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		expected, err := ioutil.ReadFile(goldenFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, string(expected), content.String(), format)
+	}
+}
+
+func TestUnitContentDisposition(t *testing.T) {
+	assert.Equal(t, `attachment; filename="results.csv"`, contentDisposition("results", "csv"))
+	assert.Equal(t, `attachment; filename="results.csv"`, contentDisposition("results.csv", "csv"))
+	assert.Equal(t, `attachment; filename="my_results_2019.kml"`, contentDisposition("my results/2019", "kml"))
+	assert.Equal(t, `attachment; filename="____evil.gpx"`, contentDisposition("\"\r\n;evil", "gpx"))
+}
+
+func TestPlacesHandlerGetPlacesDownload(t *testing.T) {
+	googlePlacesProvider := new(mockGooglePlacesProvider)
+	googlePlacesProvider.On("GetPlacesByQuery", mock.Anything, mock.Anything).Return(goldenPlaces, nil)
+	placesHandler := NewPlacesHandler(googlePlacesProvider)
+
+	rr := httptest.NewRecorder()
+	placesHandler.GetPlaces(rr, httptest.NewRequest("GET", "/api/v1/places?text=vegan&format=csv&filename=vegan", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "text/csv", rr.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="vegan.csv"`, rr.Header().Get("Content-Disposition"))
+	expected, _ := ioutil.ReadFile(filepath.Join("testdata", "places.csv.golden"))
+	assert.Equal(t, string(expected), rr.Body.String())
+	assert.Equal(t, rr.Header().Get("Content-Length"), strconv.Itoa(rr.Body.Len()))
+
+	// same ETag for the same results
+	req := httptest.NewRequest("GET", "/api/v1/places?text=vegan&format=csv", nil)
+	req.Header.Set("If-None-Match", rr.Header().Get("ETag"))
+	rr = httptest.NewRecorder()
+	placesHandler.GetPlaces(rr, req)
+	assert.Equal(t, http.StatusNotModified, rr.Code)
+}
@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"context"
+	"github.com/codeselim/go-webservice-places-provider/api"
+	"github.com/codeselim/go-webservice-places-provider/config"
+	"github.com/codeselim/go-webservice-places-provider/log"
+	"github.com/codeselim/go-webservice-places-provider/providers"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/**
+ * Geocoding: the locations of a free-form address, from the providers implementing providers.Geocoder, and the
+ * nearest address of a location with the establishments around it, from the providers implementing
+ * providers.ReverseGeocoder. The geocoders are queried in parallel as the places searches are.
+ */
+
+const addressQueryParam = "address"
+
+// agreement distances in meters by precision: two results agree when they are closer than the distance of the
+// coarser one, e.g. 5km for a postal code
+var agreementDistances = map[string]float64{
+	api.PrecisionRooftop:      100,
+	api.PrecisionInterpolated: 250,
+	api.PrecisionStreet:       1000,
+	api.PrecisionPostalCode:   5000,
+	api.PrecisionCity:         10000,
+	api.PrecisionRegion:       100000,
+	api.PrecisionCountry:      1000000,
+	api.PrecisionApproximate:  10000,
+}
+
+// GetGeocoding serves the locations of the free-form address query param, the most likely first
+func (p *PlacesHandler) GetGeocoding(w http.ResponseWriter, r *http.Request) {
+	address := strings.TrimSpace(r.URL.Query().Get(addressQueryParam))
+	if address == "" || len(address) > config.MaxGeocodeAddressLength {
+		HandleError(newBadRequestError(r, api.AddressParamIsMissingErrorCode), w, r)
+		return
+	}
+	language, err := getLanguage(r)
+	if err != nil {
+		HandleError(err, w, r)
+		return
+	}
+	placesProviders, err := p.AllowedProviders(r.Context())
+	if err != nil {
+		HandleError(err, w, r)
+		return
+	}
+	geocoders, err := filterGeocoders(r.Context(), placesProviders, func(provider providers.Provider) bool {
+		_, ok := provider.(providers.Geocoder)
+		return ok
+	})
+	if err != nil {
+		HandleError(err, w, r)
+		return
+	}
+
+	results, complete, err := p.Geocode(r.Context(), geocoders, providers.GeocodeRequest{Address: address, Language: language})
+	if err != nil {
+		HandleError(err, w, r)
+		return
+	}
+	policy := newProvidersCachePolicy(r, geocoders, complete)
+	if r.URL.Query().Get(languageQueryParam) == "" {
+		policy.vary = append(policy.vary, "Accept-Language")
+	}
+	writeCacheableJSON(w, r, results, policy)
+}
+
+// Geocode queries the geocoders in parallel and scores the agreement of their results. The results are not complete
+// when a provider failed, the dominant error is returned when all of them failed
+func (p *PlacesHandler) Geocode(ctx context.Context, geocoders []providers.Provider, request providers.GeocodeRequest) (api.GeocodingResults, bool, error) {
+	providersResults := map[providers.ProviderLabel]api.GeocodingResults{}
+	providersErrors := map[providers.ProviderLabel]error{}
+	fanOut(geocoders, func(provider providers.Provider) (func(), error) {
+		results, err := provider.(providers.Geocoder).Geocode(ctx, request)
+		return func() {
+			if err != nil {
+				log.GetLoggerWithContext(ctx).Error(err.Error()) //log error instead and return what is collected
+				providersErrors[provider.GetProviderLabel()] = err
+				return
+			}
+			providersResults[provider.GetProviderLabel()] = results
+		}, err
+	})
+	if len(providersErrors) > 0 && len(providersResults) == 0 {
+		// no results at all would read as an unknown address
+		return nil, false, dominantError(geocoders, providersErrors)
+	}
+
+	// in the providers order, not the answers one: the equally scored results keep a stable order
+	results := api.GeocodingResults{}
+	for _, provider := range geocoders {
+		results = append(results, providersResults[provider.GetProviderLabel()]...)
+	}
+	scoreAgreement(results, len(providersResults))
+	return results, len(providersErrors) == 0, nil
+}
+
+// scoreAgreement sets the agreement of the results: the share of the answering providers with a result close enough,
+// the result provider included. The most agreed results come first, then the most confident ones
+func scoreAgreement(results api.GeocodingResults, answering int) {
+	for i := range results {
+		agreeing := map[string]bool{results[i].Provider: true}
+		for _, other := range results {
+			if !agreeing[other.Provider] && agree(results[i], other) {
+				agreeing[other.Provider] = true
+			}
+		}
+		results[i].Agreement = float64(len(agreeing)) / float64(answering)
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Agreement != results[j].Agreement {
+			return results[i].Agreement > results[j].Agreement
+		}
+		return results[i].Confidence > results[j].Confidence
+	})
+}
+
+func agree(result api.GeocodingResult, other api.GeocodingResult) bool {
+	maxDistance := math.Max(agreementDistances[result.Precision], agreementDistances[other.Precision])
+	return distanceFrom(providers.Location{Lat: result.Location.Lat, Lng: result.Location.Lng}, &other.Location) <= maxDistance
+}
+
+// GetReverseGeocoding serves the nearest address and establishments of the latitude and longitude query params
+func (p *PlacesHandler) GetReverseGeocoding(w http.ResponseWriter, r *http.Request) {
+	location, err := getRequiredLocation(r)
+	if err != nil {
+		HandleError(err, w, r)
+		return
+	}
+	language, err := getLanguage(r)
+	if err != nil {
+		HandleError(err, w, r)
+		return
+	}
+	placesProviders, err := p.AllowedProviders(r.Context())
+	if err != nil {
+		HandleError(err, w, r)
+		return
+	}
+	geocoders, err := filterGeocoders(r.Context(), placesProviders, func(provider providers.Provider) bool {
+		_, ok := provider.(providers.ReverseGeocoder)
+		return ok
+	})
+	if err != nil {
+		HandleError(err, w, r)
+		return
+	}
+
+	geocoding, complete, err := p.ReverseGeocode(r.Context(), geocoders, providers.ReverseGeocodeRequest{Location: location, Language: language})
+	if err != nil {
+		HandleError(err, w, r)
+		return
+	}
+	policy := newProvidersCachePolicy(r, geocoders, complete)
+	if r.URL.Query().Get(languageQueryParam) == "" {
+		policy.vary = append(policy.vary, "Accept-Language")
+	}
+	writeCacheableJSON(w, r, geocoding, policy)
+}
+
+// ReverseGeocode queries the reverse geocoders in parallel: the address nearest to the location wins and the
+// establishments are merged, the nearest first. The geocoding is not complete when a provider failed, the dominant
+// error is returned when all of them failed
+func (p *PlacesHandler) ReverseGeocode(ctx context.Context, geocoders []providers.Provider, request providers.ReverseGeocodeRequest) (api.ReverseGeocoding, bool, error) {
+	geocoding := api.ReverseGeocoding{Places: api.Places{}}
+	providersErrors := map[providers.ProviderLabel]error{}
+	nearest := math.Inf(1)
+	fanOut(geocoders, func(provider providers.Provider) (func(), error) {
+		result, err := provider.(providers.ReverseGeocoder).ReverseGeocode(ctx, request)
+		return func() {
+			if err != nil {
+				log.GetLoggerWithContext(ctx).Error(err.Error()) //log error instead and return what is collected
+				providersErrors[provider.GetProviderLabel()] = err
+				return
+			}
+			geocoding.Places = append(geocoding.Places, result.Places...)
+			if result.Address == nil || result.Location == nil {
+				return
+			}
+			if d := distanceFrom(request.Location, result.Location); d < nearest {
+				nearest = d
+				geocoding.Address, geocoding.Location, geocoding.Provider = result.Address, result.Location, result.Provider
+			}
+		}, err
+	})
+	if len(providersErrors) == len(geocoders) {
+		// no address at all would read as a location without address
+		return api.ReverseGeocoding{}, false, dominantError(geocoders, providersErrors)
+	}
+	sort.SliceStable(geocoding.Places, func(i, j int) bool {
+		return distanceFrom(request.Location, geocoding.Places[i].Location) < distanceFrom(request.Location, geocoding.Places[j].Location)
+	})
+	return geocoding, len(providersErrors) == 0, nil
+}
+
+// filterGeocoders keeps the providers implementing a geocoding interface, at least one of them has to
+func filterGeocoders(ctx context.Context, placesProviders []providers.Provider, isGeocoder func(provider providers.Provider) bool) ([]providers.Provider, error) {
+	geocoders := []providers.Provider{}
+	for _, provider := range placesProviders {
+		if isGeocoder(provider) {
+			geocoders = append(geocoders, provider)
+		}
+	}
+	if len(geocoders) == 0 {
+		return nil, newBadRequestErrorWithContext(ctx, api.GeocodingNotSupportedErrorCode)
+	}
+	return geocoders, nil
+}
+
+// getRequiredLocation returns the location of the latitude and longitude query params, both are required
+func getRequiredLocation(r *http.Request) (providers.Location, error) {
+	keys := r.URL.Query()
+	lat, errLat := strconv.ParseFloat(keys.Get("latitude"), 64)
+	lng, errLng := strconv.ParseFloat(keys.Get("longitude"), 64)
+	if errLat != nil || errLng != nil || !validPosition(lng, lat) {
+		return providers.Location{}, newBadRequestError(r, api.LatLngParamMalformedErrorCode)
+	}
+	return providers.Location{Lat: lat, Lng: lng}, nil
+}
+
+// distanceFrom returns the distance of a place location in meters, infinite without location
+func distanceFrom(from providers.Location, location *api.Location) float64 {
+	if location == nil {
+		return math.Inf(1)
+	}
+	return providers.Distance(from, providers.Location{Lat: location.Lat, Lng: location.Lng})
+}
@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/codeselim/go-webservice-places-provider/api"
+	"github.com/codeselim/go-webservice-places-provider/providers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type mockGeocodingGooglePlacesProvider struct {
+	mockGooglePlacesProvider
+}
+
+func (m *mockGeocodingGooglePlacesProvider) Geocode(ctx context.Context, request providers.GeocodeRequest) (api.GeocodingResults, error) {
+	args := m.Called(ctx, request)
+	return args.Get(0).(api.GeocodingResults), args.Error(1)
+}
+func (m *mockGeocodingGooglePlacesProvider) ReverseGeocode(ctx context.Context, request providers.ReverseGeocodeRequest) (api.ReverseGeocoding, error) {
+	args := m.Called(ctx, request)
+	return args.Get(0).(api.ReverseGeocoding), args.Error(1)
+}
+
+// a geocoding only provider, as Nominatim
+type mockGeocoderProvider struct {
+	mockFourSquarePlacesProvider
+}
+
+func (m *mockGeocoderProvider) GetProviderLabel() providers.ProviderLabel {
+	return "geocoder-provider-label"
+}
+func (m *mockGeocoderProvider) GetSearchModes() []providers.SearchMode {
+	return []providers.SearchMode{}
+}
+func (m *mockGeocoderProvider) Geocode(ctx context.Context, request providers.GeocodeRequest) (api.GeocodingResults, error) {
+	args := m.Called(ctx, request)
+	return args.Get(0).(api.GeocodingResults), args.Error(1)
+}
+func (m *mockGeocoderProvider) ReverseGeocode(ctx context.Context, request providers.ReverseGeocodeRequest) (api.ReverseGeocoding, error) {
+	args := m.Called(ctx, request)
+	return args.Get(0).(api.ReverseGeocoding), args.Error(1)
+}
+
+func getReverseGeocoding(t *testing.T, rr *httptest.ResponseRecorder) api.ReverseGeocoding {
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	geocoding := api.ReverseGeocoding{}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &geocoding))
+	return geocoding
+}
+
+func TestPlacesHandlerGetReverseGeocoding(t *testing.T) {
+	googleProvider := new(mockGeocodingGooglePlacesProvider)
+	googleProvider.On("ReverseGeocode", mock.Anything, mock.Anything).Return(api.ReverseGeocoding{
+		Address:  &api.Address{Street: "Jungfernstieg", HouseNumber: "1", City: "Hamburg", Formatted: "Jungfernstieg 1, 20095 Hamburg"},
+		Location: &api.Location{Lat: 53.5530, Lng: 9.9930},
+		Provider: "google-provider-label",
+		Places:   api.Places{{ID: "far", Location: &api.Location{Lat: 53.5515, Lng: 9.9937}}},
+	}, nil)
+	geocoderProvider := new(mockGeocoderProvider)
+	geocoderProvider.On("ReverseGeocode", mock.Anything, mock.Anything).Return(api.ReverseGeocoding{
+		Address:  &api.Address{Street: "Jungfernstieg", HouseNumber: "2", City: "Hamburg", Formatted: "Jungfernstieg 2, 20095 Hamburg"},
+		Location: &api.Location{Lat: 53.5512, Lng: 9.9937},
+		Provider: "geocoder-provider-label",
+		Places:   api.Places{{ID: "near", Location: &api.Location{Lat: 53.5511, Lng: 9.9937}}},
+	}, nil)
+	foursquareProvider := new(mockFourSquarePlacesProvider) // not a geocoder, skipped
+	placesHandler := NewPlacesHandler(googleProvider, geocoderProvider, foursquareProvider)
+
+	rr := httptest.NewRecorder()
+	placesHandler.GetReverseGeocoding(rr, httptest.NewRequest("GET", "/api/v1/geocode/reverse?latitude=53.5511&longitude=9.9937&language=de", nil))
+	geocoding := getReverseGeocoding(t, rr)
+	assert.Equal(t, "Jungfernstieg 2, 20095 Hamburg", geocoding.Address.Formatted)
+	assert.Equal(t, "2", geocoding.Address.HouseNumber)
+	assert.Equal(t, "geocoder-provider-label", geocoding.Provider)
+	require.Len(t, geocoding.Places, 2)
+	assert.Equal(t, "near", geocoding.Places[0].ID)
+	assert.Equal(t, "far", geocoding.Places[1].ID)
+	assert.Equal(t, "public, no-cache", rr.Header().Get("Cache-Control"))
+	assert.NotContains(t, rr.Header()["Vary"], "Accept-Language")
+
+	googleProvider.AssertCalled(t, "ReverseGeocode", mock.Anything, providers.ReverseGeocodeRequest{
+		Location: providers.Location{Lat: 53.5511, Lng: 9.9937},
+		Language: "de",
+	})
+	foursquareProvider.AssertNotCalled(t, "GetPlacesByQuery", mock.Anything, mock.Anything)
+}
+
+func TestPlacesHandlerGetReverseGeocodingSkipOneProviderErr(t *testing.T) {
+	googleProvider := new(mockGeocodingGooglePlacesProvider)
+	googleProvider.On("ReverseGeocode", mock.Anything, mock.Anything).Return(api.ReverseGeocoding{Places: api.Places{}}, errors.New("provider failure"))
+	geocoderProvider := new(mockGeocoderProvider)
+	geocoderProvider.On("ReverseGeocode", mock.Anything, mock.Anything).Return(api.ReverseGeocoding{
+		Address:  &api.Address{Street: "Jungfernstieg", HouseNumber: "2", City: "Hamburg", Formatted: "Jungfernstieg 2, 20095 Hamburg"},
+		Location: &api.Location{Lat: 53.5512, Lng: 9.9937},
+		Provider: "geocoder-provider-label",
+		Places:   api.Places{},
+	}, nil)
+	placesHandler := NewPlacesHandler(googleProvider, geocoderProvider)
+
+	rr := httptest.NewRecorder()
+	request := httptest.NewRequest("GET", "/api/v1/geocode/reverse?latitude=53.5511&longitude=9.9937", nil)
+	request.Header.Set("Accept-Language", "fr-FR")
+	placesHandler.GetReverseGeocoding(rr, request)
+	geocoding := getReverseGeocoding(t, rr)
+	assert.Equal(t, "Jungfernstieg 2, 20095 Hamburg", geocoding.Address.Formatted)
+	assert.Empty(t, geocoding.Places)
+	assert.Contains(t, rr.Header()["Vary"], "Accept-Language")
+	geocoderProvider.AssertCalled(t, "ReverseGeocode", mock.Anything, providers.ReverseGeocodeRequest{
+		Location: providers.Location{Lat: 53.5511, Lng: 9.9937},
+		Language: "fr",
+	})
+}
+
+func TestPlacesHandlerGetReverseGeocodingAllProvidersFailed(t *testing.T) {
+	googleProvider := new(mockGeocodingGooglePlacesProvider)
+	googleProvider.On("ReverseGeocode", mock.Anything, mock.Anything).Return(api.ReverseGeocoding{},
+		&providers.ProviderError{Provider: "google-provider-label", Kind: providers.QuotaErrorKind, Err: errors.New("OVER_QUERY_LIMIT")})
+	geocoderProvider := new(mockGeocoderProvider)
+	geocoderProvider.On("ReverseGeocode", mock.Anything, mock.Anything).Return(api.ReverseGeocoding{},
+		&providers.ProviderError{Provider: "geocoder-provider-label", Kind: providers.QuotaErrorKind, Err: errors.New("429")})
+	placesHandler := NewPlacesHandler(googleProvider, geocoderProvider)
+
+	rr := httptest.NewRecorder()
+	placesHandler.GetReverseGeocoding(rr, httptest.NewRequest("GET", "/api/v1/geocode/reverse?latitude=53.5511&longitude=9.9937", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"code":`+strconv.Itoa(api.ProviderQuotaExceededErrorCode))
+}
+
+func TestPlacesHandlerGetReverseGeocodingErrors(t *testing.T) {
+	geocoderHandler := NewPlacesHandler(new(mockGeocoderProvider))
+	for _, query := range []string{"", "latitude=53.55", "latitude=53.55&longitude=east", "latitude=91&longitude=9.99"} {
+		rr := httptest.NewRecorder()
+		geocoderHandler.GetReverseGeocoding(rr, httptest.NewRequest("GET", "/api/v1/geocode/reverse?"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, rr.Code, query)
+		assert.Contains(t, rr.Body.String(), `"code":`+strconv.Itoa(api.LatLngParamMalformedErrorCode), query)
+	}
+
+	placesHandler := NewPlacesHandler(new(mockFourSquarePlacesProvider))
+	rr := httptest.NewRecorder()
+	placesHandler.GetReverseGeocoding(rr, httptest.NewRequest("GET", "/api/v1/geocode/reverse?latitude=53.55&longitude=9.99", nil))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"code":`+strconv.Itoa(api.GeocodingNotSupportedErrorCode))
+}
+
+func getGeocodingResults(t *testing.T, rr *httptest.ResponseRecorder) api.GeocodingResults {
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	results := api.GeocodingResults{}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &results))
+	return results
+}
+
+func TestPlacesHandlerGetGeocoding(t *testing.T) {
+	googleProvider := new(mockGeocodingGooglePlacesProvider)
+	googleProvider.On("Geocode", mock.Anything, mock.Anything).Return(api.GeocodingResults{
+		{Address: api.Address{City: "Hamburg", CountryCode: "DE"}, Location: api.Location{Lat: 53.5511, Lng: 9.9937},
+			Provider: "google-provider-label", Precision: api.PrecisionRooftop, Confidence: 1},
+		{Address: api.Address{City: "Hamburg", Region: "Pennsylvania", CountryCode: "US"}, Location: api.Location{Lat: 40.55, Lng: -75.98},
+			Provider: "google-provider-label", Precision: api.PrecisionCity, Confidence: 0.5},
+	}, nil)
+	geocoderProvider := new(mockGeocoderProvider)
+	geocoderProvider.On("Geocode", mock.Anything, mock.Anything).Return(api.GeocodingResults{
+		{Address: api.Address{City: "Hamburg", CountryCode: "DE"}, Location: api.Location{Lat: 53.5512, Lng: 9.9938},
+			Provider: "geocoder-provider-label", Precision: api.PrecisionRooftop, Confidence: 1},
+	}, nil)
+	placesHandler := NewPlacesHandler(new(mockFourSquarePlacesProvider), googleProvider, geocoderProvider)
+
+	rr := httptest.NewRecorder()
+	placesHandler.GetGeocoding(rr, httptest.NewRequest("GET", "/api/v1/geocode?address=Jungfernstieg+1,+Hamburg&language=de", nil))
+	results := getGeocodingResults(t, rr)
+	require.Len(t, results, 3)
+	// both providers locate the address there
+	assert.Equal(t, "google-provider-label", results[0].Provider)
+	assert.Equal(t, 1.0, results[0].Agreement)
+	assert.Equal(t, "geocoder-provider-label", results[1].Provider)
+	assert.Equal(t, 1.0, results[1].Agreement)
+	assert.Equal(t, "US", results[2].Address.CountryCode)
+	assert.Equal(t, 0.5, results[2].Agreement)
+
+	geocoderProvider.AssertCalled(t, "Geocode", mock.Anything, providers.GeocodeRequest{Address: "Jungfernstieg 1, Hamburg", Language: "de"})
+}
+
+func TestPlacesHandlerGetGeocodingSkipOneProviderErr(t *testing.T) {
+	googleProvider := new(mockGeocodingGooglePlacesProvider)
+	googleProvider.On("Geocode", mock.Anything, mock.Anything).Return(api.GeocodingResults{}, errors.New("provider failure"))
+	geocoderProvider := new(mockGeocoderProvider)
+	geocoderProvider.On("Geocode", mock.Anything, mock.Anything).Return(api.GeocodingResults{
+		{Location: api.Location{Lat: 53.5512, Lng: 9.9938}, Provider: "geocoder-provider-label", Precision: api.PrecisionStreet, Confidence: 0.7},
+	}, nil)
+	placesHandler := NewPlacesHandler(googleProvider, geocoderProvider)
+
+	rr := httptest.NewRecorder()
+	placesHandler.GetGeocoding(rr, httptest.NewRequest("GET", "/api/v1/geocode?address=Jungfernstieg", nil))
+	results := getGeocodingResults(t, rr)
+	require.Len(t, results, 1)
+	assert.Equal(t, 1.0, results[0].Agreement) // the failing provider doesn't count
+	assert.Equal(t, "public, no-cache", rr.Header().Get("Cache-Control"))
+	assert.Contains(t, rr.Header()["Vary"], "Accept-Language")
+}
+
+func TestPlacesHandlerGetGeocodingAllProvidersFailed(t *testing.T) {
+	googleProvider := new(mockGeocodingGooglePlacesProvider)
+	googleProvider.On("Geocode", mock.Anything, mock.Anything).Return(api.GeocodingResults{},
+		&providers.ProviderError{Provider: "google-provider-label", Kind: providers.UpstreamErrorKind, Err: errors.New("UNKNOWN_ERROR")})
+	geocoderProvider := new(mockGeocoderProvider)
+	geocoderProvider.On("Geocode", mock.Anything, mock.Anything).Return(api.GeocodingResults{}, errors.New("unclassified"))
+	placesHandler := NewPlacesHandler(googleProvider, geocoderProvider)
+
+	rr := httptest.NewRecorder()
+	placesHandler.GetGeocoding(rr, httptest.NewRequest("GET", "/api/v1/geocode?address=Jungfernstieg", nil))
+	// the classified failure wins over the unknown one
+	assert.Equal(t, http.StatusBadGateway, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"code":`+strconv.Itoa(api.ProviderUnavailableErrorCode))
+}
+
+func TestPlacesHandlerGetGeocodingErrors(t *testing.T) {
+	geocoderHandler := NewPlacesHandler(new(mockGeocoderProvider))
+	for _, query := range []string{"", "address=+", "address=" + strings.Repeat("a", 257)} {
+		rr := httptest.NewRecorder()
+		geocoderHandler.GetGeocoding(rr, httptest.NewRequest("GET", "/api/v1/geocode?"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, rr.Code, query)
+		assert.Contains(t, rr.Body.String(), `"code":`+strconv.Itoa(api.AddressParamIsMissingErrorCode), query)
+	}
+
+	placesHandler := NewPlacesHandler(new(mockFourSquarePlacesProvider))
+	rr := httptest.NewRecorder()
+	placesHandler.GetGeocoding(rr, httptest.NewRequest("GET", "/api/v1/geocode?address=Hamburg", nil))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"code":`+strconv.Itoa(api.GeocodingNotSupportedErrorCode))
+}
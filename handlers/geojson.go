@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/codeselim/go-webservice-places-provider/api"
+	"io"
+)
+
+/**
+ * GeoJSON (RFC 7946) encoder: places are returned as a FeatureCollection of Point features.
+ * Places without coordinates are kept, with a null geometry (an "unlocated" feature, RFC 7946 section 3.2),
+ * so the GeoJSON and JSON responses always hold the same places. Map libraries skip such features.
+ * The details of a place are a single Feature, unlocated as well: the providers details have no coordinates yet.
+ */
+
+type geoJSONEncoder struct{}
+
+func (geoJSONEncoder) ContentType() string {
+	return "application/geo+json"
+}
+
+func (geoJSONEncoder) FileExtension() string {
+	return "geojson"
+}
+
+func (geoJSONEncoder) EncodePlaces(w io.Writer, places api.Places) error {
+	return json.NewEncoder(w).Encode(toFeatureCollection(places))
+}
+
+func toFeatureCollection(places api.Places) api.FeatureCollection {
+	collection := api.FeatureCollection{
+		Type:     "FeatureCollection",
+		Features: make([]api.Feature, 0, len(places)),
+	}
+	for _, place := range places {
+		collection.Features = append(collection.Features, toFeature(place))
+	}
+	return collection
+}
+
+func toFeature(place api.Place) api.Feature {
+	feature := api.Feature{
+		Type: "Feature",
+		ID:   place.Provider + ":" + place.ID, // ids are only unique per provider
+		Properties: api.FeatureProperties{
+			ID:         place.ID,
+			Provider:   place.Provider,
+			Name:       place.Name,
+			Address:    place.Address,
+			URI:        place.URI,
+			Categories: place.Categories,
+		},
+	}
+	if place.Location != nil {
+		feature.Geometry = &api.Geometry{
+			Type:        "Point",
+			Coordinates: []float64{place.Location.Lng, place.Location.Lat},
+		}
+	}
+	return feature
+}
+
+// toDetailsFeature returns the details of a place of provider, served at uri, as an unlocated feature
+func toDetailsFeature(provider string, uri string, details api.PlaceDetails) api.Feature {
+	return api.Feature{
+		Type: "Feature",
+		ID:   provider + ":" + details.ID,
+		Properties: api.FeatureProperties{
+			ID:       details.ID,
+			Provider: provider,
+			Name:     details.Name,
+			URI:      uri,
+		},
+	}
+}
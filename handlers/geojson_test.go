@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/codeselim/go-webservice-places-provider/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPlacesHandlerGetPlacesGeoJSON(t *testing.T) {
+	googlePlacesProvider := new(mockGooglePlacesProvider)
+	googlePlacesProvider.On("GetPlacesByQuery", mock.Anything, mock.Anything).Return(api.Places{apiPlaceFromGoogle}, nil)
+	foursquarePlacesProvider := new(mockFourSquarePlacesProvider)
+	foursquarePlacesProvider.On("GetPlacesByQuery", mock.Anything, mock.Anything).Return(api.Places{apiPlaceFromFoursquare}, nil)
+	placesHandler := NewPlacesHandler(foursquarePlacesProvider, googlePlacesProvider)
+
+	req := httptest.NewRequest("GET", "/api/v1/places?text=vegan", nil)
+	req.Header.Set("Accept", "application/geo+json")
+	rr := httptest.NewRecorder()
+	placesHandler.GetPlaces(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/geo+json", rr.Header().Get("Content-Type"))
+	// in the providers order
+	collection := toFeatureCollection(api.Places{apiPlaceFromFoursquare, apiPlaceFromGoogle})
+	assert.Equal(t, mustMarshal(t, collection), rr.Body.String())
+}
+
+func TestUnitToFeatureCollection(t *testing.T) {
+	expected := `{
+		"type": "FeatureCollection",
+		"features": [
+			{
+				"type": "Feature",
+				"id": "foursquare-provider-label:id2",
+				"geometry": {"type": "Point", "coordinates": [16.77, 32.22]},
+				"properties": {"id": "id2", "provider": "foursquare-provider-label", "name": "place2", "address": "address2", "uri": "Uri2"}
+			},
+			{
+				"type": "Feature",
+				"id": "google-provider-label:id1",
+				"geometry": null,
+				"properties": {"id": "id1", "provider": "google-provider-label", "name": "place1", "address": "address1", "uri": "Uri1"}
+			}
+		]
+	}`
+	assert.JSONEq(t, expected, mustMarshal(t, toFeatureCollection(api.Places{apiPlaceFromFoursquare, apiPlaceFromGoogle})))
+
+	// no places: an empty collection, not null
+	assert.JSONEq(t, `{"type": "FeatureCollection", "features": []}`, mustMarshal(t, toFeatureCollection(api.Places{})))
+}
+
+// same serialization as the encoders
+func mustMarshal(t *testing.T, value interface{}) string {
+	content := &bytes.Buffer{}
+	if err := json.NewEncoder(content).Encode(value); err != nil {
+		t.Fatal(err)
+	}
+	return content.String()
+}
+
+func TestPlacesHandlerGetPlaceGeoJSON(t *testing.T) {
+	googlePlacesProvider := new(mockGooglePlacesProvider)
+	googlePlacesProvider.On("GetPlaceDetails", mock.Anything, "id1").Return(api.PlaceDetails{ID: "id1", Name: "place1"}, nil)
+	placesHandler := NewPlacesHandler(googlePlacesProvider)
+
+	req := newPlaceRequest("google-provider-label", "id1")
+	req.Header.Set("Accept", "application/geo+json")
+	rr := httptest.NewRecorder()
+	placesHandler.GetPlace(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/geo+json", rr.Header().Get("Content-Type"))
+	assert.Contains(t, rr.Header().Values("Vary"), "Accept")
+
+	feature := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &feature))
+	assert.Equal(t, "Feature", feature["type"])
+	assert.Equal(t, "google-provider-label:id1", feature["id"])
+	assert.Contains(t, feature, "geometry")
+	assert.Nil(t, feature["geometry"], "the details have no coordinates")
+	assert.Equal(t, map[string]interface{}{"id": "id1", "provider": "google-provider-label", "name": "place1",
+		"uri": "/api/v1/places/google-provider-label/id1"}, feature["properties"])
+
+	// a single place has no csv, kml or gpx representation
+	rr = httptest.NewRecorder()
+	req = newPlaceRequest("google-provider-label", "id1")
+	req.URL.RawQuery = "format=csv"
+	placesHandler.GetPlace(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
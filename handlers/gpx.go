@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"github.com/codeselim/go-webservice-places-provider/api"
+	"io"
+)
+
+/**
+ * GPX 1.1 encoder (GPS devices), one waypoint per place: name, address as description, provider as source
+ * and uri as link. A GPX waypoint requires coordinates, places without coordinates are skipped.
+ */
+
+const (
+	gpxNamespace = "http://www.topografix.com/GPX/1/1"
+	gpxCreator   = "go-webservice-places-provider"
+)
+
+type gpxWaypoint struct {
+	XMLName xml.Name `xml:"wpt"`
+	Lat     float64  `xml:"lat,attr"`
+	Lon     float64  `xml:"lon,attr"`
+	Name    string   `xml:"name"`
+	Desc    string   `xml:"desc,omitempty"`
+	Src     string   `xml:"src,omitempty"`
+	Link    *gpxLink `xml:"link,omitempty"`
+}
+
+type gpxLink struct {
+	Href string `xml:"href,attr"`
+}
+
+type gpxEncoder struct{}
+
+func (gpxEncoder) ContentType() string {
+	return "application/gpx+xml"
+}
+
+func (gpxEncoder) FileExtension() string {
+	return "gpx"
+}
+
+func (gpxEncoder) EncodePlaces(w io.Writer, places api.Places) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	gpx := xml.StartElement{
+		Name: xml.Name{Local: "gpx"},
+		Attr: []xml.Attr{
+			{Name: xml.Name{Local: "version"}, Value: "1.1"},
+			{Name: xml.Name{Local: "creator"}, Value: gpxCreator},
+			{Name: xml.Name{Local: "xmlns"}, Value: gpxNamespace},
+		},
+	}
+	if err := encoder.EncodeToken(gpx); err != nil {
+		return err
+	}
+	for _, place := range places {
+		if place.Location == nil {
+			continue
+		}
+		if err := encoder.Encode(toGPXWaypoint(place)); err != nil {
+			return err
+		}
+	}
+	if err := encoder.EncodeToken(gpx.End()); err != nil {
+		return err
+	}
+	if err := encoder.Flush(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func toGPXWaypoint(place api.Place) gpxWaypoint {
+	waypoint := gpxWaypoint{
+		Lat:  place.Location.Lat,
+		Lon:  place.Location.Lng,
+		Name: place.Name,
+		Desc: place.Address,
+		Src:  place.Provider,
+	}
+	if place.URI != "" {
+		waypoint.Link = &gpxLink{Href: place.URI}
+	}
+	return waypoint
+}
@@ -0,0 +1,320 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/codeselim/go-webservice-places-provider/api"
+	"github.com/codeselim/go-webservice-places-provider/config"
+	"github.com/codeselim/go-webservice-places-provider/log"
+	"github.com/codeselim/go-webservice-places-provider/providers"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/location"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"net/http"
+)
+
+/**
+ * GraphQL endpoint: a places search and the selected details fields of the found places in one round trip.
+ * It runs on the places aggregation core, the details are fetched through a per query dataloader.
+ * The errors carry the api.Error code, type and traceId in their extensions.
+ */
+
+type GraphQLHandler struct {
+	placesHandler *PlacesHandler
+	schema        graphql.Schema
+	maxComplexity int
+}
+
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+func NewGraphQLHandler(placesHandler *PlacesHandler, maxComplexity int) *GraphQLHandler {
+	if placesHandler == nil {
+		log.GetLogger().Panic("places handler should be provided")
+	}
+	if maxComplexity <= 0 {
+		maxComplexity = config.DefaultGraphQLMaxComplexity
+	}
+	g := &GraphQLHandler{placesHandler: placesHandler, maxComplexity: maxComplexity}
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{Query: g.queryType()})
+	if err != nil {
+		log.GetLogger().Panic(err)
+	}
+	g.schema = schema
+	return g
+}
+
+// ServeHTTP answers the GET (query string) and POST (json body) GraphQL requests
+func (g *GraphQLHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	request, err := parseGraphQLRequest(r)
+	if err != nil {
+		HandleError(err, w, r)
+		return
+	}
+
+	sessionID, err := getSessionID(r)
+	if err != nil {
+		HandleError(err, w, r)
+		return
+	}
+
+	// the details fetched within a session conclude it
+	result := g.execute(providers.WithSessionID(r.Context(), sessionID), request)
+
+	setDefaultHeaders(w)
+	w.Header().Set("Cache-Control", "private, no-store")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		log.GetLoggerWithContext(r.Context()).Error(err.Error())
+	}
+}
+
+func parseGraphQLRequest(r *http.Request) (graphQLRequest, error) {
+	request := graphQLRequest{}
+	malformed := newBadRequestError(r, api.MalformedGraphQLRequestErrorCode)
+
+	if r.Method == http.MethodPost {
+		body := http.MaxBytesReader(nil, r.Body, config.MaxGraphQLRequestBytes)
+		if err := json.NewDecoder(body).Decode(&request); err != nil {
+			return request, malformed
+		}
+	} else {
+		keys := r.URL.Query()
+		request.Query = keys.Get("query")
+		request.OperationName = keys.Get("operationName")
+		if variables := keys.Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &request.Variables); err != nil {
+				return request, malformed
+			}
+		}
+	}
+	if request.Query == "" {
+		return request, malformed
+	}
+	return request, nil
+}
+
+// execute parses, validates and estimates the query before running it
+func (g *GraphQLHandler) execute(ctx context.Context, request graphQLRequest) *graphql.Result {
+	document, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{
+		Body: []byte(request.Query),
+		Name: "GraphQL request",
+	})})
+	if err != nil {
+		return &graphql.Result{Errors: gqlerrors.FormatErrors(err)}
+	}
+	validation := graphql.ValidateDocument(&g.schema, document, nil)
+	if !validation.IsValid {
+		return &graphql.Result{Errors: validation.Errors}
+	}
+	if complexity := queryComplexity(document, request.OperationName, request.Variables); complexity > g.maxComplexity {
+		apiError := newGraphQLError(ctx, newBadRequestErrorWithContext(ctx, api.QueryTooComplexErrorCode))
+		return &graphql.Result{Errors: []gqlerrors.FormattedError{{
+			Message:    apiError.Error(),
+			Locations:  []location.SourceLocation{},
+			Extensions: apiError.Extensions(),
+		}}}
+	}
+
+	loader := newDetailsLoader(ctx, g.placesHandler)
+	result := graphql.Execute(graphql.ExecuteParams{
+		Schema:        g.schema,
+		AST:           document,
+		OperationName: request.OperationName,
+		Args:          request.Variables,
+		Context:       withDetailsLoader(ctx, loader),
+	})
+	result.Errors = append(result.Errors, loader.errors...)
+	return result
+}
+
+func (g *GraphQLHandler) queryType() *graphql.Object {
+	locationType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Location",
+		Fields: graphql.Fields{
+			"lat": &graphql.Field{Type: graphql.NewNonNull(graphql.Float)},
+			"lng": &graphql.Field{Type: graphql.NewNonNull(graphql.Float)},
+		},
+	})
+	locationInputType := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "LocationInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"lat": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.Float)},
+			"lng": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.Float)},
+		},
+	})
+	placeDetailsType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "PlaceDetails",
+		Fields: graphql.Fields{
+			"id":       &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"name":     &graphql.Field{Type: graphql.String},
+			"someText": &graphql.Field{Type: graphql.String},
+		},
+	})
+	placeType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Place",
+		Fields: graphql.Fields{
+			"id":         &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"provider":   &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"name":       &graphql.Field{Type: graphql.String},
+			"address":    &graphql.Field{Type: graphql.String},
+			"uri":        &graphql.Field{Type: graphql.String},
+			"location":   &graphql.Field{Type: locationType},
+			"categories": &graphql.Field{Type: graphql.NewList(graphql.NewNonNull(graphql.String))},
+			"details": &graphql.Field{
+				Type:        placeDetailsType,
+				Description: "Fetched from the place provider, each details fetch adds to the query complexity",
+				Resolve:     g.resolvePlaceDetails,
+			},
+		},
+	})
+
+	return graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"places": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(placeType))),
+				Args: graphql.FieldConfigArgument{
+					"text":       &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"near":       &graphql.ArgumentConfig{Type: locationInputType},
+					"radius":     &graphql.ArgumentConfig{Type: graphql.Int, Description: "Search radius in kilometers, from 1 to 50"},
+					"providers":  &graphql.ArgumentConfig{Type: graphql.NewList(graphql.NewNonNull(graphql.String))},
+					"categories": &graphql.ArgumentConfig{Type: graphql.NewList(graphql.NewNonNull(graphql.String))},
+					"limit":      &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: config.DefaultGraphQLPlacesLimit},
+				},
+				Resolve: g.resolvePlaces,
+			},
+			"place": &graphql.Field{
+				Type: placeDetailsType,
+				Args: graphql.FieldConfigArgument{
+					"provider": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"id":       &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: g.resolvePlace,
+			},
+		},
+	})
+}
+
+func (g *GraphQLHandler) resolvePlaces(p graphql.ResolveParams) (interface{}, error) {
+	ctx := p.Context
+	request := providers.PlaceSearchRequest{SessionID: providers.GetSessionID(ctx)}
+	request.InputString, _ = p.Args["text"].(string)
+	if request.InputString == "" {
+		return nil, newGraphQLError(ctx, newBadRequestErrorWithContext(ctx, api.TextInputParamIsMissingErrorCode))
+	}
+	if near, ok := p.Args["near"].(map[string]interface{}); ok {
+		lat, _ := near["lat"].(float64)
+		lng, _ := near["lng"].(float64)
+		request.Location = &providers.Location{Lat: lat, Lng: lng}
+	}
+	if radius, ok := p.Args["radius"].(int); ok {
+		if radius < 1 || radius > config.MaxAllowedSearchRadius {
+			return nil, newGraphQLError(ctx, newBadRequestErrorWithContext(ctx, api.RadiusParamMalformedErrorCode))
+		}
+		request.Radius = radius
+	}
+	if categories, ok := p.Args["categories"].([]interface{}); ok {
+		for _, name := range categories {
+			category, ok := providers.ParseSearchCategory(name.(string))
+			if !ok {
+				return nil, newGraphQLError(ctx, newBadRequestErrorWithContext(ctx, api.CategoryParamMalformedErrorCode))
+			}
+			request.Categories = append(request.Categories, category)
+		}
+	}
+	limit, _ := p.Args["limit"].(int)
+	if limit < 1 || limit > config.MaxGraphQLPlacesLimit {
+		return nil, newGraphQLError(ctx, newBadRequestErrorWithContext(ctx, api.LimitParamMalformedErrorCode))
+	}
+
+	placesProviders, err := g.placesHandler.AllowedProviders(ctx)
+	if err != nil {
+		return nil, newGraphQLError(ctx, err)
+	}
+	if labels, ok := p.Args["providers"].([]interface{}); ok {
+		if placesProviders, err = g.placesHandler.selectProviders(ctx, placesProviders, labels); err != nil {
+			return nil, newGraphQLError(ctx, err)
+		}
+	}
+
+	places, _, err := g.placesHandler.SearchPlaces(ctx, placesProviders, request)
+	if err != nil {
+		return nil, newGraphQLError(ctx, err)
+	}
+	if len(places) > limit {
+		places = places[:limit]
+	}
+	return places, nil
+}
+
+func (g *GraphQLHandler) resolvePlaceDetails(p graphql.ResolveParams) (interface{}, error) {
+	place, ok := p.Source.(api.Place)
+	if !ok {
+		return nil, nil
+	}
+	if apiError := CheckScope(p.Context, ScopePlacesDetails); apiError != nil {
+		return nil, newGraphQLError(p.Context, apiError)
+	}
+	return g.loadDetails(p, place.Provider, place.ID), nil
+}
+
+func (g *GraphQLHandler) resolvePlace(p graphql.ResolveParams) (interface{}, error) {
+	if apiError := CheckScope(p.Context, ScopePlacesDetails); apiError != nil {
+		return nil, newGraphQLError(p.Context, apiError)
+	}
+	provider, _ := p.Args["provider"].(string)
+	id, _ := p.Args["id"].(string)
+	return g.loadDetails(p, provider, id), nil
+}
+
+// returns the thunk of the dataloader. The executor drops the extensions of the errors returned by the thunks:
+// a failed fetch resolves to null and its error is added to the result once the query is executed
+func (g *GraphQLHandler) loadDetails(p graphql.ResolveParams, provider string, id string) func() (interface{}, error) {
+	thunk := detailsLoaderFromContext(p.Context).load(provider, id)
+	return func() (interface{}, error) {
+		details, err := thunk()
+		if err != nil {
+			located := graphql.NewLocatedErrorWithPath(newGraphQLError(p.Context, err), graphql.FieldASTsToNodeASTs(p.Info.FieldASTs), p.Info.Path.AsArray())
+			detailsLoaderFromContext(p.Context).addError(gqlerrors.FormatError(located))
+			return nil, nil
+		}
+		return details, nil
+	}
+}
+
+// graphQLError exposes an api.Error in the GraphQL errors extensions
+type graphQLError struct {
+	apiError *api.Error
+}
+
+// newGraphQLError logs the error, unexpected errors are hidden behind an internal error as the http errors handler does
+func newGraphQLError(ctx context.Context, err error) *graphQLError {
+	log.GetLoggerWithContext(ctx).Error(err.Error())
+	return &graphQLError{apiError: ToAPIError(ctx, err)}
+}
+
+func (e *graphQLError) Error() string {
+	return e.apiError.Message
+}
+
+func (e *graphQLError) Extensions() map[string]interface{} {
+	extensions := map[string]interface{}{
+		"status":  e.apiError.StatusCode,
+		"traceId": e.apiError.TraceId,
+	}
+	if e.apiError.Code != 0 {
+		extensions["code"] = e.apiError.Code
+	}
+	if e.apiError.Type != "" {
+		extensions["type"] = e.apiError.Type
+	}
+	if e.apiError.RetryAfter > 0 {
+		extensions["retryAfter"] = e.apiError.RetryAfter
+	}
+	return extensions
+}
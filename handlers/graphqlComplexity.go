@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"github.com/codeselim/go-webservice-places-provider/config"
+	"github.com/graphql-go/graphql/language/ast"
+	"strconv"
+)
+
+/**
+ * Static complexity of a GraphQL operation, checked before running it so a query can't fan out unbounded
+ * details fetches. A field costs 1, a place details fetch costs config.GraphQLDetailsCost, and the fields
+ * selected on a places list are multiplied by its limit: an upper bound, whatever the providers return.
+ */
+
+type complexityEstimator struct {
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]interface{}
+}
+
+// queryComplexity returns the complexity of the executed operation, 0 when there is none (the execution reports it)
+func queryComplexity(document *ast.Document, operationName string, variables map[string]interface{}) int {
+	estimator := complexityEstimator{fragments: map[string]*ast.FragmentDefinition{}, variables: variables}
+	var operation *ast.OperationDefinition
+	for _, definition := range document.Definitions {
+		switch definition := definition.(type) {
+		case *ast.FragmentDefinition:
+			estimator.fragments[definition.Name.Value] = definition
+		case *ast.OperationDefinition:
+			if operation != nil {
+				continue
+			}
+			if operationName == "" || (definition.Name != nil && definition.Name.Value == operationName) {
+				operation = definition
+			}
+		}
+	}
+	if operation == nil {
+		return 0
+	}
+	return estimator.selectionSet(operation.SelectionSet)
+}
+
+// fragments cycles are rejected by the validation, before the estimation
+func (e *complexityEstimator) selectionSet(selectionSet *ast.SelectionSet) int {
+	if selectionSet == nil {
+		return 0
+	}
+	complexity := 0
+	for _, selection := range selectionSet.Selections {
+		switch selection := selection.(type) {
+		case *ast.Field:
+			complexity += e.field(selection)
+		case *ast.InlineFragment:
+			complexity += e.selectionSet(selection.SelectionSet)
+		case *ast.FragmentSpread:
+			if fragment, ok := e.fragments[selection.Name.Value]; ok {
+				complexity += e.selectionSet(fragment.SelectionSet)
+			}
+		}
+	}
+	return complexity
+}
+
+func (e *complexityEstimator) field(field *ast.Field) int {
+	children := e.selectionSet(field.SelectionSet)
+	switch field.Name.Value {
+	case "places":
+		return 1 + e.limit(field)*children
+	case "place", "details":
+		return config.GraphQLDetailsCost + children
+	}
+	return 1 + children
+}
+
+// the limit argument of a places field, bounded as the resolver does
+func (e *complexityEstimator) limit(field *ast.Field) int {
+	limit := config.DefaultGraphQLPlacesLimit
+	for _, argument := range field.Arguments {
+		if argument.Name.Value != "limit" {
+			continue
+		}
+		switch value := argument.Value.(type) {
+		case *ast.IntValue:
+			if l, err := strconv.Atoi(value.Value); err == nil {
+				limit = l
+			}
+		case *ast.Variable:
+			switch l := e.variables[value.Name.Value].(type) {
+			case float64: // json numbers
+				limit = int(l)
+			case int:
+				limit = l
+			}
+		}
+	}
+	if limit < 1 || limit > config.MaxGraphQLPlacesLimit {
+		return config.MaxGraphQLPlacesLimit
+	}
+	return limit
+}
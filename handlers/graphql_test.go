@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/codeselim/go-webservice-places-provider/api"
+	"github.com/codeselim/go-webservice-places-provider/auth"
+	"github.com/codeselim/go-webservice-places-provider/config"
+	"github.com/codeselim/go-webservice-places-provider/providers"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+type graphQLTestResponse struct {
+	Data   map[string]json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string                 `json:"message"`
+		Path       []interface{}          `json:"path"`
+		Extensions map[string]interface{} `json:"extensions"`
+	} `json:"errors"`
+}
+
+func postGraphQL(t *testing.T, handler http.Handler, body interface{}) (*httptest.ResponseRecorder, graphQLTestResponse) {
+	payload, err := json.Marshal(body)
+	require.NoError(t, err)
+	req := httptest.NewRequest("POST", "/graphql", bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	response := graphQLTestResponse{}
+	if rr.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	}
+	return rr, response
+}
+
+func TestGraphQLPlacesWithDetails(t *testing.T) {
+	googleProvider := new(mockGooglePlacesProvider)
+	googleProvider.On("GetPlacesByQuery", mock.Anything, providers.PlaceSearchRequest{
+		InputString: "coffee",
+		Location:    &providers.Location{Lat: 1.5, Lng: 2.5},
+		Radius:      10,
+	}).Return(api.Places{apiPlaceFromGoogle, {ID: "id3", Provider: "google-provider-label", Name: "place3"}}, nil)
+	googleProvider.On("GetPlaceDetails", mock.Anything, "id1").Return(api.PlaceDetails{ID: "id1", SomeText: "text1"}, nil)
+	googleProvider.On("GetPlaceDetails", mock.Anything, "id3").Return(api.PlaceDetails{ID: "id3", SomeText: "text3"}, nil)
+	placesHandler := NewPlacesHandler(googleProvider)
+	handler := NewGraphQLHandler(&placesHandler, 0)
+
+	rr, response := postGraphQL(t, handler, map[string]interface{}{
+		"query": `query($near: LocationInput) {
+			places(text: "coffee", near: $near, radius: 10) { id name details { someText } }
+			place(provider: "google-provider-label", id: "id1") { id someText }
+		}`,
+		"variables": map[string]interface{}{"near": map[string]float64{"lat": 1.5, "lng": 2.5}},
+	})
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	assert.Empty(t, response.Errors)
+	assert.JSONEq(t, `[
+		{"id": "id1", "name": "place1", "details": {"someText": "text1"}},
+		{"id": "id3", "name": "place3", "details": {"someText": "text3"}}
+	]`, string(response.Data["places"]))
+	assert.JSONEq(t, `{"id": "id1", "someText": "text1"}`, string(response.Data["place"]))
+	// a place asked twice is fetched once
+	googleProvider.AssertNumberOfCalls(t, "GetPlaceDetails", 2)
+}
+
+func TestGraphQLSession(t *testing.T) {
+	googleProvider := new(mockGooglePlacesProvider)
+	googleProvider.On("GetPlacesByQuery", mock.Anything, providers.PlaceSearchRequest{InputString: "coffee", SessionID: "abc-123"}).Return(api.Places{}, nil)
+	googleProvider.On("GetPlaceDetails", mock.MatchedBy(func(ctx context.Context) bool {
+		return providers.GetSessionID(ctx) == "abc-123"
+	}), "id1").Return(api.PlaceDetails{ID: "id1"}, nil)
+	placesHandler := NewPlacesHandler(googleProvider)
+	handler := NewGraphQLHandler(&placesHandler, 0)
+
+	// the details call concludes the session of the searches
+	req := httptest.NewRequest("GET", "/graphql?query="+url.QueryEscape(`{
+		places(text: "coffee") { id }
+		place(provider: "google-provider-label", id: "id1") { id }
+	}`), nil)
+	req.Header.Set("X-Session-ID", "abc-123")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	googleProvider.AssertExpectations(t)
+}
+
+func TestGraphQLPlacesLimitAndProviders(t *testing.T) {
+	googleProvider := new(mockGooglePlacesProvider)
+	foursquareProvider := new(mockFourSquarePlacesProvider)
+	foursquareProvider.On("GetPlacesByQuery", mock.Anything, mock.Anything).Return(api.Places{apiPlaceFromFoursquare, apiPlaceFromFoursquare}, nil)
+	placesHandler := NewPlacesHandler(googleProvider, foursquareProvider)
+	handler := NewGraphQLHandler(&placesHandler, 0)
+
+	query := url.Values{"query": {`{ places(text: "coffee", providers: ["foursquare-provider-label"], limit: 1) { id location { lat lng } } }`}}
+	req := httptest.NewRequest("GET", "/graphql?"+query.Encode(), nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"data": {"places": [{"id": "id2", "location": {"lat": 32.22, "lng": 16.77}}]}}`, rr.Body.String())
+	googleProvider.AssertNotCalled(t, "GetPlacesByQuery", mock.Anything, mock.Anything)
+}
+
+func TestGraphQLErrorsExtensions(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		code   float64
+		status float64
+	}{
+		{"radius", `{ places(text: "coffee", radius: 500) { id } }`, api.RadiusParamMalformedErrorCode, http.StatusBadRequest},
+		{"limit", `{ places(text: "coffee", limit: 0) { id } }`, api.LimitParamMalformedErrorCode, http.StatusBadRequest},
+		{"text", `{ places(text: "") { id } }`, api.TextInputParamIsMissingErrorCode, http.StatusBadRequest},
+		{"unknown provider", `{ places(text: "coffee", providers: ["yelp"]) { id } }`, api.UnknownProviderErrorCode, http.StatusNotFound},
+		{"details of an unknown provider", `{ place(provider: "yelp", id: "1") { id } }`, api.UnknownProviderErrorCode, http.StatusNotFound},
+		{"too complex", `{ places(text: "coffee", limit: 50) { details { id } } }`, api.QueryTooComplexErrorCode, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			googleProvider := new(mockGooglePlacesProvider)
+			placesHandler := NewPlacesHandler(googleProvider)
+			handler := NewGraphQLHandler(&placesHandler, 0)
+
+			rr, response := postGraphQL(t, handler, map[string]string{"query": test.query})
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			require.Len(t, response.Errors, 1)
+			assert.Equal(t, test.code, response.Errors[0].Extensions["code"])
+			assert.Equal(t, test.status, response.Errors[0].Extensions["status"])
+			assert.NotEmpty(t, response.Errors[0].Message)
+			googleProvider.AssertNotCalled(t, "GetPlacesByQuery", mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestGraphQLDetailsProviderError(t *testing.T) {
+	googleProvider := new(mockGooglePlacesProvider)
+	googleProvider.On("GetPlacesByQuery", mock.Anything, mock.Anything).Return(api.Places{apiPlaceFromGoogle}, nil)
+	googleProvider.On("GetPlaceDetails", mock.Anything, "id1").Return(api.PlaceDetails{}, errors.New("upstream failure"))
+	placesHandler := NewPlacesHandler(googleProvider)
+	handler := NewGraphQLHandler(&placesHandler, 0)
+
+	rr, response := postGraphQL(t, handler, map[string]string{"query": `{ places(text: "coffee") { id details { id } } }`})
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	// the places are kept, the failed details are null
+	assert.JSONEq(t, `[{"id": "id1", "details": null}]`, string(response.Data["places"]))
+	require.Len(t, response.Errors, 1)
+	assert.Equal(t, []interface{}{"places", float64(0), "details"}, response.Errors[0].Path)
+	assert.Equal(t, float64(http.StatusInternalServerError), response.Errors[0].Extensions["status"])
+	assert.NotContains(t, response.Errors[0].Message, "upstream failure")
+}
+
+func TestGraphQLDetailsScope(t *testing.T) {
+	googleProvider := new(mockGooglePlacesProvider)
+	googleProvider.On("GetPlacesByQuery", mock.Anything, mock.Anything).Return(api.Places{apiPlaceFromGoogle}, nil)
+	placesHandler := NewPlacesHandler(googleProvider)
+	handler := NewGraphQLHandler(&placesHandler, 0)
+
+	// a token granted the search only
+	query := url.Values{"query": {`{ places(text: "coffee") { id details { id } } place(provider: "google-provider-label", id: "id1") { id } }`}}
+	req := httptest.NewRequest("GET", "/graphql?"+query.Encode(), nil)
+	req = req.WithContext(auth.WithPrincipal(req.Context(), &auth.Principal{ClientID: "web-app", Scoped: true, Scopes: []string{ScopePlacesSearch}}))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	response := graphQLTestResponse{}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.JSONEq(t, `[{"id": "id1", "details": null}]`, string(response.Data["places"]))
+	assert.JSONEq(t, `null`, string(response.Data["place"]))
+	require.Len(t, response.Errors, 2)
+	for _, graphQLError := range response.Errors {
+		assert.Equal(t, float64(api.InsufficientScopeErrorCode), graphQLError.Extensions["code"])
+		assert.Equal(t, float64(http.StatusForbidden), graphQLError.Extensions["status"])
+	}
+	googleProvider.AssertNotCalled(t, "GetPlaceDetails", mock.Anything, mock.Anything)
+}
+
+func TestGraphQLMalformedRequests(t *testing.T) {
+	placesHandler := NewPlacesHandler(new(mockGooglePlacesProvider))
+	handler := NewGraphQLHandler(&placesHandler, 0)
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest("POST", "/graphql", bytes.NewBufferString("{not json")),
+		httptest.NewRequest("POST", "/graphql", bytes.NewBufferString(`{"variables": {}}`)),
+		httptest.NewRequest("GET", "/graphql", nil),
+		httptest.NewRequest("GET", "/graphql?query={places}&variables=nope", nil),
+	} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"code":10018`)
+	}
+
+	// syntax errors are GraphQL errors
+	rr, response := postGraphQL(t, handler, map[string]string{"query": "{ places("})
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NotEmpty(t, response.Errors)
+}
+
+func TestQueryComplexity(t *testing.T) {
+	tests := []struct {
+		query     string
+		variables map[string]interface{}
+		expected  int
+	}{
+		{`{ places(text: "a") { id name } }`, nil, 1 + config.DefaultGraphQLPlacesLimit*2},
+		{`{ places(text: "a", limit: 3) { id details { id someText } } }`, nil, 1 + 3*(1+config.GraphQLDetailsCost+2)},
+		{`query($l: Int) { places(text: "a", limit: $l) { id } }`, map[string]interface{}{"l": float64(5)}, 1 + 5},
+		{`{ place(provider: "p", id: "1") { id } other: place(provider: "p", id: "2") { id } }`, nil, 2 * (config.GraphQLDetailsCost + 1)},
+		{`{ places(text: "a", limit: 2) { ...fields } } fragment fields on Place { id ... on Place { name } }`, nil, 1 + 2*2},
+		{`{ places(text: "a", limit: 1000) { id } }`, nil, 1 + config.MaxGraphQLPlacesLimit},
+		{`query first { places(text: "a", limit: 1) { id } } query second { place(provider: "p", id: "1") { id } }`, nil, 2},
+	}
+	for _, test := range tests {
+		document, err := parser.Parse(parser.ParseParams{Source: test.query})
+		require.NoError(t, err)
+		assert.Equal(t, test.expected, queryComplexity(document, "", test.variables), test.query)
+	}
+
+	document, err := parser.Parse(parser.ParseParams{Source: tests[6].query})
+	require.NoError(t, err)
+	assert.Equal(t, config.GraphQLDetailsCost+1, queryComplexity(document, "second", nil))
+	assert.Equal(t, 0, queryComplexity(document, "third", nil))
+}
+
+func TestGraphQLPlacesCategories(t *testing.T) {
+	foursquareProvider := new(mockFourSquarePlacesProvider)
+	veganPlace := api.Place{ID: "id3", Provider: "foursquare-provider-label", Name: "Vegan", Categories: []string{"vegan"}}
+	foursquareProvider.On("GetPlacesByQuery", mock.Anything, mock.Anything).Return(api.Places{veganPlace}, nil)
+	placesHandler := NewPlacesHandler(foursquareProvider)
+	handler := NewGraphQLHandler(&placesHandler, 0)
+
+	query := url.Values{"query": {`{ places(text: "burger", categories: ["Restaurant"]) { id categories } }`}}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/graphql?"+query.Encode(), nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"data": {"places": [{"id": "id3", "categories": ["vegan"]}]}}`, rr.Body.String())
+	foursquareProvider.AssertCalled(t, "GetPlacesByQuery", mock.Anything, providers.PlaceSearchRequest{InputString: "burger", Categories: []string{"restaurant"}})
+
+	query = url.Values{"query": {`{ places(text: "burger", categories: ["casino"]) { id } }`}}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/graphql?"+query.Encode(), nil))
+	assert.Contains(t, rr.Body.String(), `"code":10026`)
+}
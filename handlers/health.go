@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/codeselim/go-webservice-places-provider/api"
+	"github.com/codeselim/go-webservice-places-provider/config"
+	"github.com/codeselim/go-webservice-places-provider/log"
+	"github.com/codeselim/go-webservice-places-provider/providers"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	livenessStateLabel     = "ALIVE"
+	readinessStateReady    = apiStatusStateLabel
+	readinessStateNotReady = "NOT_READY"
+	readinessMessage       = "API v1 ready to serve requests"
+	notReadyMessage        = "API v1 has no usable provider"
+	shuttingDownStateLabel = "SHUTTING_DOWN"
+	shuttingDownMessage    = "API v1 is shutting down"
+
+	providerStateUp      = "UP"
+	providerStateDown    = "DOWN"
+	providerStateUnknown = "UNKNOWN" // provider doesn't implement providers.HealthChecker
+
+	circuitStateOpen = "OPEN"
+)
+
+// last known health of a provider
+type providerHealthState struct {
+	lastChecked time.Time
+	lastSuccess time.Time
+	lastErr     error
+}
+
+// HealthHandler serves the liveness and readiness probes.
+// Readiness runs the providers health probes (when implemented) and caches the results for a TTL,
+// so frequent probes from an orchestrator don't burn the providers quotas.
+type HealthHandler struct {
+	placesProviders []providers.Provider
+	ttl             time.Duration
+	timeout         time.Duration
+
+	mu     sync.Mutex // guards states
+	states map[providers.ProviderLabel]*providerHealthState
+
+	refreshMu sync.Mutex // only one probes round at a time
+
+	shuttingDown int32 // set atomically, once the server starts draining
+}
+
+func NewHealthHandler(placesProviders ...providers.Provider) *HealthHandler {
+	for _, provider := range placesProviders {
+		if provider == nil {
+			log.GetLogger().Panic("supplied providers cannot be nil")
+		}
+	}
+	return &HealthHandler{
+		placesProviders: placesProviders,
+		ttl:             config.DefaultHealthCheckTTL,
+		timeout:         config.DefaultHealthCheckTimeout,
+		states:          map[providers.ProviderLabel]*providerHealthState{},
+	}
+}
+
+// GetLiveness only tells that the process is up and serving, it never checks the providers
+func (h *HealthHandler) GetLiveness(w http.ResponseWriter, r *http.Request) {
+	status := api.Status{
+		Message:    apiStatusMessage,
+		StateLabel: livenessStateLabel,
+	}
+	setDefaultHeaders(w)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(status)
+}
+
+// FlushCache drops the cached probes results, the next readiness check probes all the providers again
+func (h *HealthHandler) FlushCache() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.states = map[providers.ProviderLabel]*providerHealthState{}
+}
+
+// ProvidersHealth returns the last known providers health, without running any probe
+func (h *HealthHandler) ProvidersHealth() []api.ProviderHealth {
+	return h.providersHealth()
+}
+
+// MarkShuttingDown flips the readiness to not-ready, so no new traffic gets routed to this instance while it drains
+func (h *HealthHandler) MarkShuttingDown() {
+	atomic.StoreInt32(&h.shuttingDown, 1)
+}
+
+// GetReadiness reports the providers health. It fails only when no provider is usable or the server is shutting down
+func (h *HealthHandler) GetReadiness(w http.ResponseWriter, r *http.Request) {
+	if atomic.LoadInt32(&h.shuttingDown) == 1 {
+		status := api.Status{
+			Message:    shuttingDownMessage,
+			StateLabel: shuttingDownStateLabel,
+		}
+		setDefaultHeaders(w)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(status)
+		return
+	}
+
+	h.refresh(r.Context())
+
+	readiness := api.Readiness{
+		Message:    readinessMessage,
+		StateLabel: readinessStateReady,
+		Providers:  h.providersHealth(),
+		Build: api.BuildInfo{
+			Version:   config.Version,
+			Commit:    config.Commit,
+			BuildTime: config.BuildTime,
+		},
+	}
+
+	statusCode := http.StatusOK
+	if !anyUsable(readiness.Providers) {
+		readiness.Message = notReadyMessage
+		readiness.StateLabel = readinessStateNotReady
+		statusCode = http.StatusServiceUnavailable
+	}
+
+	setDefaultHeaders(w)
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(readiness)
+}
+
+// refresh runs, in parallel, the health probes of the providers whose cached result is stale. The probes don't run
+// on the context of the readiness request: a probe client giving up must not mark the providers down
+func (h *HealthHandler) refresh(ctx context.Context) {
+	h.refreshMu.Lock()
+	defer h.refreshMu.Unlock()
+
+	probeCtx, cancel := context.WithTimeout(context.Background(), h.timeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, provider := range h.placesProviders {
+		checker, ok := provider.(providers.HealthChecker)
+		if !ok || !h.isStale(provider.GetProviderLabel()) {
+			continue
+		}
+		label := provider.GetProviderLabel()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := checker.CheckHealth(probeCtx)
+			if errors.Is(err, context.Canceled) {
+				return // not an answer of the provider, the next readiness check probes it again
+			}
+			if err != nil {
+				log.GetLoggerWithContext(ctx).Warn("health probe failed for provider ", label, ": ", err.Error())
+			}
+			h.record(label, err)
+		}()
+	}
+	wg.Wait()
+}
+
+func (h *HealthHandler) isStale(label providers.ProviderLabel) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	state, ok := h.states[label]
+	return !ok || time.Since(state.lastChecked) > h.ttl
+}
+
+func (h *HealthHandler) record(label providers.ProviderLabel, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	state, ok := h.states[label]
+	if !ok {
+		state = &providerHealthState{}
+		h.states[label] = state
+	}
+	state.lastChecked = time.Now()
+	state.lastErr = err
+	if err == nil {
+		state.lastSuccess = state.lastChecked
+	}
+}
+
+func (h *HealthHandler) providersHealth() []api.ProviderHealth {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	result := make([]api.ProviderHealth, 0, len(h.placesProviders))
+	for _, provider := range h.placesProviders {
+		health := api.ProviderHealth{
+			Provider:   string(provider.GetProviderLabel()),
+			StateLabel: providerStateUnknown,
+		}
+		if state, ok := h.states[provider.GetProviderLabel()]; ok {
+			lastChecked := state.lastChecked
+			health.LastChecked = &lastChecked
+			health.StateLabel = providerStateUp
+			if state.lastErr != nil {
+				health.StateLabel = providerStateDown
+				health.Error = state.lastErr.Error()
+			}
+			if !state.lastSuccess.IsZero() {
+				lastSuccess := state.lastSuccess
+				health.LastSuccess = &lastSuccess
+			}
+		}
+		if reporter, ok := provider.(providers.CircuitStateReporter); ok {
+			health.CircuitState = reporter.GetCircuitState()
+		}
+		result = append(result, health)
+	}
+	return result
+}
+
+// a provider is usable when it is not known to be down and its circuit (if any) is not open
+func anyUsable(providersHealth []api.ProviderHealth) bool {
+	for _, health := range providersHealth {
+		if health.StateLabel != providerStateDown && health.CircuitState != circuitStateOpen {
+			return true
+		}
+	}
+	return false
+}
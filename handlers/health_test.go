@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/codeselim/go-webservice-places-provider/api"
+	"github.com/codeselim/go-webservice-places-provider/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// a google provider mock which also meets the providers.HealthChecker interface
+type mockCheckableGooglePlacesProvider struct {
+	mockGooglePlacesProvider
+}
+
+func (m *mockCheckableGooglePlacesProvider) CheckHealth(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
+// a foursquare provider mock which also meets the providers.HealthChecker interface
+type mockCheckableFourSquarePlacesProvider struct {
+	mockFourSquarePlacesProvider
+}
+
+func (m *mockCheckableFourSquarePlacesProvider) CheckHealth(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
+func serveReadiness(t *testing.T, healthHandler *HealthHandler) (*httptest.ResponseRecorder, api.Readiness) {
+	req, err := http.NewRequest("GET", "/readyz", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(healthHandler.GetReadiness).ServeHTTP(rr, req)
+
+	readiness := api.Readiness{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &readiness); err != nil {
+		t.Fatal(err)
+	}
+	return rr, readiness
+}
+
+func TestUnitGetLiveness(t *testing.T) {
+	req, err := http.NewRequest("GET", "/livez", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// liveness never probes the providers: no expectations are set on the mock
+	googlePlacesProvider := new(mockCheckableGooglePlacesProvider)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(NewHealthHandler(googlePlacesProvider).GetLiveness).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"message":"API v1 Alive!","state":"ALIVE"}`, rr.Body.String())
+}
+
+func TestUnitGetReadinessAllProvidersUp(t *testing.T) {
+	googlePlacesProvider := new(mockCheckableGooglePlacesProvider)
+	foursquarePlacesProvider := new(mockCheckableFourSquarePlacesProvider)
+	googlePlacesProvider.On("CheckHealth", mock.Anything).Return(nil)
+	foursquarePlacesProvider.On("CheckHealth", mock.Anything).Return(nil)
+
+	rr, readiness := serveReadiness(t, NewHealthHandler(googlePlacesProvider, foursquarePlacesProvider))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, readinessStateReady, readiness.StateLabel)
+	assert.Equal(t, config.Version, readiness.Build.Version)
+	assert.Equal(t, 2, len(readiness.Providers))
+	for _, providerHealth := range readiness.Providers {
+		assert.Equal(t, providerStateUp, providerHealth.StateLabel)
+		assert.NotNil(t, providerHealth.LastSuccess)
+	}
+}
+
+func TestUnitGetReadinessOneProviderDown(t *testing.T) {
+	googlePlacesProvider := new(mockCheckableGooglePlacesProvider)
+	foursquarePlacesProvider := new(mockCheckableFourSquarePlacesProvider)
+	googlePlacesProvider.On("CheckHealth", mock.Anything).Return(errors.New("REQUEST_DENIED"))
+	foursquarePlacesProvider.On("CheckHealth", mock.Anything).Return(nil)
+
+	rr, readiness := serveReadiness(t, NewHealthHandler(googlePlacesProvider, foursquarePlacesProvider))
+
+	// still ready, one provider is enough
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, readinessStateReady, readiness.StateLabel)
+	assert.Equal(t, providerStateDown, readiness.Providers[0].StateLabel)
+	assert.Equal(t, "REQUEST_DENIED", readiness.Providers[0].Error)
+	assert.Nil(t, readiness.Providers[0].LastSuccess)
+	assert.Equal(t, providerStateUp, readiness.Providers[1].StateLabel)
+}
+
+func TestUnitGetReadinessAllProvidersDown(t *testing.T) {
+	googlePlacesProvider := new(mockCheckableGooglePlacesProvider)
+	foursquarePlacesProvider := new(mockCheckableFourSquarePlacesProvider)
+	googlePlacesProvider.On("CheckHealth", mock.Anything).Return(errors.New("REQUEST_DENIED"))
+	foursquarePlacesProvider.On("CheckHealth", mock.Anything).Return(errors.New("foursquare: 401 invalid auth"))
+
+	rr, readiness := serveReadiness(t, NewHealthHandler(googlePlacesProvider, foursquarePlacesProvider))
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Equal(t, readinessStateNotReady, readiness.StateLabel)
+}
+
+func TestUnitGetReadinessProviderWithoutProbe(t *testing.T) {
+	// the plain mock doesn't implement providers.HealthChecker
+	googlePlacesProvider := new(mockGooglePlacesProvider)
+
+	rr, readiness := serveReadiness(t, NewHealthHandler(googlePlacesProvider))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, providerStateUnknown, readiness.Providers[0].StateLabel)
+	assert.Nil(t, readiness.Providers[0].LastChecked)
+}
+
+func TestUnitGetReadinessCachesProbes(t *testing.T) {
+	googlePlacesProvider := new(mockCheckableGooglePlacesProvider)
+	googlePlacesProvider.On("CheckHealth", mock.Anything).Return(nil)
+	healthHandler := NewHealthHandler(googlePlacesProvider)
+
+	serveReadiness(t, healthHandler)
+	serveReadiness(t, healthHandler)
+
+	googlePlacesProvider.AssertNumberOfCalls(t, "CheckHealth", 1)
+}
+
+func TestUnitGetReadinessClientGone(t *testing.T) {
+	googlePlacesProvider := new(mockCheckableGooglePlacesProvider)
+	googlePlacesProvider.On("CheckHealth", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		assert.NoError(t, args.Get(0).(context.Context).Err(), "the probes don't run on the request context")
+	})
+	foursquarePlacesProvider := new(mockCheckableFourSquarePlacesProvider)
+	foursquarePlacesProvider.On("CheckHealth", mock.Anything).Return(context.Canceled)
+	healthHandler := NewHealthHandler(googlePlacesProvider, foursquarePlacesProvider)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rr := httptest.NewRecorder()
+	healthHandler.GetReadiness(rr, httptest.NewRequest("GET", "/readyz", nil).WithContext(ctx))
+
+	providersHealth := healthHandler.ProvidersHealth()
+	assert.Equal(t, providerStateUp, providersHealth[0].StateLabel)
+	assert.Equal(t, providerStateUnknown, providersHealth[1].StateLabel, "a cancelled probe is not recorded")
+}
+
+func TestUnitGetReadinessShuttingDown(t *testing.T) {
+	// no probe expected once shutting down
+	googlePlacesProvider := new(mockCheckableGooglePlacesProvider)
+	healthHandler := NewHealthHandler(googlePlacesProvider)
+	healthHandler.MarkShuttingDown()
+
+	req, err := http.NewRequest("GET", "/readyz", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(healthHandler.GetReadiness).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.JSONEq(t, `{"message":"API v1 is shutting down","state":"SHUTTING_DOWN"}`, rr.Body.String())
+}
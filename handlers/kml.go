@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"github.com/codeselim/go-webservice-places-provider/api"
+	"io"
+	"strconv"
+)
+
+/**
+ * KML 2.2 encoder (Google Earth), one Placemark per place. The place id, provider and uri are kept in the
+ * Placemark ExtendedData. As with GeoJSON, places without coordinates are kept, without Point: Google Earth
+ * lists them but doesn't show them on the globe.
+ */
+
+const kmlNamespace = "http://www.opengis.net/kml/2.2"
+
+type kmlPlacemark struct {
+	XMLName      xml.Name  `xml:"Placemark"`
+	Name         string    `xml:"name"`
+	Address      string    `xml:"address,omitempty"`
+	ExtendedData []kmlData `xml:"ExtendedData>Data"`
+	Point        *kmlPoint `xml:"Point,omitempty"`
+}
+
+type kmlData struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value"`
+}
+
+type kmlPoint struct {
+	Coordinates string `xml:"coordinates"` // lng,lat
+}
+
+type kmlEncoder struct{}
+
+func (kmlEncoder) ContentType() string {
+	return "application/vnd.google-earth.kml+xml"
+}
+
+func (kmlEncoder) FileExtension() string {
+	return "kml"
+}
+
+func (kmlEncoder) EncodePlaces(w io.Writer, places api.Places) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	kml := xml.StartElement{Name: xml.Name{Local: "kml"}, Attr: []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: kmlNamespace}}}
+	document := xml.StartElement{Name: xml.Name{Local: "Document"}}
+	if err := encoder.EncodeToken(kml); err != nil {
+		return err
+	}
+	if err := encoder.EncodeToken(document); err != nil {
+		return err
+	}
+	if err := encoder.EncodeElement("Places", xml.StartElement{Name: xml.Name{Local: "name"}}); err != nil {
+		return err
+	}
+	for _, place := range places {
+		if err := encoder.Encode(toKMLPlacemark(place)); err != nil {
+			return err
+		}
+	}
+	if err := encoder.EncodeToken(document.End()); err != nil {
+		return err
+	}
+	if err := encoder.EncodeToken(kml.End()); err != nil {
+		return err
+	}
+	if err := encoder.Flush(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func toKMLPlacemark(place api.Place) kmlPlacemark {
+	placemark := kmlPlacemark{
+		Name:    place.Name,
+		Address: place.Address,
+		ExtendedData: []kmlData{
+			{Name: "id", Value: place.ID},
+			{Name: "provider", Value: place.Provider},
+			{Name: "uri", Value: place.URI},
+		},
+	}
+	if place.Location != nil {
+		placemark.Point = &kmlPoint{
+			Coordinates: strconv.FormatFloat(place.Location.Lng, 'f', -1, 64) + "," + strconv.FormatFloat(place.Location.Lat, 'f', -1, 64),
+		}
+	}
+	return placemark
+}
@@ -9,8 +9,20 @@ func LoggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// log and continue
 		logger := log.GetLoggerWithContext(r.Context())
-		logger.Info(r.Method, r.RequestURI, r.RemoteAddr, r.Host)
+		logger.Info(r.Method, redactedRequestURI(r), r.RemoteAddr, r.Host)
 		// Call the next handler, which can be another middleware in the chain, or the final handler.
 		next.ServeHTTP(w, r)
 	})
 }
+
+// API keys supplied as query param must not end up in the logs
+func redactedRequestURI(r *http.Request) string {
+	query := r.URL.Query()
+	if query.Get(apiKeyQueryParam) == "" {
+		return r.RequestURI
+	}
+	query.Set(apiKeyQueryParam, "<redacted>")
+	redacted := *r.URL
+	redacted.RawQuery = query.Encode()
+	return redacted.RequestURI()
+}
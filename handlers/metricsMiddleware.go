@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"bufio"
+	"expvar"
+	"github.com/codeselim/go-webservice-places-provider/providers"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Basic application metrics, published with expvar and served on the admin server (/debug/vars)
+var (
+	httpRequests          = expvar.NewMap("http_requests")              // count by status code
+	httpRequestsDuration  = expvar.NewMap("http_requests_duration_ms")  // cumulative duration by status code
+	providerCalls         = expvar.NewMap("provider_calls")             // count by provider label
+	providerErrors        = expvar.NewMap("provider_errors")            // count by provider label
+	providerErrorKinds    = expvar.NewMap("provider_error_kinds")       // count by provider label and error kind, e.g. GOOGLE_PLACES:quota
+	providerCallsDuration = expvar.NewMap("provider_calls_duration_ms") // cumulative duration by provider label
+)
+
+// statusRecorder captures the response status code
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+// Flush keeps the streaming capability of the wrapped writer
+func (s *statusRecorder) Flush() {
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack keeps the connection takeover capability (websockets) of the wrapped writer
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := s.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	if s.status == 0 {
+		s.status = http.StatusSwitchingProtocols
+	}
+	return hijacker.Hijack()
+}
+
+func MetricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(recorder, r)
+
+		status := recorder.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		code := strconv.Itoa(status)
+		httpRequests.Add(code, 1)
+		httpRequestsDuration.AddFloat(code, float64(time.Since(start))/float64(time.Millisecond))
+	})
+}
+
+func recordProviderCall(label providers.ProviderLabel, start time.Time, err error) {
+	providerCalls.Add(string(label), 1)
+	providerCallsDuration.AddFloat(string(label), float64(time.Since(start))/float64(time.Millisecond))
+	if err != nil {
+		providerErrors.Add(string(label), 1)
+		providerErrorKinds.Add(string(label)+":"+string(providers.KindOf(err)), 1)
+	}
+}
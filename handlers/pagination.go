@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/codeselim/go-webservice-places-provider/api"
+	"github.com/codeselim/go-webservice-places-provider/config"
+	"github.com/codeselim/go-webservice-places-provider/log"
+	"github.com/codeselim/go-webservice-places-provider/providers"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+ * Pagination of the places search, enabled by the limit and cursor query parameters. The providers places are merged
+ * round-robin, each provider keeping its own ranking. The cursor holds the upstream page each provider is at (Google
+ * next_page_token, Foursquare offset), how many of its places were already returned and the merge position, so the
+ * next page continues the same merged sequence. The cursor is signed (HMAC-SHA256) and bound to its search.
+ */
+
+const (
+	limitQueryParam  = "limit"
+	cursorQueryParam = "cursor"
+)
+
+type pageCursor struct {
+	Search    string           `json:"s"` // hash of the search the cursor belongs to
+	Providers []providerCursor `json:"p"`
+	Next      int              `json:"n"` // merge position: index of the provider giving the next place
+	Expires   int64            `json:"e"` // unix seconds, the upstream page tokens expire as well
+}
+
+type providerCursor struct {
+	Provider  string `json:"l"`
+	PageToken string `json:"t,omitempty"` // upstream page being returned, empty for the first one
+	Consumed  int    `json:"c,omitempty"` // places of the upstream page already returned
+	Done      bool   `json:"d,omitempty"` // all the places of the provider were returned
+}
+
+type pageRequest struct {
+	limit  int
+	cursor *pageCursor // nil for the first page
+}
+
+// isPaginated tells if the request asks for a page of the places
+func isPaginated(r *http.Request) bool {
+	keys := r.URL.Query()
+	return keys.Get(limitQueryParam) != "" || keys.Get(cursorQueryParam) != ""
+}
+
+// parsePageRequest reads the limit and the cursor, which has to belong to the same search
+func parsePageRequest(r *http.Request, placesProviders []providers.Provider, request providers.PlaceSearchRequest) (pageRequest, error) {
+	keys := r.URL.Query()
+	page := pageRequest{limit: config.DefaultPlacesPageSize}
+	if limit := keys.Get(limitQueryParam); limit != "" {
+		var err error
+		if page.limit, err = strconv.Atoi(limit); err != nil || page.limit < 1 || page.limit > config.MaxPlacesPageSize {
+			return page, newBadRequestError(r, api.LimitParamMalformedErrorCode)
+		}
+	}
+	encoded := keys.Get(cursorQueryParam)
+	if encoded == "" {
+		return page, nil
+	}
+	cursor, err := decodeCursor(encoded)
+	if err != nil || cursor.Search != searchHash(request) || time.Now().Unix() > cursor.Expires {
+		return page, newBadRequestError(r, api.CursorParamMalformedErrorCode)
+	}
+	// the allowed providers of the caller could have changed meanwhile
+	for _, state := range cursor.Providers {
+		if findProvider(placesProviders, state.Provider) == nil {
+			return page, newBadRequestError(r, api.CursorParamMalformedErrorCode)
+		}
+	}
+	page.cursor = cursor
+	return page, nil
+}
+
+// SearchPlacesPage returns a page of the merged places and the cursor of the next page, nil on the last one.
+// A failing provider is retried on the next page, the places are then not complete. The dominant error is
+// returned when all the queried providers failed
+func (p *PlacesHandler) SearchPlacesPage(ctx context.Context, placesProviders []providers.Provider, request providers.PlaceSearchRequest,
+	page pageRequest) (api.Places, *pageCursor, bool, error) {
+	cursor := page.cursor
+	if cursor == nil {
+		cursor = &pageCursor{Search: searchHash(request)}
+		for _, provider := range placesProviders {
+			if providers.SupportsMode(provider, request.Mode) {
+				cursor.Providers = append(cursor.Providers, providerCursor{Provider: string(provider.GetProviderLabel())})
+			}
+		}
+	}
+
+	// the current upstream page of each provider, without the places already returned
+	type upstreamPage struct {
+		places        api.Places
+		nextPageToken string
+		err           error
+	}
+	pages := make([]upstreamPage, len(cursor.Providers))
+	var wg sync.WaitGroup
+	for i, state := range cursor.Providers {
+		if state.Done {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, state providerCursor) {
+			defer wg.Done()
+			provider := findProvider(placesProviders, state.Provider)
+			pageRequest := request
+			pageRequest.PageToken = state.PageToken
+			start := time.Now()
+			places, nextPageToken, err := getPlacesPage(ctx, provider, pageRequest)
+			recordProviderCall(provider.GetProviderLabel(), start, err)
+			places = providers.FilterPlacesInArea(places, request.Area)
+			if state.Consumed < len(places) {
+				places = places[state.Consumed:]
+			} else {
+				places = api.Places{}
+			}
+			pages[i] = upstreamPage{places: places, nextPageToken: nextPageToken, err: err}
+		}(i, state)
+	}
+	wg.Wait()
+
+	providersErrors := map[providers.ProviderLabel]error{}
+	answered := 0
+	for i, upstream := range pages {
+		if upstream.err != nil {
+			log.GetLoggerWithContext(ctx).Error(upstream.err.Error())
+			providersErrors[providers.ProviderLabel(cursor.Providers[i].Provider)] = upstream.err
+			pages[i].places = api.Places{}
+		} else if !cursor.Providers[i].Done {
+			answered++
+		}
+	}
+	if len(providersErrors) > 0 && answered == 0 {
+		return nil, nil, false, dominantError(placesProviders, providersErrors)
+	}
+
+	// round-robin merge from the merge position of the cursor
+	places := api.Places{}
+	taken := make([]int, len(pages))
+	next := cursor.Next
+	for remaining := true; len(places) < page.limit && remaining; {
+		remaining = false
+		for range pages {
+			i := next % len(pages)
+			next = i + 1
+			if taken[i] < len(pages[i].places) {
+				places = append(places, pages[i].places[taken[i]])
+				taken[i]++
+				remaining = true
+				break
+			}
+		}
+	}
+
+	nextCursor := &pageCursor{Search: cursor.Search, Next: next % max(len(pages), 1), Expires: time.Now().Add(config.PlacesCursorTTL).Unix()}
+	hasNext := false
+	for i, state := range cursor.Providers {
+		switch {
+		case state.Done || pages[i].err != nil:
+			// unchanged, a failed provider is retried
+		case taken[i] < len(pages[i].places):
+			state.Consumed += taken[i]
+		case pages[i].nextPageToken != "":
+			state = providerCursor{Provider: state.Provider, PageToken: pages[i].nextPageToken}
+		default:
+			state.Done = true
+		}
+		hasNext = hasNext || !state.Done
+		nextCursor.Providers = append(nextCursor.Providers, state)
+	}
+	if !hasNext {
+		nextCursor = nil
+	}
+	return places, nextCursor, len(providersErrors) == 0, nil
+}
+
+func getPlacesPage(ctx context.Context, provider providers.Provider, request providers.PlaceSearchRequest) (api.Places, string, error) {
+	if paginator, ok := provider.(providers.Paginator); ok {
+		return paginator.GetPlacesPage(ctx, request)
+	}
+	places, err := provider.GetPlacesByQuery(ctx, request)
+	return places, "", err
+}
+
+// searchHash identifies the search of a cursor, the page parameters and the session aside
+func searchHash(request providers.PlaceSearchRequest) string {
+	search := fmt.Sprintf("%s|%s|%d|%s|%s", request.InputString, request.Mode, request.Radius, request.Language,
+		strings.Join(request.Categories, ","))
+	if request.Location != nil {
+		search += fmt.Sprintf("|%f,%f", request.Location.Lat, request.Location.Lng)
+	}
+	if request.Area != nil {
+		search += "|" + request.Area.String()
+	}
+	sum := sha256.Sum256([]byte(search))
+	return base64.RawURLEncoding.EncodeToString(sum[:12])
+}
+
+// nextPageLink is the Link header of the next page: the same request with the next cursor
+func nextPageLink(r *http.Request, cursor *pageCursor) (string, error) {
+	encoded, err := encodeCursor(cursor)
+	if err != nil {
+		return "", err
+	}
+	query := r.URL.Query()
+	query.Set(cursorQueryParam, encoded)
+	return fmt.Sprintf(`<%s?%s>; rel="next"`, r.URL.Path, query.Encode()), nil
+}
+
+// the cursors are <base64 json>.<base64 signature>
+func encodeCursor(cursor *pageCursor) (string, error) {
+	payload, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(signCursor(encoded)), nil
+}
+
+func decodeCursor(encoded string) (*pageCursor, error) {
+	parts := strings.Split(encoded, ".")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("malformed cursor")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(signature, signCursor(parts[0])) {
+		return nil, fmt.Errorf("invalid cursor signature")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	cursor := &pageCursor{}
+	if err := json.Unmarshal(payload, cursor); err != nil {
+		return nil, err
+	}
+	return cursor, nil
+}
+
+func signCursor(encoded string) []byte {
+	mac := hmac.New(sha256.New, cursorKey())
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
+
+var (
+	randomCursorKey     []byte
+	randomCursorKeyOnce sync.Once
+)
+
+// cursorKey returns the configured signing key, else a random one: the cursors then don't survive restarts
+// and can't be shared by several instances
+func cursorKey() []byte {
+	if key := config.Config().CursorSigningKey; key != "" {
+		return []byte(key)
+	}
+	randomCursorKeyOnce.Do(func() {
+		randomCursorKey = make([]byte, 32)
+		if _, err := rand.Read(randomCursorKey); err != nil {
+			log.GetLogger().Panic("Couldn't generate the cursor signing key: " + err.Error())
+		}
+	})
+	return randomCursorKey
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/codeselim/go-webservice-places-provider/api"
+	"github.com/codeselim/go-webservice-places-provider/providers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// a provider returning its places in upstream pages, the page tokens are the page indexes
+type pagedProvider struct {
+	mockGooglePlacesProvider
+	label    providers.ProviderLabel
+	pages    []api.Places
+	failures int // the first calls fail
+	calls    int
+}
+
+func (m *pagedProvider) GetProviderLabel() providers.ProviderLabel {
+	return m.label
+}
+
+func (m *pagedProvider) GetPlacesPage(ctx context.Context, request providers.PlaceSearchRequest) (api.Places, string, error) {
+	m.calls++
+	if m.calls <= m.failures {
+		return nil, "", errors.New("upstream failure")
+	}
+	index, _ := strconv.Atoi(request.PageToken)
+	if index+1 < len(m.pages) {
+		return m.pages[index], strconv.Itoa(index + 1), nil
+	}
+	return m.pages[index], "", nil
+}
+
+func newPlaces(provider string, ids ...string) api.Places {
+	places := api.Places{}
+	for _, id := range ids {
+		places = append(places, api.Place{ID: id, Provider: provider})
+	}
+	return places
+}
+
+// gets a page of places and returns their ids and the link to the next page
+func getPage(t *testing.T, placesHandler PlacesHandler, target string) ([]string, string) {
+	rr := httptest.NewRecorder()
+	placesHandler.GetPlaces(rr, httptest.NewRequest("GET", target, nil))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	places := api.Places{}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &places))
+	ids := []string{}
+	for _, place := range places {
+		ids = append(ids, place.ID)
+	}
+	next := ""
+	if link := rr.Header().Get("Link"); link != "" {
+		require.True(t, strings.HasSuffix(link, `>; rel="next"`), link)
+		next = strings.TrimSuffix(strings.TrimPrefix(link, "<"), `>; rel="next"`)
+	}
+	return ids, next
+}
+
+func TestPlacesPagination(t *testing.T) {
+	providerA := &pagedProvider{label: "A", pages: []api.Places{newPlaces("A", "a1", "a2", "a3"), newPlaces("A", "a4")}}
+	providerB := &pagedProvider{label: "B", pages: []api.Places{newPlaces("B", "b1")}}
+	foursquareProvider := new(mockFourSquarePlacesProvider) // single page provider
+	foursquareProvider.On("GetPlacesByQuery", mock.Anything, mock.Anything).Return(newPlaces("C", "c1", "c2"), nil)
+	placesHandler := NewPlacesHandler(providerA, providerB, foursquareProvider)
+
+	// the providers places are merged round-robin
+	ids, next := getPage(t, placesHandler, "/api/v1/places?text=pizza&mode=text&limit=4")
+	assert.Equal(t, []string{"a1", "b1", "c1", "a2"}, ids)
+	require.NotEmpty(t, next)
+	assert.Contains(t, next, "/api/v1/places?")
+	assert.Contains(t, next, "limit=4")
+
+	// the next page goes on with the same merge position and upstream pages
+	ids, next = getPage(t, placesHandler, next)
+	assert.Equal(t, []string{"c2", "a3"}, ids)
+	require.NotEmpty(t, next)
+
+	ids, next = getPage(t, placesHandler, next)
+	assert.Equal(t, []string{"a4"}, ids)
+	assert.Empty(t, next)
+}
+
+func TestPlacesPaginationProviderFailure(t *testing.T) {
+	providerA := &pagedProvider{label: "A", pages: []api.Places{newPlaces("A", "a1", "a2")}}
+	providerB := &pagedProvider{label: "B", pages: []api.Places{newPlaces("B", "b1")}, failures: 1}
+	placesHandler := NewPlacesHandler(providerA, providerB)
+
+	ids, next := getPage(t, placesHandler, "/api/v1/places?text=pizza&limit=1")
+	assert.Equal(t, []string{"a1"}, ids)
+
+	// the failed provider is retried on the next page
+	ids, next = getPage(t, placesHandler, next)
+	assert.Equal(t, []string{"b1"}, ids)
+	ids, next = getPage(t, placesHandler, next)
+	assert.Equal(t, []string{"a2"}, ids)
+	assert.Empty(t, next)
+}
+
+func TestPlacesPaginationErrors(t *testing.T) {
+	providerA := &pagedProvider{label: "A", pages: []api.Places{newPlaces("A", "a1", "a2")}}
+	placesHandler := NewPlacesHandler(providerA)
+	_, next := getPage(t, placesHandler, "/api/v1/places?text=pizza&limit=1")
+	cursor := strings.SplitN(next, "cursor=", 2)[1]
+	cursor = strings.SplitN(cursor, "&", 2)[0]
+
+	expired, err := encodeCursor(&pageCursor{Search: searchHash(providers.PlaceSearchRequest{InputString: "pizza", Mode: providers.AutocompleteMode}),
+		Providers: []providerCursor{{Provider: "A"}}, Expires: time.Now().Add(-time.Minute).Unix()})
+	require.NoError(t, err)
+	unknownProvider, err := encodeCursor(&pageCursor{Search: searchHash(providers.PlaceSearchRequest{InputString: "pizza", Mode: providers.AutocompleteMode}),
+		Providers: []providerCursor{{Provider: "B"}}, Expires: time.Now().Add(time.Minute).Unix()})
+	require.NoError(t, err)
+	tampered := "x" + cursor[1:]
+
+	tests := []struct {
+		query string
+		code  int
+	}{
+		{"text=pizza&limit=0", api.LimitParamMalformedErrorCode},
+		{"text=pizza&limit=51", api.LimitParamMalformedErrorCode},
+		{"text=pizza&limit=ten", api.LimitParamMalformedErrorCode},
+		{"text=pizza&cursor=" + tampered, api.CursorParamMalformedErrorCode},
+		{"text=pasta&cursor=" + cursor, api.CursorParamMalformedErrorCode}, // another search
+		{"text=pizza&cursor=" + expired, api.CursorParamMalformedErrorCode},
+		{"text=pizza&cursor=" + unknownProvider, api.CursorParamMalformedErrorCode},
+		{"text=pizza&cursor=garbage", api.CursorParamMalformedErrorCode},
+	}
+	for _, test := range tests {
+		rr := httptest.NewRecorder()
+		placesHandler.GetPlaces(rr, httptest.NewRequest("GET", "/api/v1/places?"+test.query, nil))
+		assert.Equal(t, http.StatusBadRequest, rr.Code, test.query)
+		assert.Contains(t, rr.Body.String(), `"code":`+strconv.Itoa(test.code), test.query)
+	}
+
+	// without limit, the page size defaults
+	ids, _ := getPage(t, placesHandler, "/api/v1/places?text=pizza&cursor="+cursor)
+	assert.Equal(t, []string{"a2"}, ids)
+}
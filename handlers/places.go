@@ -2,16 +2,35 @@ package handlers
 
 import (
 	"context"
-	"encoding/json"
 	"github.com/codeselim/go-webservice-places-provider/api"
+	"github.com/codeselim/go-webservice-places-provider/auth"
 	"github.com/codeselim/go-webservice-places-provider/config"
 	"github.com/codeselim/go-webservice-places-provider/log"
 	"github.com/codeselim/go-webservice-places-provider/providers"
-	"golang.org/x/sync/errgroup"
+	"github.com/gorilla/mux"
 	"net/http"
+	"regexp"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
+const (
+	sessionQueryParam    = "session"
+	sessionHeader        = "X-Session-ID"
+	radiusQueryParam     = "radius"
+	languageQueryParam   = "language"
+	categoriesQueryParam = "categories"
+	providersQueryParam  = "providers"
+
+	providerPathParam = "provider"
+	placeIDPathParam  = "id"
+)
+
+var sessionIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
 type PlacesHandler struct {
 	placesProviders []providers.Provider
 }
@@ -33,7 +52,13 @@ func (p *PlacesHandler) GetPlaces(w http.ResponseWriter, r *http.Request) {
 	lat := keys.Get("latitude")
 	lng := keys.Get("longitude")
 
-	if inputString == "" {
+	mode, ok := providers.ParseSearchMode(keys.Get("mode"))
+	if !ok {
+		HandleError(newBadRequestError(r, api.ModeParamMalformedErrorCode), w, r)
+		return
+	}
+	// the nearby search lists the places around the location, the text only narrows them
+	if inputString == "" && mode != providers.NearbyMode {
 		apiError := &api.Error{
 			Code:       api.TextInputParamIsMissingErrorCode,
 			Message:    api.ErrorMessageText[api.TextInputParamIsMissingErrorCode],
@@ -44,8 +69,27 @@ func (p *PlacesHandler) GetPlaces(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	sessionID, err := getSessionID(r)
+	if err != nil {
+		HandleError(err, w, r)
+		return
+	}
 	providerRequest := providers.PlaceSearchRequest{
 		InputString: inputString,
+		SessionID:   sessionID,
+		Mode:        mode,
+	}
+	if providerRequest.Radius, err = getRadius(r); err != nil {
+		HandleError(err, w, r)
+		return
+	}
+	if providerRequest.Language, err = getLanguage(r); err != nil {
+		HandleError(err, w, r)
+		return
+	}
+	if providerRequest.Categories, err = getCategories(r); err != nil {
+		HandleError(err, w, r)
+		return
 	}
 
 	if lat != "" && lng != "" {
@@ -67,38 +111,398 @@ func (p *PlacesHandler) GetPlaces(w http.ResponseWriter, r *http.Request) {
 			Lng: lng,
 		}
 	}
+	if providerRequest.Area, err = getArea(r); err != nil {
+		HandleError(err, w, r)
+		return
+	}
+	if providerRequest.Area != nil && providerRequest.Location == nil {
+		center := providerRequest.Area.Center() // for the providers searching around a location
+		providerRequest.Location = &center
+	}
+	if mode == providers.NearbyMode && providerRequest.Location == nil {
+		HandleError(newBadRequestError(r, api.LocationRequiredErrorCode), w, r)
+		return
+	}
+
+	stream, streaming := negotiateStream(r)
+	var encoder ResponseEncoder
+	if !streaming {
+		var err error
+		if encoder, err = negotiateEncoder(r); err != nil {
+			HandleError(err, w, r)
+			return
+		}
+	}
+
+	placesProviders, err := p.AllowedProviders(r.Context())
+	if err != nil {
+		HandleError(err, w, r)
+		return
+	}
+	if labels := splitQueryParam(keys.Get(providersQueryParam)); len(labels) > 0 {
+		selection := make([]interface{}, 0, len(labels))
+		for _, label := range labels {
+			selection = append(selection, label)
+		}
+		if placesProviders, err = p.selectProviders(r.Context(), placesProviders, selection); err != nil {
+			HandleError(err, w, r)
+			return
+		}
+	}
+	if placesProviders, err = providersForMode(r.Context(), placesProviders, mode); err != nil {
+		HandleError(err, w, r)
+		return
+	}
+
+	if streaming {
+		p.writePlacesStream(w, r, stream, placesProviders, providerRequest)
+		return
+	}
+	if isPaginated(r) {
+		p.getPlacesPage(w, r, encoder, placesProviders, providerRequest)
+		return
+	}
+
+	places, complete, err := p.SearchPlaces(r.Context(), placesProviders, providerRequest)
+	if err != nil {
+		HandleError(err, w, r)
+		return
+	}
+
+	policy := newProvidersCachePolicy(r, placesProviders, complete)
+	policy.vary = append(policy.vary, negotiatedHeaders(r)...)
+	writePlaces(w, r, encoder, places, policy)
+}
 
-	places, err := p.getPlacesParallel(r.Context(), providerRequest)
+// getPlacesPage writes a page of the places, the next page is linked with a Link header
+func (p *PlacesHandler) getPlacesPage(w http.ResponseWriter, r *http.Request, encoder ResponseEncoder, placesProviders []providers.Provider,
+	providerRequest providers.PlaceSearchRequest) {
+	page, err := parsePageRequest(r, placesProviders, providerRequest)
+	if err != nil {
+		HandleError(err, w, r)
+		return
+	}
+	places, nextCursor, complete, err := p.SearchPlacesPage(r.Context(), placesProviders, providerRequest, page)
 	if err != nil {
 		HandleError(err, w, r)
+		return
+	}
+	if nextCursor != nil {
+		link, err := nextPageLink(r, nextCursor)
+		if err != nil {
+			HandleError(err, w, r)
+			return
+		}
+		w.Header().Set("Link", link)
 	}
 
-	setDefaultHeaders(w)
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(places)
+	policy := newProvidersCachePolicy(r, placesProviders, complete)
+	policy.vary = append(policy.vary, negotiatedHeaders(r)...)
+	writePlaces(w, r, encoder, places, policy)
 }
 
-// Parallel execution of providers queries with sync/errGroup for a better error handling
-// Ref. https://godoc.org/golang.org/x/sync/errgroup#ex-Group--Parallel
-func (p *PlacesHandler) getPlacesParallel(ctx context.Context, request providers.PlaceSearchRequest) (api.Places, error) {
-	g, ctx := errgroup.WithContext(ctx)
+// SearchPlaces is the aggregation core shared by the http and gRPC APIs: it queries the providers in parallel
+// and merges their places in the providers order, so the same search always gives the same places (and ETag).
+// The places are not complete when a provider failed, the dominant error is returned when all of them failed
+func (p *PlacesHandler) SearchPlaces(ctx context.Context, placesProviders []providers.Provider, request providers.PlaceSearchRequest) (api.Places, bool, error) {
+	providersPlaces := map[providers.ProviderLabel]api.Places{}
+	providersErrors := map[providers.ProviderLabel]error{}
+	p.StreamPlaces(ctx, placesProviders, request, func(label providers.ProviderLabel, places api.Places, err error) {
+		if err != nil {
+			log.GetLoggerWithContext(ctx).Error(err.Error()) //log error instead and return what is collected
+			providersErrors[label] = err
+			return
+		}
+		providersPlaces[label] = places
+	})
+	if len(providersErrors) > 0 && len(providersPlaces) == 0 {
+		// no places at all would read as a search without results
+		return nil, false, dominantError(placesProviders, providersErrors)
+	}
+
+	// in the providers order, not the answers one
 	placesResults := api.Places{}
+	for _, provider := range placesProviders {
+		placesResults = append(placesResults, providersPlaces[provider.GetProviderLabel()]...)
+	}
+	return placesResults, len(providersErrors) == 0, nil
+}
 
-	for _, provider := range p.placesProviders {
+// StreamPlaces queries the providers in parallel and calls onResults with the places (or the error) of each provider
+// as soon as it answers. A failing provider doesn't cancel the others. onResults calls are never concurrent.
+// The providers not supporting the search mode of the request are skipped
+func (p *PlacesHandler) StreamPlaces(ctx context.Context, placesProviders []providers.Provider, request providers.PlaceSearchRequest,
+	onResults func(label providers.ProviderLabel, places api.Places, err error)) {
+	capable := []providers.Provider{}
+	for _, provider := range placesProviders {
+		if providers.SupportsMode(provider, request.Mode) {
+			capable = append(capable, provider)
+		}
+	}
+	fanOut(capable, func(provider providers.Provider) (func(), error) {
+		places, err := provider.GetPlacesByQuery(ctx, request)
+		places = providers.FilterPlacesInArea(places, request.Area)
+		return func() { onResults(provider.GetProviderLabel(), places, err) }, err
+	})
+}
+
+// fanOut runs call for each provider in parallel and waits for all of them. The calls are recorded in the providers
+// metrics, the collect functions they return are run as soon as they answer and never concurrently
+func fanOut(placesProviders []providers.Provider, call func(provider providers.Provider) (collect func(), err error)) {
+	var wg sync.WaitGroup
+	var collectMu sync.Mutex // serializes the collect calls
+
+	for _, provider := range placesProviders {
 		provider := provider //check https://golang.org/doc/faq#closures_and_goroutines
-		g.Go(func() error {
-			places, err := provider.GetPlacesByQuery(ctx, request)
-			if err == nil {
-				placesResults = append(placesResults, places...)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			collect, err := call(provider)
+			recordProviderCall(provider.GetProviderLabel(), start, err)
+			collectMu.Lock()
+			defer collectMu.Unlock()
+			collect()
+		}()
+	}
+	wg.Wait()
+}
+
+// GetPlace serves the details of a place of the {provider} with the given {id}, the place uri of the search results.
+// Fetching the details of an autocomplete prediction concludes its session
+func (p *PlacesHandler) GetPlace(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	sessionID, err := getSessionID(r)
+	if err != nil {
+		HandleError(err, w, r)
+		return
+	}
+	// a place is served as JSON or as a GeoJSON Feature, the other formats are lists of places
+	encoder, err := negotiateFormat(r)
+	if err != nil {
+		HandleError(err, w, r)
+		return
+	}
+	switch encoder.(type) {
+	case jsonEncoder, geoJSONEncoder:
+	default:
+		HandleError(newBadRequestError(r, api.UnsupportedFormatErrorCode), w, r)
+		return
+	}
+	placesProviders, err := p.AllowedProviders(r.Context())
+	if err != nil {
+		HandleError(err, w, r)
+		return
+	}
+	if placesProviders, err = p.selectProviders(r.Context(), placesProviders, []interface{}{vars[providerPathParam]}); err != nil {
+		HandleError(err, w, r)
+		return
+	}
+
+	ctx := providers.WithSessionID(r.Context(), sessionID)
+	details, err := p.GetPlaceDetails(ctx, placesProviders, vars[providerPathParam], vars[placeIDPathParam])
+	if err != nil {
+		HandleError(err, w, r)
+		return
+	}
+	policy := newProvidersCachePolicy(r, placesProviders, true)
+	policy.vary = append(policy.vary, "Accept")
+	if _, ok := encoder.(geoJSONEncoder); ok {
+		writeCacheableJSONAs(w, r, toDetailsFeature(vars[providerPathParam], r.URL.Path, details), encoder.ContentType(), policy)
+		return
+	}
+	writeCacheableJSON(w, r, details, policy)
+}
+
+// GetPlaceDetails returns the details of a place from the provider with the given label
+func (p *PlacesHandler) GetPlaceDetails(ctx context.Context, placesProviders []providers.Provider, providerLabel string, placeId string) (api.PlaceDetails, error) {
+	if provider := findProvider(placesProviders, providerLabel); provider != nil {
+		start := time.Now()
+		details, err := provider.GetPlaceDetails(ctx, placeId)
+		recordProviderCall(provider.GetProviderLabel(), start, err)
+		return details, err
+	}
+	return api.PlaceDetails{}, &api.Error{
+		Code:       api.UnknownProviderErrorCode,
+		Message:    api.ErrorMessageText[api.UnknownProviderErrorCode],
+		StatusCode: http.StatusNotFound,
+		TraceId:    GetRequestID(ctx),
+	}
+}
+
+// selectProviders narrows the allowed providers down to the requested labels
+func (p *PlacesHandler) selectProviders(ctx context.Context, allowed []providers.Provider, labels []interface{}) ([]providers.Provider, error) {
+	selected := []providers.Provider{}
+	for _, label := range labels {
+		label, _ := label.(string)
+		provider := findProvider(allowed, label)
+		if provider == nil {
+			code, statusCode := api.UnknownProviderErrorCode, http.StatusNotFound
+			if findProvider(p.placesProviders, label) != nil {
+				code, statusCode = api.ProviderNotAllowedErrorCode, http.StatusForbidden
+			}
+			return nil, &api.Error{
+				Code:       code,
+				Message:    api.ErrorMessageText[code],
+				StatusCode: statusCode,
+				TraceId:    GetRequestID(ctx),
 			}
-			return err
-		})
+		}
+		if findProvider(selected, label) == nil {
+			selected = append(selected, provider)
+		}
 	}
-	if err := g.Wait(); err != nil {
-		log.GetLoggerWithContext(ctx).Error(err.Error()) //log error instead and return what is collected
-		return placesResults, nil
+	return selected, nil
+}
+
+// providersForMode keeps the providers supporting the search mode, at least one of them has to
+func providersForMode(ctx context.Context, placesProviders []providers.Provider, mode providers.SearchMode) ([]providers.Provider, error) {
+	capable := []providers.Provider{}
+	for _, provider := range placesProviders {
+		if providers.SupportsMode(provider, mode) {
+			capable = append(capable, provider)
+		}
+	}
+	if len(capable) == 0 {
+		return nil, newBadRequestErrorWithContext(ctx, api.ModeNotSupportedErrorCode)
+	}
+	return capable, nil
+}
+
+func findProvider(placesProviders []providers.Provider, label string) providers.Provider {
+	for _, provider := range placesProviders {
+		if string(provider.GetProviderLabel()) == label {
+			return provider
+		}
+	}
+	return nil
+}
+
+// AllowedProviders returns the providers the authenticated caller (if any) is allowed to fan out to
+func (p *PlacesHandler) AllowedProviders(ctx context.Context) ([]providers.Provider, error) {
+	principal, ok := auth.PrincipalFromContext(ctx)
+	if !ok {
+		return p.placesProviders, nil
+	}
+	allowed := []providers.Provider{}
+	for _, provider := range p.placesProviders {
+		if principal.IsProviderAllowed(string(provider.GetProviderLabel())) {
+			allowed = append(allowed, provider)
+		}
+	}
+	if len(allowed) == 0 {
+		return nil, &api.Error{
+			StatusCode: http.StatusForbidden,
+			Type:       api.AuthorizationErrorType,
+			Code:       api.ProviderNotAllowedErrorCode,
+			Message:    api.ErrorMessageText[api.ProviderNotAllowedErrorCode],
+			TraceId:    GetRequestID(ctx),
+		}
+	}
+	return allowed, nil
+}
+
+// getSessionID returns the client autocomplete session id (query param or header), empty without session.
+// The ids are scoped by authenticated client, so clients can't end the sessions of each other
+func getSessionID(r *http.Request) (string, error) {
+	sessionID := r.URL.Query().Get(sessionQueryParam)
+	if sessionID == "" {
+		sessionID = r.Header.Get(sessionHeader)
+	}
+	if sessionID == "" {
+		return "", nil
+	}
+	if !sessionIDPattern.MatchString(sessionID) {
+		return "", newBadRequestError(r, api.SessionParamMalformedErrorCode)
+	}
+	if principal, ok := auth.PrincipalFromContext(r.Context()); ok {
+		sessionID = principal.ClientID + "/" + sessionID
+	}
+	return sessionID, nil
+}
+
+// getRadius returns the search radius of the request in kilometers, 0 when not supplied: the providers radius is used
+func getRadius(r *http.Request) (int, error) {
+	param := r.URL.Query().Get(radiusQueryParam)
+	if param == "" {
+		return 0, nil
+	}
+	radius, err := strconv.Atoi(param)
+	if err != nil || radius < 1 || radius > config.MaxAllowedSearchRadius {
+		return 0, newBadRequestError(r, api.RadiusParamMalformedErrorCode)
+	}
+	return radius, nil
+}
+
+// getLanguage returns the language of the results: the language query param, else the preferred supported language
+// of the Accept-Language header. Empty: the providers language
+func getLanguage(r *http.Request) (string, error) {
+	if param := r.URL.Query().Get(languageQueryParam); param != "" {
+		language, ok := supportedLanguage(param)
+		if !ok {
+			return "", newBadRequestError(r, api.LanguageParamMalformedErrorCode)
+		}
+		return language, nil
+	}
+	// unsupported languages of the header are skipped, a browser sends whatever its user configured
+	languageRanges := parseAccept(r.Header.Get("Accept-Language"))
+	sort.SliceStable(languageRanges, func(i, j int) bool { return languageRanges[i].quality > languageRanges[j].quality })
+	for _, languageRange := range languageRanges {
+		if language, ok := supportedLanguage(languageRange.mediaType); ok && languageRange.quality > 0 {
+			return language, nil
+		}
+	}
+	return "", nil
+}
+
+// supportedLanguage returns the primary subtag of a language tag (e.g. "pt" of "pt-BR") when it is supported
+func supportedLanguage(tag string) (string, bool) {
+	primary := strings.ToLower(strings.SplitN(strings.Replace(tag, "_", "-", -1), "-", 2)[0])
+	for _, language := range strings.Split(config.SupportedLanguages, ",") {
+		if language == primary {
+			return language, true
+		}
+	}
+	return "", false
+}
+
+// getCategories returns the search categories of the request, nil when not supplied
+func getCategories(r *http.Request) ([]string, error) {
+	var categories []string
+	for _, name := range splitQueryParam(r.URL.Query().Get(categoriesQueryParam)) {
+		category, ok := providers.ParseSearchCategory(name)
+		if !ok {
+			return nil, newBadRequestError(r, api.CategoryParamMalformedErrorCode)
+		}
+		duplicate := false
+		for _, existing := range categories {
+			duplicate = duplicate || existing == category
+		}
+		if !duplicate {
+			categories = append(categories, category)
+		}
+	}
+	return categories, nil
+}
+
+// splitQueryParam returns the values of a comma separated query param, the empty ones aside
+func splitQueryParam(param string) []string {
+	values := []string{}
+	for _, value := range strings.Split(param, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// negotiatedHeaders are the request headers the places depend on: the format is negotiated, so is the language
+// when not supplied as query param
+func negotiatedHeaders(r *http.Request) []string {
+	if r.URL.Query().Get(languageQueryParam) != "" {
+		return []string{"Accept"}
 	}
-	return placesResults, nil
+	return []string{"Accept", "Accept-Language"}
 }
 
 func setDefaultHeaders(w http.ResponseWriter) {
@@ -5,12 +5,16 @@ import (
 	"encoding/json"
 	"errors"
 	"github.com/codeselim/go-webservice-places-provider/api"
+	"github.com/codeselim/go-webservice-places-provider/auth"
 	"github.com/codeselim/go-webservice-places-provider/providers"
+	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"testing"
+	"time"
 )
 
 var (
@@ -51,9 +55,13 @@ func (m *mockGooglePlacesProvider) GetPlaceDetails(ctx context.Context, placeId
 func (m *mockGooglePlacesProvider) GetProviderLabel() providers.ProviderLabel {
 	return "google-provider-label"
 }
+func (m *mockGooglePlacesProvider) GetSearchModes() []providers.SearchMode {
+	return []providers.SearchMode{providers.AutocompleteMode, providers.TextMode, providers.NearbyMode}
+}
 
 type mockFourSquarePlacesProvider struct {
 	mock.Mock
+	searchModes []providers.SearchMode // all the modes when empty
 }
 
 //Meet the Provider interface
@@ -68,6 +76,12 @@ func (m *mockFourSquarePlacesProvider) GetPlaceDetails(ctx context.Context, plac
 func (m *mockFourSquarePlacesProvider) GetProviderLabel() providers.ProviderLabel {
 	return "foursquare-provider-label"
 }
+func (m *mockFourSquarePlacesProvider) GetSearchModes() []providers.SearchMode {
+	if len(m.searchModes) == 0 {
+		return []providers.SearchMode{providers.AutocompleteMode, providers.TextMode, providers.NearbyMode}
+	}
+	return m.searchModes
+}
 
 func TestPlacesHandlerPanics(t *testing.T) {
 	assert.Panics(t, func() { NewPlacesHandler(nil) })
@@ -226,3 +240,230 @@ func TestPlacesHandlerGetPlacesFromAllProvidersSkipOneProviderErr(t *testing.T)
 
 	assert.Equal(t, api.Places{apiPlaceFromFoursquare}, actualPlaces)
 }
+
+func TestPlacesHandlerGetPlacesAllProvidersFail(t *testing.T) {
+	googlePlacesProvider := new(mockGooglePlacesProvider)
+	googlePlacesProvider.On("GetPlacesByQuery", mock.Anything, mock.Anything).Return(api.Places{},
+		&providers.ProviderError{Provider: "google-provider-label", Kind: providers.QuotaErrorKind, Err: errors.New("maps: OVER_QUERY_LIMIT - ")})
+	foursquarePlacesProvider := new(mockFourSquarePlacesProvider)
+	foursquarePlacesProvider.On("GetPlacesByQuery", mock.Anything, mock.Anything).Return(api.Places{}, errors.New("some-kind-of-error"))
+	placesHandler := NewPlacesHandler(foursquarePlacesProvider, googlePlacesProvider)
+
+	// no places at all is not an empty search: the classified failure is returned
+	rr := httptest.NewRecorder()
+	placesHandler.GetPlaces(rr, httptest.NewRequest("GET", "/api/v1/places?text=chocolate", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	apiError := api.Error{}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &apiError))
+	assert.Equal(t, api.ProviderQuotaExceededErrorCode, apiError.Code)
+
+	// the pages as well
+	rr = httptest.NewRecorder()
+	placesHandler.GetPlaces(rr, httptest.NewRequest("GET", "/api/v1/places?text=chocolate&limit=10", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+}
+
+// a provider whose results can be cached
+type mockCacheableGooglePlacesProvider struct {
+	mockGooglePlacesProvider
+	cacheTTL time.Duration
+}
+
+func (m *mockCacheableGooglePlacesProvider) GetCacheTTL() time.Duration {
+	return m.cacheTTL
+}
+
+func TestPlacesHandlerGetPlacesConditionalRequest(t *testing.T) {
+	googlePlacesProvider := &mockCacheableGooglePlacesProvider{cacheTTL: 5 * time.Minute}
+	googlePlacesProvider.On("GetPlacesByQuery", mock.Anything, mock.Anything).Return(api.Places{apiPlaceFromGoogle}, nil)
+	foursquarePlacesProvider := new(mockFourSquarePlacesProvider)
+	foursquarePlacesProvider.On("GetPlacesByQuery", mock.Anything, mock.Anything).Return(api.Places{apiPlaceFromFoursquare}, nil)
+
+	placesHandler := NewPlacesHandler(googlePlacesProvider)
+	rr := httptest.NewRecorder()
+	placesHandler.GetPlaces(rr, httptest.NewRequest("GET", "/api/v1/places?text=vegan", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "public, max-age=300", rr.Header().Get("Cache-Control"))
+	etag := rr.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	// the client already has the results
+	req := httptest.NewRequest("GET", "/api/v1/places?text=vegan", nil)
+	req.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	placesHandler.GetPlaces(rr, req)
+	assert.Equal(t, http.StatusNotModified, rr.Code)
+	assert.Equal(t, etag, rr.Header().Get("ETag"))
+	assert.Equal(t, 0, rr.Body.Len())
+
+	// results of a provider without cache TTL are revalidated on every use
+	placesHandler = NewPlacesHandler(googlePlacesProvider, foursquarePlacesProvider)
+	rr = httptest.NewRecorder()
+	placesHandler.GetPlaces(rr, httptest.NewRequest("GET", "/api/v1/places?text=vegan", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "public, no-cache", rr.Header().Get("Cache-Control"))
+	assert.NotEqual(t, etag, rr.Header().Get("ETag"))
+}
+
+func TestPlacesHandlerGetPlacesSession(t *testing.T) {
+	googlePlacesProvider := new(mockGooglePlacesProvider)
+	googlePlacesProvider.On("GetPlacesByQuery", mock.Anything, mock.Anything).Return(api.Places{apiPlaceFromGoogle}, nil)
+	placesHandler := NewPlacesHandler(googlePlacesProvider)
+
+	placesHandler.GetPlaces(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/v1/places?text=vegan&session=abc-123", nil))
+	googlePlacesProvider.AssertCalled(t, "GetPlacesByQuery", mock.Anything, providers.PlaceSearchRequest{InputString: "vegan", SessionID: "abc-123", Mode: providers.AutocompleteMode})
+
+	// from the header, scoped by authenticated client
+	req := httptest.NewRequest("GET", "/api/v1/places?text=vegan", nil)
+	req.Header.Set("X-Session-ID", "abc-123")
+	req = req.WithContext(auth.WithPrincipal(req.Context(), &auth.Principal{ClientID: "mobile-app"}))
+	placesHandler.GetPlaces(httptest.NewRecorder(), req)
+	googlePlacesProvider.AssertCalled(t, "GetPlacesByQuery", mock.Anything, providers.PlaceSearchRequest{InputString: "vegan", SessionID: "mobile-app/abc-123", Mode: providers.AutocompleteMode})
+
+	rr := httptest.NewRecorder()
+	placesHandler.GetPlaces(rr, httptest.NewRequest("GET", "/api/v1/places?text=vegan&session=a/b", nil))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"code":10020`)
+}
+
+func TestPlacesHandlerGetPlacesSearchModes(t *testing.T) {
+	googlePlacesProvider := new(mockGooglePlacesProvider)
+	googlePlacesProvider.On("GetPlacesByQuery", mock.Anything, mock.Anything).Return(api.Places{apiPlaceFromGoogle}, nil)
+	foursquarePlacesProvider := &mockFourSquarePlacesProvider{searchModes: []providers.SearchMode{providers.AutocompleteMode, providers.TextMode}}
+	foursquarePlacesProvider.On("GetPlacesByQuery", mock.Anything, mock.Anything).Return(api.Places{apiPlaceFromFoursquare}, nil)
+	placesHandler := NewPlacesHandler(googlePlacesProvider, foursquarePlacesProvider)
+
+	// nearby works without text, and only fans out to the capable providers
+	rr := httptest.NewRecorder()
+	placesHandler.GetPlaces(rr, httptest.NewRequest("GET", "/api/v1/places?mode=nearby&latitude=53.5&longitude=9.9", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	googlePlacesProvider.AssertCalled(t, "GetPlacesByQuery", mock.Anything, providers.PlaceSearchRequest{
+		Location: &providers.Location{Lat: 53.5, Lng: 9.9},
+		Mode:     providers.NearbyMode,
+	})
+	foursquarePlacesProvider.AssertNotCalled(t, "GetPlacesByQuery", mock.Anything, mock.Anything)
+
+	rr = httptest.NewRecorder()
+	placesHandler.GetPlaces(rr, httptest.NewRequest("GET", "/api/v1/places?mode=text&text=pizza%20in%20hamburg", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	foursquarePlacesProvider.AssertCalled(t, "GetPlacesByQuery", mock.Anything, providers.PlaceSearchRequest{InputString: "pizza in hamburg", Mode: providers.TextMode})
+
+	tests := []struct {
+		query string
+		code  int
+	}{
+		{"mode=fuzzy&text=pizza", api.ModeParamMalformedErrorCode},
+		{"mode=nearby&text=pizza", api.LocationRequiredErrorCode},
+		{"mode=text", api.TextInputParamIsMissingErrorCode},
+	}
+	for _, test := range tests {
+		rr = httptest.NewRecorder()
+		placesHandler.GetPlaces(rr, httptest.NewRequest("GET", "/api/v1/places?"+test.query, nil))
+		assert.Equal(t, http.StatusBadRequest, rr.Code, test.query)
+		assert.Contains(t, rr.Body.String(), `"code":`+strconv.Itoa(test.code), test.query)
+	}
+
+	// none of the providers supports the mode
+	placesHandler = NewPlacesHandler(foursquarePlacesProvider)
+	rr = httptest.NewRecorder()
+	placesHandler.GetPlaces(rr, httptest.NewRequest("GET", "/api/v1/places?mode=nearby&latitude=53.5&longitude=9.9", nil))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"code":10023`)
+}
+
+func TestPlacesHandlerGetPlacesSearchParams(t *testing.T) {
+	googlePlacesProvider := new(mockGooglePlacesProvider)
+	googlePlacesProvider.On("GetPlacesByQuery", mock.Anything, mock.Anything).Return(api.Places{apiPlaceFromGoogle}, nil)
+	foursquarePlacesProvider := new(mockFourSquarePlacesProvider)
+	foursquarePlacesProvider.On("GetPlacesByQuery", mock.Anything, mock.Anything).Return(api.Places{apiPlaceFromFoursquare}, nil)
+	placesHandler := NewPlacesHandler(googlePlacesProvider, foursquarePlacesProvider)
+
+	rr := httptest.NewRecorder()
+	placesHandler.GetPlaces(rr, httptest.NewRequest("GET", "/api/v1/places?text=vegan&radius=5&language=pt-BR&categories=Restaurant,,cafe,restaurant&providers=google-provider-label", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	googlePlacesProvider.AssertCalled(t, "GetPlacesByQuery", mock.Anything, providers.PlaceSearchRequest{
+		InputString: "vegan",
+		Mode:        providers.AutocompleteMode,
+		Radius:      5,
+		Language:    "pt",
+		Categories:  []string{"restaurant", "cafe"},
+	})
+	foursquarePlacesProvider.AssertNotCalled(t, "GetPlacesByQuery", mock.Anything, mock.Anything)
+	assert.NotContains(t, rr.Header()["Vary"], "Accept-Language", "the language isn't negotiated")
+
+	// the language falls back to the preferred supported one of the Accept-Language header
+	req := httptest.NewRequest("GET", "/api/v1/places?text=vegan", nil)
+	req.Header.Set("Accept-Language", "nl-NL, de;q=0.8, fr;q=0.9, *;q=0.5")
+	rr = httptest.NewRecorder()
+	placesHandler.GetPlaces(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	foursquarePlacesProvider.AssertCalled(t, "GetPlacesByQuery", mock.Anything, providers.PlaceSearchRequest{
+		InputString: "vegan",
+		Mode:        providers.AutocompleteMode,
+		Language:    "fr",
+	})
+	assert.Contains(t, rr.Header()["Vary"], "Accept-Language")
+
+	tests := []struct {
+		query      string
+		statusCode int
+		code       int
+	}{
+		{"text=vegan&radius=0", http.StatusBadRequest, api.RadiusParamMalformedErrorCode},
+		{"text=vegan&radius=51", http.StatusBadRequest, api.RadiusParamMalformedErrorCode},
+		{"text=vegan&radius=far", http.StatusBadRequest, api.RadiusParamMalformedErrorCode},
+		{"text=vegan&language=nl", http.StatusBadRequest, api.LanguageParamMalformedErrorCode},
+		{"text=vegan&categories=cafe,casino", http.StatusBadRequest, api.CategoryParamMalformedErrorCode},
+		{"text=vegan&providers=google-provider-label,YELP", http.StatusNotFound, api.UnknownProviderErrorCode},
+	}
+	for _, test := range tests {
+		rr = httptest.NewRecorder()
+		placesHandler.GetPlaces(rr, httptest.NewRequest("GET", "/api/v1/places?"+test.query, nil))
+		assert.Equal(t, test.statusCode, rr.Code, test.query)
+		assert.Contains(t, rr.Body.String(), `"code":`+strconv.Itoa(test.code), test.query)
+	}
+}
+
+func newPlaceRequest(provider string, id string) *http.Request {
+	req := httptest.NewRequest("GET", "/api/v1/places/"+provider+"/"+id, nil)
+	return mux.SetURLVars(req, map[string]string{providerPathParam: provider, placeIDPathParam: id})
+}
+
+func TestPlacesHandlerGetPlace(t *testing.T) {
+	googlePlacesProvider := &mockCacheableGooglePlacesProvider{cacheTTL: 5 * time.Minute}
+	details := api.PlaceDetails{ID: "id1", Name: "place1"}
+	googlePlacesProvider.On("GetPlaceDetails", mock.Anything, "id1").Return(details, nil)
+	googlePlacesProvider.On("GetPlaceDetails", mock.Anything, "stale").Return(api.PlaceDetails{},
+		&providers.ProviderError{Provider: "google-provider-label", Kind: providers.NotFoundErrorKind, Err: errors.New("maps: NOT_FOUND - ")})
+	placesHandler := NewPlacesHandler(googlePlacesProvider, new(mockFourSquarePlacesProvider))
+
+	rr := httptest.NewRecorder()
+	placesHandler.GetPlace(rr, newPlaceRequest("google-provider-label", "id1"))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "public, max-age=300", rr.Header().Get("Cache-Control"))
+	received := api.PlaceDetails{}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &received))
+	assert.Equal(t, details, received)
+
+	// conditional request
+	req := newPlaceRequest("google-provider-label", "id1")
+	req.Header.Set("If-None-Match", rr.Header().Get("ETag"))
+	rr = httptest.NewRecorder()
+	placesHandler.GetPlace(rr, req)
+	assert.Equal(t, http.StatusNotModified, rr.Code)
+
+	rr = httptest.NewRecorder()
+	placesHandler.GetPlace(rr, newPlaceRequest("google-provider-label", "stale"))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = httptest.NewRecorder()
+	placesHandler.GetPlace(rr, newPlaceRequest("unknown", "id1"))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	// a provider the key isn't allowed to use
+	req = newPlaceRequest("foursquare-provider-label", "id2")
+	req = req.WithContext(auth.WithPrincipal(req.Context(), &auth.Principal{ClientID: "web-app", AllowedProviders: []string{"google-provider-label"}}))
+	rr = httptest.NewRecorder()
+	placesHandler.GetPlace(rr, req)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+}
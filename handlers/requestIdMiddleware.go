@@ -16,6 +16,11 @@ func AssignRequestID(ctx context.Context) context.Context {
 	return context.WithValue(ctx, config.ContextKeyRequestID, reqID.String())
 }
 
+// WithRequestID attaches a request ID received from the caller (e.g. in the gRPC metadata)
+func WithRequestID(ctx context.Context, reqID string) context.Context {
+	return context.WithValue(ctx, config.ContextKeyRequestID, reqID)
+}
+
 // GetRequestID will get reqID from a http request and return it as a string
 func GetRequestID(ctx context.Context) string {
 
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/codeselim/go-webservice-places-provider/api"
+	"github.com/codeselim/go-webservice-places-provider/auth"
+	"github.com/codeselim/go-webservice-places-provider/log"
+	"github.com/codeselim/go-webservice-places-provider/providers"
+	"hash"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+ * Buffered responses path: the body is serialized before anything is written, so it can get a strong ETag
+ * and conditional requests (If-None-Match) can be answered with a 304 Not Modified.
+ */
+
+// cachePolicy of a response, built from the cache TTLs of the providers it comes from
+type cachePolicy struct {
+	maxAge  time.Duration // 0: stored but revalidated on every use
+	private bool          // the response depends on the authenticated client, shared caches (CDN) must not store it
+	vary    []string      // request headers the response depends on
+}
+
+// newProvidersCachePolicy returns the policy of results aggregated from placesProviders: the shortest TTL wins.
+// Incomplete results (a provider failed) are revalidated on every use
+func newProvidersCachePolicy(r *http.Request, placesProviders []providers.Provider, complete bool) cachePolicy {
+	policy := cachePolicy{}
+	if complete && len(placesProviders) > 0 {
+		policy.maxAge = -1
+		for _, provider := range placesProviders {
+			ttl := time.Duration(0)
+			if reporter, ok := provider.(providers.CacheTTLReporter); ok {
+				ttl = reporter.GetCacheTTL()
+			}
+			if policy.maxAge < 0 || ttl < policy.maxAge {
+				policy.maxAge = ttl
+			}
+		}
+	}
+	if _, ok := auth.PrincipalFromContext(r.Context()); ok {
+		policy.private = true
+		policy.vary = append(policy.vary, "Authorization", apiKeyHeader)
+	}
+	return policy
+}
+
+func (c cachePolicy) cacheControl() string {
+	visibility := "public"
+	if c.private {
+		visibility = "private"
+	}
+	if c.maxAge <= 0 {
+		return visibility + ", no-cache"
+	}
+	return visibility + ", max-age=" + strconv.Itoa(int(c.maxAge.Seconds()))
+}
+
+// writeCacheableJSON writes body with its ETag and cache headers, or a 304 when the client already has it
+func writeCacheableJSON(w http.ResponseWriter, r *http.Request, body interface{}, policy cachePolicy) {
+	writeCacheableJSONAs(w, r, body, "application/json", policy)
+}
+
+// writeCacheableJSONAs writes a JSON based format, e.g. GeoJSON, as writeCacheableJSON does
+func writeCacheableJSONAs(w http.ResponseWriter, r *http.Request, body interface{}, contentType string, policy cachePolicy) {
+	content, err := json.Marshal(body)
+	if err != nil {
+		HandleError(err, w, r)
+		return
+	}
+	writeCacheable(w, r, append(content, '\n'), contentType, policy)
+}
+
+// writePlaces streams the places in the negotiated format. The places are encoded twice: a first time to compute
+// their ETag and length without holding the whole document in memory, then to the client when it doesn't have them yet
+func writePlaces(w http.ResponseWriter, r *http.Request, encoder ResponseEncoder, places api.Places, policy cachePolicy) {
+	digest := newDigestWriter()
+	if err := encoder.EncodePlaces(digest, places); err != nil {
+		HandleError(err, w, r)
+		return
+	}
+	if filename := r.URL.Query().Get(filenameQueryParam); filename != "" {
+		w.Header().Set("Content-Disposition", contentDisposition(filename, encoder.FileExtension()))
+	}
+	// a HEAD gets the body as well, the server discards it: the compression middleware picks the encoding of a GET
+	if !writeCacheHeaders(w, r, digest.etag(), digest.length, encoder.ContentType(), policy) {
+		return
+	}
+	if err := encoder.EncodePlaces(w, places); err != nil {
+		// the headers are sent, the client gets a truncated body (shorter than its Content-Length)
+		log.GetLoggerWithContext(r.Context()).Error("Couldn't write the places: " + err.Error())
+	}
+}
+
+func writeCacheable(w http.ResponseWriter, r *http.Request, content []byte, contentType string, policy cachePolicy) {
+	digest := newDigestWriter()
+	digest.Write(content)
+	if writeCacheHeaders(w, r, digest.etag(), digest.length, contentType, policy) {
+		w.Write(content)
+	}
+}
+
+// writeCacheHeaders sends the headers of a 200, or a 304 when the client already has the content. It returns false on 304
+func writeCacheHeaders(w http.ResponseWriter, r *http.Request, etag string, length int, contentType string, policy cachePolicy) bool {
+	setDefaultHeaders(w)
+	headers := w.Header()
+	headers.Set("Content-Type", contentType)
+	headers.Set("ETag", etag)
+	headers.Set("Cache-Control", policy.cacheControl())
+	for _, vary := range policy.vary {
+		addVary(headers, vary)
+	}
+
+	if ifNoneMatchMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return false
+	}
+	headers.Set("Content-Length", strconv.Itoa(length))
+	w.WriteHeader(http.StatusOK)
+	return true
+}
+
+// digestWriter hashes and counts what is written to it
+type digestWriter struct {
+	hash   hash.Hash
+	length int
+}
+
+func newDigestWriter() *digestWriter {
+	return &digestWriter{hash: sha256.New()}
+}
+
+func (d *digestWriter) Write(b []byte) (int, error) {
+	d.length += len(b)
+	return d.hash.Write(b)
+}
+
+// strong ETag: the same serialized body always gets the same ETag, whatever the instance serving it
+func (d *digestWriter) etag() string {
+	return `"` + hex.EncodeToString(d.hash.Sum(nil)[:16]) + `"`
+}
+
+// If-None-Match uses the weak comparison (RFC 7232): W/"x" matches "x"
+func ifNoneMatchMatches(ifNoneMatch string, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"github.com/codeselim/go-webservice-places-provider/api"
+	"github.com/codeselim/go-webservice-places-provider/auth"
+	"github.com/codeselim/go-webservice-places-provider/providers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUnitIfNoneMatchMatches(t *testing.T) {
+	etag := `"abc"`
+	assert.True(t, ifNoneMatchMatches(`"abc"`, etag))
+	assert.True(t, ifNoneMatchMatches(`W/"abc"`, etag))
+	assert.True(t, ifNoneMatchMatches(`"other", "abc"`, etag))
+	assert.True(t, ifNoneMatchMatches(`*`, etag))
+	assert.False(t, ifNoneMatchMatches(``, etag))
+	assert.False(t, ifNoneMatchMatches(`"other"`, etag))
+}
+
+func TestUnitProvidersCachePolicy(t *testing.T) {
+	shortTTL := &mockCacheableGooglePlacesProvider{cacheTTL: time.Minute}
+	longTTL := &mockCacheableGooglePlacesProvider{cacheTTL: time.Hour}
+	req := httptest.NewRequest("GET", "/api/v1/places?text=vegan", nil)
+
+	policy := newProvidersCachePolicy(req, []providers.Provider{shortTTL, longTTL}, true)
+	assert.Equal(t, "public, max-age=60", policy.cacheControl())
+
+	// incomplete results
+	policy = newProvidersCachePolicy(req, []providers.Provider{shortTTL, longTTL}, false)
+	assert.Equal(t, "public, no-cache", policy.cacheControl())
+
+	// authenticated clients results
+	req = req.WithContext(auth.WithPrincipal(req.Context(), &auth.Principal{ClientID: "web-app"}))
+	policy = newProvidersCachePolicy(req, []providers.Provider{longTTL}, true)
+	assert.Equal(t, "private, max-age=3600", policy.cacheControl())
+	assert.Equal(t, []string{"Authorization", "X-API-Key"}, policy.vary)
+}
+
+func TestUnitWriteCacheableJSONHead(t *testing.T) {
+	body := api.Places{apiPlaceFromGoogle}
+	get := httptest.NewRecorder()
+	writeCacheableJSON(get, httptest.NewRequest("GET", "/api/v1/places", nil), body, cachePolicy{maxAge: time.Minute})
+	head := httptest.NewRecorder()
+	writeCacheableJSON(head, httptest.NewRequest("HEAD", "/api/v1/places", nil), body, cachePolicy{maxAge: time.Minute})
+
+	assert.Equal(t, http.StatusOK, head.Code)
+	assert.Equal(t, get.Header(), head.Header())
+}
+
+func TestWriteCacheableJSONHeadCompressed(t *testing.T) {
+	body := api.Places{}
+	for i := 0; i < 20; i++ {
+		body = append(body, apiPlaceFromGoogle)
+	}
+	server := httptest.NewServer(CompressMiddleware(newTestCompressionConfig())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeCacheableJSON(w, r, body, cachePolicy{maxAge: time.Minute})
+	})))
+	defer server.Close()
+
+	responses := map[string]*http.Response{}
+	for _, method := range []string{"GET", "HEAD"} {
+		req, _ := http.NewRequest(method, server.URL, nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		resp, err := http.DefaultClient.Do(req)
+		if !assert.NoError(t, err) {
+			return
+		}
+		resp.Body.Close()
+		responses[method] = resp
+	}
+
+	get, head := responses["GET"], responses["HEAD"]
+	assert.Equal(t, "gzip", head.Header.Get("Content-Encoding"))
+	assert.True(t, strings.HasSuffix(head.Header.Get("ETag"), `-gzip"`))
+	// not the uncompressed length (net/http sets the compressed one of a GET whose body it buffered whole)
+	assert.Equal(t, "", head.Header.Get("Content-Length"))
+	for _, header := range []string{"Content-Encoding", "ETag", "Vary", "Cache-Control", "Content-Type"} {
+		assert.Equal(t, get.Header.Get(header), head.Header.Get(header), header)
+	}
+}
+
+func TestPlacesHandlerETagIndependentOfProvidersLatency(t *testing.T) {
+	etag := func(googleLatency, foursquareLatency time.Duration) string {
+		googlePlacesProvider := new(mockGooglePlacesProvider)
+		googlePlacesProvider.On("GetPlacesByQuery", mock.Anything, mock.Anything).Return(api.Places{apiPlaceFromGoogle}, nil).After(googleLatency)
+		foursquarePlacesProvider := new(mockFourSquarePlacesProvider)
+		foursquarePlacesProvider.On("GetPlacesByQuery", mock.Anything, mock.Anything).Return(api.Places{apiPlaceFromFoursquare}, nil).After(foursquareLatency)
+		placesHandler := NewPlacesHandler(googlePlacesProvider, foursquarePlacesProvider)
+
+		rr := httptest.NewRecorder()
+		placesHandler.GetPlaces(rr, httptest.NewRequest("GET", "/api/v1/places?text=vegan", nil))
+		assert.Equal(t, http.StatusOK, rr.Code)
+		return rr.Header().Get("ETag")
+	}
+
+	googleFirst := etag(0, 20*time.Millisecond)
+	assert.NotEmpty(t, googleFirst)
+	assert.Equal(t, googleFirst, etag(20*time.Millisecond, 0))
+}
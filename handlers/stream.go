@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/codeselim/go-webservice-places-provider/api"
+	"github.com/codeselim/go-webservice-places-provider/log"
+	"github.com/codeselim/go-webservice-places-provider/providers"
+	"io"
+	"net/http"
+	"strings"
+)
+
+/**
+ * Streaming mode of the places search, selected with the Accept header: text/event-stream (Server-Sent Events)
+ * or application/x-ndjson. The places of each provider are flushed as soon as it answers, instead of waiting
+ * for the slowest one. The stream ends with a summary event listing the providers statuses.
+ */
+
+const (
+	placesEvent  = "places"  // data: api.ProviderPlaces, api.ProviderPlacesV2 in v2
+	summaryEvent = "summary" // data: api.StreamSummary
+
+	providerStateOK     = "OK"
+	providerStateFailed = "FAILED"
+)
+
+type streamEncoder interface {
+	ContentType() string
+	EncodeEvent(w io.Writer, event string, data interface{}) error
+}
+
+var streamEncoders = []streamEncoder{sseEncoder{}, ndjsonEncoder{}}
+
+// negotiateStream returns the stream encoder when a streaming media type is the best match of the Accept header.
+// The format query parameter, the paginated and the HEAD requests always get a regular response
+func negotiateStream(r *http.Request) (streamEncoder, bool) {
+	if r.Method == http.MethodHead || r.URL.Query().Get(formatQueryParam) != "" || isPaginated(r) {
+		return nil, false
+	}
+	var best streamEncoder
+	bestQuality := 0.0
+	for _, mediaRange := range parseAccept(r.Header.Get("Accept")) {
+		if mediaRange.quality <= bestQuality {
+			continue
+		}
+		if stream := findStreamEncoder(mediaRange.mediaType); stream != nil {
+			best, bestQuality = stream, mediaRange.quality
+		} else if isServedMediaType(mediaRange.mediaType) {
+			best, bestQuality = nil, mediaRange.quality
+		}
+	}
+	return best, best != nil
+}
+
+func findStreamEncoder(mediaType string) streamEncoder {
+	for _, stream := range streamEncoders {
+		if stream.ContentType() == mediaType {
+			return stream
+		}
+	}
+	return nil
+}
+
+// wildcards and the registered formats are served with a regular response
+func isServedMediaType(mediaType string) bool {
+	if strings.HasSuffix(mediaType, "*") {
+		return true
+	}
+	encodersMu.RLock()
+	defer encodersMu.RUnlock()
+	for _, encoder := range encoders {
+		if encoder.ContentType() == mediaType {
+			return true
+		}
+	}
+	return false
+}
+
+// writePlacesStream streams the places of each provider as it answers. Once the client is gone (failed write or
+// cancelled request) nothing more is written, the cancelled context stops the pending provider calls
+func (p *PlacesHandler) writePlacesStream(w http.ResponseWriter, r *http.Request, stream streamEncoder, placesProviders []providers.Provider,
+	request providers.PlaceSearchRequest) {
+	ctx := r.Context()
+	logger := log.GetLoggerWithContext(ctx)
+
+	headers := w.Header()
+	headers.Set("Content-Type", stream.ContentType())
+	headers.Set("Cache-Control", "no-cache")
+	headers.Set("X-Accel-Buffering", "no") // disables the proxies (nginx) buffering
+	addVary(headers, "Accept")
+	w.WriteHeader(http.StatusOK)
+	flush := func() {
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+	}
+	flush()
+
+	var writeErr error
+	summary := api.StreamSummary{Complete: true, Providers: []api.ProviderStatus{}}
+	p.StreamPlaces(ctx, placesProviders, request, func(label providers.ProviderLabel, places api.Places, err error) {
+		status := api.ProviderStatus{Provider: string(label), State: providerStateOK, Count: len(places)}
+		if err != nil {
+			logger.Error(err.Error())
+			status = api.ProviderStatus{Provider: string(label), State: providerStateFailed, Error: ToAPIError(ctx, err)}
+			summary.Complete = false
+		}
+		summary.Providers = append(summary.Providers, status)
+		if err != nil || writeErr != nil || ctx.Err() != nil {
+			return
+		}
+		if writeErr = stream.EncodeEvent(w, placesEvent, providerPlaces(ctx, string(label), places)); writeErr == nil {
+			flush()
+		}
+	})
+
+	if writeErr != nil || ctx.Err() != nil {
+		logger.Info("Client gone, places stream stopped")
+		return
+	}
+	if err := stream.EncodeEvent(w, summaryEvent, summary); err != nil {
+		logger.Info("Client gone, places stream stopped")
+		return
+	}
+	flush()
+}
+
+// sseEncoder writes Server-Sent Events, the data is a single line of json
+type sseEncoder struct{}
+
+func (sseEncoder) ContentType() string {
+	return "text/event-stream"
+}
+
+func (sseEncoder) EncodeEvent(w io.Writer, event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+	return err
+}
+
+// ndjsonEncoder writes an {"event": ..., "data": ...} json object per line
+type ndjsonEncoder struct{}
+
+type ndjsonEvent struct {
+	Event string      `json:"event"`
+	Data  interface{} `json:"data"`
+}
+
+func (ndjsonEncoder) ContentType() string {
+	return "application/x-ndjson"
+}
+
+func (ndjsonEncoder) EncodeEvent(w io.Writer, event string, data interface{}) error {
+	return json.NewEncoder(w).Encode(ndjsonEvent{Event: event, Data: data})
+}
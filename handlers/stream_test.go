@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/codeselim/go-webservice-places-provider/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// a fast google provider and a foursquare provider answering once released
+func newStreamTestServer(t *testing.T, release chan struct{}, foursquareErr error, wrap func(http.Handler) http.Handler) (*httptest.Server, chan error) {
+	googleProvider := new(mockGooglePlacesProvider)
+	googleProvider.On("GetPlacesByQuery", mock.Anything, mock.Anything).Return(api.Places{apiPlaceFromGoogle}, nil)
+	foursquareDone := make(chan error, 1)
+	foursquareProvider := new(mockFourSquarePlacesProvider)
+	foursquareProvider.On("GetPlacesByQuery", mock.Anything, mock.Anything).Return(api.Places{apiPlaceFromFoursquare}, foursquareErr).Run(func(args mock.Arguments) {
+		ctx := args.Get(0).(context.Context)
+		select {
+		case <-release:
+			foursquareDone <- nil
+		case <-ctx.Done():
+			foursquareDone <- ctx.Err()
+		}
+	})
+	placesHandler := NewPlacesHandler(googleProvider, foursquareProvider)
+
+	server := httptest.NewServer(wrap(http.HandlerFunc(placesHandler.GetPlaces)))
+	t.Cleanup(server.Close)
+	return server, foursquareDone
+}
+
+func noMiddleware(next http.Handler) http.Handler {
+	return next
+}
+
+func TestPlacesStreamSSE(t *testing.T) {
+	release := make(chan struct{})
+	server, _ := newStreamTestServer(t, release, nil, noMiddleware)
+
+	req, _ := http.NewRequest("GET", server.URL+"/places?text=coffee", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "no-cache", resp.Header.Get("Cache-Control"))
+	assert.Equal(t, "Accept", resp.Header.Get("Vary"))
+
+	reader := bufio.NewReader(resp.Body)
+	// the google places are received while foursquare is still pending
+	event, data := readSSEEvent(t, reader)
+	assert.Equal(t, "places", event)
+	assert.JSONEq(t, `{"provider": "google-provider-label", "places": [{"id": "id1", "provider": "google-provider-label", "name": "place1", "address": "address1", "uri": "Uri1"}]}`, data)
+
+	close(release)
+	event, data = readSSEEvent(t, reader)
+	assert.Equal(t, "places", event)
+	assert.Contains(t, data, `"provider":"foursquare-provider-label"`)
+
+	event, data = readSSEEvent(t, reader)
+	assert.Equal(t, "summary", event)
+	summary := api.StreamSummary{}
+	require.NoError(t, json.Unmarshal([]byte(data), &summary))
+	assert.True(t, summary.Complete)
+	assert.Equal(t, []api.ProviderStatus{
+		{Provider: "google-provider-label", State: "OK", Count: 1},
+		{Provider: "foursquare-provider-label", State: "OK", Count: 1},
+	}, summary.Providers)
+
+	_, err = reader.ReadByte()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestPlacesStreamNDJSONWithProviderError(t *testing.T) {
+	release := make(chan struct{})
+	close(release)
+	server, _ := newStreamTestServer(t, release, errors.New("foursquare is down"), noMiddleware)
+
+	req, _ := http.NewRequest("GET", server.URL+"/places?text=coffee", nil)
+	req.Header.Set("Accept", "application/x-ndjson")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, "application/x-ndjson", resp.Header.Get("Content-Type"))
+	events := []ndjsonEvent{}
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		event := ndjsonEvent{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		events = append(events, event)
+	}
+
+	require.Len(t, events, 2)
+	assert.Equal(t, "places", events[0].Event)
+	assert.Equal(t, "summary", events[1].Event)
+	data, _ := json.Marshal(events[1].Data)
+	summary := api.StreamSummary{}
+	require.NoError(t, json.Unmarshal(data, &summary))
+	assert.False(t, summary.Complete)
+	// the providers are listed by order of answer
+	assert.ElementsMatch(t, []api.ProviderStatus{
+		{Provider: "google-provider-label", State: "OK", Count: 1},
+		{Provider: "foursquare-provider-label", State: "FAILED", Error: &api.Error{
+			Message: "Oops! something went wrong! Please refer to our support with your traceId",
+		}},
+	}, summary.Providers)
+}
+
+func TestPlacesStreamCompressed(t *testing.T) {
+	release := make(chan struct{})
+	compress := CompressMiddleware(CompressionConfig{Encodings: []string{"gzip"}, MinSize: 1024, ContentTypes: []string{"text/*"}})
+	server, _ := newStreamTestServer(t, release, nil, compress)
+
+	req, _ := http.NewRequest("GET", server.URL+"/places?text=coffee", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+	gzipReader, err := gzip.NewReader(resp.Body)
+	require.NoError(t, err)
+	reader := bufio.NewReader(gzipReader)
+	// small flushed batches are compressed and received right away
+	event, _ := readSSEEvent(t, reader)
+	assert.Equal(t, "places", event)
+
+	close(release)
+	readSSEEvent(t, reader)
+	event, _ = readSSEEvent(t, reader)
+	assert.Equal(t, "summary", event)
+}
+
+func TestPlacesStreamClientGone(t *testing.T) {
+	release := make(chan struct{})
+	server, foursquareDone := newStreamTestServer(t, release, nil, noMiddleware)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/places?text=coffee", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	readSSEEvent(t, bufio.NewReader(resp.Body))
+	cancel()
+	resp.Body.Close()
+
+	// the pending provider call is cancelled
+	select {
+	case err := <-foursquareDone:
+		assert.Equal(t, context.Canceled, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the provider call wasn't cancelled")
+	}
+}
+
+func TestNegotiateStream(t *testing.T) {
+	tests := []struct {
+		accept   string
+		query    string
+		method   string
+		expected string
+	}{
+		{"text/event-stream", "", "GET", "text/event-stream"},
+		{"application/x-ndjson", "", "GET", "application/x-ndjson"},
+		{"application/json, text/event-stream;q=0.5", "", "GET", ""},
+		{"application/json;q=0.5, application/x-ndjson", "", "GET", "application/x-ndjson"},
+		{"text/event-stream;q=0.1, */*;q=0.5", "", "GET", ""},
+		{"image/png, text/event-stream;q=0.1", "", "GET", "text/event-stream"},
+		{"text/event-stream", "format=csv", "GET", ""},
+		{"text/event-stream", "", "HEAD", ""},
+		{"", "", "GET", ""},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, "/places?"+test.query, nil)
+		req.Header.Set("Accept", test.accept)
+		stream, ok := negotiateStream(req)
+		if test.expected == "" {
+			assert.False(t, ok, test.accept)
+			continue
+		}
+		require.True(t, ok, test.accept)
+		assert.Equal(t, test.expected, stream.ContentType())
+	}
+}
+
+// reads an event of a Server-Sent Events stream
+func readSSEEvent(t *testing.T, reader *bufio.Reader) (string, string) {
+	var event, data string
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			return event, data
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/codeselim/go-webservice-places-provider/api"
+	"github.com/codeselim/go-webservice-places-provider/config"
+	"io"
+	"net/http"
+)
+
+/**
+ * API versions: the v2 routes share the v1 handlers, only the representations differ. The v2 places have a structured
+ * address (api.PlaceV2) where the v1 ones keep its display line. The file formats (GeoJSON, CSV, KML, GPX) are the
+ * same in both versions.
+ */
+
+const apiVersion2 = 2
+
+// APIVersionMiddleware serves the requests with the representations of an API version
+func APIVersionMiddleware(version int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), config.ContextKeyAPIVersion, version)))
+		})
+	}
+}
+
+// isAPIVersion2 tells if the request is served with the v2 representations
+func isAPIVersion2(ctx context.Context) bool {
+	version, _ := ctx.Value(config.ContextKeyAPIVersion).(int)
+	return version == apiVersion2
+}
+
+// providerPlaces returns the streamed batch of places in the representation of the request API version
+func providerPlaces(ctx context.Context, provider string, places api.Places) interface{} {
+	if isAPIVersion2(ctx) {
+		return api.ProviderPlacesV2{Provider: provider, Places: places.V2()}
+	}
+	return api.ProviderPlaces{Provider: provider, Places: places}
+}
+
+// jsonV2Encoder is the json format of the v2 API, negotiated as the v1 one
+type jsonV2Encoder struct {
+	jsonEncoder
+}
+
+func (jsonV2Encoder) EncodePlaces(w io.Writer, places api.Places) error {
+	return json.NewEncoder(w).Encode(places.V2())
+}
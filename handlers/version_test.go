@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/codeselim/go-webservice-places-provider/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var structuredAddressPlaces = api.Places{
+	{ID: "structured", Provider: "foursquare-provider-label", Address: "Jungfernstieg 1, 20095 Hamburg, Germany", StructuredAddress: &api.Address{
+		Street: "Jungfernstieg", HouseNumber: "1", PostalCode: "20095", City: "Hamburg", CountryCode: "DE", Formatted: "Jungfernstieg 1, 20095 Hamburg",
+	}},
+	{ID: "flat", Provider: "foursquare-provider-label", Address: "Hamburg, Germany"},
+	{ID: "none", Provider: "foursquare-provider-label"},
+}
+
+func newVersionTestHandler() http.Handler {
+	foursquareProvider := new(mockFourSquarePlacesProvider)
+	foursquareProvider.On("GetPlacesByQuery", mock.Anything, mock.Anything).Return(structuredAddressPlaces, nil)
+	placesHandler := NewPlacesHandler(foursquareProvider)
+	return http.HandlerFunc(placesHandler.GetPlaces)
+}
+
+func TestPlacesHandlerGetPlacesV1Address(t *testing.T) {
+	rr := httptest.NewRecorder()
+	newVersionTestHandler().ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/places?text=jungfernstieg", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"address":"Jungfernstieg 1, 20095 Hamburg, Germany"`)
+	assert.NotContains(t, rr.Body.String(), `houseNumber`)
+}
+
+func TestPlacesHandlerGetPlacesV2Address(t *testing.T) {
+	handler := APIVersionMiddleware(2)(newVersionTestHandler())
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v2/places?text=jungfernstieg", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+	places := api.PlacesV2{}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &places))
+	require.Len(t, places, 3)
+	assert.Equal(t, structuredAddressPlaces[0].StructuredAddress, places[0].Address)
+	assert.Equal(t, &api.Address{Formatted: "Hamburg, Germany"}, places[1].Address) // without structure, the display line
+	assert.Nil(t, places[2].Address)
+
+	// the file formats are the same in both versions
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v2/places?text=jungfernstieg&format=csv", nil))
+	assert.Equal(t, "text/csv", rr.Header().Get("Content-Type"))
+	assert.Contains(t, rr.Body.String(), "Jungfernstieg 1, 20095 Hamburg, Germany")
+}
+
+func TestPlacesStreamV2Address(t *testing.T) {
+	rr := httptest.NewRecorder()
+	request := httptest.NewRequest("GET", "/api/v2/places?text=jungfernstieg", nil)
+	request.Header.Set("Accept", "application/x-ndjson")
+	APIVersionMiddleware(2)(newVersionTestHandler()).ServeHTTP(rr, request)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+	require.Len(t, lines, 2) // the places, then the summary
+	event := struct {
+		Event string               `json:"event"`
+		Data  api.ProviderPlacesV2 `json:"data"`
+	}{}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &event))
+	assert.Equal(t, placesEvent, event.Event)
+	require.Len(t, event.Data.Places, 3)
+	assert.Equal(t, "Jungfernstieg", event.Data.Places[0].Address.Street)
+}
+
+func TestPlaceV2EmptyAddress(t *testing.T) {
+	assert.Nil(t, api.Place{ID: "empty", StructuredAddress: &api.Address{}}.V2().Address, `no "address": {}`)
+	assert.Equal(t, &api.Address{Formatted: "Hamburg"}, api.Place{Address: "Hamburg", StructuredAddress: &api.Address{}}.V2().Address)
+}
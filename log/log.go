@@ -25,10 +25,17 @@ func init() {
 }
 
 func GetLoggerWithContext(ctx context.Context) *logrus.Entry {
-	return log.WithFields(logrus.Fields{
+	fields := logrus.Fields{
 		"requestID": getRequestID(ctx),
-	})
-
+	}
+	// authenticated requests are attributed to their client
+	if clientID, ok := ctx.Value(config.ContextKeyClientID).(string); ok && clientID != "" {
+		fields["clientID"] = clientID
+	}
+	if subject, ok := ctx.Value(config.ContextKeySubject).(string); ok && subject != "" {
+		fields["subject"] = subject
+	}
+	return log.WithFields(fields)
 }
 
 func GetLogger() *logrus.Entry {
@@ -46,3 +53,17 @@ func getRequestID(ctx context.Context) string {
 
 	return ""
 }
+
+// SetLevel switches the logging level at runtime, level is one of logrus levels (debug, info, warning...)
+func SetLevel(level string) error {
+	parsedLevel, err := logrus.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	log.SetLevel(parsedLevel)
+	return nil
+}
+
+func GetLevel() string {
+	return log.GetLevel().String()
+}
@@ -1,24 +1,116 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"github.com/codeselim/go-webservice-places-provider/auth"
 	"github.com/codeselim/go-webservice-places-provider/config"
+	"github.com/codeselim/go-webservice-places-provider/grpcserver"
 	"github.com/codeselim/go-webservice-places-provider/handlers"
 	"github.com/codeselim/go-webservice-places-provider/log"
 	"github.com/codeselim/go-webservice-places-provider/providers"
+	"github.com/codeselim/go-webservice-places-provider/server"
 	gh "github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 )
 
 const apiVersion = "v1"
 
-var webServerPort string
+var (
+	webServerPort        string
+	readHeaderTimeout    time.Duration
+	readTimeout          time.Duration
+	writeTimeout         time.Duration
+	idleTimeout          time.Duration
+	maxHeaderBytes       int
+	shutdownGracePeriod  time.Duration
+	shutdownDelay        time.Duration
+	tlsCertFile          string
+	tlsKeyFile           string
+	tlsClientCAFile      string
+	tlsMinVersion        string
+	tlsCipherSuites      string
+	tlsReloadInterval    time.Duration
+	adminServerPort      string
+	grpcServerPort       string
+	grpcBindAddress      string
+	adminBindAddress     string
+	apiKeysFile          string
+	jwtIssuer            string
+	jwtAudience          string
+	jwksFile             string
+	jwksURL              string
+	jwksRefreshInterval  time.Duration
+	corsAllowedOrigins   string
+	corsAllowedMethods   string
+	corsAllowedHeaders   string
+	corsExposedHeaders   string
+	corsAllowCredentials bool
+	corsMaxAge           time.Duration
+	compressEncodings    string
+	compressMinSize      int
+	compressContentTypes string
+	googlePlacesCacheTTL time.Duration
+	foursquareCacheTTL   time.Duration
+	nominatimURL         string
+	nominatimCacheTTL    time.Duration
+	graphqlMaxComplexity int
+	autocompleteDebounce time.Duration
+	autocompleteIdle     time.Duration
+	autocompleteRate     float64
+)
 
 func init() {
 	flag.StringVar(&webServerPort, "httpServerPort", config.DefaultHttpServerPort, "Default port to expose on the API. use -httpServerPort=<port_value>")
+	flag.DurationVar(&readHeaderTimeout, "readHeaderTimeout", config.DefaultReadHeaderTimeout, "Maximum duration to read the request headers")
+	flag.DurationVar(&readTimeout, "readTimeout", config.DefaultReadTimeout, "Maximum duration to read the entire request")
+	flag.DurationVar(&writeTimeout, "writeTimeout", config.DefaultWriteTimeout, "Maximum duration before timing out the response writes")
+	flag.DurationVar(&idleTimeout, "idleTimeout", config.DefaultIdleTimeout, "Maximum duration to wait for the next request on keep-alive connections")
+	flag.IntVar(&maxHeaderBytes, "maxHeaderBytes", config.DefaultMaxHeaderBytes, "Maximum size of the request headers in bytes")
+	flag.DurationVar(&shutdownGracePeriod, "shutdownGracePeriod", config.DefaultShutdownGracePeriod, "Time given to in-flight requests to finish on SIGTERM/SIGINT")
+	flag.DurationVar(&shutdownDelay, "shutdownDelay", config.DefaultShutdownDelay, "Time new requests are still served on SIGTERM/SIGINT, once the readiness is flipped and before draining")
+	flag.StringVar(&tlsCertFile, "tlsCertFile", "", "TLS certificate file (PEM). Serves HTTPS when provided with -tlsKeyFile")
+	flag.StringVar(&tlsKeyFile, "tlsKeyFile", "", "TLS private key file (PEM)")
+	flag.StringVar(&tlsClientCAFile, "tlsClientCAFile", "", "CA bundle (PEM) to verify client certificates against. Enables mTLS")
+	flag.StringVar(&tlsMinVersion, "tlsMinVersion", config.DefaultTLSMinVersion, "Minimum TLS version: 1.2 or 1.3")
+	flag.StringVar(&tlsCipherSuites, "tlsCipherSuites", "", "Comma separated TLS 1.2 cipher suites names, defaults to Go's secure suites")
+	flag.DurationVar(&tlsReloadInterval, "tlsReloadInterval", config.DefaultTLSReloadInterval, "How often the TLS files are checked for changes")
+	flag.IntVar(&graphqlMaxComplexity, "graphqlMaxComplexity", config.DefaultGraphQLMaxComplexity, "Maximum complexity of a GraphQL query, a place details fetch costs "+strconv.Itoa(config.GraphQLDetailsCost))
+	flag.DurationVar(&autocompleteDebounce, "autocompleteDebounce", config.DefaultAutocompleteDebounce, "How long the websocket autocomplete waits for the client to stop typing before searching")
+	flag.DurationVar(&autocompleteIdle, "autocompleteIdleTimeout", config.DefaultAutocompleteIdleTimeout, "Websocket autocomplete connections without queries for this long are closed")
+	flag.Float64Var(&autocompleteRate, "autocompleteRate", config.DefaultAutocompleteRate, "Maximum queries per second of a websocket autocomplete connection")
+	flag.StringVar(&grpcServerPort, "grpcServerPort", config.DefaultGrpcServerPort, "Port of the gRPC PlacesService, for internal services. Empty to disable it")
+	flag.StringVar(&grpcBindAddress, "grpcBindAddress", config.DefaultGrpcBindAddress, "Address the gRPC server binds to. Empty for all the interfaces")
+	flag.StringVar(&adminServerPort, "adminServerPort", config.DefaultAdminServerPort, "Port of the admin server (pprof, metrics, runtime controls). Empty to disable it")
+	flag.StringVar(&adminBindAddress, "adminBindAddress", config.DefaultAdminBindAddress, "Address the admin server binds to. Keep it private!")
+	flag.StringVar(&apiKeysFile, "apiKeysFile", "", "Json file of the clients API keys (hashed secrets, origins, providers and quotas). Enables the API key authentication")
+	flag.StringVar(&jwtIssuer, "jwtIssuer", "", "Expected issuer (iss) of the JWT bearer tokens")
+	flag.StringVar(&jwtAudience, "jwtAudience", "", "Expected audience (aud) of the JWT bearer tokens")
+	flag.StringVar(&jwksFile, "jwksFile", "", "Local JWKS file to verify the JWT bearer tokens. Enables the JWT authentication")
+	flag.StringVar(&jwksURL, "jwksURL", "", "JWKS URL to verify the JWT bearer tokens (instead of -jwksFile). Enables the JWT authentication")
+	flag.DurationVar(&jwksRefreshInterval, "jwksRefreshInterval", config.DefaultJWKSRefreshInterval, "How often the JWKS is refreshed")
+	flag.StringVar(&corsAllowedOrigins, "corsAllowedOrigins", config.DefaultCORSAllowedOrigins, "Comma separated CORS allowed origins: exact origins, wildcard patterns (https://*.example.com) or *")
+	flag.StringVar(&corsAllowedMethods, "corsAllowedMethods", config.DefaultCORSAllowedMethods, "Comma separated CORS allowed methods")
+	flag.StringVar(&corsAllowedHeaders, "corsAllowedHeaders", config.DefaultCORSAllowedHeaders, "Comma separated request headers the browsers can send")
+	flag.StringVar(&corsExposedHeaders, "corsExposedHeaders", config.DefaultCORSExposedHeaders, "Comma separated response headers readable by the browsers")
+	flag.BoolVar(&corsAllowCredentials, "corsAllowCredentials", false, "Allow the browsers to send credentials (cookies, authorization headers)")
+	flag.DurationVar(&corsMaxAge, "corsMaxAge", config.DefaultCORSMaxAge, "How long the browsers can cache the preflight responses")
+	flag.DurationVar(&googlePlacesCacheTTL, "googlePlacesCacheTTL", config.DefaultProviderCacheTTL, "How long clients and CDNs can cache the Google Places results")
+	flag.DurationVar(&foursquareCacheTTL, "foursquareCacheTTL", config.DefaultProviderCacheTTL, "How long clients and CDNs can cache the Foursquare results")
+	flag.StringVar(&nominatimURL, "nominatimURL", "", "Base URL of a Nominatim API for the geocoding, e.g. https://nominatim.openstreetmap.org. Empty to disable it")
+	flag.DurationVar(&nominatimCacheTTL, "nominatimCacheTTL", config.DefaultProviderCacheTTL, "How long clients and CDNs can cache the Nominatim results")
+	flag.StringVar(&compressEncodings, "compressEncodings", config.DefaultCompressionEncodings, "Comma separated response encodings (br, zstd, gzip) by order of preference. Empty to disable the compression")
+	flag.IntVar(&compressMinSize, "compressMinSize", config.DefaultCompressionMinSize, "Minimum size in bytes of the compressed responses")
+	flag.StringVar(&compressContentTypes, "compressContentTypes", config.DefaultCompressibleContentTypes, "Comma separated compressible media types, e.g. application/json or text/*")
 }
 
 func main() {
@@ -28,20 +120,199 @@ func main() {
 
 	// Bootstrap the application
 	// Providers
-	googlePlacesConfig := providers.ProviderConfig{Timeout: time.Second * 12, Language: "en"} //else config will fall to defaults
-	foursquareConfig := providers.ProviderConfig{Timeout: time.Second * 13}                   // for example...
+	googlePlacesConfig := providers.ProviderConfig{Timeout: time.Second * 12, Language: "en", CacheTTL: googlePlacesCacheTTL} //else config will fall to defaults
+	foursquareConfig := providers.ProviderConfig{Timeout: time.Second * 13, CacheTTL: foursquareCacheTTL}                     // for example...
 	googlePlacesProvider := providers.NewGoogleLocationProvider(&googlePlacesConfig)
 	foursquareProvider := providers.NewFoursquareProvider(&foursquareConfig)
-	placesHandler := handlers.NewPlacesHandler(googlePlacesProvider, foursquareProvider) //extend and provide as many providers as you want!
+	placesProviders := []providers.Provider{googlePlacesProvider, foursquareProvider}
+	if nominatimURL != "" {
+		nominatimConfig := providers.ProviderConfig{Timeout: time.Second * 10, CacheTTL: nominatimCacheTTL}
+		placesProviders = append(placesProviders, providers.NewNominatimProvider(nominatimURL, &nominatimConfig))
+	}
+	placesHandler := handlers.NewPlacesHandler(placesProviders...) //extend and provide as many providers as you want!
+	healthHandler := handlers.NewHealthHandler(placesProviders...)
 
 	// Other handlers
 	recoveryHandler := gh.RecoveryHandler()
-	// todo compress handler ...etc
+	compressHandler := func(next http.Handler) http.Handler { return next }
+	if encodings := splitList(compressEncodings); len(encodings) > 0 {
+		compressHandler = handlers.CompressMiddleware(handlers.CompressionConfig{
+			Encodings:    encodings,
+			MinSize:      compressMinSize,
+			ContentTypes: splitList(compressContentTypes),
+		})
+	}
+
+	// clients authentication, when API keys and/or JWT are configured. Endpoints are gated by OAuth2 scopes
+	protect := func(scope string, next http.Handler) http.Handler { return next }
+	corsConfig := handlers.CORSConfig{
+		AllowedOrigins:   splitList(corsAllowedOrigins),
+		AllowedMethods:   splitList(corsAllowedMethods),
+		AllowedHeaders:   splitList(corsAllowedHeaders),
+		ExposedHeaders:   splitList(corsExposedHeaders),
+		AllowCredentials: corsAllowCredentials,
+		MaxAge:           corsMaxAge,
+	}
+	authConfig := handlers.AuthConfig{}
+	if apiKeysFile != "" {
+		apiKeyStore, err := auth.LoadAPIKeyStore(apiKeysFile)
+		if err != nil {
+			logger.Fatal("Couldn't load the API keys: " + err.Error())
+		}
+		authConfig.APIKeys = apiKeyStore
+		// the origins of the keys are allowed as well, the auth middleware still checks them per key
+		corsConfig.AllowedOrigins = append(corsConfig.AllowedOrigins, apiKeyStore.AllowedOrigins()...)
+	}
+	var jwks *auth.JWKS
+	if jwksFile != "" || jwksURL != "" {
+		var err error
+		if jwksFile != "" {
+			jwks, err = auth.NewJWKSFromFile(jwksFile, jwksRefreshInterval)
+		} else {
+			jwks, err = auth.NewJWKSFromURL(jwksURL, jwksRefreshInterval, nil)
+		}
+		if err != nil {
+			logger.Fatal("Couldn't load the JWKS: " + err.Error())
+		}
+		jwtVerifier, err := auth.NewJWTVerifier(auth.JWTConfig{Issuer: jwtIssuer, Audience: jwtAudience, Leeway: config.DefaultJWTLeeway}, jwks)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		authConfig.JWT = jwtVerifier
+	}
+	if authConfig.APIKeys != nil || authConfig.JWT != nil {
+		protect = func(scope string, next http.Handler) http.Handler {
+			return handlers.AuthMiddleware(authConfig)(handlers.RequireScope(scope)(next))
+		}
+	} else {
+		logger.Warn("No API keys file nor JWKS supplied, the places endpoint is open to anyone")
+	}
+	if config.Config().CursorSigningKey == "" {
+		logger.Warn("No CURSOR_SIGNING_KEY supplied, the pagination cursors won't survive restarts nor work across instances")
+	}
 
 	r := mux.NewRouter()
-	r.Use(handlers.RequestIdMiddleware, handlers.LoggingMiddleware)
-	r.HandleFunc("/api/"+apiVersion+"/places", placesHandler.GetPlaces).Methods("GET")
+	r.Use(handlers.RequestIdMiddleware, handlers.LoggingMiddleware, handlers.MetricsMiddleware)
+	r.Handle("/api/"+apiVersion+"/places", protect(handlers.ScopePlacesSearch, http.HandlerFunc(placesHandler.GetPlaces))).Methods("GET", "HEAD", "POST")
+	// v2: the same search, the places addresses are structured
+	r.Handle("/api/v2/places", handlers.APIVersionMiddleware(2)(protect(handlers.ScopePlacesSearch, http.HandlerFunc(placesHandler.GetPlaces)))).Methods("GET", "HEAD", "POST")
+	r.Handle("/graphql", protect(handlers.ScopePlacesSearch, handlers.NewGraphQLHandler(&placesHandler, graphqlMaxComplexity))).Methods("GET", "POST")
+	autocompleteHandler := handlers.NewAutocompleteHandler(&placesHandler, handlers.AutocompleteConfig{
+		AllowedOrigins: corsConfig.AllowedOrigins,
+		Debounce:       autocompleteDebounce,
+		IdleTimeout:    autocompleteIdle,
+		Rate:           autocompleteRate,
+		APIKeys:        authConfig.APIKeys,
+	})
+	r.Handle("/api/"+apiVersion+"/places/autocomplete", protect(handlers.ScopePlacesSearch, autocompleteHandler)).Methods("GET")
+	r.Handle("/api/"+apiVersion+"/places/{provider}/{id}", protect(handlers.ScopePlacesDetails, http.HandlerFunc(placesHandler.GetPlace))).Methods("GET", "HEAD")
+	r.Handle("/api/"+apiVersion+"/geocode", protect(handlers.ScopePlacesSearch, http.HandlerFunc(placesHandler.GetGeocoding))).Methods("GET", "HEAD")
+	r.Handle("/api/"+apiVersion+"/geocode/reverse", protect(handlers.ScopePlacesSearch, http.HandlerFunc(placesHandler.GetReverseGeocoding))).Methods("GET", "HEAD")
 	r.HandleFunc("/api/"+apiVersion+"/status", handlers.GetStatus).Methods("GET")
+	r.HandleFunc("/livez", healthHandler.GetLiveness).Methods("GET")
+	r.HandleFunc("/readyz", healthHandler.GetReadiness).Methods("GET")
+
+	serverConfig := server.Config{
+		Addr:                ":" + webServerPort,
+		ReadHeaderTimeout:   readHeaderTimeout,
+		ReadTimeout:         readTimeout,
+		WriteTimeout:        writeTimeout,
+		IdleTimeout:         idleTimeout,
+		MaxHeaderBytes:      maxHeaderBytes,
+		ShutdownGracePeriod: shutdownGracePeriod,
+		ShutdownDelay:       shutdownDelay,
+	}
+	if tlsCertFile != "" || tlsKeyFile != "" {
+		serverConfig.TLS = &server.TLSConfig{
+			CertFile:       tlsCertFile,
+			KeyFile:        tlsKeyFile,
+			ClientCAFile:   tlsClientCAFile,
+			MinVersion:     tlsMinVersion,
+			ReloadInterval: tlsReloadInterval,
+		}
+		if tlsCipherSuites != "" {
+			serverConfig.TLS.CipherSuites = strings.Split(tlsCipherSuites, ",")
+		}
+	}
+	// CORS wraps the router so the preflight requests never reach the GET only routes
+	httpServer := server.NewServer(recoveryHandler(handlers.CORSMiddleware(corsConfig)(compressHandler(r))), serverConfig, healthHandler)
+	// the websocket sessions are hijacked connections, the server doesn't drain them
+	httpServer.RegisterOnShutdown(autocompleteHandler.Shutdown)
+
+	// a SIGTERM/SIGINT starts the graceful shutdown sequence
+	ctx, stop := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		sig := <-signals
+		logger.Info("Received signal: " + sig.String())
+		stop()
+	}()
+
+	// Admin server, on its own listener: its routes are never exposed on the public router
+	if adminServerPort != "" {
+		adminHandler := handlers.NewAdminHandler(healthHandler, flag.CommandLine)
+		for _, provider := range placesProviders {
+			if holder, ok := provider.(providers.CacheHolder); ok {
+				for name, cache := range holder.GetCaches() {
+					adminHandler.RegisterCache(name, cache)
+				}
+			}
+		}
+		if jwks != nil {
+			adminHandler.RegisterCache("jwks", jwks)
+		}
+		adminServer := server.NewServer(recoveryHandler(adminHandler.Router()), server.Config{
+			Addr:         adminBindAddress + ":" + adminServerPort,
+			WriteTimeout: config.DefaultAdminWriteTimeout,
+		}, nil)
+		go func() {
+			logger.Info("Serving admin requests on " + adminBindAddress + ":" + adminServerPort)
+			if err := adminServer.ListenAndServe(ctx); err != nil {
+				logger.Error("Admin server stopped: " + err.Error())
+			}
+		}()
+	}
+
+	// gRPC server, sharing the places aggregation core, the authentication and the TLS settings with the http API
+	if grpcServerPort != "" {
+		grpcConfig := grpcserver.Config{}
+		if authConfig.APIKeys != nil || authConfig.JWT != nil {
+			grpcConfig.Auth = &authConfig
+		}
+		if serverConfig.TLS != nil {
+			tlsConfig, err := server.NewReloadingTLSConfig(ctx, *serverConfig.TLS)
+			if err != nil {
+				logger.Fatal("Couldn't load the gRPC TLS certificate: " + err.Error())
+			}
+			grpcConfig.TLS = tlsConfig
+		}
+		listener, err := net.Listen("tcp", grpcBindAddress+":"+grpcServerPort)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		go func() {
+			logger.Info("Serving gRPC requests on " + grpcBindAddress + ":" + grpcServerPort)
+			if err := grpcserver.Serve(ctx, grpcserver.NewServer(&placesHandler, grpcConfig), listener, shutdownGracePeriod); err != nil {
+				logger.Error("gRPC server stopped: " + err.Error())
+			}
+		}()
+	}
+
 	logger.Info("Serving requests on port: " + webServerPort)
-	logger.Fatal(http.ListenAndServe(":"+webServerPort, recoveryHandler(r)))
+	if err := httpServer.ListenAndServe(ctx); err != nil {
+		logger.Fatal(err)
+	}
+	logger.Info("Bye!")
+}
+
+// splits a comma separated flag value, ignoring the blanks
+func splitList(value string) []string {
+	values := []string{}
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
 }
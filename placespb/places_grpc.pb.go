@@ -0,0 +1,208 @@
+// Places service: the gRPC interface of the places aggregation, for internal services.
+// It mirrors the json API resources (api package). Go code generation: make proto
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: places.proto
+
+package placespb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	PlacesService_SearchPlaces_FullMethodName       = "/places.v1.PlacesService/SearchPlaces"
+	PlacesService_StreamSearchPlaces_FullMethodName = "/places.v1.PlacesService/StreamSearchPlaces"
+	PlacesService_GetPlaceDetails_FullMethodName    = "/places.v1.PlacesService/GetPlaceDetails"
+)
+
+// PlacesServiceClient is the client API for PlacesService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type PlacesServiceClient interface {
+	// SearchPlaces returns the places of all the providers, once they all answered
+	SearchPlaces(ctx context.Context, in *SearchPlacesRequest, opts ...grpc.CallOption) (*SearchPlacesResponse, error)
+	// StreamSearchPlaces sends the places of each provider as soon as it answers
+	StreamSearchPlaces(ctx context.Context, in *SearchPlacesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ProviderPlaces], error)
+	GetPlaceDetails(ctx context.Context, in *GetPlaceDetailsRequest, opts ...grpc.CallOption) (*PlaceDetails, error)
+}
+
+type placesServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewPlacesServiceClient(cc grpc.ClientConnInterface) PlacesServiceClient {
+	return &placesServiceClient{cc}
+}
+
+func (c *placesServiceClient) SearchPlaces(ctx context.Context, in *SearchPlacesRequest, opts ...grpc.CallOption) (*SearchPlacesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SearchPlacesResponse)
+	err := c.cc.Invoke(ctx, PlacesService_SearchPlaces_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *placesServiceClient) StreamSearchPlaces(ctx context.Context, in *SearchPlacesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ProviderPlaces], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &PlacesService_ServiceDesc.Streams[0], PlacesService_StreamSearchPlaces_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SearchPlacesRequest, ProviderPlaces]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type PlacesService_StreamSearchPlacesClient = grpc.ServerStreamingClient[ProviderPlaces]
+
+func (c *placesServiceClient) GetPlaceDetails(ctx context.Context, in *GetPlaceDetailsRequest, opts ...grpc.CallOption) (*PlaceDetails, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PlaceDetails)
+	err := c.cc.Invoke(ctx, PlacesService_GetPlaceDetails_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// PlacesServiceServer is the server API for PlacesService service.
+// All implementations must embed UnimplementedPlacesServiceServer
+// for forward compatibility.
+type PlacesServiceServer interface {
+	// SearchPlaces returns the places of all the providers, once they all answered
+	SearchPlaces(context.Context, *SearchPlacesRequest) (*SearchPlacesResponse, error)
+	// StreamSearchPlaces sends the places of each provider as soon as it answers
+	StreamSearchPlaces(*SearchPlacesRequest, grpc.ServerStreamingServer[ProviderPlaces]) error
+	GetPlaceDetails(context.Context, *GetPlaceDetailsRequest) (*PlaceDetails, error)
+	mustEmbedUnimplementedPlacesServiceServer()
+}
+
+// UnimplementedPlacesServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedPlacesServiceServer struct{}
+
+func (UnimplementedPlacesServiceServer) SearchPlaces(context.Context, *SearchPlacesRequest) (*SearchPlacesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SearchPlaces not implemented")
+}
+func (UnimplementedPlacesServiceServer) StreamSearchPlaces(*SearchPlacesRequest, grpc.ServerStreamingServer[ProviderPlaces]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamSearchPlaces not implemented")
+}
+func (UnimplementedPlacesServiceServer) GetPlaceDetails(context.Context, *GetPlaceDetailsRequest) (*PlaceDetails, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetPlaceDetails not implemented")
+}
+func (UnimplementedPlacesServiceServer) mustEmbedUnimplementedPlacesServiceServer() {}
+func (UnimplementedPlacesServiceServer) testEmbeddedByValue()                       {}
+
+// UnsafePlacesServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to PlacesServiceServer will
+// result in compilation errors.
+type UnsafePlacesServiceServer interface {
+	mustEmbedUnimplementedPlacesServiceServer()
+}
+
+func RegisterPlacesServiceServer(s grpc.ServiceRegistrar, srv PlacesServiceServer) {
+	// If the following call pancis, it indicates UnimplementedPlacesServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&PlacesService_ServiceDesc, srv)
+}
+
+func _PlacesService_SearchPlaces_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchPlacesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PlacesServiceServer).SearchPlaces(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PlacesService_SearchPlaces_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PlacesServiceServer).SearchPlaces(ctx, req.(*SearchPlacesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PlacesService_StreamSearchPlaces_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SearchPlacesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(PlacesServiceServer).StreamSearchPlaces(m, &grpc.GenericServerStream[SearchPlacesRequest, ProviderPlaces]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type PlacesService_StreamSearchPlacesServer = grpc.ServerStreamingServer[ProviderPlaces]
+
+func _PlacesService_GetPlaceDetails_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetPlaceDetailsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PlacesServiceServer).GetPlaceDetails(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PlacesService_GetPlaceDetails_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PlacesServiceServer).GetPlaceDetails(ctx, req.(*GetPlaceDetailsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// PlacesService_ServiceDesc is the grpc.ServiceDesc for PlacesService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var PlacesService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "places.v1.PlacesService",
+	HandlerType: (*PlacesServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "SearchPlaces",
+			Handler:    _PlacesService_SearchPlaces_Handler,
+		},
+		{
+			MethodName: "GetPlaceDetails",
+			Handler:    _PlacesService_GetPlaceDetails_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamSearchPlaces",
+			Handler:       _PlacesService_StreamSearchPlaces_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "places.proto",
+}
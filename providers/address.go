@@ -0,0 +1,71 @@
+package providers
+
+import (
+	"github.com/codeselim/go-webservice-places-provider/api"
+	"regexp"
+	"strings"
+)
+
+/**
+ * Structured addresses: the providers fill the components they know, the display line follows the conventions of the
+ * address country. The countries without specific conventions get the continental European one.
+ */
+
+// FormatAddress returns the display line of an address, following the conventions of its country:
+//   - DE and default: Jungfernstieg 1, 20095 Hamburg
+//   - FR: 1 Rue de Rivoli, 75001 Paris
+//   - US, CA, AU: 350 5th Ave, New York, NY 10118
+//   - GB, IE, NZ: 10 Downing Street, London SW1A 2AA
+//   - JP, KR, CN, TW: 100-0001 Tokyo Chiyoda 1-1, from the largest component
+func FormatAddress(address api.Address) string {
+	switch address.CountryCode {
+	case "FR":
+		return joinNonEmpty(", ",
+			joinNonEmpty(" ", address.HouseNumber, address.Street),
+			joinNonEmpty(" ", address.PostalCode, address.City))
+	case "US", "CA", "AU":
+		return joinNonEmpty(", ",
+			joinNonEmpty(" ", address.HouseNumber, address.Street),
+			address.City,
+			joinNonEmpty(" ", address.Region, address.PostalCode))
+	case "GB", "IE", "NZ":
+		return joinNonEmpty(", ",
+			joinNonEmpty(" ", address.HouseNumber, address.Street),
+			joinNonEmpty(" ", address.City, address.PostalCode))
+	case "JP", "KR", "CN", "TW":
+		return joinNonEmpty(" ", address.PostalCode, address.Region, address.City, address.Street, address.HouseNumber)
+	default:
+		return joinNonEmpty(", ",
+			joinNonEmpty(" ", address.Street, address.HouseNumber),
+			joinNonEmpty(" ", address.PostalCode, address.City))
+	}
+}
+
+// house numbers as "1", "12a", "3-5" or "7/2", unlike the street names as "5th Ave"
+var houseNumberPattern = regexp.MustCompile(`^[0-9]+[A-Za-z]?([-/][0-9]+[A-Za-z]?)?$`)
+
+// splitStreetLine splits a street line into its street and house number, the number being its last ("Jungfernstieg 1")
+// or first ("350 5th Ave") word. The whole line is the street otherwise
+func splitStreetLine(line string) (string, string) {
+	words := strings.Fields(line)
+	if len(words) < 2 {
+		return line, ""
+	}
+	if last := words[len(words)-1]; houseNumberPattern.MatchString(last) {
+		return strings.Join(words[:len(words)-1], " "), last
+	}
+	if houseNumberPattern.MatchString(words[0]) {
+		return strings.Join(words[1:], " "), words[0]
+	}
+	return line, ""
+}
+
+func joinNonEmpty(separator string, values ...string) string {
+	nonEmpty := make([]string, 0, len(values))
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			nonEmpty = append(nonEmpty, value)
+		}
+	}
+	return strings.Join(nonEmpty, separator)
+}
@@ -0,0 +1,43 @@
+package providers
+
+import (
+	"github.com/codeselim/go-webservice-places-provider/api"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestUnitFormatAddress(t *testing.T) {
+	for expected, address := range map[string]api.Address{
+		"Jungfernstieg 1, 20095 Hamburg":     {Street: "Jungfernstieg", HouseNumber: "1", PostalCode: "20095", City: "Hamburg", CountryCode: "DE"},
+		"Kalverstraat 92, 1012 PH Amsterdam": {Street: "Kalverstraat", HouseNumber: "92", PostalCode: "1012 PH", City: "Amsterdam", CountryCode: "NL"},
+		"1 Rue de Rivoli, 75001 Paris":       {Street: "Rue de Rivoli", HouseNumber: "1", PostalCode: "75001", City: "Paris", CountryCode: "FR"},
+		"350 5th Ave, New York, NY 10118":    {Street: "5th Ave", HouseNumber: "350", PostalCode: "10118", City: "New York", Region: "NY", CountryCode: "US"},
+		"10 Downing Street, London SW1A 2AA": {Street: "Downing Street", HouseNumber: "10", PostalCode: "SW1A 2AA", City: "London", CountryCode: "GB"},
+		"100-0001 東京都 千代田区 千代田 1-1":          {Street: "千代田", HouseNumber: "1-1", PostalCode: "100-0001", City: "千代田区", Region: "東京都", CountryCode: "JP"},
+		// missing components are skipped
+		"20095 Hamburg":  {PostalCode: "20095", City: "Hamburg", CountryCode: "DE"},
+		"Jungfernstieg":  {Street: "Jungfernstieg"},
+		"Austin, TX":     {City: "Austin", Region: "TX", CountryCode: "US"},
+		"":               {CountryCode: "DE"},
+		"Main Street 12": {Street: "Main Street", HouseNumber: "12", CountryCode: "XX"},
+	} {
+		assert.Equal(t, expected, FormatAddress(address))
+	}
+}
+
+func TestUnitsplitStreetLine(t *testing.T) {
+	for line, expected := range map[string][2]string{
+		"Jungfernstieg 1":     {"Jungfernstieg", "1"},
+		"Lange Reihe 12a":     {"Lange Reihe", "12a"},
+		"Hauptstraße 3-5":     {"Hauptstraße", "3-5"},
+		"350 5th Ave":         {"5th Ave", "350"},
+		"5th Ave":             {"5th Ave", ""},
+		"Jungfernstieg":       {"Jungfernstieg", ""},
+		"Am Sandtorkai":       {"Am Sandtorkai", ""},
+		"":                    {"", ""},
+		"Calle de Alcalá 7/2": {"Calle de Alcalá", "7/2"},
+	} {
+		street, houseNumber := splitStreetLine(line)
+		assert.Equal(t, expected, [2]string{street, houseNumber}, line)
+	}
+}
@@ -0,0 +1,109 @@
+package providers
+
+import (
+	"fmt"
+	"github.com/codeselim/go-webservice-places-provider/api"
+	"github.com/codeselim/go-webservice-places-provider/config"
+	"math"
+	"strings"
+)
+
+/**
+ * Search areas: the places are searched in a polygon (a map viewport, a neighbourhood), the providers get the best
+ * equivalent they support (a bounding box, a center and a radius) and their places are then filtered with
+ * point-in-polygon checks.
+ */
+
+const earthRadius = 6371000 // meters
+
+// Area is a polygon, as the GeoJSON ones: the first ring is the exterior, the next ones are holes. The rings are closed
+type Area struct {
+	Rings [][]Location
+}
+
+// NewBoundingBox returns the area of a bounding box, it can't cross the antimeridian
+func NewBoundingBox(minLng float64, minLat float64, maxLng float64, maxLat float64) *Area {
+	return &Area{Rings: [][]Location{{
+		{Lat: minLat, Lng: minLng},
+		{Lat: minLat, Lng: maxLng},
+		{Lat: maxLat, Lng: maxLng},
+		{Lat: maxLat, Lng: minLng},
+		{Lat: minLat, Lng: minLng},
+	}}}
+}
+
+// Bounds returns the south-west and north-east corners of the exterior ring
+func (a *Area) Bounds() (Location, Location) {
+	sw := Location{Lat: math.Inf(1), Lng: math.Inf(1)}
+	ne := Location{Lat: math.Inf(-1), Lng: math.Inf(-1)}
+	for _, vertex := range a.Rings[0] {
+		sw.Lat, sw.Lng = math.Min(sw.Lat, vertex.Lat), math.Min(sw.Lng, vertex.Lng)
+		ne.Lat, ne.Lng = math.Max(ne.Lat, vertex.Lat), math.Max(ne.Lng, vertex.Lng)
+	}
+	return sw, ne
+}
+
+// Center returns the center of the bounds
+func (a *Area) Center() Location {
+	sw, ne := a.Bounds()
+	return Location{Lat: (sw.Lat + ne.Lat) / 2, Lng: (sw.Lng + ne.Lng) / 2}
+}
+
+// Radius returns the radius of the circle around the center covering the bounds, in meters. It is capped to the
+// providers maximum: the places of a larger area are the ones close to its center
+func (a *Area) Radius() int {
+	sw, ne := a.Bounds()
+	radius := Distance(a.Center(), sw)
+	for _, corner := range []Location{ne, {Lat: sw.Lat, Lng: ne.Lng}, {Lat: ne.Lat, Lng: sw.Lng}} {
+		radius = math.Max(radius, Distance(a.Center(), corner))
+	}
+	return int(math.Min(math.Ceil(radius), config.MaxAreaSearchRadius))
+}
+
+// Contains tells if a location is in the area, with an even-odd ray casting over all the rings: the holes are out
+func (a *Area) Contains(location Location) bool {
+	inside := false
+	for _, ring := range a.Rings {
+		for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+			if (ring[i].Lat > location.Lat) != (ring[j].Lat > location.Lat) &&
+				location.Lng < (ring[j].Lng-ring[i].Lng)*(location.Lat-ring[i].Lat)/(ring[j].Lat-ring[i].Lat)+ring[i].Lng {
+				inside = !inside
+			}
+		}
+	}
+	return inside
+}
+
+func (a *Area) String() string {
+	rings := make([]string, 0, len(a.Rings))
+	for _, ring := range a.Rings {
+		vertices := make([]string, 0, len(ring))
+		for _, vertex := range ring {
+			vertices = append(vertices, fmt.Sprintf("%f,%f", vertex.Lng, vertex.Lat))
+		}
+		rings = append(rings, strings.Join(vertices, " "))
+	}
+	return strings.Join(rings, "|")
+}
+
+// FilterPlacesInArea keeps the places located in the area, all the places without area
+func FilterPlacesInArea(places api.Places, area *Area) api.Places {
+	if area == nil {
+		return places
+	}
+	filtered := api.Places{}
+	for _, place := range places {
+		if place.Location != nil && area.Contains(Location{Lat: place.Location.Lat, Lng: place.Location.Lng}) {
+			filtered = append(filtered, place)
+		}
+	}
+	return filtered
+}
+
+// Distance returns the great-circle distance between two locations in meters (haversine formula)
+func Distance(from Location, to Location) float64 {
+	lat1, lat2 := from.Lat*math.Pi/180, to.Lat*math.Pi/180
+	dLat, dLng := lat2-lat1, (to.Lng-from.Lng)*math.Pi/180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(h))
+}
@@ -0,0 +1,57 @@
+package providers
+
+import (
+	"github.com/codeselim/go-webservice-places-provider/api"
+	"github.com/codeselim/go-webservice-places-provider/config"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestUnitAreaBoundingBox(t *testing.T) {
+	area := NewBoundingBox(9.9, 53.5, 10.1, 53.6)
+	sw, ne := area.Bounds()
+	assert.Equal(t, Location{Lat: 53.5, Lng: 9.9}, sw)
+	assert.Equal(t, Location{Lat: 53.6, Lng: 10.1}, ne)
+	assert.InDelta(t, 53.55, area.Center().Lat, 1e-9)
+	assert.InDelta(t, 10.0, area.Center().Lng, 1e-9)
+
+	assert.True(t, area.Contains(Location{Lat: 53.55, Lng: 10}))
+	assert.False(t, area.Contains(Location{Lat: 53.65, Lng: 10}))
+	assert.False(t, area.Contains(Location{Lat: 53.55, Lng: 10.2}))
+
+	// the distance to the southern corners, ~8.6km
+	assert.InDelta(t, 8640, area.Radius(), 50)
+	assert.Equal(t, config.MaxAreaSearchRadius, NewBoundingBox(0, 0, 10, 10).Radius())
+}
+
+func TestUnitAreaPolygonWithHole(t *testing.T) {
+	area := &Area{Rings: [][]Location{
+		{{Lat: 0, Lng: 0}, {Lat: 0, Lng: 10}, {Lat: 10, Lng: 10}, {Lat: 10, Lng: 0}, {Lat: 0, Lng: 0}},
+		{{Lat: 4, Lng: 4}, {Lat: 4, Lng: 6}, {Lat: 6, Lng: 6}, {Lat: 6, Lng: 4}, {Lat: 4, Lng: 4}},
+	}}
+	assert.True(t, area.Contains(Location{Lat: 2, Lng: 2}))
+	assert.False(t, area.Contains(Location{Lat: 5, Lng: 5}), "in the hole")
+	assert.False(t, area.Contains(Location{Lat: 11, Lng: 5}))
+
+	triangle := &Area{Rings: [][]Location{{{Lat: 0, Lng: 0}, {Lat: 0, Lng: 10}, {Lat: 10, Lng: 0}, {Lat: 0, Lng: 0}}}}
+	assert.True(t, triangle.Contains(Location{Lat: 2, Lng: 2}))
+	assert.False(t, triangle.Contains(Location{Lat: 8, Lng: 8}), "in the bounds, out of the polygon")
+}
+
+func TestUnitFilterPlacesInArea(t *testing.T) {
+	places := api.Places{
+		{ID: "in", Location: &api.Location{Lat: 53.55, Lng: 10}},
+		{ID: "out", Location: &api.Location{Lat: 52.5, Lng: 13.4}},
+		{ID: "unlocated"},
+	}
+	assert.Len(t, FilterPlacesInArea(places, nil), 3)
+
+	filtered := FilterPlacesInArea(places, NewBoundingBox(9.9, 53.5, 10.1, 53.6))
+	assert.Len(t, filtered, 1)
+	assert.Equal(t, "in", filtered[0].ID)
+}
+
+func TestUnitDistance(t *testing.T) {
+	// Hamburg - Berlin
+	assert.InDelta(t, 255000, Distance(Location{Lat: 53.5511, Lng: 9.9937}, Location{Lat: 52.5200, Lng: 13.4050}), 1000)
+}
@@ -0,0 +1,183 @@
+package providers
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"github.com/codeselim/go-webservice-places-provider/api"
+	"github.com/codeselim/go-webservice-places-provider/log"
+	"strings"
+	"sync"
+)
+
+/**
+ * Canonical categories: a category tree common to all the providers (restaurant > vegan, lodging > hotel...), shipped
+ * as data in categories.json with the mappings of the providers categories (Google place types, Foursquare category
+ * ids) to it. The places get the canonical categories of their provider categories, and the searches are narrowed to
+ * canonical categories, a category including its descendants.
+ */
+
+//go:embed categories.json
+var categoriesJSON []byte
+
+// categoryNode is a node of the canonical category tree
+type categoryNode struct {
+	ID       string          `json:"id"`
+	Name     string          `json:"name"`
+	Children []*categoryNode `json:"children,omitempty"`
+	parent   *categoryNode
+}
+
+type providerCategoryMapping struct {
+	ID       string `json:"id"`             // provider category
+	Name     string `json:"name,omitempty"` // informative, the provider ids are often opaque
+	Category string `json:"category"`       // canonical category
+}
+
+type providerCategories struct {
+	Categories []providerCategoryMapping `json:"categories"`
+	Ignored    []string                  `json:"ignored,omitempty"` // generic provider categories without a canonical one
+}
+
+type categoryTaxonomy struct {
+	Categories []*categoryNode                       `json:"categories"`
+	Providers  map[ProviderLabel]*providerCategories `json:"providers"`
+
+	byID     map[string]*categoryNode
+	mappings map[ProviderLabel]map[string]string // provider category -> canonical category
+	ignored  map[ProviderLabel]map[string]bool
+	unmapped sync.Map // provider categories already logged
+}
+
+var taxonomy = mustLoadTaxonomy(categoriesJSON)
+
+func mustLoadTaxonomy(data []byte) *categoryTaxonomy {
+	t, err := loadTaxonomy(data)
+	if err != nil {
+		log.GetLogger().Panic("Invalid categories data: " + err.Error())
+	}
+	return t
+}
+
+// loadTaxonomy parses the categories data, the ids have to be unique and the mappings to target existing categories
+func loadTaxonomy(data []byte) (*categoryTaxonomy, error) {
+	t := &categoryTaxonomy{}
+	if err := json.Unmarshal(data, t); err != nil {
+		return nil, err
+	}
+	t.byID = map[string]*categoryNode{}
+	var index func(categories []*categoryNode, parent *categoryNode) error
+	index = func(categories []*categoryNode, parent *categoryNode) error {
+		for _, category := range categories {
+			if category.ID == "" || t.byID[category.ID] != nil {
+				return fmt.Errorf("missing or duplicated category id %q", category.ID)
+			}
+			category.parent = parent
+			t.byID[category.ID] = category
+			if err := index(category.Children, category); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := index(t.Categories, nil); err != nil {
+		return nil, err
+	}
+
+	t.mappings = map[ProviderLabel]map[string]string{}
+	t.ignored = map[ProviderLabel]map[string]bool{}
+	for provider, categories := range t.Providers {
+		t.mappings[provider] = map[string]string{}
+		for _, mapping := range categories.Categories {
+			if t.byID[mapping.Category] == nil {
+				return nil, fmt.Errorf("%s category %q mapped to the unknown category %q", provider, mapping.ID, mapping.Category)
+			}
+			t.mappings[provider][mapping.ID] = mapping.Category
+		}
+		t.ignored[provider] = map[string]bool{}
+		for _, ignored := range categories.Ignored {
+			t.ignored[provider][ignored] = true
+		}
+	}
+	return t, nil
+}
+
+// ParseSearchCategory returns the canonical category of its id, case insensitive
+func ParseSearchCategory(id string) (string, bool) {
+	id = strings.ToLower(strings.TrimSpace(id))
+	if _, ok := taxonomy.byID[id]; !ok {
+		return "", false
+	}
+	return id, true
+}
+
+// includes tells if a category is one of the categories or one of their descendants
+func (t *categoryTaxonomy) includes(categories []string, id string) bool {
+	for category := t.byID[id]; category != nil; category = category.parent {
+		for _, included := range categories {
+			if category.ID == included {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// providerCategories returns the provider categories of the canonical categories and their descendants, in the
+// data order. Empty: the provider has none of them
+func (t *categoryTaxonomy) providerCategories(provider ProviderLabel, categories []string) []string {
+	providerCategories := []string{}
+	if t.Providers[provider] == nil {
+		return providerCategories
+	}
+	for _, mapping := range t.Providers[provider].Categories {
+		if t.includes(categories, mapping.Category) {
+			providerCategories = append(providerCategories, mapping.ID)
+		}
+	}
+	return providerCategories
+}
+
+// canonicalCategories returns the canonical categories of provider categories, without duplicates. The unmapped
+// provider categories are logged once, so the mapping can be extended
+func (t *categoryTaxonomy) canonicalCategories(provider ProviderLabel, ids []string, names []string) []string {
+	var categories []string
+	for i, id := range ids {
+		category, ok := t.mappings[provider][id]
+		if !ok {
+			if _, logged := t.unmapped.LoadOrStore(string(provider)+"|"+id, true); !logged && !t.ignored[provider][id] {
+				name := id
+				if i < len(names) {
+					name = names[i]
+				}
+				log.GetLogger().Warnf("Unmapped %s category %q (%s), extend providers/categories.json", provider, id, name)
+			}
+			continue
+		}
+		duplicate := false
+		for _, existing := range categories {
+			duplicate = duplicate || existing == category
+		}
+		if !duplicate {
+			categories = append(categories, category)
+		}
+	}
+	return categories
+}
+
+// filterPlacesByCategories keeps the places of any of the categories, all the places when no category is requested
+func filterPlacesByCategories(places api.Places, categories []string) api.Places {
+	if len(categories) == 0 {
+		return places
+	}
+	filtered := api.Places{}
+	for _, place := range places {
+		for _, category := range place.Categories {
+			if taxonomy.includes(categories, category) {
+				filtered = append(filtered, place)
+				break
+			}
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,58 @@
+package providers
+
+import (
+	"github.com/codeselim/go-webservice-places-provider/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestUnitLoadTaxonomy(t *testing.T) {
+	_, err := loadTaxonomy(categoriesJSON)
+	require.NoError(t, err)
+
+	_, err = loadTaxonomy([]byte(`{"categories": [{"id": "bar"}, {"id": "pub"}, {"id": "bar"}]}`))
+	assert.Error(t, err, "duplicated id")
+	_, err = loadTaxonomy([]byte(`{"categories": [{"id": "bar", "children": [{"id": "bar"}]}]}`))
+	assert.Error(t, err, "duplicated child id")
+	_, err = loadTaxonomy([]byte(`{"categories": [{"id": "bar"}], "providers": {"FOURSQUARE": {"categories": [{"id": "1", "category": "pub"}]}}}`))
+	assert.Error(t, err, "mapping to an unknown category")
+}
+
+func TestUnitTaxonomyIncludes(t *testing.T) {
+	assert.True(t, taxonomy.includes([]string{"restaurant"}, "vegan"))
+	assert.True(t, taxonomy.includes([]string{"bar", "vegan"}, "vegan"))
+	assert.False(t, taxonomy.includes([]string{"vegan"}, "restaurant"))
+	assert.False(t, taxonomy.includes([]string{"restaurant"}, "unknown"))
+}
+
+func TestUnitTaxonomyProviderCategories(t *testing.T) {
+	assert.Equal(t, []string{"lodging", "campground", "rv_park"}, taxonomy.providerCategories(GooglePlacesProviderLabel, []string{"lodging"}))
+	assert.Equal(t, []string{"4bf58dd8d48988d1fa931735", "4bf58dd8d48988d1ee931735", "4bf58dd8d48988d1e4941735"},
+		taxonomy.providerCategories(FoursquareLabel, []string{"lodging"}))
+	assert.Empty(t, taxonomy.providerCategories(GooglePlacesProviderLabel, []string{"vegan"}))
+	assert.Empty(t, taxonomy.providerCategories("YELP", []string{"bar"}))
+}
+
+func TestUnitTaxonomyCanonicalCategories(t *testing.T) {
+	assert.Equal(t, []string{"restaurant"}, taxonomy.canonicalCategories(GooglePlacesProviderLabel,
+		[]string{"meal_takeaway", "restaurant", "food", "point_of_interest", "establishment"}, nil))
+	assert.Nil(t, taxonomy.canonicalCategories(GooglePlacesProviderLabel, []string{"casino"}, nil))
+	_, logged := taxonomy.unmapped.Load(string(GooglePlacesProviderLabel) + "|casino")
+	assert.True(t, logged, "the unmapped categories are logged once")
+}
+
+func TestUnitfilterPlacesByCategories(t *testing.T) {
+	places := api.Places{
+		{ID: "vegan", Categories: []string{"vegan"}},
+		{ID: "hotel", Categories: []string{"hotel"}},
+		{ID: "bar", Categories: []string{"cafe", "bar"}},
+		{ID: "none"},
+	}
+	assert.Len(t, filterPlacesByCategories(places, nil), 4)
+
+	filtered := filterPlacesByCategories(places, []string{"restaurant", "bar"})
+	require.Len(t, filtered, 2)
+	assert.Equal(t, "vegan", filtered[0].ID)
+	assert.Equal(t, "bar", filtered[1].ID)
+}
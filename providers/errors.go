@@ -0,0 +1,151 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/peppage/foursquarego"
+	"net"
+	"net/http"
+	"strings"
+)
+
+/**
+ * Provider errors: the providers classify the failures of their upstream APIs, so the handlers (api errors) and the
+ * metrics consume the same classification.
+ */
+
+// ErrorKind is the class of a provider failure
+type ErrorKind string
+
+const (
+	TimeoutErrorKind    = ErrorKind("timeout")     // the upstream API didn't answer in time
+	AuthErrorKind       = ErrorKind("auth")        // invalid or missing credentials, the upstream API denied the request
+	QuotaErrorKind      = ErrorKind("quota")       // the upstream quota or rate limit is exceeded
+	UpstreamErrorKind   = ErrorKind("upstream")    // upstream 5xx, unreachable API or unreadable response
+	BadRequestErrorKind = ErrorKind("bad_request") // the upstream API rejected the request parameters
+	NotFoundErrorKind   = ErrorKind("not_found")   // unknown place, e.g. a stale place id
+	UnknownErrorKind    = ErrorKind("unknown")     // unclassified errors
+)
+
+// ProviderError is a classified failure of a provider, it wraps the upstream error
+type ProviderError struct {
+	Provider ProviderLabel
+	Kind     ErrorKind
+	Err      error
+}
+
+func (e *ProviderError) Error() string {
+	return fmt.Sprintf("%s: %s error: %v", e.Provider, e.Kind, e.Err)
+}
+
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable tells if the same call can succeed later: timeouts, exceeded quotas and upstream failures
+func (e *ProviderError) Retryable() bool {
+	return e.Kind == TimeoutErrorKind || e.Kind == QuotaErrorKind || e.Kind == UpstreamErrorKind
+}
+
+// KindOf returns the class of a provider error, UnknownErrorKind when it isn't classified
+func KindOf(err error) ErrorKind {
+	var providerError *ProviderError
+	if errors.As(err, &providerError) {
+		return providerError.Kind
+	}
+	return UnknownErrorKind
+}
+
+// classifyError classifies the errors common to the providers: timeouts and transport failures. The cancelled calls
+// (client gone) and the errors already classified are returned as is
+func classifyError(label ProviderLabel, err error) error {
+	var providerError *ProviderError
+	if err == nil || errors.Is(err, context.Canceled) || errors.As(err, &providerError) {
+		return err
+	}
+	var netError net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netError) && netError.Timeout()) {
+		return &ProviderError{Provider: label, Kind: TimeoutErrorKind, Err: err}
+	}
+	return &ProviderError{Provider: label, Kind: UpstreamErrorKind, Err: err}
+}
+
+// statusErrorKind returns the class of an upstream http error status
+func statusErrorKind(statusCode int) ErrorKind {
+	switch {
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		return AuthErrorKind
+	case statusCode == http.StatusTooManyRequests:
+		return QuotaErrorKind
+	case statusCode == http.StatusNotFound:
+		return NotFoundErrorKind
+	case statusCode == http.StatusRequestTimeout || statusCode == http.StatusGatewayTimeout:
+		return TimeoutErrorKind
+	case statusCode >= 400 && statusCode < 500:
+		return BadRequestErrorKind
+	default:
+		return UpstreamErrorKind
+	}
+}
+
+// google statuses of the failed responses, see https://developers.google.com/maps/documentation/places/web-service/search#PlacesSearchStatus
+var googleStatusErrorKinds = map[string]ErrorKind{
+	"OVER_QUERY_LIMIT": QuotaErrorKind,
+	"OVER_DAILY_LIMIT": QuotaErrorKind,
+	"REQUEST_DENIED":   AuthErrorKind,
+	"INVALID_REQUEST":  BadRequestErrorKind,
+	"NOT_FOUND":        NotFoundErrorKind,
+	"UNKNOWN_ERROR":    UpstreamErrorKind,
+}
+
+// googleError classifies the errors of the maps client. It has no error type: the failed responses are
+// formatted as "maps: <status> - <message>", the invalid requests are rejected before being sent
+func googleError(err error) error {
+	if err == nil {
+		return nil
+	}
+	message := err.Error()
+	if status := strings.TrimPrefix(message, "maps: "); status != message {
+		status = strings.SplitN(status, " ", 2)[0]
+		if kind, ok := googleStatusErrorKinds[status]; ok {
+			return &ProviderError{Provider: GooglePlacesProviderLabel, Kind: kind, Err: err}
+		}
+		if strings.ToUpper(status) != status && errors.Unwrap(err) == nil { // a local validation, e.g. "maps: Input missing"
+			return &ProviderError{Provider: GooglePlacesProviderLabel, Kind: BadRequestErrorKind, Err: err}
+		}
+	}
+	return classifyError(GooglePlacesProviderLabel, err)
+}
+
+// foursquare error types, see https://developer.foursquare.com/docs/api-reference/errors
+var foursquareErrorTypeKinds = map[string]ErrorKind{
+	"invalid_auth":        AuthErrorKind,
+	"not_authorized":      AuthErrorKind,
+	"rate_limit_exceeded": QuotaErrorKind,
+	"quota_exceeded":      QuotaErrorKind,
+	"param_error":         BadRequestErrorKind,
+	"failed_geocode":      BadRequestErrorKind,
+	"endpoint_error":      NotFoundErrorKind,
+	"server_error":        UpstreamErrorKind,
+}
+
+// foursquareError classifies the errors of the foursquare client: its api errors carry an error type and the
+// http status of the response
+func foursquareError(resp *http.Response, err error) error {
+	if err == nil {
+		return nil
+	}
+	var apiError *foursquarego.APIError
+	if errors.As(err, &apiError) {
+		kind, ok := foursquareErrorTypeKinds[apiError.Meta.ErrorType]
+		if !ok {
+			kind = statusErrorKind(apiError.Meta.Code)
+		}
+		return &ProviderError{Provider: FoursquareLabel, Kind: kind, Err: err}
+	}
+	if resp != nil && resp.StatusCode >= 400 {
+		return &ProviderError{Provider: FoursquareLabel, Kind: statusErrorKind(resp.StatusCode), Err: err}
+	}
+	return classifyError(FoursquareLabel, err)
+}
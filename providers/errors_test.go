@@ -0,0 +1,121 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/peppage/foursquarego"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"googlemaps.github.io/maps"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUnitclassifyError(t *testing.T) {
+	assert.Nil(t, classifyError(FoursquareLabel, nil))
+	assert.Equal(t, TimeoutErrorKind, KindOf(classifyError(FoursquareLabel, context.DeadlineExceeded)))
+	assert.Equal(t, TimeoutErrorKind, KindOf(classifyError(FoursquareLabel, &net.DNSError{Err: "i/o timeout", IsTimeout: true})))
+	assert.Equal(t, UpstreamErrorKind, KindOf(classifyError(FoursquareLabel, errors.New("connection refused"))))
+
+	// the client went away, not a provider failure
+	assert.Equal(t, context.Canceled, classifyError(FoursquareLabel, context.Canceled))
+
+	classified := &ProviderError{Provider: NominatimLabel, Kind: QuotaErrorKind, Err: errors.New("slow down")}
+	assert.True(t, classified == classifyError(FoursquareLabel, classified), "already classified")
+}
+
+func TestUnitstatusErrorKind(t *testing.T) {
+	for statusCode, kind := range map[int]ErrorKind{
+		http.StatusBadRequest:          BadRequestErrorKind,
+		http.StatusUnprocessableEntity: BadRequestErrorKind,
+		http.StatusUnauthorized:        AuthErrorKind,
+		http.StatusForbidden:           AuthErrorKind,
+		http.StatusNotFound:            NotFoundErrorKind,
+		http.StatusTooManyRequests:     QuotaErrorKind,
+		http.StatusRequestTimeout:      TimeoutErrorKind,
+		http.StatusGatewayTimeout:      TimeoutErrorKind,
+		http.StatusInternalServerError: UpstreamErrorKind,
+		http.StatusBadGateway:          UpstreamErrorKind,
+		http.StatusServiceUnavailable:  UpstreamErrorKind,
+	} {
+		assert.Equal(t, kind, statusErrorKind(statusCode), statusCode)
+	}
+}
+
+func TestUnitgoogleError(t *testing.T) {
+	assert.Nil(t, googleError(nil))
+	for message, kind := range map[string]ErrorKind{
+		"maps: OVER_QUERY_LIMIT - You have exceeded your rate-limit for this API.": QuotaErrorKind,
+		"maps: OVER_DAILY_LIMIT - ":                                      QuotaErrorKind,
+		"maps: REQUEST_DENIED - The provided API key is invalid.":        AuthErrorKind,
+		"maps: INVALID_REQUEST - ":                                       BadRequestErrorKind,
+		"maps: NOT_FOUND - ":                                             NotFoundErrorKind,
+		"maps: UNKNOWN_ERROR - ":                                         UpstreamErrorKind,
+		"maps: Input missing":                                            BadRequestErrorKind,
+		"invalid character '<' looking for beginning of value":           UpstreamErrorKind, // an html error page
+		"Get \"https://maps.googleapis.com/\": connection reset by peer": UpstreamErrorKind,
+	} {
+		err := googleError(errors.New(message))
+		assert.Equal(t, kind, KindOf(err), message)
+		assert.Contains(t, err.Error(), string(GooglePlacesProviderLabel))
+	}
+	assert.Equal(t, TimeoutErrorKind, KindOf(googleError(fmt.Errorf("maps: %w", context.DeadlineExceeded))))
+}
+
+func TestUnitGoogleErrorResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status": "OVER_QUERY_LIMIT", "error_message": "You have exceeded your daily request quota for this API."}`))
+	}))
+	defer server.Close()
+	client, err := maps.NewClient(maps.WithAPIKey("key"), maps.WithBaseURL(server.URL))
+	require.NoError(t, err)
+	g := &googlePlacesProvider{providerConfig: &ProviderConfig{}, mapsClient: client}
+
+	_, err = g.Geocode(context.Background(), GeocodeRequest{Address: "Jungfernstieg 1, Hamburg"})
+	providerError := &ProviderError{}
+	require.True(t, errors.As(err, &providerError))
+	assert.Equal(t, GooglePlacesProviderLabel, providerError.Provider)
+	assert.Equal(t, QuotaErrorKind, providerError.Kind)
+	assert.True(t, providerError.Retryable())
+}
+
+func TestUnitfoursquareError(t *testing.T) {
+	assert.Nil(t, foursquareError(nil, nil))
+	apiError := func(code int, errorType string) error {
+		return &foursquarego.APIError{Meta: foursquarego.Meta{Code: code, ErrorType: errorType, ErrorDetail: "detail"}}
+	}
+	for kind, err := range map[ErrorKind]error{
+		AuthErrorKind:       apiError(http.StatusUnauthorized, "invalid_auth"),
+		QuotaErrorKind:      apiError(http.StatusForbidden, "rate_limit_exceeded"), // a 403, still a quota
+		BadRequestErrorKind: apiError(http.StatusBadRequest, "param_error"),
+		NotFoundErrorKind:   apiError(http.StatusNotFound, "endpoint_error"),
+		UpstreamErrorKind:   apiError(http.StatusInternalServerError, "server_error"),
+	} {
+		assert.Equal(t, kind, KindOf(foursquareError(nil, err)), err.Error())
+	}
+	// unknown error types are classified by their status
+	assert.Equal(t, QuotaErrorKind, KindOf(foursquareError(nil, apiError(http.StatusTooManyRequests, "other"))))
+
+	// unreadable responses, by their http status
+	assert.Equal(t, UpstreamErrorKind, KindOf(foursquareError(&http.Response{StatusCode: http.StatusBadGateway}, errors.New("invalid character '<'"))))
+	assert.Equal(t, TimeoutErrorKind, KindOf(foursquareError(nil, &net.DNSError{Err: "i/o timeout", IsTimeout: true})))
+}
+
+func TestUnitProviderErrorRetryable(t *testing.T) {
+	for kind, retryable := range map[ErrorKind]bool{
+		TimeoutErrorKind:    true,
+		QuotaErrorKind:      true,
+		UpstreamErrorKind:   true,
+		AuthErrorKind:       false,
+		BadRequestErrorKind: false,
+		NotFoundErrorKind:   false,
+	} {
+		err := fmt.Errorf("search: %w", &ProviderError{Provider: FoursquareLabel, Kind: kind, Err: errors.New("boom")})
+		assert.Equal(t, kind, KindOf(err))
+		assert.Equal(t, retryable, (&ProviderError{Kind: kind}).Retryable(), kind)
+	}
+	assert.Equal(t, UnknownErrorKind, KindOf(errors.New("unclassified")))
+}
@@ -2,17 +2,22 @@ package providers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/codeselim/go-webservice-places-provider/api"
 	"github.com/codeselim/go-webservice-places-provider/config"
 	"github.com/codeselim/go-webservice-places-provider/log"
 	"github.com/peppage/foursquarego"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
 /**
  * Places provider: Foursquare
  * API ref: https://developer.foursquare.com/docs/api/venues/suggestcompletion
- * Provides places results from the Foursquare Venues API
+ * Provides places results from the Foursquare Venues API: suggestions (autocomplete), search (text) and explore (nearby)
  */
 
 // since we are obliged ot use a location with the search. In case Lat/Lng are not supplied
@@ -25,7 +30,6 @@ const (
 type foursquareProvider struct {
 	providerLabel  ProviderLabel
 	providerConfig *ProviderConfig
-	fsClient       *foursquarego.Client
 }
 
 // Constructor
@@ -34,41 +38,170 @@ func NewFoursquareProvider(providerConfig *ProviderConfig) Provider {
 		log.GetLogger().Panic("ProviderConfig should be provided")
 	}
 
-	httpClient := getHttpClientFromConfig(providerConfig)
-	client := foursquarego.NewClient(httpClient,
-		"foursquare",
-		config.Config().FoursquareClientID,
-		config.Config().FoursquareClientSecret, "")
-
 	return &foursquareProvider{
 		providerLabel:  FoursquareLabel,
 		providerConfig: providerConfig,
-		fsClient:       client,
 	}
 }
 
+// client returns a client bound to the context of a call: the foursquarego API takes no context, its transport
+// attaches it to the requests, so that a cancelled call (e.g. a superseded autocomplete query) stops its request.
+// The Foursquare localization is negotiated with the Accept-Language header, set by the transport as well
+func (f *foursquareProvider) client(ctx context.Context, language string) *foursquarego.Client {
+	var transport http.RoundTripper = http.DefaultTransport
+	if language != "" {
+		transport = &acceptLanguageTransport{language: language, next: transport}
+	}
+	httpClient := getHttpClientFromConfig(f.providerConfig)
+	httpClient.Transport = &contextTransport{ctx: ctx, next: transport}
+	return foursquarego.NewClient(httpClient,
+		"foursquare",
+		config.Config().FoursquareClientID,
+		config.Config().FoursquareClientSecret, "")
+}
+
+// contextTransport attaches the context of a call to its requests
+type contextTransport struct {
+	ctx  context.Context
+	next http.RoundTripper
+}
+
+func (t *contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.next.RoundTrip(req.WithContext(t.ctx))
+}
+
+// acceptLanguageTransport sets the Accept-Language header of the requests
+type acceptLanguageTransport struct {
+	language string
+	next     http.RoundTripper
+}
+
+func (t *acceptLanguageTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context()) // a RoundTripper must not modify the request
+	req.Header.Set("Accept-Language", t.language)
+	return t.next.RoundTrip(req)
+}
+
 func (f *foursquareProvider) GetPlacesByQuery(ctx context.Context, request PlaceSearchRequest) (places api.Places, err error) {
+	places, _, err = f.GetPlacesPage(ctx, request)
+	return places, err
+}
 
-	searchParam := &foursquarego.VenueSuggestParams{
-		Radius: getSearchRadiusFromConfig(f.providerConfig),
-		Query:  request.InputString,
+// GetPlacesPage pages the explore results with their offset, the suggestions and the search have a single page.
+// Only the search filters the categories, it serves the searches with categories of every mode
+func (f *foursquareProvider) GetPlacesPage(ctx context.Context, request PlaceSearchRequest) (api.Places, string, error) {
+	switch {
+	case request.Mode == TextMode || len(request.Categories) > 0:
+		places, err := f.search(ctx, request)
+		return places, "", err
+	case request.Mode == NearbyMode:
+		return f.explore(ctx, request)
+	default:
+		places, err := f.suggestCompletion(ctx, request)
+		return places, "", err
 	}
+}
 
-	if request.Location != nil {
-		searchParam.LatLong = fmt.Sprintf("%.6f,%.6f", request.Location.Lat, request.Location.Lng)
-	} else {
-		// since we are obliged ot use a location with the search. In case Lat/Lng are not supplied
-		// Just for this demo, in real life, one can adopt other solutions (e.g. location from IP...)
-		searchParam.LatLong = fmt.Sprintf("%.6f,%.6f", fallbackLat, fallbackLng)
+func (f *foursquareProvider) suggestCompletion(ctx context.Context, request PlaceSearchRequest) (api.Places, error) {
+	searchParam := &foursquarego.VenueSuggestParams{
+		Radius:  getSearchRadiusMeters(f.providerConfig, request),
+		Query:   request.InputString,
+		LatLong: getLatLong(request.Location),
+	}
+	if request.Area != nil {
+		center := request.Area.Center()
+		searchParam.LatLong, searchParam.Radius = getLatLong(&center), 0
+		searchParam.Sw, searchParam.Ne = getBounds(request.Area)
 	}
 	// Get venues suggestions
-	miniVenues, _, err := f.fsClient.Venues.SuggestCompletion(searchParam)
+	miniVenues, resp, err := f.client(ctx, request.Language).Venues.SuggestCompletion(searchParam)
+	if err != nil {
+		return api.Places{}, foursquareError(resp, err)
+	}
+	return fourSquarePlacesToApiPlacesConverter(miniVenues), nil
+}
+
+// API ref: https://developer.foursquare.com/docs/api/venues/search
+func (f *foursquareProvider) search(ctx context.Context, request PlaceSearchRequest) (api.Places, error) {
+	searchParam := &foursquarego.VenueSearchParams{
+		Radius:  getSearchRadiusMeters(f.providerConfig, request),
+		Query:   request.InputString,
+		LatLong: getLatLong(request.Location),
+		Intent:  foursquarego.IntentBrowse,
+	}
+	if request.Area != nil { // the browse intent takes either a location and a radius, or a bounding box
+		searchParam.LatLong, searchParam.Radius = "", 0
+		searchParam.Sw, searchParam.Ne = getBounds(request.Area)
+	}
+	// Categories ref: https://developer.foursquare.com/docs/resources/categories, a category includes its sub-categories
+	if len(request.Categories) > 0 {
+		if searchParam.CategoryID = taxonomy.providerCategories(FoursquareLabel, request.Categories); len(searchParam.CategoryID) == 0 {
+			return api.Places{}, nil // Foursquare has none of the categories
+		}
+	}
+	venues, resp, err := f.client(ctx, request.Language).Venues.Search(searchParam)
+	if err != nil {
+		return api.Places{}, foursquareError(resp, err)
+	}
+	return fourSquareVenuesToApiPlacesConverter(venues), nil
+}
+
+// API ref: https://developer.foursquare.com/docs/api/venues/explore
+func (f *foursquareProvider) explore(ctx context.Context, request PlaceSearchRequest) (api.Places, string, error) {
+	if request.Location == nil && request.Area == nil {
+		return api.Places{}, "", errors.New("foursquare: the nearby search requires a location")
+	}
+	offset := 0
+	if request.PageToken != "" {
+		var err error
+		if offset, err = strconv.Atoi(request.PageToken); err != nil || offset < 0 {
+			err = errors.New("foursquare: malformed page token " + request.PageToken)
+			return api.Places{}, "", &ProviderError{Provider: FoursquareLabel, Kind: BadRequestErrorKind, Err: err}
+		}
+	}
+	exploreParam := &foursquarego.VenueExploreParams{
+		Radius:  getSearchRadiusMeters(f.providerConfig, request),
+		Query:   request.InputString,
+		LatLong: getLatLong(request.Location),
+		Offset:  offset,
+	}
+	if request.Area != nil { // no bounding box for the explore, the circle covering the area
+		center := request.Area.Center()
+		exploreParam.LatLong, exploreParam.Radius = getLatLong(&center), request.Area.Radius()
+	}
+	resp, httpResp, err := f.client(ctx, request.Language).Venues.Explore(exploreParam)
 	if err != nil {
-		return api.Places{}, err
+		return api.Places{}, "", foursquareError(httpResp, err)
+	}
+	venues := []foursquarego.Venue{}
+	for _, group := range resp.Groups {
+		for _, item := range group.Items {
+			venues = append(venues, item.Venue)
+		}
 	}
+	return fourSquareVenuesToApiPlacesConverter(venues), exploreNextPageToken(offset, len(venues), resp.TotalResults), nil
+}
+
+// the next page starts after the returned venues, until the total results
+func exploreNextPageToken(offset int, count int, totalResults int) string {
+	if count == 0 || offset+count >= totalResults {
+		return ""
+	}
+	return strconv.Itoa(offset + count)
+}
+
+// the searches require a location, the fallback one is used without Lat/Lng
+func getLatLong(location *Location) string {
+	if location == nil {
+		return fmt.Sprintf("%.6f,%.6f", fallbackLat, fallbackLng)
+	}
+	return fmt.Sprintf("%.6f,%.6f", location.Lat, location.Lng)
+}
 
-	places = fourSquarePlacesToApiPlacesConverter(miniVenues)
-	return places, nil
+// getBounds returns the south-west and north-east corners of the area bounds
+func getBounds(area *Area) (string, string) {
+	sw, ne := area.Bounds()
+	return getLatLong(&sw), getLatLong(&ne)
 }
 
 func (f *foursquareProvider) GetPlaceDetails(ctx context.Context, placeId string) (placeDetails api.PlaceDetails, err error) {
@@ -80,6 +213,14 @@ func (f *foursquareProvider) GetProviderLabel() ProviderLabel {
 	return f.providerLabel
 }
 
+func (f *foursquareProvider) GetSearchModes() []SearchMode {
+	return []SearchMode{AutocompleteMode, TextMode, NearbyMode}
+}
+
+func (f *foursquareProvider) GetCacheTTL() time.Duration {
+	return getCacheTTLFromConfig(f.providerConfig)
+}
+
 // Converter Foursquare Models -> API Models
 func fourSquarePlacesToApiPlacesConverter(venues []foursquarego.MiniVenue) api.Places {
 	places := api.Places{}
@@ -88,18 +229,58 @@ func fourSquarePlacesToApiPlacesConverter(venues []foursquarego.MiniVenue) api.P
 			ID:       venue.ID,
 			Name:     venue.Name,
 			Provider: string(FoursquareLabel),
-			URI:      fmt.Sprintf("/fs/details/%s", venue.ID), //kind of hateoas href
+			URI:      placeURI(FoursquareLabel, venue.ID), //kind of hateoas href
 			Address:  getFormattedAddress(venue),
 			Location: &api.Location{
 				Lat: venue.Location.Lat,
 				Lng: venue.Location.Lng,
 			},
+			Categories:        venueCategories(venue.Category),
+			StructuredAddress: venueAddress(venue.Location),
 		}
 		places = append(places, place)
 	}
 	return places
 }
 
+// the venues of the search and explore endpoints have the same fields as the suggested ones, and more
+func fourSquareVenuesToApiPlacesConverter(venues []foursquarego.Venue) api.Places {
+	miniVenues := make([]foursquarego.MiniVenue, 0, len(venues))
+	for _, venue := range venues {
+		miniVenues = append(miniVenues, foursquarego.MiniVenue{ID: venue.ID, Name: venue.Name, Location: venue.Location, Category: venue.Categories})
+	}
+	return fourSquarePlacesToApiPlacesConverter(miniVenues)
+}
+
+func venueCategories(categories []foursquarego.Category) []string {
+	ids := make([]string, 0, len(categories))
+	names := make([]string, 0, len(categories))
+	for _, category := range categories {
+		ids = append(ids, category.ID)
+		names = append(names, category.Name)
+	}
+	return taxonomy.canonicalCategories(FoursquareLabel, ids, names)
+}
+
+// venueAddress returns the structured address of a venue, whatever components it has. Nil without any
+func venueAddress(location foursquarego.Location) *api.Address {
+	street, houseNumber := splitStreetLine(location.Address) // a single line, e.g. "Jungfernstieg 1"
+	address := api.Address{
+		Street:      street,
+		HouseNumber: houseNumber,
+		PostalCode:  location.PostalCode,
+		City:        location.City,
+		Region:      location.State,
+		CountryCode: strings.ToUpper(location.Cc),
+	}
+	if address == (api.Address{}) {
+		return nil
+	}
+	address.Formatted = FormatAddress(address)
+	return &address
+}
+
+// the display line of the v1 API
 func getFormattedAddress(venue foursquarego.MiniVenue) string {
 	// Either a full address or nothing!
 	// (since foursquare can return incomplete addresses sometimes )
@@ -112,3 +293,9 @@ func getFormattedAddress(venue foursquarego.MiniVenue) string {
 		return ""
 	}
 }
+
+// Health probe: the categories endpoint is static and cheap, it still validates the client credentials
+func (f *foursquareProvider) CheckHealth(ctx context.Context) error {
+	_, resp, err := f.client(ctx, "").Venues.Categories()
+	return foursquareError(resp, err)
+}
@@ -1,8 +1,14 @@
 package providers
 
 import (
+	"context"
+	"errors"
+	"github.com/codeselim/go-webservice-places-provider/api"
 	"github.com/peppage/foursquarego"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 )
@@ -66,3 +72,86 @@ func TestUnitgetFormattedAddress(t *testing.T) {
 	address = getFormattedAddress(venue)
 	assert.Equal(t, "", address)
 }
+
+func TestUnitfourSquareVenuesToApiPlacesConverter(t *testing.T) {
+	venues := []foursquarego.Venue{
+		{ID: "someID", Name: "Venue", Location: foursquarego.Location{Lat: 53.5, Lng: 9.9, Address: "Street 1", PostalCode: "20095", City: "Hamburg", Country: "Germany"}},
+	}
+
+	places := fourSquareVenuesToApiPlacesConverter(venues)
+	assert.Equal(t, 1, len(places))
+	assert.Equal(t, "Street 1, 20095 Hamburg, Germany", places[0].Address)
+	assert.Equal(t, 53.5, places[0].Location.Lat)
+	assert.Equal(t, "/api/v1/places/FOURSQUARE/someID", places[0].URI)
+}
+
+func TestUnitgetLatLong(t *testing.T) {
+	assert.Equal(t, "53.500000,9.900000", getLatLong(&Location{Lat: 53.5, Lng: 9.9}))
+	assert.Equal(t, "53.564615,9.918173", getLatLong(nil))
+}
+
+func TestUnitexploreNextPageToken(t *testing.T) {
+	assert.Equal(t, "30", exploreNextPageToken(0, 30, 100))
+	assert.Equal(t, "60", exploreNextPageToken(30, 30, 100))
+	assert.Equal(t, "", exploreNextPageToken(90, 10, 100))
+	assert.Equal(t, "", exploreNextPageToken(30, 0, 100))
+}
+
+func TestUnitvenueCategories(t *testing.T) {
+	categories := venueCategories([]foursquarego.Category{
+		{ID: "4bf58dd8d48988d1d3941735", Name: "Vegetarian / Vegan Restaurant"},
+		{ID: "4bf58dd8d48988d1e0931735", Name: "Coffee Shop"},
+		{ID: "4bf58dd8d48988d16d941735", Name: "Café"},
+		{ID: "unknown", Name: "Unmapped"},
+	})
+	assert.Equal(t, []string{"vegan", "cafe"}, categories)
+}
+
+func TestUnitContextTransport(t *testing.T) {
+	var language string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		language = r.Header.Get("Accept-Language")
+	}))
+	defer server.Close()
+
+	transport := &contextTransport{ctx: context.Background(), next: &acceptLanguageTransport{language: "de", next: http.DefaultTransport}}
+	resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "de", language)
+
+	// a cancelled call doesn't send its request
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	language = ""
+	_, err = (&http.Client{Transport: &contextTransport{ctx: ctx, next: http.DefaultTransport}}).Get(server.URL)
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Equal(t, "", language)
+}
+
+func TestUnitAcceptLanguageTransport(t *testing.T) {
+	var language string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		language = r.Header.Get("Accept-Language")
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: &acceptLanguageTransport{language: "de", next: http.DefaultTransport}}
+	resp, err := client.Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "de", language)
+}
+
+func TestUnitvenueAddress(t *testing.T) {
+	assert.Nil(t, venueAddress(foursquarego.Location{Lat: 53.5, Lng: 9.9}))
+
+	// partial addresses are kept, unlike the v1 display line
+	address := venueAddress(foursquarego.Location{Address: "Jungfernstieg 1", City: "Hamburg", Cc: "de"})
+	assert.Equal(t, &api.Address{Street: "Jungfernstieg", HouseNumber: "1", City: "Hamburg", CountryCode: "DE", Formatted: "Jungfernstieg 1, Hamburg"}, address)
+
+	address = venueAddress(foursquarego.Location{Address: "350 5th Ave", PostalCode: "10118", City: "New York", State: "NY", Cc: "US"})
+	assert.Equal(t, "5th Ave", address.Street)
+	assert.Equal(t, "350", address.HouseNumber)
+	assert.Equal(t, "350 5th Ave, New York, NY 10118", address.Formatted)
+}
@@ -0,0 +1,35 @@
+package providers
+
+import (
+	"github.com/codeselim/go-webservice-places-provider/api"
+)
+
+/**
+ * Forward geocoding: the free-form addresses are resolved to locations and structured addresses. Each provider rates
+ * the precision of its results with the api precision levels, their confidence derives from it.
+ */
+
+// confidence of a result by precision, before the provider match quality
+var precisionConfidence = map[string]float64{
+	api.PrecisionRooftop:      1,
+	api.PrecisionInterpolated: 0.9,
+	api.PrecisionStreet:       0.7,
+	api.PrecisionPostalCode:   0.6,
+	api.PrecisionCity:         0.5,
+	api.PrecisionRegion:       0.3,
+	api.PrecisionCountry:      0.2,
+	api.PrecisionApproximate:  0.1,
+}
+
+// partial matches (a misspelled or missing component) lose a quarter of their confidence
+const partialMatchPenalty = 0.75
+
+// geocodeConfidence returns the confidence of a result of a precision, partial when the provider matched only a part
+// of the address
+func geocodeConfidence(precision string, partialMatch bool) float64 {
+	confidence := precisionConfidence[precision]
+	if partialMatch {
+		confidence *= partialMatchPenalty
+	}
+	return confidence
+}
@@ -2,23 +2,28 @@ package providers
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"github.com/codeselim/go-webservice-places-provider/api"
 	"github.com/codeselim/go-webservice-places-provider/config"
 	"github.com/codeselim/go-webservice-places-provider/log"
 	"googlemaps.github.io/maps"
+	"sync"
+	"time"
 )
 
 /**
  * Places provider: Google Places
  * API ref: https://developers.google.com/places/web-service/autocomplete#place_autocomplete_results
- * Provides places results from the Google Places API
+ * Provides places results from the Google Places API: autocomplete, text and nearby searches, and the forward and
+ * reverse geocoding of the Google Geocoding API
  */
 
 type googlePlacesProvider struct {
 	providerLabel  ProviderLabel
 	providerConfig *ProviderConfig
 	mapsClient     *maps.Client
+	sessions       *autocompleteSessions
+	locations      *placeLocations
 }
 
 // Constructor
@@ -39,62 +44,400 @@ func NewGoogleLocationProvider(providerConfig *ProviderConfig) Provider {
 		providerLabel:  GooglePlacesProviderLabel,
 		providerConfig: providerConfig,
 		mapsClient:     client,
+		sessions:       newAutocompleteSessions(),
+		locations:      newPlaceLocations(),
 	}
 }
 
 func (g *googlePlacesProvider) GetPlacesByQuery(ctx context.Context, request PlaceSearchRequest) (places api.Places, err error) {
-	language := config.DefaultGooglePlacesLanguage
-	if g.providerConfig.Language != "" {
-		language = g.providerConfig.Language
+	places, _, err = g.GetPlacesPage(ctx, request)
+	return places, err
+}
+
+// GetPlacesPage pages the text and nearby searches with their next_page_token, the autocomplete has a single page
+func (g *googlePlacesProvider) GetPlacesPage(ctx context.Context, request PlaceSearchRequest) (api.Places, string, error) {
+	switch request.Mode {
+	case TextMode:
+		return g.textSearch(ctx, request)
+	case NearbyMode:
+		return g.nearbySearch(ctx, request)
+	default:
+		places, err := g.autocomplete(ctx, request)
+		return places, "", err
 	}
+}
 
+func (g *googlePlacesProvider) autocomplete(ctx context.Context, request PlaceSearchRequest) (api.Places, error) {
+	location, radius := g.searchCircle(request)
 	searchParam := &maps.PlaceAutocompleteRequest{
-		Input:    request.InputString,
-		Language: language,
-		Radius:   uint(getSearchRadiusFromConfig(g.providerConfig)),
-		Types:    "establishment",
+		Input:        request.InputString,
+		Language:     g.language(request),
+		Radius:       radius,
+		Types:        "establishment",
+		Location:     location,
+		StrictBounds: request.Area != nil,
 	}
 
-	if request.Location != nil {
-		searchParam.Location = &maps.LatLng{
-			Lat: request.Location.Lat,
-			Lng: request.Location.Lng,
-		}
+	// keystrokes of a session are billed as a single autocomplete session
+	sessionToken, inSession := g.sessions.token(request.SessionID)
+	if inSession {
+		searchParam.SessionToken = maps.PlaceAutocompleteSessionToken(sessionToken)
 	}
 
-	resp, err := g.mapsClient.PlaceAutocomplete(context.Background(), searchParam)
+	resp, err := g.mapsClient.PlaceAutocomplete(ctx, searchParam)
 	if err != nil {
-		return api.Places{}, err
+		return api.Places{}, googleError(err)
 	}
 
-	apiPlaces := googlePlacesToApiPlacesConverter(resp)
+	// the autocomplete can't be restricted to place types, its predictions are filtered
+	apiPlaces := filterPlacesByCategories(googlePlacesToApiPlacesConverter(resp), request.Categories)
+	if request.Area != nil {
+		apiPlaces = g.locate(ctx, apiPlaces) // the predictions are filtered by their location
+	}
+	if inSession {
+		placeIDs := make([]string, 0, len(apiPlaces))
+		for _, place := range apiPlaces {
+			placeIDs = append(placeIDs, place.ID)
+		}
+		g.sessions.predicted(request.SessionID, sessionToken, placeIDs)
+	}
 	return apiPlaces, nil
 }
 
+// Text Search API ref: https://developers.google.com/places/web-service/search#TextSearchRequests
+func (g *googlePlacesProvider) textSearch(ctx context.Context, request PlaceSearchRequest) (api.Places, string, error) {
+	placeType, ok := googlePlaceType(request.Categories)
+	if !ok {
+		return api.Places{}, "", nil
+	}
+	location, radius := g.searchCircle(request)
+	searchParam := &maps.TextSearchRequest{
+		Query:     request.InputString,
+		Language:  g.language(request),
+		Location:  location,
+		PageToken: request.PageToken,
+		Type:      placeType,
+	}
+	if searchParam.Location != nil {
+		searchParam.Radius = radius // required with a location
+	}
+
+	resp, err := g.mapsClient.TextSearch(ctx, searchParam)
+	if err != nil {
+		return api.Places{}, "", googleError(err)
+	}
+	return filterPlacesByCategories(googleSearchResultsToApiPlacesConverter(resp.Results), request.Categories), resp.NextPageToken, nil
+}
+
+// Nearby Search API ref: https://developers.google.com/places/web-service/search#PlaceSearchRequests
+func (g *googlePlacesProvider) nearbySearch(ctx context.Context, request PlaceSearchRequest) (api.Places, string, error) {
+	if request.Location == nil && request.Area == nil {
+		return api.Places{}, "", errors.New("google places: the nearby search requires a location")
+	}
+	placeType, ok := googlePlaceType(request.Categories)
+	if !ok {
+		return api.Places{}, "", nil
+	}
+	location, radius := g.searchCircle(request)
+	searchParam := &maps.NearbySearchRequest{
+		Location:  location,
+		Radius:    radius,
+		Keyword:   request.InputString,
+		Language:  g.language(request),
+		PageToken: request.PageToken,
+		Type:      placeType,
+	}
+
+	resp, err := g.mapsClient.NearbySearch(ctx, searchParam)
+	if err != nil {
+		return api.Places{}, "", googleError(err)
+	}
+	return filterPlacesByCategories(googleSearchResultsToApiPlacesConverter(resp.Results), request.Categories), resp.NextPageToken, nil
+}
+
+// searchCircle returns the location and radius of a search: the circle covering the area, else the request ones
+func (g *googlePlacesProvider) searchCircle(request PlaceSearchRequest) (*maps.LatLng, uint) {
+	if request.Area != nil {
+		center := request.Area.Center()
+		return toGoogleLatLng(&center), uint(request.Area.Radius())
+	}
+	return toGoogleLatLng(request.Location), uint(getSearchRadiusMeters(g.providerConfig, request))
+}
+
+// locate sets the location of the places, looked up with a details request (geometry only) when not cached.
+// The places whose lookup failed stay without location
+func (g *googlePlacesProvider) locate(ctx context.Context, places api.Places) api.Places {
+	var wg sync.WaitGroup
+	lookups := make(chan struct{}, config.PlaceLocationLookupConcurrency)
+	for i := range places {
+		if location, ok := g.locations.get(places[i].ID); ok {
+			places[i].Location = &location
+			continue
+		}
+		wg.Add(1)
+		go func(place *api.Place) {
+			defer wg.Done()
+			lookups <- struct{}{}
+			defer func() { <-lookups }()
+			resp, err := g.mapsClient.PlaceDetails(ctx, &maps.PlaceDetailsRequest{
+				PlaceID: place.ID,
+				Fields:  []maps.PlaceDetailsFieldMask{maps.PlaceDetailsFieldMaskGeometry},
+			})
+			if err != nil {
+				log.GetLoggerWithContext(ctx).Warn("google places: couldn't locate " + place.ID + ": " + err.Error())
+				return
+			}
+			location := api.Location{Lat: resp.Geometry.Location.Lat, Lng: resp.Geometry.Location.Lng}
+			g.locations.set(place.ID, location)
+			place.Location = &location
+		}(&places[i])
+	}
+	wg.Wait()
+	return places
+}
+
+// Geocode resolves a free-form address, the Geocoding API returns the best matches first
+// Geocoding API ref: https://developers.google.com/maps/documentation/geocoding/requests-geocoding
+func (g *googlePlacesProvider) Geocode(ctx context.Context, request GeocodeRequest) (api.GeocodingResults, error) {
+	results, err := g.mapsClient.Geocode(ctx, &maps.GeocodingRequest{
+		Address:  request.Address,
+		Language: g.language(PlaceSearchRequest{Language: request.Language}),
+	})
+	if err != nil {
+		return api.GeocodingResults{}, googleError(err)
+	}
+	if len(results) > config.MaxGeocodingResults {
+		results = results[:config.MaxGeocodingResults]
+	}
+	return googleGeocodingResultsConverter(results), nil
+}
+
+// ReverseGeocode returns the most precise address of the location (the Geocoding API sorts its results by precision)
+// and the establishments of a nearby search around it. A failing nearby search doesn't lose the address, the
+// geocoding then has no establishments
+// Geocoding API ref: https://developers.google.com/maps/documentation/geocoding/requests-reverse-geocoding
+func (g *googlePlacesProvider) ReverseGeocode(ctx context.Context, request ReverseGeocodeRequest) (api.ReverseGeocoding, error) {
+	geocoding := api.ReverseGeocoding{Places: api.Places{}}
+	language := g.language(PlaceSearchRequest{Language: request.Language})
+	results, err := g.mapsClient.ReverseGeocode(ctx, &maps.GeocodingRequest{
+		LatLng:   toGoogleLatLng(&request.Location),
+		Language: language,
+	})
+	if err != nil {
+		return geocoding, googleError(err)
+	}
+	if len(results) > 0 {
+		address := googleAddress(results[0].AddressComponents, results[0].FormattedAddress)
+		geocoding.Address = &address
+		geocoding.Location = &api.Location{Lat: results[0].Geometry.Location.Lat, Lng: results[0].Geometry.Location.Lng}
+		geocoding.Provider = string(GooglePlacesProviderLabel)
+	}
+
+	places, _, err := g.nearbySearch(ctx, PlaceSearchRequest{
+		Location:     &request.Location,
+		radiusMeters: config.ReverseGeocodeRadius,
+		Language:     language,
+		Mode:         NearbyMode,
+	})
+	if err != nil {
+		if geocoding.Address == nil {
+			return geocoding, err
+		}
+		log.GetLoggerWithContext(ctx).Warn("google places: reverse geocoding without establishments: " + err.Error())
+		return geocoding, nil
+	}
+	geocoding.Places = places
+	return geocoding, nil
+}
+
+// the language of the request wins over the provider one
+func (g *googlePlacesProvider) language(request PlaceSearchRequest) string {
+	if request.Language != "" {
+		return request.Language
+	}
+	if g.providerConfig.Language != "" {
+		return g.providerConfig.Language
+	}
+	return config.DefaultGooglePlacesLanguage
+}
+
+// googlePlaceType returns the place type searching the categories: the searches take a single type, the results of
+// several types are filtered. False when Google has none of the categories
+func googlePlaceType(categories []string) (maps.PlaceType, bool) {
+	if len(categories) == 0 {
+		return "", true
+	}
+	placeTypes := taxonomy.providerCategories(GooglePlacesProviderLabel, categories)
+	if len(placeTypes) == 1 {
+		return maps.PlaceType(placeTypes[0]), true
+	}
+	return "", len(placeTypes) > 0
+}
+
+func toGoogleLatLng(location *Location) *maps.LatLng {
+	if location == nil {
+		return nil
+	}
+	return &maps.LatLng{Lat: location.Lat, Lng: location.Lng}
+}
+
 func (g *googlePlacesProvider) GetPlaceDetails(ctx context.Context, placeId string) (placeDetails api.PlaceDetails, err error) {
+	// the details of a prediction conclude its autocomplete session, the next keystrokes start a new session.
+	// The details are not fetched from Google yet: the session token will then go with the details request
+	// (maps.PlaceDetailsRequest.SessionToken), until then Google bills the sessions as ones without details
+	g.sessions.end(GetSessionID(ctx), placeId)
 	//dummy implementation, extend in the future
 	return api.PlaceDetails{ID: placeId, Name: "John Smith", SomeText: "Endpoint Not implemented yet! Take it easy!"}, nil
 }
 
+// GetCaches returns the autocomplete session tokens and the predictions locations caches
+func (g *googlePlacesProvider) GetCaches() map[string]Cache {
+	return map[string]Cache{"session-tokens": g.sessions, "place-locations": g.locations}
+}
+
 func (g *googlePlacesProvider) GetProviderLabel() ProviderLabel {
 	return g.providerLabel
 }
 
+func (g *googlePlacesProvider) GetSearchModes() []SearchMode {
+	return []SearchMode{AutocompleteMode, TextMode, NearbyMode}
+}
+
+func (g *googlePlacesProvider) GetCacheTTL() time.Duration {
+	return getCacheTTLFromConfig(g.providerConfig)
+}
+
 // Converter Google Models -> API Models
 func googlePlacesToApiPlacesConverter(resp maps.AutocompleteResponse) api.Places {
 	places := api.Places{}
 	Predictions := resp.Predictions
 
 	for _, prediction := range Predictions {
+		place := api.Place{
+			Provider:   string(GooglePlacesProviderLabel),
+			Address:    prediction.StructuredFormatting.SecondaryText, //relying on the secondary text since the search types is fixed on establishments
+			Name:       prediction.StructuredFormatting.MainText,
+			ID:         prediction.PlaceID,
+			Location:   nil,                                                     // no place location details in the returned results
+			URI:        placeURI(GooglePlacesProviderLabel, prediction.PlaceID), //kind of hateoas href
+			Categories: taxonomy.canonicalCategories(GooglePlacesProviderLabel, prediction.Types, nil),
+			// no StructuredAddress: the predictions have no address components (the details have them, billed),
+			// the v2 address is the display line
+		}
+		places = append(places, place)
+	}
+	return places
+}
+
+// the text and nearby searches results have a location, unlike the autocomplete predictions
+func googleSearchResultsToApiPlacesConverter(results []maps.PlacesSearchResult) api.Places {
+	places := api.Places{}
+	for _, result := range results {
+		address := result.FormattedAddress
+		if address == "" {
+			address = result.Vicinity // the nearby search only returns a simplified address
+		}
 		place := api.Place{
 			Provider: string(GooglePlacesProviderLabel),
-			Address:  prediction.StructuredFormatting.SecondaryText, //relying on the secondary text since the search types is fixed on establishments
-			Name:     prediction.StructuredFormatting.MainText,
-			ID:       prediction.PlaceID,
-			Location: nil,                                               // no place location details in the returned results
-			URI:      fmt.Sprintf("/gp/details/%s", prediction.PlaceID), //kind of hateoas href
+			Address:  address,
+			Name:     result.Name,
+			ID:       result.PlaceID,
+			Location: &api.Location{
+				Lat: result.Geometry.Location.Lat,
+				Lng: result.Geometry.Location.Lng,
+			},
+			URI:        placeURI(GooglePlacesProviderLabel, result.PlaceID),
+			Categories: taxonomy.canonicalCategories(GooglePlacesProviderLabel, result.Types, nil),
+			// the search results have no address components either
 		}
 		places = append(places, place)
 	}
 	return places
 }
+
+func googleGeocodingResultsConverter(results []maps.GeocodingResult) api.GeocodingResults {
+	geocodingResults := api.GeocodingResults{}
+	for _, result := range results {
+		precision := googlePrecision(result)
+		geocodingResults = append(geocodingResults, api.GeocodingResult{
+			Address:    googleAddress(result.AddressComponents, result.FormattedAddress),
+			Location:   api.Location{Lat: result.Geometry.Location.Lat, Lng: result.Geometry.Location.Lng},
+			Provider:   string(GooglePlacesProviderLabel),
+			Precision:  precision,
+			Confidence: geocodeConfidence(precision, result.PartialMatch),
+		})
+	}
+	return geocodingResults
+}
+
+// googleAddress returns the structured address of the address components
+func googleAddress(components []maps.AddressComponent, formatted string) api.Address {
+	address := api.Address{Formatted: formatted}
+	for _, component := range components {
+		for _, componentType := range component.Types {
+			switch componentType {
+			case "street_number":
+				address.HouseNumber = component.LongName
+			case "route":
+				address.Street = component.LongName
+			case "postal_code":
+				address.PostalCode = component.LongName
+			case "locality":
+				address.City = component.LongName
+			case "postal_town": // the UK city, when there is no locality
+				if address.City == "" {
+					address.City = component.LongName
+				}
+			case "administrative_area_level_1":
+				address.Region = component.LongName
+			case "country":
+				address.CountryCode = component.ShortName
+			}
+		}
+	}
+	return address
+}
+
+// googlePrecision returns the precision of a result from its most precise type. The addresses are rooftop when
+// Google knows their building, else interpolated along the street
+func googlePrecision(result maps.GeocodingResult) string {
+	types := map[string]bool{}
+	for _, resultType := range result.Types {
+		types[resultType] = true
+	}
+	switch {
+	case types["street_address"] || types["premise"] || types["subpremise"]:
+		if result.Geometry.LocationType == string(maps.GeocodeAccuracyRooftop) {
+			return api.PrecisionRooftop
+		}
+		return api.PrecisionInterpolated
+	case types["route"] || types["intersection"]:
+		return api.PrecisionStreet
+	case types["postal_code"]:
+		return api.PrecisionPostalCode
+	case types["locality"] || types["sublocality"] || types["postal_town"] || types["neighborhood"]:
+		return api.PrecisionCity
+	case types["administrative_area_level_1"] || types["administrative_area_level_2"]:
+		return api.PrecisionRegion
+	case types["country"]:
+		return api.PrecisionCountry
+	}
+	return api.PrecisionApproximate
+}
+
+// the place of the health probes: Google Sydney, the example place of the Places API documentation
+const healthProbePlaceID = "ChIJN1t_tDeuEmsRUsoyG83frY4"
+
+// Health probe: the details of a place restricted to its id, an "ID Refresh" request Google doesn't bill, unlike
+// the searches and the autocomplete requests. It still validates the API key and the upstream availability,
+// a stale probe place (NOT_FOUND) is an answer as well
+func (g *googlePlacesProvider) CheckHealth(ctx context.Context) error {
+	_, err := g.mapsClient.PlaceDetails(ctx, &maps.PlaceDetailsRequest{
+		PlaceID: healthProbePlaceID,
+		Fields:  []maps.PlaceDetailsFieldMask{maps.PlaceDetailsFieldMaskPlaceID},
+	})
+	if err = googleError(err); KindOf(err) == NotFoundErrorKind {
+		return nil
+	}
+	return err
+}
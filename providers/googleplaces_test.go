@@ -1,8 +1,14 @@
 package providers
 
 import (
+	"context"
+	"github.com/codeselim/go-webservice-places-provider/api"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"googlemaps.github.io/maps"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -12,6 +18,14 @@ func TestUnitNewGoogleLocationProvider(t *testing.T) {
 	//check label
 }
 
+func TestUnitGoogleCaches(t *testing.T) {
+	holder, ok := NewGoogleLocationProvider(&ProviderConfig{}).(CacheHolder)
+	require.True(t, ok)
+	caches := holder.GetCaches()
+	assert.Contains(t, caches, "session-tokens")
+	assert.Contains(t, caches, "place-locations")
+}
+
 func TestUnitGPWithConfig(t *testing.T) {
 	//empty config
 	assert.NotPanics(t, func() { NewGoogleLocationProvider(&ProviderConfig{}) })
@@ -45,4 +59,231 @@ func TestUnitgooglePlacesToApiPlacesConverter(t *testing.T) {
 
 	//additional structure verifications can be added... e.g. with reflect.DeepEqual
 	assert.Equal(t, 2, len(actualApiPlaces))
+	assert.Nil(t, api.Place{Provider: "GOOGLE_PLACES", ID: "no-secondary-text"}.V2().Address)
+}
+
+func TestUnitgoogleSearchResultsToApiPlacesConverter(t *testing.T) {
+	results := []maps.PlacesSearchResult{
+		{PlaceID: "someID", Name: "Text search result", FormattedAddress: "Street 1, Hamburg"},
+		{PlaceID: "someID2", Name: "Nearby search result", Vicinity: "Street 2", Geometry: maps.AddressGeometry{Location: maps.LatLng{Lat: 53.5, Lng: 9.9}}},
+	}
+
+	places := googleSearchResultsToApiPlacesConverter(results)
+	assert.Equal(t, 2, len(places))
+	assert.Equal(t, "Street 1, Hamburg", places[0].Address)
+	assert.Equal(t, "Street 2", places[1].Address)
+	assert.Equal(t, &api.Location{Lat: 53.5, Lng: 9.9}, places[1].Location)
+	assert.Equal(t, "/api/v1/places/GOOGLE_PLACES/someID2", places[1].URI)
+	// no address components, the v2 address is the display line
+	assert.Nil(t, places[0].StructuredAddress)
+	assert.Equal(t, &api.Address{Formatted: "Street 1, Hamburg"}, places[0].V2().Address)
+}
+
+func TestUnitgooglePlaceType(t *testing.T) {
+	placeType, ok := googlePlaceType([]string{"museum"})
+	assert.True(t, ok)
+	assert.Equal(t, maps.PlaceTypeMuseum, placeType)
+
+	// several types are filtered
+	placeType, ok = googlePlaceType([]string{"museum", "bar"})
+	assert.True(t, ok)
+	assert.Equal(t, maps.PlaceType(""), placeType)
+	placeType, ok = googlePlaceType([]string{"supermarket"})
+	assert.True(t, ok)
+	assert.Equal(t, maps.PlaceType(""), placeType)
+
+	_, ok = googlePlaceType([]string{"vegan"})
+	assert.False(t, ok, "no place type for vegan restaurants")
+	_, ok = googlePlaceType(nil)
+	assert.True(t, ok)
+}
+
+func TestUnitgoogleSearchResultsCategories(t *testing.T) {
+	results := []maps.PlacesSearchResult{
+		{PlaceID: "restaurant", Types: []string{"restaurant", "food", "establishment"}},
+		{PlaceID: "bar", Types: []string{"bar", "night_club", "establishment"}},
+		{PlaceID: "hotel", Types: []string{"lodging", "establishment"}},
+	}
+	places := googleSearchResultsToApiPlacesConverter(results)
+	assert.Equal(t, []string{"restaurant"}, places[0].Categories)
+	assert.Equal(t, []string{"bar", "nightclub"}, places[1].Categories)
+	assert.Equal(t, []string{"lodging"}, places[2].Categories)
+}
+
+func TestUnitGoogleLanguage(t *testing.T) {
+	g := &googlePlacesProvider{providerConfig: &ProviderConfig{}}
+	assert.Equal(t, "en", g.language(PlaceSearchRequest{}))
+	assert.Equal(t, "de", g.language(PlaceSearchRequest{Language: "de"}))
+	g.providerConfig.Language = "fr"
+	assert.Equal(t, "fr", g.language(PlaceSearchRequest{}))
+	assert.Equal(t, "de", g.language(PlaceSearchRequest{Language: "de"}))
+}
+
+func TestUnitGoogleLocate(t *testing.T) {
+	var lookups int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&lookups, 1)
+		if r.URL.Query().Get("placeid") == "unknown" {
+			w.Write([]byte(`{"status": "NOT_FOUND"}`))
+			return
+		}
+		assert.Equal(t, "geometry", r.URL.Query().Get("fields"))
+		w.Write([]byte(`{"status": "OK", "result": {"geometry": {"location": {"lat": 53.5, "lng": 9.9}}}}`))
+	}))
+	defer server.Close()
+	client, err := maps.NewClient(maps.WithAPIKey("key"), maps.WithBaseURL(server.URL))
+	require.NoError(t, err)
+	g := &googlePlacesProvider{providerConfig: &ProviderConfig{}, mapsClient: client, locations: newPlaceLocations()}
+
+	places := g.locate(context.Background(), api.Places{{ID: "place-1"}, {ID: "unknown"}})
+	require.NotNil(t, places[0].Location)
+	assert.Equal(t, api.Location{Lat: 53.5, Lng: 9.9}, *places[0].Location)
+	assert.Nil(t, places[1].Location)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&lookups))
+
+	// the locations are cached
+	places = g.locate(context.Background(), api.Places{{ID: "place-1"}})
+	assert.NotNil(t, places[0].Location)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&lookups))
+}
+
+func TestUnitGoogleReverseGeocode(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/maps/api/geocode/json":
+			assert.Equal(t, "53.5511,9.9937", r.URL.Query().Get("latlng"))
+			assert.Equal(t, "de", r.URL.Query().Get("language"))
+			w.Write([]byte(`{"status": "OK", "results": [
+				{"formatted_address": "Jungfernstieg 1, 20095 Hamburg", "geometry": {"location": {"lat": 53.5512, "lng": 9.9936}},
+					"address_components": [
+						{"long_name": "1", "short_name": "1", "types": ["street_number"]},
+						{"long_name": "Jungfernstieg", "short_name": "Jungfernstieg", "types": ["route"]},
+						{"long_name": "Hamburg", "short_name": "HH", "types": ["locality", "political"]},
+						{"long_name": "Germany", "short_name": "DE", "types": ["country", "political"]},
+						{"long_name": "20095", "short_name": "20095", "types": ["postal_code"]}]},
+				{"formatted_address": "20095 Hamburg", "geometry": {"location": {"lat": 53.55, "lng": 10.0}}}]}`))
+		case "/maps/api/place/nearbysearch/json":
+			assert.Equal(t, "53.5511,9.9937", r.URL.Query().Get("location"))
+			assert.Equal(t, "50", r.URL.Query().Get("radius"))
+			w.Write([]byte(`{"status": "OK", "results": [{"place_id": "cafe-1", "name": "Café Paris", "types": ["cafe"],
+				"geometry": {"location": {"lat": 53.5512, "lng": 9.9936}}}]}`))
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+	client, err := maps.NewClient(maps.WithAPIKey("key"), maps.WithBaseURL(server.URL))
+	require.NoError(t, err)
+	g := &googlePlacesProvider{providerConfig: &ProviderConfig{}, mapsClient: client}
+
+	geocoding, err := g.ReverseGeocode(context.Background(), ReverseGeocodeRequest{Location: Location{Lat: 53.5511, Lng: 9.9937}, Language: "de"})
+	require.NoError(t, err)
+	assert.Equal(t, &api.Address{Street: "Jungfernstieg", HouseNumber: "1", PostalCode: "20095", City: "Hamburg", CountryCode: "DE",
+		Formatted: "Jungfernstieg 1, 20095 Hamburg"}, geocoding.Address)
+	assert.Equal(t, &api.Location{Lat: 53.5512, Lng: 9.9936}, geocoding.Location)
+	assert.Equal(t, string(GooglePlacesProviderLabel), geocoding.Provider)
+	require.Len(t, geocoding.Places, 1)
+	assert.Equal(t, "cafe-1", geocoding.Places[0].ID)
+}
+
+func TestUnitGoogleReverseGeocodeNearbySearchFailure(t *testing.T) {
+	geocodeResults := `{"status": "OK", "results": [
+		{"formatted_address": "Jungfernstieg 1, 20095 Hamburg", "geometry": {"location": {"lat": 53.5512, "lng": 9.9936}}}]}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/maps/api/geocode/json":
+			w.Write([]byte(geocodeResults))
+		case "/maps/api/place/nearbysearch/json":
+			w.Write([]byte(`{"status": "OVER_QUERY_LIMIT"}`))
+		}
+	}))
+	defer server.Close()
+	client, err := maps.NewClient(maps.WithAPIKey("key"), maps.WithBaseURL(server.URL))
+	require.NoError(t, err)
+	g := &googlePlacesProvider{providerConfig: &ProviderConfig{}, mapsClient: client}
+
+	// the address is kept
+	geocoding, err := g.ReverseGeocode(context.Background(), ReverseGeocodeRequest{Location: Location{Lat: 53.5511, Lng: 9.9937}})
+	require.NoError(t, err)
+	assert.Equal(t, "Jungfernstieg 1, 20095 Hamburg", geocoding.Address.Formatted)
+	assert.Empty(t, geocoding.Places)
+
+	// nothing to return without address
+	geocodeResults = `{"status": "ZERO_RESULTS", "results": []}`
+	_, err = g.ReverseGeocode(context.Background(), ReverseGeocodeRequest{Location: Location{Lat: 53.5511, Lng: 9.9937}})
+	assert.Equal(t, QuotaErrorKind, KindOf(err))
+}
+
+func TestUnitGoogleGeocode(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/maps/api/geocode/json", r.URL.Path)
+		assert.Equal(t, "Jungfernstieg 1, Hamburg", r.URL.Query().Get("address"))
+		w.Write([]byte(`{"status": "OK", "results": [
+			{"formatted_address": "Jungfernstieg 1, 20095 Hamburg, Germany", "types": ["street_address"],
+				"geometry": {"location": {"lat": 53.5512, "lng": 9.9936}, "location_type": "ROOFTOP"},
+				"address_components": [
+					{"long_name": "1", "short_name": "1", "types": ["street_number"]},
+					{"long_name": "Jungfernstieg", "short_name": "Jungfernstieg", "types": ["route"]},
+					{"long_name": "Hamburg", "short_name": "HH", "types": ["locality", "political"]},
+					{"long_name": "Hamburg", "short_name": "HH", "types": ["administrative_area_level_1", "political"]},
+					{"long_name": "Germany", "short_name": "DE", "types": ["country", "political"]},
+					{"long_name": "20095", "short_name": "20095", "types": ["postal_code"]}]},
+			{"formatted_address": "Jungfernstieg, Kiel, Germany", "types": ["route"], "partial_match": true,
+				"geometry": {"location": {"lat": 54.32, "lng": 10.13}, "location_type": "GEOMETRIC_CENTER"}}]}`))
+	}))
+	defer server.Close()
+	client, err := maps.NewClient(maps.WithAPIKey("key"), maps.WithBaseURL(server.URL))
+	require.NoError(t, err)
+	g := &googlePlacesProvider{providerConfig: &ProviderConfig{}, mapsClient: client}
+
+	results, err := g.Geocode(context.Background(), GeocodeRequest{Address: "Jungfernstieg 1, Hamburg"})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.Equal(t, api.Address{
+		Street:      "Jungfernstieg",
+		HouseNumber: "1",
+		PostalCode:  "20095",
+		City:        "Hamburg",
+		Region:      "Hamburg",
+		CountryCode: "DE",
+		Formatted:   "Jungfernstieg 1, 20095 Hamburg, Germany",
+	}, results[0].Address)
+	assert.Equal(t, api.Location{Lat: 53.5512, Lng: 9.9936}, results[0].Location)
+	assert.Equal(t, api.PrecisionRooftop, results[0].Precision)
+	assert.Equal(t, 1.0, results[0].Confidence)
+	assert.Equal(t, api.PrecisionStreet, results[1].Precision)
+	assert.InDelta(t, 0.525, results[1].Confidence, 1e-9) // partial match
+}
+
+func TestUnitGooglePrecision(t *testing.T) {
+	precision := func(locationType string, types ...string) string {
+		return googlePrecision(maps.GeocodingResult{Types: types, Geometry: maps.AddressGeometry{LocationType: locationType}})
+	}
+	assert.Equal(t, api.PrecisionRooftop, precision("ROOFTOP", "premise"))
+	assert.Equal(t, api.PrecisionInterpolated, precision("RANGE_INTERPOLATED", "street_address"))
+	assert.Equal(t, api.PrecisionPostalCode, precision("APPROXIMATE", "postal_code"))
+	assert.Equal(t, api.PrecisionCity, precision("APPROXIMATE", "locality", "political"))
+	assert.Equal(t, api.PrecisionRegion, precision("APPROXIMATE", "administrative_area_level_1", "political"))
+	assert.Equal(t, api.PrecisionCountry, precision("APPROXIMATE", "country", "political"))
+	assert.Equal(t, api.PrecisionApproximate, precision("APPROXIMATE", "natural_feature"))
+}
+
+func TestUnitGoogleCheckHealth(t *testing.T) {
+	status := "OK"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// an unbilled details request, only the place id
+		assert.Equal(t, "/maps/api/place/details/json", r.URL.Path)
+		assert.Equal(t, "place_id", r.URL.Query().Get("fields"))
+		w.Write([]byte(`{"status": "` + status + `", "result": {"place_id": "` + healthProbePlaceID + `"}}`))
+	}))
+	defer server.Close()
+	client, err := maps.NewClient(maps.WithAPIKey("key"), maps.WithBaseURL(server.URL))
+	require.NoError(t, err)
+	g := &googlePlacesProvider{providerConfig: &ProviderConfig{}, mapsClient: client}
+
+	assert.NoError(t, g.CheckHealth(context.Background()))
+	status = "NOT_FOUND" // the probe place is gone, google still answered
+	assert.NoError(t, g.CheckHealth(context.Background()))
+	status = "REQUEST_DENIED"
+	assert.Equal(t, AuthErrorKind, KindOf(g.CheckHealth(context.Background())))
 }
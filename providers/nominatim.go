@@ -0,0 +1,244 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/codeselim/go-webservice-places-provider/api"
+	"github.com/codeselim/go-webservice-places-provider/config"
+	"github.com/codeselim/go-webservice-places-provider/log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+ * Geocoding provider: Nominatim (OpenStreetMap), or any backend exposing its API (self-hosted Nominatim, LocationIQ...)
+ * API ref: https://nominatim.org/release-docs/latest/api/Search/ and https://nominatim.org/release-docs/latest/api/Reverse/
+ * Provides the forward and reverse geocoding only: it runs no places search. The public instance allows a request per
+ * second, see https://operations.osmfoundation.org/policies/nominatim/
+ */
+
+// the OpenStreetMap categories of the features that are establishments, as opposed to roads, buildings or boundaries
+var nominatimEstablishmentCategories = map[string]bool{"amenity": true, "shop": true, "tourism": true, "leisure": true}
+
+type nominatimProvider struct {
+	providerLabel  ProviderLabel
+	providerConfig *ProviderConfig
+	baseURL        string
+	httpClient     *http.Client
+}
+
+// nominatimPlace is a search or reverse geocoding result of the jsonv2 format
+type nominatimPlace struct {
+	OsmType     string            `json:"osm_type"`
+	OsmID       int64             `json:"osm_id"`
+	Lat         string            `json:"lat"`
+	Lon         string            `json:"lon"`
+	Category    string            `json:"category"`
+	Type        string            `json:"type"`
+	Name        string            `json:"name"`
+	DisplayName string            `json:"display_name"`
+	PlaceRank   int               `json:"place_rank"`  // 30 for a building, 26 for a street, 16 for a city, 4 for a country
+	AddressType string            `json:"addresstype"` // e.g. postcode
+	Address     map[string]string `json:"address"`     // with addressdetails=1
+	Error       string            `json:"error"`       // e.g. "Unable to geocode" in the middle of the ocean
+}
+
+// Constructor, baseURL is the root of the API, e.g. https://nominatim.openstreetmap.org
+func NewNominatimProvider(baseURL string, providerConfig *ProviderConfig) Provider {
+	if providerConfig == nil {
+		log.GetLogger().Panic("ProviderConfig should be provided")
+	}
+
+	return &nominatimProvider{
+		providerLabel:  NominatimLabel,
+		providerConfig: providerConfig,
+		baseURL:        strings.TrimSuffix(baseURL, "/"),
+		httpClient:     getHttpClientFromConfig(providerConfig),
+	}
+}
+
+func (n *nominatimProvider) GetPlacesByQuery(ctx context.Context, request PlaceSearchRequest) (api.Places, error) {
+	return api.Places{}, errors.New("nominatim: the places search is not supported")
+}
+
+func (n *nominatimProvider) GetPlaceDetails(ctx context.Context, placeId string) (api.PlaceDetails, error) {
+	return api.PlaceDetails{}, errors.New("nominatim: the place details are not supported")
+}
+
+func (n *nominatimProvider) GetProviderLabel() ProviderLabel {
+	return n.providerLabel
+}
+
+func (n *nominatimProvider) GetSearchModes() []SearchMode {
+	return []SearchMode{}
+}
+
+func (n *nominatimProvider) GetCacheTTL() time.Duration {
+	return getCacheTTLFromConfig(n.providerConfig)
+}
+
+// Geocode resolves a free-form address with the search API, the best matches first
+func (n *nominatimProvider) Geocode(ctx context.Context, request GeocodeRequest) (api.GeocodingResults, error) {
+	params := url.Values{
+		"format":         {"jsonv2"},
+		"q":              {request.Address},
+		"addressdetails": {"1"},
+		"limit":          {strconv.Itoa(config.MaxGeocodingResults)},
+	}
+	places := []nominatimPlace{}
+	if err := n.getJSON(ctx, "/search", params, request.Language, &places); err != nil {
+		return api.GeocodingResults{}, err
+	}
+	results := api.GeocodingResults{}
+	for _, place := range places {
+		lat, errLat := strconv.ParseFloat(place.Lat, 64)
+		lng, errLng := strconv.ParseFloat(place.Lon, 64)
+		if errLat != nil || errLng != nil {
+			return api.GeocodingResults{}, fmt.Errorf("nominatim: malformed location %s,%s", place.Lat, place.Lon)
+		}
+		precision := nominatimPrecision(place)
+		results = append(results, api.GeocodingResult{
+			Address:    nominatimAddress(place),
+			Location:   api.Location{Lat: lat, Lng: lng},
+			Provider:   string(NominatimLabel),
+			Precision:  precision,
+			Confidence: geocodeConfidence(precision, false),
+		})
+	}
+	return results, nil
+}
+
+// ReverseGeocode returns the feature at the location: its address, and the feature itself when it is an establishment
+func (n *nominatimProvider) ReverseGeocode(ctx context.Context, request ReverseGeocodeRequest) (api.ReverseGeocoding, error) {
+	geocoding := api.ReverseGeocoding{Places: api.Places{}}
+	params := url.Values{
+		"format":         {"jsonv2"},
+		"lat":            {strconv.FormatFloat(request.Location.Lat, 'f', -1, 64)},
+		"lon":            {strconv.FormatFloat(request.Location.Lng, 'f', -1, 64)},
+		"addressdetails": {"1"},
+	}
+	place := nominatimPlace{}
+	if err := n.getJSON(ctx, "/reverse", params, request.Language, &place); err != nil {
+		return geocoding, err
+	}
+	if place.Error != "" {
+		return geocoding, nil // nothing at the location
+	}
+	lat, errLat := strconv.ParseFloat(place.Lat, 64)
+	lng, errLng := strconv.ParseFloat(place.Lon, 64)
+	if errLat != nil || errLng != nil {
+		return geocoding, fmt.Errorf("nominatim: malformed location %s,%s", place.Lat, place.Lon)
+	}
+	location := &api.Location{Lat: lat, Lng: lng}
+	address := nominatimAddress(place)
+	geocoding.Address = &address
+	geocoding.Location = location
+	geocoding.Provider = string(NominatimLabel)
+	if place.Name != "" && nominatimEstablishmentCategories[place.Category] {
+		geocoding.Places = append(geocoding.Places, nominatimPlaceToApiPlaceConverter(place, location))
+	}
+	return geocoding, nil
+}
+
+// getJSON decodes the response of an API path into out
+func (n *nominatimProvider) getJSON(ctx context.Context, path string, params url.Values, language string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, n.baseURL+path+"?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", config.NominatimUserAgent)
+	if language == "" {
+		language = n.providerConfig.Language
+	}
+	if language != "" {
+		req.Header.Set("Accept-Language", language)
+	}
+	resp, err := n.httpClient.Do(req)
+	if err != nil {
+		return classifyError(NominatimLabel, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("nominatim: %s returned %s", path, resp.Status)
+		return &ProviderError{Provider: NominatimLabel, Kind: statusErrorKind(resp.StatusCode), Err: err}
+	}
+	return classifyError(NominatimLabel, json.NewDecoder(resp.Body).Decode(out))
+}
+
+// Converter Nominatim Models -> API Models
+func nominatimPlaceToApiPlaceConverter(place nominatimPlace, location *api.Location) api.Place {
+	address := nominatimAddress(place)
+	return api.Place{
+		ID:                fmt.Sprintf("%s/%d", place.OsmType, place.OsmID),
+		Provider:          string(NominatimLabel),
+		Name:              place.Name,
+		Location:          location,
+		Address:           place.DisplayName,
+		URI:               fmt.Sprintf("https://www.openstreetmap.org/%s/%d", place.OsmType, place.OsmID),
+		Categories:        taxonomy.canonicalCategories(NominatimLabel, []string{place.Category + "/" + place.Type}, nil),
+		StructuredAddress: &address,
+	}
+}
+
+// nominatimAddress returns the structured address of the address details
+func nominatimAddress(place nominatimPlace) api.Address {
+	address := api.Address{
+		Street:      place.Address["road"],
+		HouseNumber: place.Address["house_number"],
+		PostalCode:  place.Address["postcode"],
+		Region:      place.Address["state"],
+		CountryCode: strings.ToUpper(place.Address["country_code"]),
+	}
+	// the city is named after its size
+	for _, key := range []string{"city", "town", "village", "municipality"} {
+		if city := place.Address[key]; city != "" {
+			address.City = city
+			break
+		}
+	}
+	// the display name lists all the enclosing areas (suburb, district, county...), too long for a display line
+	if address.Formatted = FormatAddress(address); address.Formatted == "" {
+		address.Formatted = place.DisplayName
+	}
+	return address
+}
+
+// nominatimPrecision returns the precision of a result from its place rank,
+// see https://nominatim.org/release-docs/latest/customize/Ranking/
+func nominatimPrecision(place nominatimPlace) string {
+	switch {
+	case place.AddressType == "postcode":
+		return api.PrecisionPostalCode
+	case place.PlaceRank >= 30:
+		return api.PrecisionRooftop
+	case place.PlaceRank >= 26:
+		return api.PrecisionStreet
+	case place.PlaceRank >= 13:
+		return api.PrecisionCity
+	case place.PlaceRank >= 5:
+		return api.PrecisionRegion
+	case place.PlaceRank == 4:
+		return api.PrecisionCountry
+	}
+	return api.PrecisionApproximate
+}
+
+// Health probe: the status endpoint, it checks the database without geocoding anything
+func (n *nominatimProvider) CheckHealth(ctx context.Context) error {
+	status := struct {
+		Status  int    `json:"status"`
+		Message string `json:"message"`
+	}{}
+	if err := n.getJSON(ctx, "/status", url.Values{"format": {"json"}}, "", &status); err != nil {
+		return err
+	}
+	if status.Status != 0 {
+		return &ProviderError{Provider: NominatimLabel, Kind: UpstreamErrorKind, Err: errors.New("nominatim: " + status.Message)}
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package providers
+
+import (
+	"context"
+	"github.com/codeselim/go-webservice-places-provider/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newTestNominatimProvider(t *testing.T, handler http.HandlerFunc) *nominatimProvider {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return NewNominatimProvider(server.URL+"/", &ProviderConfig{Language: "en"}).(*nominatimProvider)
+}
+
+func TestUnitNominatimReverseGeocode(t *testing.T) {
+	n := newTestNominatimProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/reverse", r.URL.Path)
+		assert.Equal(t, "jsonv2", r.URL.Query().Get("format"))
+		assert.Equal(t, "53.5511", r.URL.Query().Get("lat"))
+		assert.Equal(t, "9.9937", r.URL.Query().Get("lon"))
+		assert.Equal(t, "de", r.Header.Get("Accept-Language"))
+		assert.NotEmpty(t, r.Header.Get("User-Agent"))
+		assert.Equal(t, "1", r.URL.Query().Get("addressdetails"))
+		w.Write([]byte(`{"osm_type": "node", "osm_id": 42, "lat": "53.5512", "lon": "9.9936", "category": "amenity",
+			"type": "cafe", "name": "Café Paris", "display_name": "Café Paris, Rathausstraße 4, 20095 Hamburg",
+			"address": {"road": "Rathausstraße", "house_number": "4", "postcode": "20095", "city": "Hamburg", "country_code": "de"}}`))
+	})
+
+	geocoding, err := n.ReverseGeocode(context.Background(), ReverseGeocodeRequest{Location: Location{Lat: 53.5511, Lng: 9.9937}, Language: "de"})
+	require.NoError(t, err)
+	assert.Equal(t, &api.Address{Street: "Rathausstraße", HouseNumber: "4", PostalCode: "20095", City: "Hamburg", CountryCode: "DE",
+		Formatted: "Rathausstraße 4, 20095 Hamburg"}, geocoding.Address)
+	assert.Equal(t, &api.Location{Lat: 53.5512, Lng: 9.9936}, geocoding.Location)
+	assert.Equal(t, string(NominatimLabel), geocoding.Provider)
+	require.Len(t, geocoding.Places, 1)
+	assert.Equal(t, "node/42", geocoding.Places[0].ID)
+	assert.Equal(t, "Café Paris", geocoding.Places[0].Name)
+	assert.Equal(t, "https://www.openstreetmap.org/node/42", geocoding.Places[0].URI)
+	assert.Equal(t, []string{"cafe"}, geocoding.Places[0].Categories)
+	assert.Equal(t, &api.Address{Street: "Rathausstraße", HouseNumber: "4", PostalCode: "20095", City: "Hamburg", CountryCode: "DE",
+		Formatted: "Rathausstraße 4, 20095 Hamburg"}, geocoding.Places[0].StructuredAddress)
+}
+
+func TestUnitNominatimReverseGeocodeAddressOnly(t *testing.T) {
+	n := newTestNominatimProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "en", r.Header.Get("Accept-Language")) // the provider language
+		w.Write([]byte(`{"osm_type": "way", "osm_id": 7, "lat": "53.5", "lon": "9.9", "category": "highway",
+			"type": "residential", "name": "Jungfernstieg", "display_name": "Jungfernstieg, 20095 Hamburg"}`))
+	})
+	geocoding, err := n.ReverseGeocode(context.Background(), ReverseGeocodeRequest{Location: Location{Lat: 53.5, Lng: 9.9}})
+	require.NoError(t, err)
+	// no address details, the display name
+	assert.Equal(t, &api.Address{Formatted: "Jungfernstieg, 20095 Hamburg"}, geocoding.Address)
+	assert.Empty(t, geocoding.Places)
+
+	// nothing at the location
+	n = newTestNominatimProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"error": "Unable to geocode"}`))
+	})
+	geocoding, err = n.ReverseGeocode(context.Background(), ReverseGeocodeRequest{Location: Location{Lat: 0, Lng: -30}})
+	require.NoError(t, err)
+	assert.Nil(t, geocoding.Address)
+	assert.Nil(t, geocoding.Location)
+	assert.NotNil(t, geocoding.Places)
+
+	n = newTestNominatimProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	_, err = n.ReverseGeocode(context.Background(), ReverseGeocodeRequest{Location: Location{Lat: 53.5, Lng: 9.9}})
+	assert.Error(t, err)
+	assert.Equal(t, QuotaErrorKind, KindOf(err))
+}
+
+func TestUnitNominatimGeocode(t *testing.T) {
+	n := newTestNominatimProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/search", r.URL.Path)
+		assert.Equal(t, "Jungfernstieg 1, Hamburg", r.URL.Query().Get("q"))
+		assert.Equal(t, "1", r.URL.Query().Get("addressdetails"))
+		w.Write([]byte(`[
+			{"lat": "53.5512", "lon": "9.9936", "place_rank": 30, "addresstype": "building",
+				"display_name": "1, Jungfernstieg, Hamburg, 20095, Deutschland",
+				"address": {"house_number": "1", "road": "Jungfernstieg", "city": "Hamburg", "state": "Hamburg",
+					"postcode": "20095", "country_code": "de"}},
+			{"lat": "53.55", "lon": "10.0", "place_rank": 21, "addresstype": "postcode", "display_name": "20095, Hamburg",
+				"address": {"postcode": "20095", "town": "Hamburg", "country_code": "de"}}]`))
+	})
+
+	results, err := n.Geocode(context.Background(), GeocodeRequest{Address: "Jungfernstieg 1, Hamburg"})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.Equal(t, api.Address{
+		Street:      "Jungfernstieg",
+		HouseNumber: "1",
+		PostalCode:  "20095",
+		City:        "Hamburg",
+		Region:      "Hamburg",
+		CountryCode: "DE",
+		Formatted:   "Jungfernstieg 1, 20095 Hamburg",
+	}, results[0].Address)
+	assert.Equal(t, api.Location{Lat: 53.5512, Lng: 9.9936}, results[0].Location)
+	assert.Equal(t, string(NominatimLabel), results[0].Provider)
+	assert.Equal(t, api.PrecisionRooftop, results[0].Precision)
+	assert.Equal(t, api.PrecisionPostalCode, results[1].Precision)
+	assert.Equal(t, "Hamburg", results[1].Address.City)
+}
+
+func TestUnitNominatimCheckHealth(t *testing.T) {
+	n := newTestNominatimProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/status", r.URL.Path)
+		w.Write([]byte(`{"status": 0, "message": "OK"}`))
+	})
+	assert.NoError(t, n.CheckHealth(context.Background()))
+
+	n = newTestNominatimProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"status": 700, "message": "Database connection failed"}`))
+	})
+	assert.Error(t, n.CheckHealth(context.Background()))
+}
+
+func TestUnitNominatimSearchNotSupported(t *testing.T) {
+	n := NewNominatimProvider("http://localhost", &ProviderConfig{})
+	assert.Empty(t, n.GetSearchModes())
+	assert.False(t, SupportsMode(n, AutocompleteMode))
+	_, err := n.GetPlacesByQuery(context.Background(), PlaceSearchRequest{InputString: "pizza"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,79 @@
+package providers
+
+import (
+	"github.com/codeselim/go-webservice-places-provider/api"
+	"github.com/codeselim/go-webservice-places-provider/config"
+	"sync"
+	"time"
+)
+
+/**
+ * Cache of the places locations looked up for the results without coordinates (Google autocomplete predictions), so
+ * the area searches can filter them without a lookup per keystroke. Locations expire after config.PlaceLocationCacheTTL.
+ */
+
+type cachedPlaceLocation struct {
+	location api.Location
+	expires  time.Time
+}
+
+type placeLocations struct {
+	mu        sync.Mutex
+	locations map[string]cachedPlaceLocation
+	ttl       time.Duration
+	maxSize   int
+	lastSweep time.Time
+	now       func() time.Time // overridden by the tests
+}
+
+func newPlaceLocations() *placeLocations {
+	return &placeLocations{
+		locations: map[string]cachedPlaceLocation{},
+		ttl:       config.PlaceLocationCacheTTL,
+		maxSize:   config.MaxCachedPlaceLocations,
+		now:       time.Now,
+	}
+}
+
+// get returns the cached location of a place
+func (c *placeLocations) get(placeID string) (api.Location, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cached, ok := c.locations[placeID]
+	if !ok || c.now().After(cached.expires) {
+		return api.Location{}, false
+	}
+	return cached.location, true
+}
+
+// set caches the location of a place, unless the cache is full
+func (c *placeLocations) set(placeID string, location api.Location) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	c.sweep(now)
+	if _, ok := c.locations[placeID]; !ok && len(c.locations) >= c.maxSize {
+		return
+	}
+	c.locations[placeID] = cachedPlaceLocation{location: location, expires: now.Add(c.ttl)}
+}
+
+// FlushCache drops the cached locations, the next area searches look them up again
+func (c *placeLocations) FlushCache() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.locations = map[string]cachedPlaceLocation{}
+}
+
+// sweep drops the expired locations, at most once per ttl
+func (c *placeLocations) sweep(now time.Time) {
+	if now.Sub(c.lastSweep) < c.ttl {
+		return
+	}
+	c.lastSweep = now
+	for id, cached := range c.locations {
+		if now.After(cached.expires) {
+			delete(c.locations, id)
+		}
+	}
+}
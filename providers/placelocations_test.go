@@ -0,0 +1,41 @@
+package providers
+
+import (
+	"github.com/codeselim/go-webservice-places-provider/api"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestUnitPlaceLocations(t *testing.T) {
+	now := time.Now()
+	locations := newPlaceLocations()
+	locations.now = func() time.Time { return now }
+	locations.maxSize = 2
+
+	_, ok := locations.get("place-1")
+	assert.False(t, ok)
+	locations.set("place-1", api.Location{Lat: 53.5, Lng: 9.9})
+	location, ok := locations.get("place-1")
+	assert.True(t, ok)
+	assert.Equal(t, api.Location{Lat: 53.5, Lng: 9.9}, location)
+
+	// a full cache doesn't cache the new places
+	locations.set("place-2", api.Location{})
+	locations.set("place-3", api.Location{})
+	_, ok = locations.get("place-3")
+	assert.False(t, ok)
+
+	// the locations expire, and are swept
+	now = now.Add(locations.ttl + time.Second)
+	_, ok = locations.get("place-1")
+	assert.False(t, ok)
+	locations.set("place-3", api.Location{})
+	_, ok = locations.get("place-3")
+	assert.True(t, ok)
+	assert.Len(t, locations.locations, 1)
+
+	locations.FlushCache()
+	_, ok = locations.get("place-3")
+	assert.False(t, ok)
+}
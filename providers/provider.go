@@ -5,6 +5,7 @@ import (
 	"github.com/codeselim/go-webservice-places-provider/api"
 	"github.com/codeselim/go-webservice-places-provider/config"
 	"net/http"
+	"net/url"
 	"time"
 )
 
@@ -13,19 +14,53 @@ type ProviderLabel string
 const (
 	GooglePlacesProviderLabel = ProviderLabel("GOOGLE_PLACES")
 	FoursquareLabel           = ProviderLabel("FOURSQUARE")
+	NominatimLabel            = ProviderLabel("NOMINATIM")
 	// ...
 )
 
+// SearchMode is the kind of search run by the providers
+type SearchMode string
+
+const (
+	AutocompleteMode = SearchMode("autocomplete") // predictions of a partial input, the default
+	TextMode         = SearchMode("text")         // full text search, e.g. "pizza in Hamburg"
+	NearbyMode       = SearchMode("nearby")       // places around a location, the text is optional
+)
+
+var searchModes = []SearchMode{AutocompleteMode, TextMode, NearbyMode}
+
+// ParseSearchMode returns the search mode of its name, autocomplete when empty
+func ParseSearchMode(name string) (SearchMode, bool) {
+	if name == "" {
+		return AutocompleteMode, true
+	}
+	for _, mode := range searchModes {
+		if string(mode) == name {
+			return mode, true
+		}
+	}
+	return "", false
+}
+
 type ProviderConfig struct {
 	Timeout      time.Duration //configures a timeout to short-circuits long-running connections
 	Language     string
-	SearchRadius int //can be also provided as query param instead of internal config
+	SearchRadius int           //km, can be also provided as query param instead of internal config
+	CacheTTL     time.Duration // how long clients and CDNs can cache the results, see the provider terms of use
 	//... extend following requirements
 }
 
 type PlaceSearchRequest struct {
-	InputString string
-	Location    *Location
+	InputString  string
+	Location     *Location
+	Radius       int        // km, overrides the provider search radius when set
+	SessionID    string     // client autocomplete session id, mapped to a session token by the providers billing per session
+	Mode         SearchMode // empty: autocomplete
+	PageToken    string     // upstream page to return, for the Paginator providers. Empty for the first page
+	Language     string     // primary language subtag of the results, e.g. "de". Empty: the provider language
+	Categories   []string   // search categories, the places of any of them are returned. Empty: all the places
+	Area         *Area      // the places are searched in the area, over the location and radius. Nil: no area
+	radiusMeters int        // overrides the radius for the internal searches finer than a kilometer, e.g. the reverse geocoding
 }
 
 type Location struct {
@@ -37,9 +72,85 @@ type Provider interface {
 	GetPlacesByQuery(ctx context.Context, request PlaceSearchRequest) (api.Places, error)
 	GetPlaceDetails(ctx context.Context, placeId string) (api.PlaceDetails, error)
 	GetProviderLabel() ProviderLabel
+	GetSearchModes() []SearchMode // the search modes the provider supports
 	//... extend interface
 }
 
+// placeURI returns the uri of the details of a place, served by the places details endpoint
+func placeURI(label ProviderLabel, placeId string) string {
+	return "/api/v1/places/" + string(label) + "/" + url.PathEscape(placeId)
+}
+
+// SupportsMode tells if a provider supports a search mode, the empty mode is autocomplete
+func SupportsMode(provider Provider, mode SearchMode) bool {
+	if mode == "" {
+		mode = AutocompleteMode
+	}
+	for _, supported := range provider.GetSearchModes() {
+		if supported == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// Paginator is an optional interface for providers returning their results in pages. The next page token is empty
+// on the last page. Providers not implementing it return a single page
+type Paginator interface {
+	GetPlacesPage(ctx context.Context, request PlaceSearchRequest) (places api.Places, nextPageToken string, err error)
+}
+
+// HealthChecker is an optional interface a Provider can implement to expose a cheap
+// health probe against its upstream API. It is used by the readiness endpoint.
+type HealthChecker interface {
+	CheckHealth(ctx context.Context) error
+}
+
+// CircuitStateReporter is an optional interface for providers wrapped by a circuit breaker.
+// The reported state is only informative and shown on the readiness endpoint.
+type CircuitStateReporter interface {
+	GetCircuitState() string
+}
+
+// CacheTTLReporter is an optional interface for providers whose results can be cached by the clients and CDNs.
+// Results of providers not implementing it are not cacheable.
+type CacheTTLReporter interface {
+	GetCacheTTL() time.Duration
+}
+
+// Cache is an internal cache of a provider, flushable from the admin server
+type Cache interface {
+	FlushCache()
+}
+
+// CacheHolder is an optional interface for providers holding internal caches, by cache name
+type CacheHolder interface {
+	GetCaches() map[string]Cache
+}
+
+// ReverseGeocodeRequest is a location to resolve to its nearest address
+type ReverseGeocodeRequest struct {
+	Location Location
+	Language string // primary language subtag of the address, e.g. "de". Empty: the provider language
+}
+
+// ReverseGeocoder is an optional interface for providers resolving a location to its nearest address and the
+// establishments around it. Geocoding only providers return no search mode
+type ReverseGeocoder interface {
+	ReverseGeocode(ctx context.Context, request ReverseGeocodeRequest) (api.ReverseGeocoding, error)
+}
+
+// GeocodeRequest is a free-form address to resolve, e.g. "Jungfernstieg 1, Hamburg"
+type GeocodeRequest struct {
+	Address  string
+	Language string // primary language subtag of the addresses, e.g. "de". Empty: the provider language
+}
+
+// Geocoder is an optional interface for providers resolving free-form addresses to locations, the best matches first
+type Geocoder interface {
+	Geocode(ctx context.Context, request GeocodeRequest) (api.GeocodingResults, error)
+}
+
 //helper functions
 func getHttpClientFromConfig(providerConfig *ProviderConfig) *http.Client {
 	timeout := config.DefaultProviderTimeout
@@ -53,8 +164,31 @@ func getHttpClientFromConfig(providerConfig *ProviderConfig) *http.Client {
 
 func getSearchRadiusFromConfig(providerConfig *ProviderConfig) int {
 	radius := config.DefaultSearchRadius
-	if providerConfig.SearchRadius != 0 && providerConfig.SearchRadius < config.MaxAllowedSearchRadius {
+	if providerConfig.SearchRadius != 0 && providerConfig.SearchRadius <= config.MaxAllowedSearchRadius {
 		radius = providerConfig.SearchRadius
 	}
 	return radius
 }
+
+// the radius of the request wins over the provider one, within the same bounds
+func getSearchRadius(providerConfig *ProviderConfig, request PlaceSearchRequest) int {
+	if request.Radius > 0 && request.Radius <= config.MaxAllowedSearchRadius {
+		return request.Radius
+	}
+	return getSearchRadiusFromConfig(providerConfig)
+}
+
+// getSearchRadiusMeters returns the search radius in meters, the unit of the providers APIs
+func getSearchRadiusMeters(providerConfig *ProviderConfig, request PlaceSearchRequest) int {
+	if request.radiusMeters > 0 {
+		return request.radiusMeters
+	}
+	return getSearchRadius(providerConfig, request) * 1000
+}
+
+func getCacheTTLFromConfig(providerConfig *ProviderConfig) time.Duration {
+	if providerConfig.CacheTTL > 0 {
+		return providerConfig.CacheTTL
+	}
+	return config.DefaultProviderCacheTTL
+}
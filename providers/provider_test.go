@@ -34,3 +34,46 @@ func TestUnitgetSearchRadiusFromConfig(t *testing.T) {
 	assert.Equal(t, 10, radius2)
 	assert.Equal(t, config.DefaultSearchRadius, radius3)
 }
+
+func TestUnitgetSearchRadius(t *testing.T) {
+	providerConfig := ProviderConfig{SearchRadius: 10}
+
+	assert.Equal(t, 10, getSearchRadius(&providerConfig, PlaceSearchRequest{}))
+	assert.Equal(t, 5, getSearchRadius(&providerConfig, PlaceSearchRequest{Radius: 5}))
+	assert.Equal(t, 10, getSearchRadius(&providerConfig, PlaceSearchRequest{Radius: config.MaxAllowedSearchRadius + 1}))
+}
+
+func TestUnitgetSearchRadiusMeters(t *testing.T) {
+	assert.Equal(t, config.DefaultSearchRadius*1000, getSearchRadiusMeters(&ProviderConfig{}, PlaceSearchRequest{}))
+	assert.Equal(t, 5000, getSearchRadiusMeters(&ProviderConfig{}, PlaceSearchRequest{Radius: 5}))
+	assert.Equal(t, config.MaxAreaSearchRadius, getSearchRadiusMeters(&ProviderConfig{}, PlaceSearchRequest{Radius: config.MaxAllowedSearchRadius}))
+	assert.Equal(t, 50, getSearchRadiusMeters(&ProviderConfig{}, PlaceSearchRequest{Radius: 5, radiusMeters: 50}))
+}
+
+func TestUnitParseSearchMode(t *testing.T) {
+	mode, ok := ParseSearchMode("")
+	assert.True(t, ok)
+	assert.Equal(t, AutocompleteMode, mode)
+	mode, ok = ParseSearchMode("nearby")
+	assert.True(t, ok)
+	assert.Equal(t, NearbyMode, mode)
+	_, ok = ParseSearchMode("Nearby")
+	assert.False(t, ok)
+}
+
+func TestUnitSupportsMode(t *testing.T) {
+	provider := NewFoursquareProvider(&ProviderConfig{})
+	assert.True(t, SupportsMode(provider, ""))
+	assert.True(t, SupportsMode(provider, TextMode))
+	assert.False(t, SupportsMode(provider, SearchMode("reverse")))
+}
+
+func TestUnitParseSearchCategory(t *testing.T) {
+	category, ok := ParseSearchCategory(" Car_Rental ")
+	assert.True(t, ok)
+	assert.Equal(t, "car_rental", category)
+	_, ok = ParseSearchCategory("casino")
+	assert.False(t, ok)
+	_, ok = ParseSearchCategory("")
+	assert.False(t, ok)
+}
@@ -0,0 +1,122 @@
+package providers
+
+import (
+	"context"
+	"github.com/codeselim/go-webservice-places-provider/config"
+	"github.com/google/uuid"
+	"sync"
+	"time"
+)
+
+/**
+ * Autocomplete sessions of the providers billing per session (Google Places): the keystrokes of a client session
+ * share a session token, and the session is concluded by a details call for one of its predictions.
+ * The clients send their own session id, mapped here to the provider session token. Sessions expire after
+ * config.AutocompleteSessionTTL without keystrokes.
+ */
+
+// WithSessionID returns a copy of ctx carrying the client session id, for the details calls which have no request
+func WithSessionID(ctx context.Context, sessionID string) context.Context {
+	return context.WithValue(ctx, config.ContextKeySessionID, sessionID)
+}
+
+// GetSessionID returns the client session id of the context, empty without session
+func GetSessionID(ctx context.Context) string {
+	sessionID, _ := ctx.Value(config.ContextKeySessionID).(string)
+	return sessionID
+}
+
+type autocompleteSession struct {
+	token       uuid.UUID
+	lastUsed    time.Time
+	predictions map[string]bool // place ids of the last results, a details call for one of them concludes the session
+}
+
+type autocompleteSessions struct {
+	mu        sync.Mutex
+	sessions  map[string]*autocompleteSession
+	ttl       time.Duration
+	maxSize   int
+	lastSweep time.Time
+	now       func() time.Time // overridden by the tests
+}
+
+func newAutocompleteSessions() *autocompleteSessions {
+	return &autocompleteSessions{
+		sessions: map[string]*autocompleteSession{},
+		ttl:      config.AutocompleteSessionTTL,
+		maxSize:  config.MaxAutocompleteSessions,
+		now:      time.Now,
+	}
+}
+
+// token returns the session token of a client session, a new session starts when it is unknown or expired.
+// No token is returned without session id, or when too many sessions are in progress
+func (s *autocompleteSessions) token(sessionID string) (uuid.UUID, bool) {
+	if sessionID == "" {
+		return uuid.UUID{}, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	s.sweep(now)
+	session, ok := s.sessions[sessionID]
+	if !ok || now.Sub(session.lastUsed) > s.ttl {
+		if !ok && len(s.sessions) >= s.maxSize {
+			return uuid.UUID{}, false
+		}
+		session = &autocompleteSession{token: uuid.New()}
+		s.sessions[sessionID] = session
+	}
+	session.lastUsed = now
+	return session.token, true
+}
+
+// predicted records the place ids of the last results of a session
+func (s *autocompleteSessions) predicted(sessionID string, token uuid.UUID, placeIDs []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[sessionID]
+	if !ok || session.token != token {
+		return // concluded or renewed meanwhile
+	}
+	session.predictions = make(map[string]bool, len(placeIDs))
+	for _, id := range placeIDs {
+		session.predictions[id] = true
+	}
+}
+
+// end concludes the session when the place is one of its predictions, and returns its token for the details call
+func (s *autocompleteSessions) end(sessionID string, placeID string) (uuid.UUID, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[sessionID]
+	if !ok || !session.predictions[placeID] {
+		return uuid.UUID{}, false
+	}
+	delete(s.sessions, sessionID)
+	if s.now().Sub(session.lastUsed) > s.ttl {
+		return uuid.UUID{}, false
+	}
+	return session.token, true
+}
+
+// FlushCache drops the sessions in progress, the next keystrokes of their clients start new sessions
+func (s *autocompleteSessions) FlushCache() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions = map[string]*autocompleteSession{}
+}
+
+// sweep drops the expired sessions, at most once per ttl
+func (s *autocompleteSessions) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < s.ttl {
+		return
+	}
+	s.lastSweep = now
+	for id, session := range s.sessions {
+		if now.Sub(session.lastUsed) > s.ttl {
+			delete(s.sessions, id)
+		}
+	}
+}
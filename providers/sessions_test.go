@@ -0,0 +1,136 @@
+package providers
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestSessions(now *time.Time) *autocompleteSessions {
+	sessions := newAutocompleteSessions()
+	sessions.now = func() time.Time { return *now }
+	return sessions
+}
+
+func TestUnitAutocompleteSessionsToken(t *testing.T) {
+	now := time.Now()
+	sessions := newTestSessions(&now)
+
+	_, ok := sessions.token("")
+	assert.False(t, ok)
+
+	token, ok := sessions.token("session-1")
+	require.True(t, ok)
+	other, _ := sessions.token("session-2")
+	assert.NotEqual(t, token, other)
+
+	// the keystrokes keep the session alive
+	now = now.Add(sessions.ttl - time.Second)
+	again, _ := sessions.token("session-1")
+	assert.Equal(t, token, again)
+	now = now.Add(sessions.ttl - time.Second)
+	again, _ = sessions.token("session-1")
+	assert.Equal(t, token, again)
+
+	// and it expires after the inactivity ttl
+	now = now.Add(sessions.ttl + time.Second)
+	renewed, _ := sessions.token("session-1")
+	assert.NotEqual(t, token, renewed)
+	assert.Len(t, sessions.sessions, 1, "the expired sessions are swept")
+}
+
+func TestUnitAutocompleteSessionsFlushCache(t *testing.T) {
+	now := time.Now()
+	sessions := newTestSessions(&now)
+	token, _ := sessions.token("session-1")
+
+	sessions.FlushCache()
+	renewed, ok := sessions.token("session-1")
+	assert.True(t, ok)
+	assert.NotEqual(t, token, renewed)
+}
+
+func TestUnitAutocompleteSessionsEnd(t *testing.T) {
+	now := time.Now()
+	sessions := newTestSessions(&now)
+	token, _ := sessions.token("session-1")
+	sessions.predicted("session-1", token, []string{"place-1", "place-2"})
+
+	// a details call outside of the predictions doesn't conclude it
+	_, ok := sessions.end("session-1", "place-3")
+	assert.False(t, ok)
+	_, ok = sessions.end("session-2", "place-1")
+	assert.False(t, ok)
+
+	ended, ok := sessions.end("session-1", "place-2")
+	require.True(t, ok)
+	assert.Equal(t, token, ended)
+
+	// the next keystroke starts a new session
+	next, _ := sessions.token("session-1")
+	assert.NotEqual(t, token, next)
+	_, ok = sessions.end("session-1", "place-2")
+	assert.False(t, ok)
+}
+
+func TestUnitAutocompleteSessionsEndExpired(t *testing.T) {
+	now := time.Now()
+	sessions := newTestSessions(&now)
+	token, _ := sessions.token("session-1")
+	sessions.predicted("session-1", token, []string{"place-1"})
+
+	now = now.Add(sessions.ttl + time.Second)
+	_, ok := sessions.end("session-1", "place-1")
+	assert.False(t, ok)
+}
+
+func TestUnitAutocompleteSessionsPredictedRenewed(t *testing.T) {
+	now := time.Now()
+	sessions := newTestSessions(&now)
+	token, _ := sessions.token("session-1")
+	now = now.Add(sessions.ttl + time.Second)
+	sessions.token("session-1")
+
+	// late results of the expired session are ignored
+	sessions.predicted("session-1", token, []string{"place-1"})
+	_, ok := sessions.end("session-1", "place-1")
+	assert.False(t, ok)
+}
+
+func TestUnitAutocompleteSessionsMaxSize(t *testing.T) {
+	now := time.Now()
+	sessions := newTestSessions(&now)
+	sessions.maxSize = 2
+	sessions.token("session-1")
+	sessions.token("session-2")
+
+	_, ok := sessions.token("session-3")
+	assert.False(t, ok)
+	_, ok = sessions.token("session-1")
+	assert.True(t, ok, "the sessions in progress go on")
+}
+
+func TestUnitAutocompleteSessionsConcurrency(t *testing.T) {
+	sessions := newAutocompleteSessions()
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sessionID := "session-" + strconv.Itoa(i%5)
+			token, _ := sessions.token(sessionID)
+			sessions.predicted(sessionID, token, []string{"place-" + strconv.Itoa(i)})
+			sessions.end(sessionID, "place-"+strconv.Itoa(i))
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestUnitSessionIDContext(t *testing.T) {
+	assert.Equal(t, "", GetSessionID(context.Background()))
+	assert.Equal(t, "session-1", GetSessionID(WithSessionID(context.Background(), "session-1")))
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"context"
+	"github.com/codeselim/go-webservice-places-provider/config"
+	"github.com/codeselim/go-webservice-places-provider/log"
+	"net"
+	"net/http"
+	"time"
+)
+
+/**
+ * Http server wrapper: a hardened http.Server (timeouts, header size limit) with a graceful shutdown sequence.
+ * On shutdown:
+ *   1) the readiness is flipped to not-ready
+ *   2) the new requests are still served for a delay, until the load balancers notice the readiness change
+ *   3) in-flight requests are given a grace period to finish, new connections are refused. The shutdown hooks
+ *      close what the http server doesn't drain (e.g. the hijacked websocket connections)
+ *   4) once the grace period is over, the requests contexts are cancelled (aborting the outstanding provider calls)
+ *      and the remaining connections are closed
+ */
+
+type Config struct {
+	Addr                string
+	ReadHeaderTimeout   time.Duration
+	ReadTimeout         time.Duration
+	WriteTimeout        time.Duration
+	IdleTimeout         time.Duration
+	MaxHeaderBytes      int
+	ShutdownGracePeriod time.Duration
+	ShutdownDelay       time.Duration // between the readiness flip and the draining, 0: no delay
+	TLS                 *TLSConfig    // serves HTTPS when set
+}
+
+// ReadinessSwitch is notified when the shutdown sequence starts (e.g. handlers.HealthHandler)
+type ReadinessSwitch interface {
+	MarkShuttingDown()
+}
+
+type Server struct {
+	httpServer  *http.Server
+	gracePeriod time.Duration
+	delay       time.Duration
+	readiness   ReadinessSwitch
+	tlsConfig   *TLSConfig
+	baseCtx     context.Context
+	cancelBase  context.CancelFunc // cancels all the requests contexts
+	onShutdown  []func(ctx context.Context)
+}
+
+// Constructor, zero values in the config fall to the defaults. readiness can be nil
+func NewServer(handler http.Handler, serverConfig Config, readiness ReadinessSwitch) *Server {
+	baseCtx, cancelBase := context.WithCancel(context.Background())
+
+	httpServer := &http.Server{
+		Addr:              serverConfig.Addr,
+		Handler:           handler,
+		ReadHeaderTimeout: durationOrDefault(serverConfig.ReadHeaderTimeout, config.DefaultReadHeaderTimeout),
+		ReadTimeout:       durationOrDefault(serverConfig.ReadTimeout, config.DefaultReadTimeout),
+		WriteTimeout:      durationOrDefault(serverConfig.WriteTimeout, config.DefaultWriteTimeout),
+		IdleTimeout:       durationOrDefault(serverConfig.IdleTimeout, config.DefaultIdleTimeout),
+		MaxHeaderBytes:    config.DefaultMaxHeaderBytes,
+		BaseContext:       func(net.Listener) context.Context { return baseCtx },
+	}
+	if serverConfig.MaxHeaderBytes > 0 {
+		httpServer.MaxHeaderBytes = serverConfig.MaxHeaderBytes
+	}
+
+	return &Server{
+		httpServer:  httpServer,
+		gracePeriod: durationOrDefault(serverConfig.ShutdownGracePeriod, config.DefaultShutdownGracePeriod),
+		delay:       serverConfig.ShutdownDelay,
+		readiness:   readiness,
+		tlsConfig:   serverConfig.TLS,
+		baseCtx:     baseCtx,
+		cancelBase:  cancelBase,
+	}
+}
+
+// RegisterOnShutdown registers a function run when the draining starts, ctx is done at the end of the grace period.
+// The hooks run before the server waits for its in-flight requests
+func (s *Server) RegisterOnShutdown(hook func(ctx context.Context)) {
+	s.onShutdown = append(s.onShutdown, hook)
+}
+
+// ListenAndServe listens on the configured address and serves until ctx is done, then shuts down gracefully
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.httpServer.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, listener)
+}
+
+// Serve serves on the given listener until ctx is done (e.g. on SIGTERM), then runs the shutdown sequence.
+// It returns nil on a clean shutdown
+func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
+	if s.tlsConfig != nil {
+		if err := s.setupTLS(); err != nil {
+			listener.Close()
+			return err
+		}
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if s.tlsConfig != nil {
+			serveErr <- s.httpServer.ServeTLS(listener, "", "") // certificates are served by the tls.Config
+			return
+		}
+		serveErr <- s.httpServer.Serve(listener)
+	}()
+
+	select {
+	case err := <-serveErr:
+		s.cancelBase()
+		return err
+	case <-ctx.Done():
+	}
+
+	return s.shutdown()
+}
+
+// loads the certificates and starts watching them for changes until the server stops
+func (s *Server) setupTLS() error {
+	tlsConfig, err := NewReloadingTLSConfig(s.baseCtx, *s.tlsConfig)
+	if err != nil {
+		return err
+	}
+	s.httpServer.TLSConfig = tlsConfig
+	return nil
+}
+
+func (s *Server) shutdown() error {
+	logger := log.GetLogger()
+	if s.readiness != nil {
+		s.readiness.MarkShuttingDown()
+	}
+	if s.delay > 0 {
+		// the load balancers keep routing requests until their next readiness probe
+		logger.Info("Shutting down, still serving the new requests for ", s.delay)
+		time.Sleep(s.delay)
+	}
+
+	logger.Info("Shutting down, draining in-flight requests for at most ", s.gracePeriod)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.gracePeriod)
+	defer cancel()
+
+	for _, hook := range s.onShutdown {
+		hook(shutdownCtx)
+	}
+	err := s.httpServer.Shutdown(shutdownCtx)
+	// in all cases, cancel what could still be running
+	s.cancelBase()
+	if err == context.DeadlineExceeded {
+		logger.Warn("Grace period is over, cancelling the outstanding requests")
+		return s.httpServer.Close()
+	}
+	if err == nil {
+		logger.Info("Server drained and stopped")
+	}
+	return err
+}
+
+func durationOrDefault(value time.Duration, defaultValue time.Duration) time.Duration {
+	if value > 0 {
+		return value
+	}
+	return defaultValue
+}
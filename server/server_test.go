@@ -0,0 +1,175 @@
+package server
+
+import (
+	"context"
+	"github.com/codeselim/go-webservice-places-provider/config"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type mockReadinessSwitch struct {
+	shuttingDown int32
+}
+
+func (m *mockReadinessSwitch) MarkShuttingDown() {
+	atomic.StoreInt32(&m.shuttingDown, 1)
+}
+
+func (m *mockReadinessSwitch) isShuttingDown() bool {
+	return atomic.LoadInt32(&m.shuttingDown) == 1
+}
+
+// starts the server on a random local port, returns the base url and the channel receiving Serve's result
+func startServer(t *testing.T, ctx context.Context, server *Server) (string, chan error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- server.Serve(ctx, listener)
+	}()
+	return "http://" + listener.Addr().String(), done
+}
+
+func TestUnitNewServerDefaults(t *testing.T) {
+	server := NewServer(http.NotFoundHandler(), Config{Addr: ":0", WriteTimeout: time.Minute}, nil)
+
+	assert.Equal(t, config.DefaultReadHeaderTimeout, server.httpServer.ReadHeaderTimeout)
+	assert.Equal(t, config.DefaultReadTimeout, server.httpServer.ReadTimeout)
+	assert.Equal(t, time.Minute, server.httpServer.WriteTimeout)
+	assert.Equal(t, config.DefaultIdleTimeout, server.httpServer.IdleTimeout)
+	assert.Equal(t, config.DefaultMaxHeaderBytes, server.httpServer.MaxHeaderBytes)
+	assert.Equal(t, config.DefaultShutdownGracePeriod, server.gracePeriod)
+}
+
+func TestUnitServerDrainsInFlightRequests(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusOK)
+	})
+
+	readiness := &mockReadinessSwitch{}
+	ctx, stop := context.WithCancel(context.Background())
+	url, done := startServer(t, ctx, NewServer(handler, Config{ShutdownGracePeriod: 5 * time.Second}, readiness))
+
+	responseCode := make(chan int, 1)
+	go func() {
+		resp, err := http.Get(url)
+		if err != nil {
+			responseCode <- 0
+			return
+		}
+		resp.Body.Close()
+		responseCode <- resp.StatusCode
+	}()
+
+	<-started
+	stop() // imitates SIGTERM
+
+	// the readiness is flipped while the in-flight request is still running
+	deadline := time.Now().Add(time.Second)
+	for !readiness.isShuttingDown() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.True(t, readiness.isShuttingDown())
+	select {
+	case <-done:
+		t.Fatal("server stopped before the in-flight request finished")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	assert.Equal(t, http.StatusOK, <-responseCode)
+	assert.NoError(t, <-done)
+}
+
+func TestUnitServerCancelsRequestsAfterGracePeriod(t *testing.T) {
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		// imitates a long provider call, honoring the request context
+		<-r.Context().Done()
+		close(cancelled)
+	})
+
+	ctx, stop := context.WithCancel(context.Background())
+	url, done := startServer(t, ctx, NewServer(handler, Config{ShutdownGracePeriod: 100 * time.Millisecond}, nil))
+
+	go func() {
+		resp, err := http.Get(url)
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	<-started
+	stop()
+
+	select {
+	case <-cancelled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("outstanding request was not cancelled after the grace period")
+	}
+	assert.NoError(t, <-done)
+}
+
+func TestUnitServerServesNewRequestsDuringShutdownDelay(t *testing.T) {
+	readiness := &mockReadinessSwitch{}
+	ctx, stop := context.WithCancel(context.Background())
+	url, done := startServer(t, ctx, NewServer(http.NotFoundHandler(), Config{ShutdownDelay: 300 * time.Millisecond}, readiness))
+
+	stop()
+	deadline := time.Now().Add(time.Second)
+	for !readiness.isShuttingDown() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.True(t, readiness.isShuttingDown())
+
+	// not ready anymore, still serving until the load balancers notice it
+	resp, err := http.Get(url)
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	}
+	assert.NoError(t, <-done)
+}
+
+func TestUnitServerRefusesNewRequestsAfterShutdown(t *testing.T) {
+	ctx, stop := context.WithCancel(context.Background())
+	url, done := startServer(t, ctx, NewServer(http.NotFoundHandler(), Config{}, nil))
+
+	stop()
+	assert.NoError(t, <-done)
+
+	_, err := http.Get(url)
+	assert.Error(t, err)
+}
+
+func TestUnitServerRunsShutdownHooks(t *testing.T) {
+	ctx, stop := context.WithCancel(context.Background())
+	server := NewServer(http.NotFoundHandler(), Config{ShutdownGracePeriod: time.Second}, nil)
+	hooked := make(chan bool, 1)
+	server.RegisterOnShutdown(func(ctx context.Context) {
+		_, hasDeadline := ctx.Deadline()
+		hooked <- hasDeadline
+	})
+	_, done := startServer(t, ctx, server)
+
+	stop()
+	assert.NoError(t, <-done)
+	select {
+	case hasDeadline := <-hooked:
+		assert.True(t, hasDeadline, "the hooks are bounded by the grace period")
+	default:
+		t.Fatal("the shutdown hook didn't run")
+	}
+}
@@ -0,0 +1,223 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/codeselim/go-webservice-places-provider/config"
+	"github.com/codeselim/go-webservice-places-provider/log"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+ * TLS/mTLS serving. The certificate, key and client CA bundle files are watched (polling on their modification time)
+ * and hot reloaded, so a certificate rotation doesn't need a restart.
+ */
+
+type TLSConfig struct {
+	CertFile       string
+	KeyFile        string
+	ClientCAFile   string        // when set, client certificates are required and verified against this CA bundle (mTLS)
+	MinVersion     string        // "1.2" or "1.3"
+	CipherSuites   []string      // crypto/tls suites names, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256. Only apply to TLS 1.2
+	ReloadInterval time.Duration // how often the files are checked for changes
+}
+
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// certReloader holds the current certificate and client CA pool, and reloads them when the files change on disk
+type certReloader struct {
+	tlsConfig TLSConfig
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTime   time.Time // latest modification time among the watched files
+}
+
+func newCertReloader(tlsConfig TLSConfig) (*certReloader, error) {
+	if tlsConfig.CertFile == "" || tlsConfig.KeyFile == "" {
+		return nil, errors.New("both the TLS certificate and key files should be provided")
+	}
+	reloader := &certReloader{tlsConfig: tlsConfig}
+	if err := reloader.reload(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+func (c *certReloader) watchedFiles() []string {
+	files := []string{c.tlsConfig.CertFile, c.tlsConfig.KeyFile}
+	if c.tlsConfig.ClientCAFile != "" {
+		files = append(files, c.tlsConfig.ClientCAFile)
+	}
+	return files
+}
+
+func (c *certReloader) latestModTime() (time.Time, error) {
+	latest := time.Time{}
+	for _, file := range c.watchedFiles() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return latest, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// reload loads the files, the current certificate is kept on any error
+func (c *certReloader) reload() error {
+	modTime, err := c.latestModTime()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(c.tlsConfig.CertFile, c.tlsConfig.KeyFile)
+	if err != nil {
+		return err
+	}
+	var clientCAs *x509.CertPool
+	if c.tlsConfig.ClientCAFile != "" {
+		pem, err := ioutil.ReadFile(c.tlsConfig.ClientCAFile)
+		if err != nil {
+			return err
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no valid certificate found in the client CA file %s", c.tlsConfig.ClientCAFile)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cert = &cert
+	c.clientCAs = clientCAs
+	c.modTime = modTime
+	return nil
+}
+
+// reloadIfChanged reloads the files when any of them has a newer modification time
+func (c *certReloader) reloadIfChanged() error {
+	modTime, err := c.latestModTime()
+	if err != nil {
+		return err
+	}
+	c.mu.RLock()
+	changed := modTime.After(c.modTime)
+	c.mu.RUnlock()
+	if !changed {
+		return nil
+	}
+	if err := c.reload(); err != nil {
+		return err
+	}
+	log.GetLogger().Info("TLS certificate reloaded from " + c.tlsConfig.CertFile)
+	return nil
+}
+
+// watch checks the files every interval until ctx is done
+func (c *certReloader) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.reloadIfChanged(); err != nil {
+				log.GetLogger().Error("Couldn't reload the TLS certificate, keeping the current one: " + err.Error())
+			}
+		}
+	}
+}
+
+func (c *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
+
+func (c *certReloader) getClientCAs() *x509.CertPool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.clientCAs
+}
+
+// NewReloadingTLSConfig returns a tls.Config serving the certificate files, hot reloaded until ctx is done.
+// Used by the listeners not served by Server, e.g. the gRPC one
+func NewReloadingTLSConfig(ctx context.Context, tlsConfig TLSConfig) (*tls.Config, error) {
+	reloader, err := newCertReloader(tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+	serverTLSConfig, err := buildTLSConfig(tlsConfig, reloader)
+	if err != nil {
+		return nil, err
+	}
+	go reloader.watch(ctx, durationOrDefault(tlsConfig.ReloadInterval, config.DefaultTLSReloadInterval))
+	return serverTLSConfig, nil
+}
+
+// buildTLSConfig returns the server tls.Config, backed by the reloader for the certificate and client CAs
+func buildTLSConfig(tlsConfig TLSConfig, reloader *certReloader) (*tls.Config, error) {
+	minVersionLabel := tlsConfig.MinVersion
+	if minVersionLabel == "" {
+		minVersionLabel = config.DefaultTLSMinVersion
+	}
+	minVersion, ok := tlsVersions[minVersionLabel]
+	if !ok {
+		return nil, fmt.Errorf("unsupported TLS minimum version %q, use one of 1.2, 1.3", minVersionLabel)
+	}
+	cipherSuites, err := parseCipherSuites(tlsConfig.CipherSuites)
+	if err != nil {
+		return nil, err
+	}
+
+	baseConfig := &tls.Config{
+		MinVersion:     minVersion,
+		CipherSuites:   cipherSuites,
+		NextProtos:     []string{"h2", "http/1.1"}, // HTTP/2 enabled
+		GetCertificate: reloader.getCertificate,
+	}
+	if tlsConfig.ClientCAFile != "" {
+		baseConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		// the client CAs can be reloaded, so the config is resolved per connection
+		baseConfig.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			connConfig := baseConfig.Clone()
+			connConfig.GetConfigForClient = nil
+			connConfig.ClientCAs = reloader.getClientCAs()
+			return connConfig, nil
+		}
+	}
+	return baseConfig, nil
+}
+
+func parseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil // crypto/tls secure defaults
+	}
+	available := map[string]uint16{}
+	for _, suite := range tls.CipherSuites() {
+		available[suite.Name] = suite.ID
+	}
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := available[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("unsupported or insecure TLS cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
@@ -0,0 +1,276 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// self-signed material generated at test time
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+func generateCert(t *testing.T, serial int64, isCA bool, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "places-test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		IsCA:         isCA,
+
+		BasicConstraintsValid: true,
+	}
+	parentCert, parentKey := template, key
+	if parent != nil {
+		parentCert, parentKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parentCert, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func writeFile(t *testing.T, path string, content []byte) {
+	if err := ioutil.WriteFile(path, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (c *testCert) clientCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.cert.Raw}, PrivateKey: c.key}
+}
+
+// starts a TLS server with the given config, returns its url and the function to stop it
+func startTLSServer(t *testing.T, tlsConfig *TLSConfig) (string, func()) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- NewServer(handler, Config{TLS: tlsConfig, ShutdownGracePeriod: time.Second}, nil).Serve(ctx, listener)
+	}()
+	return "https://" + listener.Addr().String(), func() {
+		stop()
+		assert.NoError(t, <-done)
+	}
+}
+
+func newTLSClient(rootCA *testCert, clientCerts ...tls.Certificate) *http.Client {
+	roots := x509.NewCertPool()
+	roots.AddCert(rootCA.cert)
+	return &http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{RootCAs: roots, Certificates: clientCerts},
+			ForceAttemptHTTP2: true,
+		},
+	}
+}
+
+func TestUnitServeTLSWithHTTP2(t *testing.T) {
+	dir, err := ioutil.TempDir("", "places-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca := generateCert(t, 1, true, nil)
+	serverCert := generateCert(t, 2, false, ca)
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writeFile(t, certFile, serverCert.certPEM)
+	writeFile(t, keyFile, serverCert.keyPEM)
+
+	url, stop := startTLSServer(t, &TLSConfig{CertFile: certFile, KeyFile: keyFile})
+	defer stop()
+
+	resp, err := newTLSClient(ca).Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 2, resp.ProtoMajor)
+	assert.Equal(t, uint16(tls.VersionTLS13), resp.TLS.Version)
+}
+
+func TestUnitServeMutualTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "places-mtls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca := generateCert(t, 1, true, nil)
+	serverCert := generateCert(t, 2, false, ca)
+	clientCert := generateCert(t, 3, false, ca)
+	otherCA := generateCert(t, 4, true, nil)
+	untrustedClientCert := generateCert(t, 5, false, otherCA)
+
+	certFile, keyFile, caFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), filepath.Join(dir, "ca.crt")
+	writeFile(t, certFile, serverCert.certPEM)
+	writeFile(t, keyFile, serverCert.keyPEM)
+	writeFile(t, caFile, ca.certPEM)
+
+	url, stop := startTLSServer(t, &TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile})
+	defer stop()
+
+	// no client certificate
+	_, err = newTLSClient(ca).Get(url)
+	assert.Error(t, err)
+
+	// client certificate from an unknown CA
+	_, err = newTLSClient(ca, untrustedClientCert.clientCertificate()).Get(url)
+	assert.Error(t, err)
+
+	resp, err := newTLSClient(ca, clientCert.clientCertificate()).Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 2, resp.ProtoMajor)
+}
+
+func TestUnitCertReloaderHotReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "places-tls-reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca := generateCert(t, 1, true, nil)
+	firstCert := generateCert(t, 100, false, ca)
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writeFile(t, certFile, firstCert.certPEM)
+	writeFile(t, keyFile, firstCert.keyPEM)
+
+	url, stop := startTLSServer(t, &TLSConfig{CertFile: certFile, KeyFile: keyFile, ReloadInterval: 20 * time.Millisecond})
+	defer stop()
+
+	servedSerial := func() int64 {
+		// new client each time, no connection reuse
+		resp, err := newTLSClient(ca).Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.TLS.PeerCertificates[0].SerialNumber.Int64()
+	}
+	assert.Equal(t, int64(100), servedSerial())
+
+	// rotate the certificate on disk
+	secondCert := generateCert(t, 200, false, ca)
+	writeFile(t, certFile, secondCert.certPEM)
+	writeFile(t, keyFile, secondCert.keyPEM)
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, future, future)
+	os.Chtimes(keyFile, future, future)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for servedSerial() != 200 && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	assert.Equal(t, int64(200), servedSerial())
+}
+
+func TestUnitCertReloaderKeepsCertificateOnBrokenFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "places-tls-broken")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca := generateCert(t, 1, true, nil)
+	serverCert := generateCert(t, 2, false, ca)
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writeFile(t, certFile, serverCert.certPEM)
+	writeFile(t, keyFile, serverCert.keyPEM)
+
+	reloader, err := newCertReloader(TLSConfig{CertFile: certFile, KeyFile: keyFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeFile(t, certFile, []byte("not a certificate"))
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, future, future)
+
+	assert.Error(t, reloader.reloadIfChanged())
+	cert, _ := reloader.getCertificate(nil)
+	assert.Equal(t, serverCert.cert.Raw, cert.Certificate[0])
+}
+
+func TestUnitBuildTLSConfig(t *testing.T) {
+	reloader := &certReloader{}
+
+	tlsConfig, err := buildTLSConfig(TLSConfig{}, reloader)
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS12), tlsConfig.MinVersion)
+	assert.Nil(t, tlsConfig.CipherSuites)
+	assert.Equal(t, tls.NoClientCert, tlsConfig.ClientAuth)
+
+	tlsConfig, err = buildTLSConfig(TLSConfig{MinVersion: "1.3", CipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"}}, reloader)
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS13), tlsConfig.MinVersion)
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}, tlsConfig.CipherSuites)
+
+	_, err = buildTLSConfig(TLSConfig{MinVersion: "1.0"}, reloader)
+	assert.Error(t, err)
+
+	// insecure suites are refused
+	_, err = buildTLSConfig(TLSConfig{CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}}, reloader)
+	assert.Error(t, err)
+}
+
+func TestUnitNewCertReloaderMissingFiles(t *testing.T) {
+	_, err := newCertReloader(TLSConfig{CertFile: "tls.crt"})
+	assert.Error(t, err)
+
+	_, err = newCertReloader(TLSConfig{CertFile: "/does/not/exist.crt", KeyFile: "/does/not/exist.key"})
+	assert.Error(t, err)
+}